@@ -291,20 +291,17 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/v1/file/": {
-            "post": {
-                "description": "Initiate a new file upload. Receives regionId and bucketCode, returns a pre-signed upload URL and TTL (seconds). Admin access required.",
-                "consumes": [
-                    "application/json"
-                ],
+        "/api/v1/events": {
+            "get": {
+                "description": "Server-Sent Events stream of file, bucket and service token events as they happen on this instance. Each event carries its ID, type and the affected record as JSON; bucket credentials and token keys are left out. Admin access required.\nA client reconnecting with Last-Event-ID receives the events it missed while they are still in the replay buffer. If some have already left it, a stream.gap event is sent first.",
                 "produces": [
-                    "application/json"
+                    "text/event-stream"
                 ],
                 "tags": [
-                    "files"
+                    "events"
                 ],
-                "summary": "Initiate file upload",
-                "operationId": "InitiateFileUpload",
+                "summary": "Stream lifecycle events",
+                "operationId": "StreamEvents",
                 "parameters": [
                     {
                         "type": "string",
@@ -314,20 +311,35 @@ const docTemplate = `{
                         "required": true
                     },
                     {
-                        "description": "Upload initiation data",
-                        "name": "data",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/router.InitiateFileUploadDTO"
-                        }
+                        "type": "string",
+                        "description": "ID of the last event received, to resume from",
+                        "name": "Last-Event-ID",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only events of this bucket ID",
+                        "name": "bucket",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only events of buckets in this region",
+                        "name": "region",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated event types or categories, e.g. file.finalized,bucket",
+                        "name": "type",
+                        "in": "query"
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/router.InitiateFileUploadResponse"
+                            "$ref": "#/definitions/router.Event"
                         }
                     },
                     "400": {
@@ -351,17 +363,17 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/v1/file/{blob}/finalize": {
-            "post": {
-                "description": "Finalize a file upload after client notifies server. Admin access required.",
+        "/api/v1/file/": {
+            "get": {
+                "description": "Page through the files matching the given filters, with their reference counts. Pass the nextCursor of a page as cursor to get the next one; it is left out on the last page, which may be empty. Metadata is matched with meta.\u003ckey\u003e=\u003cvalue\u003e query parameters, e.g. meta.channel=42. Admin access required.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "files"
                 ],
-                "summary": "Finalize file upload",
-                "operationId": "FinalizeFileUpload",
+                "summary": "List files",
+                "operationId": "ListFiles",
                 "parameters": [
                     {
                         "type": "string",
@@ -372,17 +384,66 @@ const docTemplate = `{
                     },
                     {
                         "type": "string",
-                        "description": "Blob ID",
-                        "name": "blob",
-                        "in": "path",
-                        "required": true
+                        "description": "Bucket ID",
+                        "name": "bucket",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "pending",
+                            "uploading",
+                            "uploaded",
+                            "scanning",
+                            "active",
+                            "deleting",
+                            "deleted",
+                            "failed"
+                        ],
+                        "type": "string",
+                        "description": "File status",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Content type",
+                        "name": "content_type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only files created after this RFC 3339 time",
+                        "name": "created_after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "Tag the files must carry",
+                        "name": "tag",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor of the page to get",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Files per page, 100 by default and at most 1000",
+                        "name": "limit",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.File"
+                            "$ref": "#/definitions/router.FileListResponse"
                         }
                     },
                     "400": {
@@ -402,19 +463,11 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/router.ErrorResponse"
                         }
-                    },
-                    "404": {
-                        "description": "Not Found",
-                        "schema": {
-                            "$ref": "#/definitions/router.ErrorResponse"
-                        }
                     }
                 }
-            }
-        },
-        "/api/v1/file/{id}": {
-            "get": {
-                "description": "Retrieve detailed information about a file by its ID, including metadata, size, content type, and reference count. Admin access required.",
+            },
+            "post": {
+                "description": "Initiate a new file upload. Receives regionId and bucketCode, returns the blob ID, TTL (seconds) and a signed upload URL. Admin access required.\nThe signed upload URL grants access to the upload endpoints of the blob without a service token until it expires, so it can be handed to untrusted clients. It is bound to the size limit and content type rules of the file.\nThe upload policy (size limit, allowed and denied content types, retention) configured for the region and bucket applies unless overridden by policy.\nWith uploadMode \"presigned-put\" or \"presigned-post\" the response also carries a presigned S3 request, so the client uploads straight to the bucket; contentType, if given, is enforced by S3. Finalize the upload afterwards with the returned blob ID.",
                 "consumes": [
                     "application/json"
                 ],
@@ -424,8 +477,8 @@ const docTemplate = `{
                 "tags": [
                     "files"
                 ],
-                "summary": "Get file by ID",
-                "operationId": "GetFileById",
+                "summary": "Initiate file upload",
+                "operationId": "InitiateFileUpload",
                 "parameters": [
                     {
                         "type": "string",
@@ -435,18 +488,20 @@ const docTemplate = `{
                         "required": true
                     },
                     {
-                        "type": "string",
-                        "description": "File ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "Upload initiation data",
+                        "name": "data",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/router.InitiateFileUploadDTO"
+                        }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
+                    "201": {
+                        "description": "Created",
                         "schema": {
-                            "$ref": "#/definitions/models.File"
+                            "$ref": "#/definitions/router.InitiateFileUploadResponse"
                         }
                     },
                     "400": {
@@ -467,21 +522,29 @@ const docTemplate = `{
                             "$ref": "#/definitions/router.ErrorResponse"
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "500": {
+                        "description": "Internal Server Error",
                         "schema": {
                             "$ref": "#/definitions/router.ErrorResponse"
                         }
                     }
                 }
-            },
-            "delete": {
-                "description": "Delete a file by ID. Removes the file from S3 storage and then deletes the database record. Admin access required.",
+            }
+        },
+        "/api/v1/file/batch": {
+            "post": {
+                "description": "Run up to 1000 get, increment, decrement and delete operations in one request. They run concurrently, so operations on the same file are not ordered, except that deletions, including those of files whose reference count a decrement brings to zero, happen after everything else. Objects are removed with one S3 DeleteObjects request per bucket where possible. Each operation gets its own result with the status the single-file endpoint would have answered with. Admin access required.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
                 "tags": [
                     "files"
                 ],
-                "summary": "Delete file",
-                "operationId": "DeleteFile",
+                "summary": "Run file operations in bulk",
+                "operationId": "RunFileOperations",
                 "parameters": [
                     {
                         "type": "string",
@@ -491,16 +554,21 @@ const docTemplate = `{
                         "required": true
                     },
                     {
-                        "type": "string",
-                        "description": "File ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "Operations",
+                        "name": "data",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/router.FileBulkDTO"
+                        }
                     }
                 ],
                 "responses": {
-                    "204": {
-                        "description": "No Content"
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/router.FileBulkResponse"
+                        }
                     },
                     "400": {
                         "description": "Bad Request",
@@ -519,25 +587,13 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/router.ErrorResponse"
                         }
-                    },
-                    "404": {
-                        "description": "Not Found",
-                        "schema": {
-                            "$ref": "#/definitions/router.ErrorResponse"
-                        }
-                    },
-                    "500": {
-                        "description": "Internal Server Error",
-                        "schema": {
-                            "$ref": "#/definitions/router.ErrorResponse"
-                        }
                     }
                 }
             }
         },
-        "/api/v1/file/{id}/decrement": {
-            "patch": {
-                "description": "Atomically decrements the reference count for a file. Used for tracking how many clients are using a file. When reference count reaches zero or below, the file is automatically deleted from both S3 storage and database. Requires authentication.",
+        "/api/v1/file/initiate-batch": {
+            "post": {
+                "description": "Initiate up to 100 file uploads in one request. Each item is handled like a single initiation and gets its own result, holding either the file GUID, blob ID and TTL or the error that prevented it. Admin access required.",
                 "consumes": [
                     "application/json"
                 ],
@@ -547,8 +603,8 @@ const docTemplate = `{
                 "tags": [
                     "files"
                 ],
-                "summary": "Decrement file reference count",
-                "operationId": "DecrementFileRef",
+                "summary": "Initiate file uploads in batch",
+                "operationId": "InitiateFileUploadBatch",
                 "parameters": [
                     {
                         "type": "string",
@@ -558,16 +614,21 @@ const docTemplate = `{
                         "required": true
                     },
                     {
-                        "type": "string",
-                        "description": "File ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "Upload initiation data",
+                        "name": "data",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/router.InitiateFileUploadBatchDTO"
+                        }
                     }
                 ],
                 "responses": {
-                    "204": {
-                        "description": "Reference count decremented successfully (and file deleted if count reached zero)"
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/router.InitiateFileUploadBatchResponse"
+                        }
                     },
                     "400": {
                         "description": "Bad Request",
@@ -581,14 +642,14 @@ const docTemplate = `{
                             "$ref": "#/definitions/router.ErrorResponse"
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "403": {
+                        "description": "Forbidden - Admin only",
                         "schema": {
                             "$ref": "#/definitions/router.ErrorResponse"
                         }
                     },
                     "500": {
-                        "description": "Internal error during file deletion",
+                        "description": "Internal Server Error",
                         "schema": {
                             "$ref": "#/definitions/router.ErrorResponse"
                         }
@@ -596,20 +657,17 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/v1/file/{id}/increment": {
-            "patch": {
-                "description": "Atomically increments the reference count for a file. Used for tracking how many clients are using a file. Requires authentication.",
-                "consumes": [
-                    "application/json"
-                ],
+        "/api/v1/file/{blob}/finalize": {
+            "post": {
+                "description": "Finalize a file upload after client notifies server. The stored object is looked up in the bucket and its size, ETag and content type are recorded on the file; an object violating the upload policy is deleted. Finalizing an upload again returns the file unchanged. Admin access required.\nWhen content scanning is enabled, the file can only be finalized once the scanner has passed it. Until then 409 is returned, and a scan is started if none is running; content the scanner rejects is moved to quarantine and 422 is returned.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "files"
                 ],
-                "summary": "Increment file reference count",
-                "operationId": "IncrementFileRef",
+                "summary": "Finalize file upload",
+                "operationId": "FinalizeFileUpload",
                 "parameters": [
                     {
                         "type": "string",
@@ -620,15 +678,18 @@ const docTemplate = `{
                     },
                     {
                         "type": "string",
-                        "description": "File ID",
-                        "name": "id",
+                        "description": "Blob ID",
+                        "name": "blob",
                         "in": "path",
                         "required": true
                     }
                 ],
                 "responses": {
-                    "204": {
-                        "description": "Reference count incremented successfully"
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.File"
+                        }
                     },
                     "400": {
                         "description": "Bad Request",
@@ -642,26 +703,59 @@ const docTemplate = `{
                             "$ref": "#/definitions/router.ErrorResponse"
                         }
                     },
+                    "403": {
+                        "description": "Forbidden - Admin only",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
                     "404": {
                         "description": "Not Found",
                         "schema": {
                             "$ref": "#/definitions/router.ErrorResponse"
                         }
+                    },
+                    "409": {
+                        "description": "Object has not been uploaded yet, its content is being scanned, or another version replaced the file meanwhile",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "410": {
+                        "description": "Upload session expired",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "415": {
+                        "description": "Content type rejected by the upload policy",
+                        "schema": {
+                            "$ref": "#/definitions/router.UploadRejectionResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Object does not match the declared checksum, or was rejected by the scanner",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
                     }
                 }
             }
         },
-        "/api/v1/st/": {
+        "/api/v1/file/{id}": {
             "get": {
-                "description": "List all service tokens (admin only).",
+                "description": "Retrieve detailed information about a file by its ID, including metadata, size, content type, and reference count. With version, the content fields describe that earlier version instead. Admin access required.",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "service-tokens"
+                    "files"
                 ],
-                "summary": "List all service tokens",
-                "operationId": "ListAllServiceTokens",
+                "summary": "Get file by ID",
+                "operationId": "GetFileById",
                 "parameters": [
                     {
                         "type": "string",
@@ -669,16 +763,32 @@ const docTemplate = `{
                         "name": "x-api-token",
                         "in": "header",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "File ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Version to describe, the current one by default",
+                        "name": "version",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/models.ServiceToken"
-                            }
+                            "$ref": "#/definitions/models.File"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
                         }
                     },
                     "401": {
@@ -692,22 +802,22 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/router.ErrorResponse"
                         }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
                     }
                 }
             },
-            "post": {
-                "description": "Create a new service token. Only one admin token can exist. Only admin can create/delete other tokens. Admin token cannot be deleted.",
-                "consumes": [
-                    "application/json"
-                ],
-                "produces": [
-                    "application/json"
-                ],
+            "delete": {
+                "description": "Delete a file by ID. The file moves to deleting, its object is removed from S3 storage, and the database record is deleted once the file is deleted. Earlier versions of the file are deleted with it. An object shared by deduplicated files is kept until the last of them is deleted. Admin access required.",
                 "tags": [
-                    "service-tokens"
+                    "files"
                 ],
-                "summary": "Create service token",
-                "operationId": "CreateServiceToken",
+                "summary": "Delete file",
+                "operationId": "DeleteFile",
                 "parameters": [
                     {
                         "type": "string",
@@ -717,21 +827,16 @@ const docTemplate = `{
                         "required": true
                     },
                     {
-                        "description": "Service Token Request",
-                        "name": "request",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/router.CreateServiceTokenRequestDto"
-                        }
+                        "type": "string",
+                        "description": "File ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
-                        "schema": {
-                            "$ref": "#/definitions/models.ServiceToken"
-                        }
+                    "204": {
+                        "description": "No Content"
                     },
                     "400": {
                         "description": "Bad Request",
@@ -750,26 +855,64 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/router.ErrorResponse"
                         }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
                     }
                 }
-            }
-        },
-        "/api/v1/st/bootstrap": {
-            "post": {
-                "description": "Create the initial admin service token. Only allowed if no admin token exists. Used for first-time setup.",
+            },
+            "patch": {
+                "description": "Change the metadata and tags clients attach to a file. Metadata keys are merged into the existing ones, and a null value removes a key. Tags can be replaced as a whole, or added and removed one by one. What the server records about the upload is left untouched. Admin access required.",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "service-tokens"
+                    "files"
+                ],
+                "summary": "Update file metadata and tags",
+                "operationId": "UpdateFile",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Token",
+                        "name": "x-api-token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "File ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Changes",
+                        "name": "changes",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/router.FileUpdateDTO"
+                        }
+                    }
                 ],
-                "summary": "Bootstrap admin token",
-                "operationId": "BootstrapAdminToken",
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.ServiceToken"
+                            "$ref": "#/definitions/models.File"
                         }
                     },
                     "400": {
@@ -778,38 +921,26 @@ const docTemplate = `{
                             "$ref": "#/definitions/router.ErrorResponse"
                         }
                     },
-                    "409": {
-                        "description": "Admin token already exists",
+                    "401": {
+                        "description": "Unauthorized",
                         "schema": {
                             "$ref": "#/definitions/router.ErrorResponse"
                         }
-                    }
-                }
-            }
-        },
-        "/api/v1/st/first-run": {
-            "get": {
-                "description": "Returns whether the admin token exists. Used to determine if setup is required.",
-                "produces": [
-                    "application/json"
-                ],
-                "tags": [
-                    "service-tokens"
-                ],
-                "summary": "Check if admin token has already been created",
-                "operationId": "FirstRunCheck",
-                "responses": {
-                    "200": {
-                        "description": "first_run: true if no admin token exists, false otherwise",
+                    },
+                    "403": {
+                        "description": "Forbidden - Admin only",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "boolean"
-                            }
+                            "$ref": "#/definitions/router.ErrorResponse"
                         }
                     },
-                    "500": {
-                        "description": "Internal server error",
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "File is being deleted",
                         "schema": {
                             "$ref": "#/definitions/router.ErrorResponse"
                         }
@@ -817,17 +948,17 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/v1/st/{id}": {
+        "/api/v1/file/{id}/content": {
             "get": {
-                "description": "Get a service token by ID",
+                "description": "Stream the content of an uploaded file from its bucket. Supports Range requests for partial downloads and media seeking, and If-None-Match, If-Modified-Since and If-Range for conditional requests. Content of encrypted files is decrypted on the fly.",
                 "produces": [
-                    "application/json"
+                    "application/octet-stream"
                 ],
                 "tags": [
-                    "service-tokens"
+                    "files"
                 ],
-                "summary": "Get service token",
-                "operationId": "GetServiceToken",
+                "summary": "Download file content",
+                "operationId": "DownloadFile",
                 "parameters": [
                     {
                         "type": "string",
@@ -838,46 +969,96 @@ const docTemplate = `{
                     },
                     {
                         "type": "string",
-                        "description": "Token ID",
+                        "description": "File ID",
                         "name": "id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Version to download, the current one by default",
+                        "name": "version",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Byte range, e.g. bytes=0-1048575",
+                        "name": "Range",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of a cached copy",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Date of a cached copy",
+                        "name": "If-Modified-Since",
+                        "in": "header"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "File content",
                         "schema": {
-                            "$ref": "#/definitions/models.ServiceToken"
+                            "type": "file"
+                        }
+                    },
+                    "206": {
+                        "description": "Partial file content",
+                        "schema": {
+                            "type": "file"
                         }
                     },
+                    "304": {
+                        "description": "Not modified"
+                    },
                     "401": {
                         "description": "Unauthorized",
                         "schema": {
                             "$ref": "#/definitions/router.ErrorResponse"
                         }
                     },
-                    "403": {
-                        "description": "Forbidden - Admin only",
+                    "404": {
+                        "description": "Not Found",
                         "schema": {
                             "$ref": "#/definitions/router.ErrorResponse"
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "409": {
+                        "description": "File has not been uploaded yet, or has not passed content scanning",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "410": {
+                        "description": "File content has been erased",
                         "schema": {
                             "$ref": "#/definitions/router.ErrorResponse"
                         }
+                    },
+                    "416": {
+                        "description": "Requested range not satisfiable"
                     }
                 }
-            },
-            "delete": {
-                "description": "Delete a service token by ID. Only admin can delete other tokens. Admin token cannot be deleted.",
+            }
+        },
+        "/api/v1/file/{id}/copy": {
+            "post": {
+                "description": "Copy an active file into a bucket of the given region, picked at random unless bucketCode is given. The copy is a new file whose GUID carries the region and bucket it is stored in; it keeps the metadata, tags and upload policy of the original, and its retention starts over. Buckets on the same endpoint copy the object within the storage; otherwise the content is streamed through KineticaFS, and encrypted or decrypted as the destination bucket requires. Admin access required.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
                 "tags": [
-                    "service-tokens"
+                    "files"
                 ],
-                "summary": "Delete service token",
-                "operationId": "DeleteServiceToken",
+                "summary": "Copy file",
+                "operationId": "CopyFile",
                 "parameters": [
                     {
                         "type": "string",
@@ -888,15 +1069,33 @@ const docTemplate = `{
                     },
                     {
                         "type": "string",
-                        "description": "Token ID",
+                        "description": "File ID",
                         "name": "id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "description": "Destination",
+                        "name": "destination",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/router.FileTransferDTO"
+                        }
                     }
                 ],
                 "responses": {
-                    "204": {
-                        "description": "No Content"
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.File"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
                     },
                     "401": {
                         "description": "Unauthorized",
@@ -915,26 +1114,42 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/router.ErrorResponse"
                         }
+                    },
+                    "409": {
+                        "description": "File is not active",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "410": {
+                        "description": "File content has been erased",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
                     }
                 }
             }
         },
-        "/api/v1/upload/{blob}": {
+        "/api/v1/file/{id}/decrement": {
             "patch": {
-                "description": "Upload file data using the blob ID provided by the server. Supports stream, form-data, and multipart uploads. No admin access required.",
+                "description": "Atomically decrements the reference count for a file. Used for tracking how many clients are using a file. Only anonymous references taken with increment, and the one of the uploader until a holder takes it over, can be released this way. When reference count reaches zero, the file is automatically deleted from both S3 storage and database. Requires authentication.",
                 "consumes": [
-                    "application/octet-stream",
-                    "multipart/form-data",
-                    "application/x-www-form-urlencoded"
+                    "application/json"
                 ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "upload"
+                    "files"
                 ],
-                "summary": "Upload file data",
-                "operationId": "UploadFileBlob",
+                "summary": "Decrement file reference count",
+                "operationId": "DecrementFileRef",
                 "parameters": [
                     {
                         "type": "string",
@@ -945,32 +1160,15 @@ const docTemplate = `{
                     },
                     {
                         "type": "string",
-                        "description": "Blob ID",
-                        "name": "blob",
+                        "description": "File ID",
+                        "name": "id",
                         "in": "path",
                         "required": true
-                    },
-                    {
-                        "type": "file",
-                        "description": "File data (multipart or form-data, required if not using raw stream)",
-                        "name": "file",
-                        "in": "formData"
-                    },
-                    {
-                        "description": "File data (raw stream, required if not using multipart/form-data)",
-                        "name": "file",
-                        "in": "body",
-                        "schema": {
-                            "type": "array",
-                            "items": {
-                                "type": "integer"
-                            }
-                        }
                     }
                 ],
                 "responses": {
                     "204": {
-                        "description": "No Content"
+                        "description": "Reference count decremented successfully (and file deleted if count reached zero)"
                     },
                     "400": {
                         "description": "Bad Request",
@@ -989,246 +1187,2997 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/router.ErrorResponse"
                         }
-                    }
-                }
-            }
-        }
-    },
-    "definitions": {
-        "models.Bucket": {
-            "type": "object",
+                    },
+                    "409": {
+                        "description": "No anonymous references left",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal error during file deletion",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/file/{id}/increment": {
+            "patch": {
+                "description": "Atomically increments the reference count for a file. Used for tracking how many clients are using a file. Requires authentication.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "files"
+                ],
+                "summary": "Increment file reference count",
+                "operationId": "IncrementFileRef",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Token",
+                        "name": "x-api-token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "File ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Reference count incremented successfully"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/file/{id}/key": {
+            "delete": {
+                "description": "Crypto-shred the content of an encrypted file by deleting its wrapped data key. The stored object can no longer be decrypted and downloads return 410. Earlier versions of the file lose their keys as well. Encrypted content is not deduplicated, so other files keep theirs; only files linked to the same object by an older release share its key. The file record itself is kept. Admin access required.",
+                "tags": [
+                    "files"
+                ],
+                "summary": "Erase file data key",
+                "operationId": "EraseFileKey",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Token",
+                        "name": "x-api-token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "File ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Data key erased"
+                    },
+                    "400": {
+                        "description": "File is not encrypted",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden - Admin only",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/file/{id}/move": {
+            "post": {
+                "description": "Move the content of an active file into a bucket of the given region, picked at random unless bucketCode is given. The file keeps its ID; its bucket and path change in one update once the content is in place, and the object it was read from is deleted unless another file or version still refers to it. Earlier versions stay where they are. Buckets on the same endpoint copy the object within the storage; otherwise the content is streamed through KineticaFS, and encrypted or decrypted as the destination bucket requires. Admin access required.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "files"
+                ],
+                "summary": "Move file",
+                "operationId": "MoveFile",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Token",
+                        "name": "x-api-token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "File ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Destination",
+                        "name": "destination",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/router.FileTransferDTO"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.File"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden - Admin only",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "File is not active, or already stored in the bucket",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "410": {
+                        "description": "File content has been erased",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/file/{id}/refs": {
+            "get": {
+                "description": "List the holders referring to the file, oldest first, with its reference count. Admin access required.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "files"
+                ],
+                "summary": "List reference holders",
+                "operationId": "ListFileReferences",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Token",
+                        "name": "x-api-token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "File ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/router.FileReferencesResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden - Admin only",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/file/{id}/refs/{holder}": {
+            "put": {
+                "description": "Record that holder, such as a message ID, refers to the file, counting it once in the reference count. Adding a holder that already refers to the file changes nothing, so the request can be retried safely. Admin access required.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "files"
+                ],
+                "summary": "Add a reference holder",
+                "operationId": "AddFileReference",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Token",
+                        "name": "x-api-token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "File ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Reference holder",
+                        "name": "holder",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Holder added"
+                    },
+                    "204": {
+                        "description": "Holder already refers to the file"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden - Admin only",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "File is being deleted",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Drop holder from the holders of the file and its count from the reference count. When the reference count reaches zero, the file is deleted from both S3 storage and database. Admin access required.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "files"
+                ],
+                "summary": "Remove a reference holder",
+                "operationId": "RemoveFileReference",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Token",
+                        "name": "x-api-token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "File ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Reference holder",
+                        "name": "holder",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Holder removed (and file deleted if the count reached zero)"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden - Admin only",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "File not found, or holder does not refer to it",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/file/{id}/versions": {
+            "get": {
+                "description": "List the earlier versions of a file still kept, newest first. The current version is the file itself. Read a version with the version query parameter of GET /api/v1/file/{id} and GET /api/v1/file/{id}/content. Admin access required.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "files"
+                ],
+                "summary": "List file versions",
+                "operationId": "ListFileVersions",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Token",
+                        "name": "x-api-token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "File ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.FileVersion"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden - Admin only",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/st/": {
+            "get": {
+                "description": "List all service tokens (admin only).",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "service-tokens"
+                ],
+                "summary": "List all service tokens",
+                "operationId": "ListAllServiceTokens",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Token",
+                        "name": "x-api-token",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.ServiceToken"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden - Admin only",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Create a new service token. Only one admin token can exist. Only admin can create/delete other tokens. Admin token cannot be deleted.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "service-tokens"
+                ],
+                "summary": "Create service token",
+                "operationId": "CreateServiceToken",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Token",
+                        "name": "x-api-token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Service Token Request",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/router.CreateServiceTokenRequestDto"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.ServiceToken"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden - Admin only",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/st/bootstrap": {
+            "post": {
+                "description": "Create the initial admin service token. Only allowed if no admin token exists. Used for first-time setup.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "service-tokens"
+                ],
+                "summary": "Bootstrap admin token",
+                "operationId": "BootstrapAdminToken",
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.ServiceToken"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Admin token already exists",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/st/first-run": {
+            "get": {
+                "description": "Returns whether the admin token exists. Used to determine if setup is required.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "service-tokens"
+                ],
+                "summary": "Check if admin token has already been created",
+                "operationId": "FirstRunCheck",
+                "responses": {
+                    "200": {
+                        "description": "first_run: true if no admin token exists, false otherwise",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "boolean"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/st/{id}": {
+            "get": {
+                "description": "Get a service token by ID",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "service-tokens"
+                ],
+                "summary": "Get service token",
+                "operationId": "GetServiceToken",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Token",
+                        "name": "x-api-token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Token ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.ServiceToken"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden - Admin only",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Delete a service token by ID. Only admin can delete other tokens. Admin token cannot be deleted.",
+                "tags": [
+                    "service-tokens"
+                ],
+                "summary": "Delete service token",
+                "operationId": "DeleteServiceToken",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Token",
+                        "name": "x-api-token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Token ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden - Admin only",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/tus/": {
+            "post": {
+                "description": "Create a tus upload for a blob returned by InitiateFileUpload. The blob ID is passed as the \"blob\" key of Upload-Metadata and the total size in Upload-Length. The Location header holds the upload URL, which keeps the query of a signed upload URL.",
+                "tags": [
+                    "tus"
+                ],
+                "summary": "Create tus upload",
+                "operationId": "TusCreateUpload",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Token, unless a signed upload URL is used",
+                        "name": "x-api-token",
+                        "in": "header"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Expiry of a signed upload URL (Unix seconds)",
+                        "name": "expires",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Signature of a signed upload URL",
+                        "name": "signature",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Protocol version (1.0.0)",
+                        "name": "Tus-Resumable",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Total size of the upload in bytes",
+                        "name": "Upload-Length",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated key/base64 value pairs; must contain blob",
+                        "name": "Upload-Metadata",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Location header points to the upload"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Upload already started or completed",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "410": {
+                        "description": "Upload session expired",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "Unsupported tus version",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Upload-Length exceeds the file size limit",
+                        "schema": {
+                            "$ref": "#/definitions/router.UploadRejectionResponse"
+                        }
+                    }
+                }
+            },
+            "options": {
+                "description": "Report the tus protocol version and extensions supported by the server.",
+                "tags": [
+                    "tus"
+                ],
+                "summary": "Tus capabilities",
+                "operationId": "TusOptions",
+                "responses": {
+                    "204": {
+                        "description": "Tus-Version and Tus-Extension headers"
+                    }
+                }
+            }
+        },
+        "/api/v1/tus/{blob}": {
+            "delete": {
+                "description": "Abort a tus upload that has not completed yet: discards the bytes stored so far, the upload session and the pending file.",
+                "tags": [
+                    "tus"
+                ],
+                "summary": "Terminate tus upload",
+                "operationId": "TusTerminate",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Token",
+                        "name": "x-api-token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Protocol version (1.0.0)",
+                        "name": "Tus-Resumable",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Blob ID",
+                        "name": "blob",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Upload terminated"
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Upload already completed",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "410": {
+                        "description": "Upload session expired",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "head": {
+                "description": "Report the offset and length of a tus upload.",
+                "tags": [
+                    "tus"
+                ],
+                "summary": "Get tus upload offset",
+                "operationId": "TusHead",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Token, unless a signed upload URL is used",
+                        "name": "x-api-token",
+                        "in": "header"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Expiry of a signed upload URL (Unix seconds)",
+                        "name": "expires",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Signature of a signed upload URL",
+                        "name": "signature",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Protocol version (1.0.0)",
+                        "name": "Tus-Resumable",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Blob ID",
+                        "name": "blob",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Upload-Offset, Upload-Length and Upload-Expires headers"
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "410": {
+                        "description": "Upload expired",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Append a chunk to a tus upload at the given Upload-Offset. The file is marked uploaded once Upload-Length bytes have been received.",
+                "consumes": [
+                    "application/offset+octet-stream"
+                ],
+                "tags": [
+                    "tus"
+                ],
+                "summary": "Upload tus chunk",
+                "operationId": "TusPatch",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Token, unless a signed upload URL is used",
+                        "name": "x-api-token",
+                        "in": "header"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Expiry of a signed upload URL (Unix seconds)",
+                        "name": "expires",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Signature of a signed upload URL",
+                        "name": "signature",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Protocol version (1.0.0)",
+                        "name": "Tus-Resumable",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Offset of this chunk",
+                        "name": "Upload-Offset",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Blob ID",
+                        "name": "blob",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Chunk data",
+                        "name": "chunk",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "type": "integer"
+                            }
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Upload-Offset header holds the new offset"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Offset mismatch, or another chunk was stored at that offset first",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "410": {
+                        "description": "Upload expired",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "415": {
+                        "description": "Content-Type must be application/offset+octet-stream, or the content type is rejected by the upload policy",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/upload/{blob}": {
+            "get": {
+                "description": "Report the state of an upload session (pending, receiving, uploaded, finalized or expired), how many bytes have been received, the declared total size, if known, and when the session expires.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "upload"
+                ],
+                "summary": "Get upload status",
+                "operationId": "GetUploadProgress",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Token, unless a signed upload URL is used",
+                        "name": "x-api-token",
+                        "in": "header"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Expiry of a signed upload URL (Unix seconds)",
+                        "name": "expires",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Signature of a signed upload URL",
+                        "name": "signature",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Blob ID",
+                        "name": "blob",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/router.UploadProgressResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Abort an upload session that has not completed: any multipart upload, partial or directly uploaded object is removed from S3, and the blob and the pending file are deleted. A signed upload URL does not grant cancelling; a service token is required.",
+                "tags": [
+                    "upload"
+                ],
+                "summary": "Cancel upload",
+                "operationId": "CancelUpload",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Token",
+                        "name": "x-api-token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Blob ID",
+                        "name": "blob",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Upload cancelled"
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Signed upload URLs cannot cancel uploads",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Upload already completed",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "head": {
+                "description": "Report how many bytes of a resumable upload have been received in the Upload-Offset header, and the declared total in Upload-Length if known. Clients resume by sending the next chunk from that offset.",
+                "tags": [
+                    "upload"
+                ],
+                "summary": "Get upload offset",
+                "operationId": "GetUploadOffset",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Token, unless a signed upload URL is used",
+                        "name": "x-api-token",
+                        "in": "header"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Expiry of a signed upload URL (Unix seconds)",
+                        "name": "expires",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Signature of a signed upload URL",
+                        "name": "signature",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Blob ID",
+                        "name": "blob",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Upload-Offset and Upload-Length headers"
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "410": {
+                        "description": "Upload session expired",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Upload file data using the blob ID provided by the server. Supports stream, form-data, and multipart uploads. No admin access required.\nSending an Upload-Offset (with Upload-Length) or Content-Range header makes the request one chunk of a resumable upload: chunks must start at the offset reported by HEAD /api/v1/upload/{blob}, and the upload completes once the declared length has been received.\nA checksum declared with Content-Digest, X-Checksum-SHA256, Content-MD5 or at initiation is compared with the received data; on a mismatch the object is discarded and 422 is returned. On chunked uploads the SHA-256 headers describe the whole file and are checked once the last chunk arrives.",
+                "consumes": [
+                    "application/octet-stream",
+                    "multipart/form-data",
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "upload"
+                ],
+                "summary": "Upload file data",
+                "operationId": "UploadFileBlob",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Token, unless a signed upload URL is used",
+                        "name": "x-api-token",
+                        "in": "header"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Expiry of a signed upload URL (Unix seconds)",
+                        "name": "expires",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Signature of a signed upload URL",
+                        "name": "signature",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Blob ID",
+                        "name": "blob",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "file",
+                        "description": "File data (multipart or form-data, required if not using raw stream)",
+                        "name": "file",
+                        "in": "formData"
+                    },
+                    {
+                        "description": "File data (raw stream, required if not using multipart/form-data)",
+                        "name": "file",
+                        "in": "body",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "type": "integer"
+                            }
+                        }
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Offset of this chunk within a resumable upload",
+                        "name": "Upload-Offset",
+                        "in": "header"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Total size of a resumable upload",
+                        "name": "Upload-Length",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Chunk position, e.g. bytes 0-1048575/4194304 or bytes 0-1048575/*",
+                        "name": "Content-Range",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Expected digest of the file, e.g. sha-256=:\u003cbase64\u003e:",
+                        "name": "Content-Digest",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Expected SHA-256 of the file, hex or base64",
+                        "name": "X-Checksum-SHA256",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Expected MD5 of the body, base64 (one-shot uploads only)",
+                        "name": "Content-MD5",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Chunk offset does not match the bytes received, another chunk was stored at that offset first, or the upload has been finalized",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "410": {
+                        "description": "Upload session expired",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "415": {
+                        "description": "Content type rejected by the upload policy",
+                        "schema": {
+                            "$ref": "#/definitions/router.UploadRejectionResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Uploaded data does not match the declared checksum",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/upload/{blob}/preflight": {
+            "post": {
+                "description": "Ask whether content with the given SHA-256 checksum is already stored. If the bucket deduplicates content, is not encrypted, and an identical file exists in its region, the file is linked to the stored object and marked uploaded, so the client can skip the upload and go straight to finalization.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "upload"
+                ],
+                "summary": "Upload preflight",
+                "operationId": "UploadPreflight",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Token, unless a signed upload URL is used",
+                        "name": "x-api-token",
+                        "in": "header"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Expiry of a signed upload URL (Unix seconds)",
+                        "name": "expires",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Signature of a signed upload URL",
+                        "name": "signature",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Blob ID",
+                        "name": "blob",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Checksum of the file to upload",
+                        "name": "data",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/router.UploadPreflightDTO"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/router.UploadPreflightResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Upload already started or completed",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "410": {
+                        "description": "Upload session expired",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/webhook/": {
+            "get": {
+                "description": "List all webhooks. Their secrets are not included.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "List webhooks",
+                "operationId": "ListWebhooks",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Token",
+                        "name": "x-api-token",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Webhook"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden - Admin only",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Register an endpoint to be notified of file lifecycle events: file.uploaded, file.finalized, file.deleted, file.migrated and refcount.zero. Only admin users can create webhooks.\nEvents are POSTed as JSON with the X-KineticaFS-Event, X-KineticaFS-Delivery and X-KineticaFS-Signature headers. The signature is \"t=\u003cunix time\u003e,v1=\u003chex HMAC-SHA256 of \"\u003ct\u003e.\u003cbody\u003e\"\u003e\" keyed by the webhook secret, which is only returned by this call. Failed deliveries are retried with exponential backoff; an event may be delivered more than once.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Create webhook",
+                "operationId": "CreateWebhook",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Token",
+                        "name": "x-api-token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Webhook",
+                        "name": "webhook",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/router.WebhookInsertDTO"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.Webhook"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden - Admin only",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/webhook/{id}": {
+            "get": {
+                "description": "Get a webhook by ID. Its secret is not included.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Get webhook",
+                "operationId": "GetWebhook",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Token",
+                        "name": "x-api-token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Webhook"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden - Admin only",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Delete a webhook along with its delivery log. Queued deliveries are dropped.",
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Delete webhook",
+                "operationId": "DeleteWebhook",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Token",
+                        "name": "x-api-token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden - Admin only",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Change the endpoint or events of a webhook, enable or disable it, or rotate its secret. The new secret is returned only when it is rotated. Deliveries queued for a disabled webhook fail without being attempted.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Update webhook",
+                "operationId": "UpdateWebhook",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Token",
+                        "name": "x-api-token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Changes",
+                        "name": "webhook",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/router.WebhookUpdateDTO"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Webhook"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden - Admin only",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/webhook/{id}/deliveries": {
+            "get": {
+                "description": "List the events queued for a webhook, newest first, with the number of attempts made and the outcome of the latest one.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "List webhook deliveries",
+                "operationId": "ListWebhookDeliveries",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Token",
+                        "name": "x-api-token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "enum": [
+                            "pending",
+                            "succeeded",
+                            "failed"
+                        ],
+                        "type": "string",
+                        "description": "Only list deliveries in this status",
+                        "name": "status",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.WebhookDelivery"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden - Admin only",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/webhook/{id}/deliveries/{delivery}/redeliver": {
+            "post": {
+                "description": "Queue a delivery for another round of attempts, e.g. once a failing endpoint has been fixed. The event is sent with its original payload and delivery ID.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Redeliver webhook event",
+                "operationId": "RedeliverWebhookEvent",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Token",
+                        "name": "x-api-token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Delivery ID",
+                        "name": "delivery",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/models.WebhookDelivery"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden - Admin only",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/router.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "models.Bucket": {
+            "type": "object",
+            "required": [
+                "access_key",
+                "endpoint",
+                "name",
+                "region",
+                "secret_key"
+            ],
+            "properties": {
+                "access_key": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "custom_config": {
+                    "type": "string"
+                },
+                "deduplicate": {
+                    "description": "store identical uploads in the region only once, unless encrypted",
+                    "type": "boolean"
+                },
+                "encrypt": {
+                    "description": "encrypt uploaded objects with per-file data keys",
+                    "type": "boolean"
+                },
+                "endpoint": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "region": {
+                    "type": "string"
+                },
+                "s3_provider": {
+                    "type": "string"
+                },
+                "secret_key": {
+                    "type": "string"
+                },
+                "storage_type": {
+                    "$ref": "#/definitions/models.StorageType"
+                },
+                "updated_at": {
+                    "type": "string"
+                },
+                "use_ssl": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "models.DeliveryStatus": {
+            "type": "string",
+            "enum": [
+                "pending",
+                "succeeded",
+                "failed"
+            ],
+            "x-enum-comments": {
+                "DeliveryStatusFailed": "every attempt failed; it is not retried unless asked to",
+                "DeliveryStatusPending": "waiting for its next attempt",
+                "DeliveryStatusSucceeded": "the endpoint accepted the event"
+            },
+            "x-enum-descriptions": [
+                "waiting for its next attempt",
+                "the endpoint accepted the event",
+                "every attempt failed; it is not retried unless asked to"
+            ],
+            "x-enum-varnames": [
+                "DeliveryStatusPending",
+                "DeliveryStatusSucceeded",
+                "DeliveryStatusFailed"
+            ]
+        },
+        "models.File": {
+            "type": "object",
+            "required": [
+                "bucket_id",
+                "name"
+            ],
+            "properties": {
+                "bucket_id": {
+                    "type": "string"
+                },
+                "checksum": {
+                    "type": "string"
+                },
+                "content_type": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "encrypted": {
+                    "description": "Encrypted files are stored encrypted with a data key, kept in DataKey\nwrapped by the master key. Without DataKey the content is unreadable.",
+                    "type": "boolean"
+                },
+                "etag": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "description": "end of the retention period, if any",
+                    "type": "string"
+                },
+                "file_size": {
+                    "type": "integer"
+                },
+                "file_size_limit": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "metadata": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "object_key": {
+                    "description": "set when the file shares the object of an identical file",
+                    "type": "string"
+                },
+                "path": {
+                    "type": "string"
+                },
+                "references": {
+                    "type": "integer"
+                },
+                "scan_detail": {
+                    "description": "what the scanner found, or why it failed",
+                    "type": "string"
+                },
+                "scan_status": {
+                    "$ref": "#/definitions/models.ScanStatus"
+                },
+                "status": {
+                    "enum": [
+                        "pending",
+                        "uploading",
+                        "uploaded",
+                        "scanning",
+                        "active",
+                        "deleting",
+                        "deleted",
+                        "failed"
+                    ],
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.FileStatus"
+                        }
+                    ]
+                },
+                "tags": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "updated_at": {
+                    "type": "string"
+                },
+                "upload_policy": {
+                    "description": "UploadPolicy holds the content type rules and retention of the file;\nits size limit is kept in FileSizeLimit.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.UploadPolicy"
+                        }
+                    ]
+                },
+                "user_metadata": {
+                    "description": "UserMetadata and Tags are set by clients, at initiation or later on.\nWhat the server records about an upload is kept in Metadata.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "version": {
+                    "description": "Version counts the contents the file has held, starting at 1. Earlier\nones are kept as FileVersion records until they are pruned.",
+                    "type": "integer"
+                },
+                "version_of": {
+                    "description": "VersionOf is set on a file created to upload a new version of another\nfile. Once finalized, its content becomes the current version of that\nfile and the record itself is removed.",
+                    "type": "string"
+                }
+            }
+        },
+        "models.FileReference": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "file_id": {
+                    "type": "string"
+                },
+                "holder": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.FileStatus": {
+            "type": "string",
+            "enum": [
+                "pending",
+                "uploading",
+                "uploaded",
+                "scanning",
+                "active",
+                "deleting",
+                "deleted",
+                "failed"
+            ],
+            "x-enum-comments": {
+                "FileStatusActive": "finalized and in use",
+                "FileStatusDeleted": "content has been removed",
+                "FileStatusDeleting": "content is being removed",
+                "FileStatusFailed": "content was rejected and cannot be used",
+                "FileStatusPending": "created, no content received yet",
+                "FileStatusScanning": "content is being scanned",
+                "FileStatusUploaded": "content is stored and awaits finalization",
+                "FileStatusUploading": "a resumable upload is receiving content"
+            },
+            "x-enum-descriptions": [
+                "created, no content received yet",
+                "a resumable upload is receiving content",
+                "content is stored and awaits finalization",
+                "content is being scanned",
+                "finalized and in use",
+                "content is being removed",
+                "content has been removed",
+                "content was rejected and cannot be used"
+            ],
+            "x-enum-varnames": [
+                "FileStatusPending",
+                "FileStatusUploading",
+                "FileStatusUploaded",
+                "FileStatusScanning",
+                "FileStatusActive",
+                "FileStatusDeleting",
+                "FileStatusDeleted",
+                "FileStatusFailed"
+            ]
+        },
+        "models.FileVersion": {
+            "type": "object",
+            "properties": {
+                "bucket_id": {
+                    "type": "string"
+                },
+                "checksum": {
+                    "type": "string"
+                },
+                "content_type": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "encrypted": {
+                    "type": "boolean"
+                },
+                "etag": {
+                    "type": "string"
+                },
+                "file_id": {
+                    "type": "string"
+                },
+                "file_size": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "modified_at": {
+                    "description": "when the content was stored",
+                    "type": "string"
+                },
+                "object_key": {
+                    "description": "key of the object holding the content",
+                    "type": "string"
+                },
+                "path": {
+                    "type": "string"
+                },
+                "scan_status": {
+                    "$ref": "#/definitions/models.ScanStatus"
+                },
+                "updated_at": {
+                    "type": "string"
+                },
+                "version": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.ScanStatus": {
+            "type": "string",
+            "enum": [
+                "",
+                "scanning",
+                "clean",
+                "quarantined",
+                "failed"
+            ],
+            "x-enum-comments": {
+                "ScanStatusClean": "the scanner found nothing",
+                "ScanStatusFailed": "the scan could not complete and will be retried",
+                "ScanStatusNone": "not scanned, scanning was not enabled",
+                "ScanStatusQuarantined": "the scanner rejected the content, which was moved aside",
+                "ScanStatusScanning": "a scan is in progress"
+            },
+            "x-enum-descriptions": [
+                "not scanned, scanning was not enabled",
+                "a scan is in progress",
+                "the scanner found nothing",
+                "the scanner rejected the content, which was moved aside",
+                "the scan could not complete and will be retried"
+            ],
+            "x-enum-varnames": [
+                "ScanStatusNone",
+                "ScanStatusScanning",
+                "ScanStatusClean",
+                "ScanStatusQuarantined",
+                "ScanStatusFailed"
+            ]
+        },
+        "models.ServiceToken": {
+            "type": "object",
+            "required": [
+                "access_key",
+                "name"
+            ],
+            "properties": {
+                "access_key": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "token_type": {
+                    "$ref": "#/definitions/models.TokenType"
+                },
+                "updated_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.StorageType": {
+            "type": "integer",
+            "format": "int32",
+            "enum": [
+                0,
+                1
+            ],
+            "x-enum-varnames": [
+                "HotStorage",
+                "ColdStorage"
+            ]
+        },
+        "models.TokenType": {
+            "type": "integer",
+            "format": "int32",
+            "enum": [
+                1,
+                2
+            ],
+            "x-enum-varnames": [
+                "AdminToken",
+                "UserToken"
+            ]
+        },
+        "models.UploadPolicy": {
+            "type": "object",
+            "properties": {
+                "allowedTypes": {
+                    "description": "MIME types or wildcards like image/*; empty allows any",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "deniedTypes": {
+                    "description": "checked before AllowedTypes",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "maxSize": {
+                    "description": "bytes, 0 for no limit",
+                    "type": "integer"
+                },
+                "retentionDays": {
+                    "description": "days a file is kept, 0 to keep it indefinitely",
+                    "type": "integer"
+                }
+            }
+        },
+        "models.Webhook": {
+            "type": "object",
+            "required": [
+                "url"
+            ],
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "enabled": {
+                    "type": "boolean"
+                },
+                "events": {
+                    "description": "the events sent to the endpoint; all of them if empty",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.WebhookEvent"
+                    }
+                },
+                "id": {
+                    "type": "string"
+                },
+                "secret": {
+                    "type": "string"
+                },
+                "updated_at": {
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.WebhookDelivery": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "event": {
+                    "$ref": "#/definitions/models.WebhookEvent"
+                },
+                "event_id": {
+                    "description": "shared by the deliveries of one event to several webhooks",
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "last_error": {
+                    "type": "string"
+                },
+                "next_attempt_at": {
+                    "type": "string"
+                },
+                "payload": {
+                    "description": "the JSON body sent to the endpoint",
+                    "type": "string"
+                },
+                "response_status": {
+                    "description": "HTTP status of the latest attempt",
+                    "type": "integer"
+                },
+                "status": {
+                    "enum": [
+                        "pending",
+                        "succeeded",
+                        "failed"
+                    ],
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.DeliveryStatus"
+                        }
+                    ]
+                },
+                "updated_at": {
+                    "type": "string"
+                },
+                "webhook_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.WebhookEvent": {
+            "type": "string",
+            "enum": [
+                "file.uploaded",
+                "file.finalized",
+                "file.deleted",
+                "file.migrated",
+                "refcount.zero"
+            ],
+            "x-enum-comments": {
+                "EventFileDeleted": "a file has been deleted, or removed past its retention",
+                "EventFileFinalized": "a file has been finalized and is active",
+                "EventFileMigrated": "a file has been moved to another bucket",
+                "EventFileUploaded": "the content of a file has been stored",
+                "EventRefcountZero": "the last reference to a file has been released"
+            },
+            "x-enum-descriptions": [
+                "the content of a file has been stored",
+                "a file has been finalized and is active",
+                "a file has been deleted, or removed past its retention",
+                "a file has been moved to another bucket",
+                "the last reference to a file has been released"
+            ],
+            "x-enum-varnames": [
+                "EventFileUploaded",
+                "EventFileFinalized",
+                "EventFileDeleted",
+                "EventFileMigrated",
+                "EventRefcountZero"
+            ]
+        },
+        "router.BucketInsertDTO": {
+            "type": "object",
+            "required": [
+                "access_key",
+                "endpoint",
+                "name",
+                "region",
+                "secret_key"
+            ],
+            "properties": {
+                "access_key": {
+                    "type": "string"
+                },
+                "custom_config": {
+                    "type": "string"
+                },
+                "deduplicate": {
+                    "type": "boolean"
+                },
+                "encrypt": {
+                    "type": "boolean"
+                },
+                "endpoint": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "region": {
+                    "type": "string"
+                },
+                "s3_provider": {
+                    "type": "string"
+                },
+                "secret_key": {
+                    "type": "string"
+                },
+                "storage_type": {
+                    "$ref": "#/definitions/models.StorageType"
+                },
+                "use_ssl": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "router.CreateServiceTokenRequestDto": {
+            "type": "object",
+            "required": [
+                "name"
+            ],
+            "properties": {
+                "name": {
+                    "type": "string",
+                    "example": "my-token"
+                }
+            }
+        },
+        "router.ErrorResponse": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "integer",
+                    "example": 400
+                },
+                "message": {
+                    "type": "string",
+                    "example": "error message"
+                }
+            }
+        },
+        "router.Event": {
+            "type": "object",
+            "properties": {
+                "bucketId": {
+                    "type": "string"
+                },
+                "createdAt": {
+                    "type": "string"
+                },
+                "data": {},
+                "id": {
+                    "type": "integer"
+                },
+                "region": {
+                    "description": "region of the bucket",
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "router.FileBulkDTO": {
+            "type": "object",
+            "required": [
+                "operations"
+            ],
+            "properties": {
+                "operations": {
+                    "type": "array",
+                    "maxItems": 1000,
+                    "minItems": 1,
+                    "items": {
+                        "$ref": "#/definitions/router.FileOperation"
+                    }
+                }
+            }
+        },
+        "router.FileBulkResponse": {
+            "type": "object",
+            "properties": {
+                "results": {
+                    "description": "in the order of the request",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/router.FileOperationResult"
+                    }
+                }
+            }
+        },
+        "router.FileListResponse": {
+            "type": "object",
+            "properties": {
+                "files": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.File"
+                    }
+                },
+                "nextCursor": {
+                    "description": "NextCursor resumes the listing after this page. It is left out on the\nlast page.",
+                    "type": "string"
+                }
+            }
+        },
+        "router.FileOperation": {
+            "type": "object",
             "required": [
-                "access_key",
-                "endpoint",
-                "name",
-                "region",
-                "secret_key"
+                "id",
+                "op"
             ],
             "properties": {
-                "access_key": {
-                    "type": "string"
-                },
-                "created_at": {
+                "id": {
+                    "description": "file GUID",
                     "type": "string"
                 },
-                "custom_config": {
-                    "type": "string"
+                "op": {
+                    "type": "string",
+                    "enum": [
+                        "get",
+                        "increment",
+                        "decrement",
+                        "delete"
+                    ]
+                }
+            }
+        },
+        "router.FileOperationResult": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "$ref": "#/definitions/router.ErrorResponse"
                 },
-                "endpoint": {
-                    "type": "string"
+                "file": {
+                    "description": "set for get",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.File"
+                        }
+                    ]
                 },
                 "id": {
                     "type": "string"
                 },
-                "name": {
+                "op": {
                     "type": "string"
                 },
-                "region": {
-                    "type": "string"
+                "status": {
+                    "type": "integer"
+                }
+            }
+        },
+        "router.FileReferencesResponse": {
+            "type": "object",
+            "properties": {
+                "holders": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.FileReference"
+                    }
                 },
-                "s3_provider": {
+                "references": {
+                    "description": "References is the reference count of the file. Besides one for every\nholder it counts the anonymous references taken with increment, and\nthe one of the uploader until the first holder takes it over.",
+                    "type": "integer"
+                }
+            }
+        },
+        "router.FileTransferDTO": {
+            "type": "object",
+            "required": [
+                "regionId"
+            ],
+            "properties": {
+                "bucketCode": {
+                    "description": "a bucket of the region is picked if empty",
                     "type": "string"
                 },
-                "secret_key": {
+                "regionId": {
                     "type": "string"
+                }
+            }
+        },
+        "router.FileUpdateDTO": {
+            "type": "object",
+            "properties": {
+                "addTags": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
                 },
-                "storage_type": {
-                    "$ref": "#/definitions/models.StorageType"
+                "metadata": {
+                    "description": "Metadata is merged into the user metadata; a null value removes the key.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
                 },
-                "updated_at": {
-                    "type": "string"
+                "removeTags": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
                 },
-                "use_ssl": {
-                    "type": "boolean"
+                "tags": {
+                    "description": "replaces all tags",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
                 }
             }
         },
-        "models.File": {
+        "router.InitiateFileUploadBatchDTO": {
             "type": "object",
             "required": [
-                "bucket_id",
-                "name"
+                "files"
             ],
             "properties": {
-                "bucket_id": {
+                "files": {
+                    "type": "array",
+                    "maxItems": 100,
+                    "minItems": 1,
+                    "items": {
+                        "$ref": "#/definitions/router.InitiateFileUploadDTO"
+                    }
+                }
+            }
+        },
+        "router.InitiateFileUploadBatchResponse": {
+            "type": "object",
+            "properties": {
+                "results": {
+                    "description": "in the order of the request",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/router.InitiateFileUploadResult"
+                    }
+                }
+            }
+        },
+        "router.InitiateFileUploadDTO": {
+            "type": "object",
+            "required": [
+                "regionId"
+            ],
+            "properties": {
+                "bucketCode": {
                     "type": "string"
                 },
                 "checksum": {
+                    "description": "expected \"sha256:\u003chex\u003e\" of the file",
                     "type": "string"
                 },
-                "content_type": {
+                "contentType": {
+                    "description": "required content type of a presigned upload",
                     "type": "string"
                 },
-                "created_at": {
+                "fileId": {
+                    "description": "FileID makes the upload a new version of an existing active file. Its\nbucket is used unless bucketCode is given.",
                     "type": "string"
                 },
-                "file_size": {
-                    "type": "integer"
-                },
-                "file_size_limit": {
+                "fileSizeLimit": {
                     "type": "integer"
                 },
-                "finalized": {
-                    "type": "boolean"
-                },
-                "id": {
-                    "type": "string"
-                },
                 "metadata": {
-                    "type": "string"
+                    "description": "Metadata and Tags are kept with the file for clients to filter on.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
                 },
-                "name": {
-                    "type": "string"
+                "policy": {
+                    "description": "Policy overrides fields of the upload policy configured for the region\nand bucket; fileSizeLimit, if set, overrides its maxSize.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.UploadPolicy"
+                        }
+                    ]
                 },
-                "path": {
+                "regionId": {
                     "type": "string"
                 },
-                "references": {
-                    "type": "integer"
+                "tags": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
                 },
-                "updated_at": {
-                    "type": "string"
+                "uploadMode": {
+                    "type": "string",
+                    "enum": [
+                        "proxy",
+                        "presigned-put",
+                        "presigned-post"
+                    ]
                 }
             }
         },
-        "models.ServiceToken": {
+        "router.InitiateFileUploadResponse": {
             "type": "object",
-            "required": [
-                "access_key",
-                "name"
-            ],
             "properties": {
-                "access_key": {
+                "fileId": {
+                    "description": "GUID of the file being uploaded, or of the file it replaces",
                     "type": "string"
                 },
-                "created_at": {
-                    "type": "string"
+                "ttl": {
+                    "description": "seconds",
+                    "type": "integer"
                 },
-                "id": {
-                    "type": "string"
+                "upload": {
+                    "description": "Upload is set for presigned upload modes and describes the request\nthat stores the file directly in the bucket.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/router.PresignedUpload"
+                        }
+                    ]
                 },
-                "name": {
+                "uploadUrl": {
+                    "description": "UploadURL is the path of the upload endpoint for the blob with a\nsignature that grants access without a service token until\nUploadURLExpiresAt. It can be handed to untrusted clients. Both are\nomitted unless upload-signing-key is set.",
                     "type": "string"
                 },
-                "token_type": {
-                    "$ref": "#/definitions/models.TokenType"
+                "uploadUrlExpiresAt": {
+                    "type": "string"
                 },
-                "updated_at": {
+                "url": {
+                    "description": "blob ID of the upload session",
                     "type": "string"
                 }
             }
         },
-        "models.StorageType": {
-            "type": "integer",
-            "format": "int32",
-            "enum": [
-                0,
-                1
-            ],
-            "x-enum-varnames": [
-                "HotStorage",
-                "ColdStorage"
-            ]
-        },
-        "models.TokenType": {
-            "type": "integer",
-            "format": "int32",
-            "enum": [
-                1,
-                2
-            ],
-            "x-enum-varnames": [
-                "AdminToken",
-                "UserToken"
-            ]
-        },
-        "router.BucketInsertDTO": {
+        "router.InitiateFileUploadResult": {
             "type": "object",
-            "required": [
-                "access_key",
-                "endpoint",
-                "name",
-                "region",
-                "secret_key"
-            ],
             "properties": {
-                "access_key": {
-                    "type": "string"
+                "error": {
+                    "$ref": "#/definitions/router.ErrorResponse"
                 },
-                "custom_config": {
+                "fileId": {
+                    "description": "GUID of the file being uploaded, or of the file it replaces",
                     "type": "string"
                 },
-                "endpoint": {
-                    "type": "string"
+                "ttl": {
+                    "description": "seconds",
+                    "type": "integer"
                 },
-                "name": {
-                    "type": "string"
+                "upload": {
+                    "description": "Upload is set for presigned upload modes and describes the request\nthat stores the file directly in the bucket.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/router.PresignedUpload"
+                        }
+                    ]
                 },
-                "region": {
+                "uploadUrl": {
+                    "description": "UploadURL is the path of the upload endpoint for the blob with a\nsignature that grants access without a service token until\nUploadURLExpiresAt. It can be handed to untrusted clients. Both are\nomitted unless upload-signing-key is set.",
                     "type": "string"
                 },
-                "s3_provider": {
+                "uploadUrlExpiresAt": {
                     "type": "string"
                 },
-                "secret_key": {
+                "url": {
+                    "description": "blob ID of the upload session",
                     "type": "string"
+                }
+            }
+        },
+        "router.PresignedUpload": {
+            "type": "object",
+            "properties": {
+                "fields": {
+                    "description": "POST: form fields to send ahead of the file",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
                 },
-                "storage_type": {
-                    "$ref": "#/definitions/models.StorageType"
+                "headers": {
+                    "description": "PUT: headers the request must carry",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
                 },
-                "use_ssl": {
-                    "type": "boolean"
+                "method": {
+                    "description": "PUT or POST",
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
                 }
             }
         },
-        "router.CreateServiceTokenRequestDto": {
+        "router.UploadPreflightDTO": {
             "type": "object",
             "required": [
-                "name"
+                "checksum"
             ],
             "properties": {
-                "name": {
+                "checksum": {
+                    "description": "\"sha256:\u003chex\u003e\" of the file to upload",
+                    "type": "string"
+                }
+            }
+        },
+        "router.UploadPreflightResponse": {
+            "type": "object",
+            "properties": {
+                "exists": {
+                    "description": "Exists is true if the content is already stored. The file then shares\nthe stored object, is marked uploaded and the upload can be skipped.",
+                    "type": "boolean"
+                }
+            }
+        },
+        "router.UploadProgressResponse": {
+            "type": "object",
+            "properties": {
+                "blobId": {
+                    "type": "string"
+                },
+                "expiresAt": {
+                    "description": "when the session lapses unless written to again",
+                    "type": "string"
+                },
+                "fileId": {
+                    "type": "string"
+                },
+                "length": {
+                    "description": "declared total size, omitted while unknown",
+                    "type": "integer"
+                },
+                "offset": {
+                    "description": "bytes received so far",
+                    "type": "integer"
+                },
+                "state": {
                     "type": "string",
-                    "example": "my-token"
+                    "enum": [
+                        "pending",
+                        "receiving",
+                        "uploaded",
+                        "finalized",
+                        "expired"
+                    ]
                 }
             }
         },
-        "router.ErrorResponse": {
+        "router.UploadRejectionResponse": {
             "type": "object",
             "properties": {
                 "code": {
                     "type": "integer",
-                    "example": 400
+                    "example": 415
+                },
+                "contentType": {
+                    "description": "detected content type, for content type rejections",
+                    "type": "string"
+                },
+                "limit": {
+                    "description": "size limit in bytes, for size_limit_exceeded",
+                    "type": "integer"
                 },
                 "message": {
                     "type": "string",
-                    "example": "error message"
+                    "example": "Content type application/x-msdownload is denied"
+                },
+                "reason": {
+                    "description": "size_limit_exceeded, content_type_denied or content_type_not_allowed",
+                    "type": "string",
+                    "example": "content_type_denied"
                 }
             }
         },
-        "router.InitiateFileUploadDTO": {
+        "router.WebhookInsertDTO": {
             "type": "object",
             "required": [
-                "regionId"
+                "url"
             ],
             "properties": {
-                "bucketCode": {
-                    "type": "string"
-                },
-                "fileSizeLimit": {
-                    "type": "integer"
+                "events": {
+                    "description": "all events if empty",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.WebhookEvent"
+                    }
                 },
-                "regionId": {
-                    "type": "string"
+                "url": {
+                    "type": "string",
+                    "example": "https://chat.example.com/hooks/kineticafs"
                 }
             }
         },
-        "router.InitiateFileUploadResponse": {
+        "router.WebhookUpdateDTO": {
             "type": "object",
             "properties": {
-                "ttl": {
-                    "description": "seconds",
-                    "type": "integer"
+                "enabled": {
+                    "type": "boolean"
+                },
+                "events": {
+                    "description": "an empty list subscribes to all events",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.WebhookEvent"
+                    }
+                },
+                "rotateSecret": {
+                    "description": "replace the signing secret, returning the new one",
+                    "type": "boolean"
                 },
                 "url": {
                     "type": "string"
@@ -11,11 +11,13 @@ import (
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 
 	_ "github.com/argon-chat/KineticaFS/docs"
 	"github.com/argon-chat/KineticaFS/pkg/models"
 	"github.com/argon-chat/KineticaFS/pkg/repositories"
 	"github.com/argon-chat/KineticaFS/pkg/router"
+	"github.com/argon-chat/KineticaFS/pkg/scanner"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
@@ -74,8 +76,27 @@ func main() {
 	serverEnabled := viper.GetBool("server")
 	if serverEnabled {
 		port := viper.GetInt("port")
+		contentScanner, err := scanner.NewScanner()
+		if err != nil {
+			log.Fatalf("Failed to initialize content scanner: %v", err)
+		}
+		server := router.NewRouter(repo, contentScanner, port)
+		wg.Add(1)
+		go server.Run(ctx, wg)
+
+		wg.Add(1)
+		go func() {
+			if err := router.NewSweeper(server).Run(ctx, wg); err != nil {
+				log.Printf("Upload sweeper failed: %v", err)
+			}
+		}()
+
 		wg.Add(1)
-		go router.NewRouter(repo, port).Run(ctx, wg)
+		go func() {
+			if err := router.NewWebhookDispatcher(server).Run(ctx, wg); err != nil {
+				log.Printf("Webhook dispatcher failed: %v", err)
+			}
+		}()
 	}
 
 	quit := make(chan os.Signal, 1)
@@ -138,6 +159,29 @@ func init() {
 	viper.SetDefault("cors-allowed-origins", "*")
 	viper.SetDefault("cors-allowed-headers", "*")
 	viper.SetDefault("migration_path", "./migrations")
+	viper.SetDefault("multipart-threshold", 16<<20)
+	viper.SetDefault("multipart-part-size", 8<<20)
+	viper.SetDefault("upload-session-ttl", 10*time.Minute)
+	viper.SetDefault("upload-sweep-interval", time.Minute)
+	viper.SetDefault("upload-url-ttl", time.Hour)
+	viper.SetDefault("upload-signing-key", "")
+	viper.SetDefault("encryption-master-key", "")
+	viper.SetDefault("encryption-master-key-file", "")
+	viper.SetDefault("scanner", "")
+	viper.SetDefault("scanner-command", "")
+	viper.SetDefault("scanner-address", "")
+	viper.SetDefault("scanner-timeout", 5*time.Minute)
+	viper.SetDefault("scan-concurrency", 4)
+	viper.SetDefault("quarantine-prefix", "quarantine/")
+	viper.SetDefault("webhook-timeout", 10*time.Second)
+	viper.SetDefault("webhook-max-attempts", 12)
+	viper.SetDefault("webhook-retry-backoff", 30*time.Second)
+	viper.SetDefault("webhook-poll-interval", 5*time.Second)
+	viper.SetDefault("event-replay-size", 1000)
+	viper.SetDefault("bulk-concurrency", 16)
+	viper.SetDefault("version-retention-count", 10)
+	viper.SetDefault("version-retention-period", time.Duration(0))
+	viper.SetDefault("idempotency-key-ttl", 24*time.Hour)
 
 	pflag.BoolP("server", "s", false, "Run as server")
 	pflag.String("token", "", "Authorization token")
@@ -149,8 +193,31 @@ func init() {
 	pflag.StringP("front-end-path", "f", "/var/www", "Path to front-end folder containing index.html (default: /var/www)")
 	pflag.StringP("region", "r", "./regions.json", "Path to regions configuration file (default: ./regions.json)")
 	pflag.String("cors-allowed-origins", "http://localhost:3000,http://localhost:8080", "CORS allowed origins (comma-separated)")
-	pflag.String("cors-allowed-headers", "Origin,Content-Type,Accept,Authorization,X-API-Token", "CORS allowed headers (comma-separated)")
+	pflag.String("cors-allowed-headers", "Origin,Content-Type,Accept,Authorization,X-API-Token,Range,If-None-Match,If-Modified-Since,If-Range,Content-Range,Content-Digest,Content-MD5,X-Checksum-SHA256,Upload-Offset,Upload-Length,Upload-Metadata,Tus-Resumable,Last-Event-ID,Idempotency-Key", "CORS allowed headers (comma-separated)")
 	pflag.String("migration_path", "./migrations", "Path to migration files (default: ./migrations)")
+	pflag.Int64("multipart-threshold", 16<<20, "Upload size in bytes above which S3 multipart upload is used (default: 16 MiB)")
+	pflag.Int64("multipart-part-size", 8<<20, "Part size in bytes for S3 multipart uploads, at least 5 MiB (default: 8 MiB)")
+	pflag.Duration("upload-session-ttl", 10*time.Minute, "How long an upload session stays usable after its last write (default: 10m)")
+	pflag.Duration("upload-sweep-interval", time.Minute, "How often expired upload sessions are swept (default: 1m)")
+	pflag.Duration("upload-url-ttl", time.Hour, "How long a signed upload URL stays valid (default: 1h)")
+	pflag.String("upload-signing-key", "", "Secret used to sign upload URLs; signed upload URLs are disabled if empty")
+	pflag.String("encryption-master-key", "", "Base64-encoded 32-byte key wrapping the data keys of encrypted buckets")
+	pflag.String("encryption-master-key-file", "", "Path to a file holding the base64-encoded encryption master key")
+	pflag.String("scanner", "", "Content scanner run on uploads (noop, command, clamd); scanning is disabled if empty")
+	pflag.String("scanner-command", "", "Command run by the command scanner with the content on stdin, e.g. \"clamdscan --no-summary -\"")
+	pflag.String("scanner-address", "", "Address of the clamd scanner, host:port or a Unix socket path")
+	pflag.Duration("scanner-timeout", 5*time.Minute, "How long a content scan may take (default: 5m)")
+	pflag.Int("scan-concurrency", 4, "Content scans run at the same time (default: 4)")
+	pflag.String("quarantine-prefix", "quarantine/", "Key prefix infected objects are moved under (default: quarantine/)")
+	pflag.Duration("webhook-timeout", 10*time.Second, "How long a webhook endpoint may take to answer (default: 10s)")
+	pflag.Int("webhook-max-attempts", 12, "Attempts made to deliver a webhook event before giving up (default: 12)")
+	pflag.Duration("webhook-retry-backoff", 30*time.Second, "Delay before retrying a failed webhook delivery, doubled with each attempt (default: 30s)")
+	pflag.Duration("webhook-poll-interval", 5*time.Second, "How often queued webhook deliveries are dispatched (default: 5s)")
+	pflag.Int("event-replay-size", 1000, "Number of recent events kept for event stream clients that reconnect (default: 1000)")
+	pflag.Int("bulk-concurrency", 16, "Operations of a bulk file request run at the same time (default: 16)")
+	pflag.Int("version-retention-count", 10, "Earlier versions kept per file, 0 to keep all (default: 10)")
+	pflag.Duration("version-retention-period", 0, "How long earlier file versions are kept after being replaced, 0 to keep them (default: 0)")
+	pflag.Duration("idempotency-key-ttl", 24*time.Hour, "How long responses to requests with an Idempotency-Key are replayed (default: 24h)")
 	pflag.Parse()
 	viper.BindPFlags(pflag.CommandLine)
 
@@ -0,0 +1,8 @@
+-- Drop resumable upload state from file_blob table
+ALTER TABLE file_blob
+    DROP COLUMN IF EXISTS hash_state,
+    DROP COLUMN IF EXISTS parts,
+    DROP COLUMN IF EXISTS content_type,
+    DROP COLUMN IF EXISTS upload_length,
+    DROP COLUMN IF EXISTS upload_offset,
+    DROP COLUMN IF EXISTS upload_id;
@@ -0,0 +1,8 @@
+-- Add resumable upload state to file_blob table
+ALTER TABLE file_blob
+    ADD COLUMN IF NOT EXISTS upload_id TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS upload_offset BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS upload_length BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS content_type TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS parts TEXT NOT NULL DEFAULT '[]',
+    ADD COLUMN IF NOT EXISTS hash_state BYTEA;
@@ -0,0 +1,3 @@
+-- Drop object ETag from file table
+ALTER TABLE file
+    DROP COLUMN IF EXISTS etag;
@@ -0,0 +1,3 @@
+-- Add object ETag to file table
+ALTER TABLE file
+    ADD COLUMN IF NOT EXISTS etag TEXT NOT NULL DEFAULT '';
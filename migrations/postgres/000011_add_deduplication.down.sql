@@ -0,0 +1,7 @@
+-- Drop content deduplication from bucket and file tables
+DROP INDEX IF EXISTS file_object_key_idx;
+DROP INDEX IF EXISTS file_checksum_idx;
+ALTER TABLE file
+    DROP COLUMN IF EXISTS object_key;
+ALTER TABLE bucket
+    DROP COLUMN IF EXISTS deduplicate;
@@ -0,0 +1,7 @@
+-- Add content deduplication to bucket and file tables
+ALTER TABLE bucket
+    ADD COLUMN IF NOT EXISTS deduplicate BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE file
+    ADD COLUMN IF NOT EXISTS object_key TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS file_checksum_idx ON file (checksum);
+CREATE INDEX IF NOT EXISTS file_object_key_idx ON file (object_key);
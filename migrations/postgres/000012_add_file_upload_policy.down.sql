@@ -0,0 +1,5 @@
+-- Drop upload policy and retention from file table
+DROP INDEX IF EXISTS file_expires_at_idx;
+ALTER TABLE file
+    DROP COLUMN IF EXISTS expires_at,
+    DROP COLUMN IF EXISTS upload_policy;
@@ -0,0 +1,5 @@
+-- Add upload policy and retention to file table
+ALTER TABLE file
+    ADD COLUMN IF NOT EXISTS upload_policy TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP;
+CREATE INDEX IF NOT EXISTS file_expires_at_idx ON file (expires_at);
@@ -0,0 +1,2 @@
+-- Drop index for expiring upload sessions
+DROP INDEX IF EXISTS file_blob_updated_at_idx;
@@ -0,0 +1,2 @@
+-- Add index for expiring upload sessions
+CREATE INDEX IF NOT EXISTS file_blob_updated_at_idx ON file_blob (updated_at);
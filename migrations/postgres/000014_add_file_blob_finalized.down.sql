@@ -0,0 +1,3 @@
+-- Drop finalization flag from file_blob table
+ALTER TABLE file_blob
+    DROP COLUMN IF EXISTS finalized;
@@ -0,0 +1,3 @@
+-- Add finalization flag to file_blob table
+ALTER TABLE file_blob
+    ADD COLUMN IF NOT EXISTS finalized BOOLEAN NOT NULL DEFAULT FALSE;
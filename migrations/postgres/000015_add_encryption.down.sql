@@ -0,0 +1,6 @@
+-- Drop envelope encryption from bucket and file tables
+ALTER TABLE file
+    DROP COLUMN IF EXISTS data_key,
+    DROP COLUMN IF EXISTS encrypted;
+ALTER TABLE bucket
+    DROP COLUMN IF EXISTS encrypt;
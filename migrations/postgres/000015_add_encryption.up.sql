@@ -0,0 +1,6 @@
+-- Add envelope encryption to bucket and file tables
+ALTER TABLE bucket
+    ADD COLUMN IF NOT EXISTS encrypt BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE file
+    ADD COLUMN IF NOT EXISTS encrypted BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN IF NOT EXISTS data_key BYTEA;
@@ -0,0 +1,4 @@
+-- Drop the content scan verdict from files
+ALTER TABLE file
+    DROP COLUMN IF EXISTS scan_detail,
+    DROP COLUMN IF EXISTS scan_status;
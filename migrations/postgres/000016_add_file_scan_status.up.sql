@@ -0,0 +1,4 @@
+-- Record the content scan verdict on files
+ALTER TABLE file
+    ADD COLUMN IF NOT EXISTS scan_status TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS scan_detail TEXT NOT NULL DEFAULT '';
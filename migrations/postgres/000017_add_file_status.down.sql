@@ -0,0 +1,6 @@
+-- Restore the finalized flag of files from their lifecycle status
+ALTER TABLE file
+    ADD COLUMN IF NOT EXISTS finalized BOOLEAN NOT NULL DEFAULT FALSE;
+UPDATE file SET finalized = status NOT IN ('pending', 'uploading');
+ALTER TABLE file
+    DROP COLUMN IF EXISTS status;
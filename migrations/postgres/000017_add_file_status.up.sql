@@ -0,0 +1,6 @@
+-- Replace the finalized flag of files with a lifecycle status
+ALTER TABLE file
+    ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'pending';
+UPDATE file SET status = 'active' WHERE finalized;
+ALTER TABLE file
+    DROP COLUMN IF EXISTS finalized;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS webhook_delivery_due_idx;
+DROP INDEX IF EXISTS webhook_delivery_webhook_id_idx;
+DROP TABLE IF EXISTS webhook_delivery;
+DROP TABLE IF EXISTS webhook;
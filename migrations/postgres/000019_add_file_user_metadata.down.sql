@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS file_tags_idx;
+DROP INDEX IF EXISTS file_user_metadata_idx;
+ALTER TABLE file
+    DROP COLUMN IF EXISTS tags,
+    DROP COLUMN IF EXISTS user_metadata;
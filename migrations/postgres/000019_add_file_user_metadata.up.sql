@@ -0,0 +1,6 @@
+-- Add client-set metadata and tags to files
+ALTER TABLE file
+    ADD COLUMN IF NOT EXISTS user_metadata JSONB NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+CREATE INDEX IF NOT EXISTS file_user_metadata_idx ON file USING GIN (user_metadata);
+CREATE INDEX IF NOT EXISTS file_tags_idx ON file USING GIN (tags);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS file_created_at_id_idx;
@@ -0,0 +1,2 @@
+-- Index the order files are listed in
+CREATE INDEX IF NOT EXISTS file_created_at_id_idx ON file (created_at, id);
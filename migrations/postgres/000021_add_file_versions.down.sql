@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS file_version;
+ALTER TABLE file
+    DROP COLUMN IF EXISTS version_of,
+    DROP COLUMN IF EXISTS version;
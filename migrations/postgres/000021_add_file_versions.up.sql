@@ -0,0 +1,27 @@
+-- Add versions to files and keep the content of earlier versions
+ALTER TABLE file
+    ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1,
+    ADD COLUMN IF NOT EXISTS version_of TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS file_version (
+    id UUID NOT NULL,
+    file_id TEXT NOT NULL,
+    version INTEGER NOT NULL,
+    bucket_id TEXT NOT NULL,
+    object_key TEXT NOT NULL,
+    path TEXT NOT NULL DEFAULT '',
+    file_size BIGINT NOT NULL DEFAULT 0,
+    content_type TEXT NOT NULL DEFAULT '',
+    checksum TEXT NOT NULL DEFAULT '',
+    etag TEXT NOT NULL DEFAULT '',
+    encrypted BOOLEAN NOT NULL DEFAULT FALSE,
+    data_key BYTEA,
+    scan_status TEXT NOT NULL DEFAULT '',
+    modified_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP,
+    updated_at TIMESTAMP,
+    PRIMARY KEY (file_id, version)
+);
+
+CREATE INDEX IF NOT EXISTS file_version_object_key_idx ON file_version (object_key);
+CREATE INDEX IF NOT EXISTS file_version_created_at_idx ON file_version (created_at);
@@ -0,0 +1,17 @@
+-- Create idempotency_record table
+CREATE TABLE IF NOT EXISTS idempotency_record (
+    id UUID NOT NULL,
+    token_id TEXT NOT NULL,
+    idempotency_key TEXT NOT NULL,
+    fingerprint TEXT NOT NULL,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    content_type TEXT NOT NULL DEFAULT '',
+    body BYTEA,
+    headers JSONB NOT NULL DEFAULT '{}',
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP,
+    updated_at TIMESTAMP,
+    PRIMARY KEY (token_id, idempotency_key)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_record_expires_at_idx ON idempotency_record (expires_at);
@@ -0,0 +1,2 @@
+ALTER TABLE file_counter DROP COLUMN IF EXISTS creation_handed_over;
+DROP TABLE IF EXISTS file_reference;
@@ -0,0 +1,10 @@
+-- Create file_reference table, the ledger of named reference holders
+CREATE TABLE IF NOT EXISTS file_reference (
+    file_id TEXT NOT NULL,
+    holder TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (file_id, holder)
+);
+
+-- Record when the first holder has taken over the reference of the uploader
+ALTER TABLE file_counter ADD COLUMN IF NOT EXISTS creation_handed_over BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,3 @@
+-- Hold files over 2 GiB, which multipart uploads allow
+ALTER TABLE file
+    ALTER COLUMN file_size TYPE BIGINT;
@@ -0,0 +1 @@
+ALTER TABLE fileblob DROP (upload_id, upload_offset, upload_length, content_type, parts, hash_state);
@@ -0,0 +1 @@
+ALTER TABLE fileblob ADD (upload_id text, upload_offset bigint, upload_length bigint, content_type text, parts text, hash_state blob);
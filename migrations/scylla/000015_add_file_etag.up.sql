@@ -0,0 +1 @@
+ALTER TABLE file ADD etag text;
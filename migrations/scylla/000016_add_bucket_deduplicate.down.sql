@@ -0,0 +1 @@
+ALTER TABLE bucket DROP deduplicate;
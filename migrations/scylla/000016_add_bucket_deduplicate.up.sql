@@ -0,0 +1 @@
+ALTER TABLE bucket ADD deduplicate boolean;
@@ -0,0 +1 @@
+ALTER TABLE file ADD object_key text;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS file_checksum_idx;
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS file_checksum_idx ON file (checksum);
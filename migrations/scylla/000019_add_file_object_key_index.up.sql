@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS file_object_key_idx ON file (object_key);
@@ -0,0 +1 @@
+ALTER TABLE file DROP (upload_policy, expires_at);
@@ -0,0 +1 @@
+ALTER TABLE file ADD (upload_policy text, expires_at timestamp);
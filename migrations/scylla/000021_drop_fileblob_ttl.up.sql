@@ -0,0 +1 @@
+ALTER TABLE fileblob WITH default_time_to_live = 0;
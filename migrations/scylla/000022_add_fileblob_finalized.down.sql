@@ -0,0 +1 @@
+ALTER TABLE fileblob DROP finalized;
@@ -0,0 +1 @@
+ALTER TABLE fileblob ADD finalized boolean;
@@ -0,0 +1 @@
+ALTER TABLE bucket ADD encrypt boolean;
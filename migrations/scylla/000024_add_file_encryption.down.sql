@@ -0,0 +1 @@
+ALTER TABLE file DROP (encrypted, data_key);
@@ -0,0 +1 @@
+ALTER TABLE file ADD (encrypted boolean, data_key blob);
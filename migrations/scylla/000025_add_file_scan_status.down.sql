@@ -0,0 +1 @@
+ALTER TABLE file DROP (scan_status, scan_detail);
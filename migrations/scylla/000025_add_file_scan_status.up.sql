@@ -0,0 +1 @@
+ALTER TABLE file ADD (scan_status text, scan_detail text);
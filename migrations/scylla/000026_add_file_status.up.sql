@@ -0,0 +1 @@
+ALTER TABLE file ADD status text;
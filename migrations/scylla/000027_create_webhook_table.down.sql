@@ -0,0 +1 @@
+DROP TABLE IF EXISTS webhook;
\ No newline at end of file
@@ -0,0 +1,11 @@
+-- Create webhook table
+CREATE TABLE IF NOT EXISTS webhook (
+    id text,
+    url text,
+    secret text,
+    events text,
+    enabled boolean,
+    created_at timestamp,
+    updated_at timestamp,
+    PRIMARY KEY (id)
+);
\ No newline at end of file
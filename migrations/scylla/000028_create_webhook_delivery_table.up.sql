@@ -0,0 +1,16 @@
+-- Create webhook_delivery table
+CREATE TABLE IF NOT EXISTS webhook_delivery (
+    id text,
+    webhook_id text,
+    event_id text,
+    event text,
+    payload text,
+    status text,
+    attempts int,
+    next_attempt_at timestamp,
+    response_status int,
+    last_error text,
+    created_at timestamp,
+    updated_at timestamp,
+    PRIMARY KEY (id)
+);
\ No newline at end of file
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS webhook_delivery_webhook_id_idx;
\ No newline at end of file
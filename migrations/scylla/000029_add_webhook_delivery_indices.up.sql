@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS webhook_delivery_webhook_id_idx ON webhook_delivery (webhook_id);
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE file DROP (user_metadata, tags);
\ No newline at end of file
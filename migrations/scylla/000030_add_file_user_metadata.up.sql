@@ -0,0 +1 @@
+ALTER TABLE file ADD (user_metadata map<text, text>, tags set<text>);
\ No newline at end of file
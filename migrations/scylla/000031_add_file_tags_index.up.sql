@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS file_tags_idx ON file (VALUES(tags));
\ No newline at end of file
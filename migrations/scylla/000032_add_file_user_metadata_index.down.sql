@@ -0,0 +1 @@
+DROP INDEX IF EXISTS file_user_metadata_idx;
\ No newline at end of file
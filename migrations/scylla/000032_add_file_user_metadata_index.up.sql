@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS file_user_metadata_idx ON file (ENTRIES(user_metadata));
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE file DROP (version, version_of);
\ No newline at end of file
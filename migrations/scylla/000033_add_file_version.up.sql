@@ -0,0 +1 @@
+ALTER TABLE file ADD (version int, version_of text);
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS file_version;
\ No newline at end of file
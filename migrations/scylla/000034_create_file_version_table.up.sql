@@ -0,0 +1,20 @@
+-- Create file_version table
+CREATE TABLE IF NOT EXISTS file_version (
+    file_id text,
+    version int,
+    id text,
+    bucket_id text,
+    object_key text,
+    path text,
+    file_size bigint,
+    content_type text,
+    checksum text,
+    etag text,
+    encrypted boolean,
+    data_key blob,
+    scan_status text,
+    modified_at timestamp,
+    created_at timestamp,
+    updated_at timestamp,
+    PRIMARY KEY ((file_id), version)
+) WITH CLUSTERING ORDER BY (version DESC);
\ No newline at end of file
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS file_version_object_key_idx;
\ No newline at end of file
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS file_version_object_key_idx ON file_version (object_key);
\ No newline at end of file
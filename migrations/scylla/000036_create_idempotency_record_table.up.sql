@@ -0,0 +1,15 @@
+-- Create idempotency_record table; rows expire with their TTL
+CREATE TABLE IF NOT EXISTS idempotency_record (
+    token_id text,
+    idempotency_key text,
+    id text,
+    fingerprint text,
+    status_code int,
+    content_type text,
+    body blob,
+    headers map<text, text>,
+    expires_at timestamp,
+    created_at timestamp,
+    updated_at timestamp,
+    PRIMARY KEY ((token_id, idempotency_key))
+);
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS file_reference;
\ No newline at end of file
@@ -0,0 +1,7 @@
+-- Create file_reference table, the ledger of named reference holders
+CREATE TABLE IF NOT EXISTS file_reference (
+    file_id text,
+    holder text,
+    created_at timestamp,
+    PRIMARY KEY ((file_id), holder)
+);
\ No newline at end of file
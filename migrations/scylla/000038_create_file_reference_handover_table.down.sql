@@ -0,0 +1 @@
+DROP TABLE IF EXISTS file_reference_handover;
\ No newline at end of file
@@ -0,0 +1,5 @@
+-- Create file_reference_handover table, recording the files whose first holder took over the reference of the uploader
+CREATE TABLE IF NOT EXISTS file_reference_handover (
+    file_id text,
+    PRIMARY KEY (file_id)
+);
\ No newline at end of file
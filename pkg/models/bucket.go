@@ -18,6 +18,8 @@ type Bucket struct {
 	S3Provider   string      `json:"s3_provider"`
 	CustomConfig string      `json:"custom_config,omitempty"`
 	StorageType  StorageType `json:"storage_type" gorm:"default:0"`
+	Deduplicate  bool        `json:"deduplicate"` // store identical uploads in the region only once, unless encrypted
+	Encrypt      bool        `json:"encrypt"`     // encrypt uploaded objects with per-file data keys
 }
 
 func (bu Bucket) GetID() string {
@@ -1,19 +1,170 @@
 package models
 
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// FileStatus is the stage of its lifecycle a file is in.
+type FileStatus string
+
+const (
+	FileStatusPending   FileStatus = "pending"   // created, no content received yet
+	FileStatusUploading FileStatus = "uploading" // a resumable upload is receiving content
+	FileStatusUploaded  FileStatus = "uploaded"  // content is stored and awaits finalization
+	FileStatusScanning  FileStatus = "scanning"  // content is being scanned
+	FileStatusActive    FileStatus = "active"    // finalized and in use
+	FileStatusDeleting  FileStatus = "deleting"  // content is being removed
+	FileStatusDeleted   FileStatus = "deleted"   // content has been removed
+	FileStatusFailed    FileStatus = "failed"    // content was rejected and cannot be used
+)
+
+var ErrIllegalTransition = errors.New("illegal file status transition")
+
+// ErrInvalidCursor is returned when a listing is resumed from a cursor the
+// repository did not hand out.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// fileTransitions lists the statuses a file may move to from each status.
+var fileTransitions = map[FileStatus][]FileStatus{
+	FileStatusPending:   {FileStatusUploading, FileStatusUploaded, FileStatusScanning, FileStatusDeleting, FileStatusFailed},
+	FileStatusUploading: {FileStatusUploaded, FileStatusScanning, FileStatusDeleting, FileStatusFailed},
+	// Content that was not finalized yet may still be replaced.
+	FileStatusUploaded: {FileStatusUploaded, FileStatusScanning, FileStatusActive, FileStatusDeleting, FileStatusFailed},
+	// A scan that stalled is started over.
+	FileStatusScanning: {FileStatusScanning, FileStatusUploaded, FileStatusDeleting, FileStatusFailed},
+	FileStatusActive:   {FileStatusDeleting},
+	FileStatusDeleting: {FileStatusDeleted},
+	FileStatusFailed:   {FileStatusDeleting},
+}
+
+// CanTransition reports whether a file may move from status s to status to.
+func (s FileStatus) CanTransition(to FileStatus) bool {
+	for _, allowed := range fileTransitions[s] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Valid reports whether s is one of the known statuses.
+func (s FileStatus) Valid() bool {
+	switch s {
+	case FileStatusPending, FileStatusUploading, FileStatusUploaded, FileStatusScanning,
+		FileStatusActive, FileStatusDeleting, FileStatusDeleted, FileStatusFailed:
+		return true
+	}
+	return false
+}
+
+// Received reports whether the content of a file in status s is stored.
+func (s FileStatus) Received() bool {
+	switch s {
+	case FileStatusUploaded, FileStatusScanning, FileStatusActive, FileStatusFailed:
+		return true
+	}
+	return false
+}
+
+// ScanStatus is where a file stands with the content scanner.
+type ScanStatus string
+
+const (
+	ScanStatusNone        ScanStatus = ""            // not scanned, scanning was not enabled
+	ScanStatusScanning    ScanStatus = "scanning"    // a scan is in progress
+	ScanStatusClean       ScanStatus = "clean"       // the scanner found nothing
+	ScanStatusQuarantined ScanStatus = "quarantined" // the scanner rejected the content, which was moved aside
+	ScanStatusFailed      ScanStatus = "failed"      // the scan could not complete and will be retried
+)
+
 type File struct {
 	ApplicationModel
-	BucketID      string `json:"bucket_id" binding:"required"`
-	Name          string `json:"name" binding:"required"`
-	Path          string `json:"path"`
-	FileSize      int64  `json:"file_size"`
-	ContentType   string `json:"content_type"`
-	Checksum      string `json:"checksum"`
-	Finalized     bool   `json:"finalized"`
-	FileSizeLimit uint64 `json:"file_size_limit"`
-	References    int64  `json:"references"`
-	Metadata      string `json:"metadata,omitempty"`
+	BucketID      string     `json:"bucket_id" binding:"required"`
+	Name          string     `json:"name" binding:"required"`
+	ObjectKey     string     `json:"object_key,omitempty"` // set when the file shares the object of an identical file
+	Path          string     `json:"path"`
+	FileSize      int64      `json:"file_size"`
+	ContentType   string     `json:"content_type"`
+	Checksum      string     `json:"checksum"`
+	ETag          string     `json:"etag,omitempty"`
+	Status        FileStatus `json:"status" enums:"pending,uploading,uploaded,scanning,active,deleting,deleted,failed"`
+	FileSizeLimit uint64     `json:"file_size_limit"`
+	References    int64      `json:"references"`
+	Metadata      string     `json:"metadata,omitempty"`
+	// UploadPolicy holds the content type rules and retention of the file;
+	// its size limit is kept in FileSizeLimit.
+	UploadPolicy *UploadPolicy `json:"upload_policy,omitempty"`
+	ExpiresAt    *time.Time    `json:"expires_at,omitempty"` // end of the retention period, if any
+	// Encrypted files are stored encrypted with a data key, kept in DataKey
+	// wrapped by the master key. Without DataKey the content is unreadable.
+	Encrypted  bool       `json:"encrypted"`
+	DataKey    []byte     `json:"-"`
+	ScanStatus ScanStatus `json:"scan_status,omitempty"`
+	ScanDetail string     `json:"scan_detail,omitempty"` // what the scanner found, or why it failed
+	// Version counts the contents the file has held, starting at 1. Earlier
+	// ones are kept as FileVersion records until they are pruned.
+	Version int `json:"version"`
+	// VersionOf is set on a file created to upload a new version of another
+	// file. Once finalized, its content becomes the current version of that
+	// file and the record itself is removed.
+	VersionOf string `json:"version_of,omitempty"`
+	// UserMetadata and Tags are set by clients, at initiation or later on.
+	// What the server records about an upload is kept in Metadata.
+	UserMetadata map[string]string `json:"user_metadata,omitempty"`
+	Tags         []string          `json:"tags,omitempty"`
+}
+
+// FileFilter selects the files of a listing. A file matches if it has every
+// field that is set, carries all of Tags and all of the Metadata pairs.
+type FileFilter struct {
+	BucketID     string
+	Status       FileStatus
+	ContentType  string
+	CreatedAfter time.Time
+	Tags         []string
+	Metadata     map[string]string
 }
 
 func (f File) GetID() string {
 	return f.ID
 }
+
+// Transition moves the file to status to, or returns ErrIllegalTransition if
+// its lifecycle does not allow that from its current status.
+func (f *File) Transition(to FileStatus) error {
+	if !f.Status.CanTransition(to) {
+		return fmt.Errorf("%w from %s to %s", ErrIllegalTransition, f.Status, to)
+	}
+	f.Status = to
+	return nil
+}
+
+// ReplaceContent makes the content uploaded by staged, a file created to
+// upload a new version of f, the current version of f.
+func (f *File) ReplaceContent(staged *File) {
+	f.BucketID = staged.BucketID
+	f.ObjectKey = staged.StorageKey()
+	f.Path = staged.Path
+	f.FileSize = staged.FileSize
+	f.ContentType = staged.ContentType
+	f.Checksum = staged.Checksum
+	f.ETag = staged.ETag
+	f.Metadata = staged.Metadata
+	f.Encrypted = staged.Encrypted
+	f.DataKey = staged.DataKey
+	f.ScanStatus = staged.ScanStatus
+	f.ScanDetail = staged.ScanDetail
+	f.Version = max(f.Version, 1) + 1
+}
+
+// StorageKey returns the key of the object holding the file's content. A
+// deduplicated file points at the object of the file it duplicates;
+// otherwise the object is stored under the file's own name.
+func (f File) StorageKey() string {
+	if f.ObjectKey != "" {
+		return f.ObjectKey
+	}
+	return f.Name
+}
@@ -1,10 +1,37 @@
 package models
 
+// FileBlob is an upload session for a File. Besides pointing at the file it
+// carries the state of a resumable upload: the S3 multipart upload backing it,
+// the parts stored so far and the running checksum of the bytes received.
 type FileBlob struct {
 	ApplicationModel
-	FileID string `json:"file_id" binding:"required"`
+	FileID       string     `json:"file_id" binding:"required"`
+	UploadID     string     `json:"upload_id,omitempty"`
+	UploadOffset int64      `json:"upload_offset"`
+	UploadLength int64      `json:"upload_length,omitempty"` // 0 while the total size is unknown
+	ContentType  string     `json:"content_type,omitempty"`
+	Parts        []BlobPart `json:"parts,omitempty"`
+	HashState    []byte     `json:"-"`
+	Finalized    bool       `json:"finalized"` // the upload has been finalized; the blob is kept until it expires
+}
+
+// BlobPart is a part of a multipart upload that has been stored in S3.
+type BlobPart struct {
+	Number int32  `json:"number"`
+	ETag   string `json:"etag"`
+	Size   int64  `json:"size"`
 }
 
 func (fb FileBlob) GetID() string {
 	return fb.ID
 }
+
+// PartsSize returns the number of bytes held by the stored parts. Any bytes
+// received beyond it are buffered in a pending part object.
+func (fb FileBlob) PartsSize() int64 {
+	var size int64
+	for _, part := range fb.Parts {
+		size += part.Size
+	}
+	return size
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// FileReference records that a holder, such as a message, refers to a file.
+// Every holder counts once towards the reference count of the file.
+type FileReference struct {
+	FileID    string    `json:"file_id"`
+	Holder    string    `json:"holder"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (r FileReference) GetID() string {
+	return r.FileID + "/" + r.Holder
+}
+
+// ErrNoReferences is returned when an anonymous reference is released while
+// the file has none left, so releases cannot cancel out named holders.
+var ErrNoReferences = errors.New("no anonymous references left")
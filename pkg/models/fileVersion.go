@@ -0,0 +1,72 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrVersionConflict is returned when a file moved to another version while
+// a new one was being promoted.
+var ErrVersionConflict = errors.New("file version changed concurrently")
+
+// FileVersion is content a file held before a newer version replaced it. It
+// keeps its own object, which is only removed once nothing refers to it.
+// CreatedAt is when the version was replaced.
+type FileVersion struct {
+	ApplicationModel
+	FileID      string     `json:"file_id"`
+	Version     int        `json:"version"`
+	BucketID    string     `json:"bucket_id"`
+	ObjectKey   string     `json:"object_key"` // key of the object holding the content
+	Path        string     `json:"path"`
+	FileSize    int64      `json:"file_size"`
+	ContentType string     `json:"content_type"`
+	Checksum    string     `json:"checksum"`
+	ETag        string     `json:"etag,omitempty"`
+	Encrypted   bool       `json:"encrypted"`
+	DataKey     []byte     `json:"-"`
+	ScanStatus  ScanStatus `json:"scan_status,omitempty"`
+	ModifiedAt  time.Time  `json:"modified_at"` // when the content was stored
+}
+
+func (v FileVersion) GetID() string {
+	return v.ID
+}
+
+// NewFileVersion records the current content of file as a version.
+func NewFileVersion(file *File) *FileVersion {
+	return &FileVersion{
+		FileID:      file.ID,
+		Version:     file.Version,
+		BucketID:    file.BucketID,
+		ObjectKey:   file.StorageKey(),
+		Path:        file.Path,
+		FileSize:    file.FileSize,
+		ContentType: file.ContentType,
+		Checksum:    file.Checksum,
+		ETag:        file.ETag,
+		Encrypted:   file.Encrypted,
+		DataKey:     file.DataKey,
+		ScanStatus:  file.ScanStatus,
+		ModifiedAt:  file.UpdatedAt,
+	}
+}
+
+// AsFile returns file as it was when it held version v.
+func (v FileVersion) AsFile(file *File) *File {
+	old := *file
+	old.Version = v.Version
+	old.BucketID = v.BucketID
+	old.ObjectKey = v.ObjectKey
+	old.Path = v.Path
+	old.FileSize = v.FileSize
+	old.ContentType = v.ContentType
+	old.Checksum = v.Checksum
+	old.ETag = v.ETag
+	old.Encrypted = v.Encrypted
+	old.DataKey = v.DataKey
+	old.ScanStatus = v.ScanStatus
+	old.ScanDetail = ""
+	old.UpdatedAt = v.ModifiedAt
+	return &old
+}
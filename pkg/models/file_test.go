@@ -0,0 +1,64 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFileTransition(t *testing.T) {
+	// The path of a file uploaded in chunks, scanned and finalized.
+	file := &File{Status: FileStatusPending}
+	for _, status := range []FileStatus{FileStatusUploading, FileStatusUploaded, FileStatusScanning, FileStatusUploaded, FileStatusActive, FileStatusDeleting, FileStatusDeleted} {
+		if err := file.Transition(status); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	tests := []struct {
+		from, to FileStatus
+	}{
+		{FileStatusPending, FileStatusActive},
+		{FileStatusScanning, FileStatusActive},
+		{FileStatusActive, FileStatusUploaded},
+		{FileStatusActive, FileStatusActive},
+		{FileStatusFailed, FileStatusActive},
+		{FileStatusDeleted, FileStatusPending},
+		{FileStatusDeleting, FileStatusActive},
+	}
+	for _, tt := range tests {
+		file := &File{Status: tt.from}
+		if err := file.Transition(tt.to); !errors.Is(err, ErrIllegalTransition) {
+			t.Errorf("%s -> %s: expected ErrIllegalTransition, got %v", tt.from, tt.to, err)
+		}
+		if file.Status != tt.from {
+			t.Errorf("%s -> %s: status changed to %s", tt.from, tt.to, file.Status)
+		}
+	}
+}
+
+func TestFileReplaceContent(t *testing.T) {
+	file := &File{
+		ApplicationModel: ApplicationModel{ID: "f1"},
+		Name:             "f1",
+		BucketID:         "b1",
+		FileSize:         10,
+		Checksum:         "sha256:aa",
+		Version:          1,
+		Tags:             []string{"avatar"},
+	}
+	staged := &File{Name: "f2", BucketID: "b1", FileSize: 20, Checksum: "sha256:bb"}
+
+	old := NewFileVersion(file)
+	file.ReplaceContent(staged)
+	if file.Version != 2 || file.StorageKey() != "f2" || file.FileSize != 20 || file.Checksum != "sha256:bb" {
+		t.Errorf("content not replaced: %+v", file)
+	}
+	if len(file.Tags) != 1 {
+		t.Errorf("tags should be kept, got %v", file.Tags)
+	}
+
+	previous := old.AsFile(file)
+	if previous.Version != 1 || previous.StorageKey() != "f1" || previous.FileSize != 10 || previous.ID != "f1" {
+		t.Errorf("unexpected previous version %+v", previous)
+	}
+}
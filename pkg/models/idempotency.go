@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// IdempotencyRecord is the response to the first request a service token sent
+// with an Idempotency-Key. Retries with the same key get it replayed until
+// ExpiresAt instead of being carried out again.
+type IdempotencyRecord struct {
+	ApplicationModel
+	TokenID     string            `json:"token_id"`
+	Key         string            `json:"key"`
+	Fingerprint string            `json:"fingerprint"` // hash of the method, URI and body of the request
+	StatusCode  int               `json:"status_code"` // 0 while the first request is being served
+	ContentType string            `json:"content_type"`
+	Headers     map[string]string `json:"headers"` // response headers replayed besides the content type
+	Body        []byte            `json:"body"`
+	ExpiresAt   time.Time         `json:"expires_at"`
+}
+
+func (r IdempotencyRecord) GetID() string {
+	return r.ID
+}
@@ -0,0 +1,12 @@
+package models
+
+// UploadPolicy restricts what may be stored in a file. Policies are declared
+// per region and per bucket in the regions configuration and can be
+// overridden when an upload is initiated; the effective policy is kept on the
+// file and enforced while its content is uploaded.
+type UploadPolicy struct {
+	MaxSize       uint64   `json:"maxSize,omitempty"`       // bytes, 0 for no limit
+	AllowedTypes  []string `json:"allowedTypes,omitempty"`  // MIME types or wildcards like image/*; empty allows any
+	DeniedTypes   []string `json:"deniedTypes,omitempty"`   // checked before AllowedTypes
+	RetentionDays int      `json:"retentionDays,omitempty"` // days a file is kept, 0 to keep it indefinitely
+}
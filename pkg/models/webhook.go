@@ -0,0 +1,86 @@
+package models
+
+import "time"
+
+// WebhookEvent is the type of an event webhooks are notified of.
+type WebhookEvent string
+
+const (
+	EventFileUploaded  WebhookEvent = "file.uploaded"  // the content of a file has been stored
+	EventFileFinalized WebhookEvent = "file.finalized" // a file has been finalized and is active
+	EventFileDeleted   WebhookEvent = "file.deleted"   // a file has been deleted, or removed past its retention
+	EventFileMigrated  WebhookEvent = "file.migrated"  // a file has been moved to another bucket
+	EventRefcountZero  WebhookEvent = "refcount.zero"  // the last reference to a file has been released
+)
+
+// WebhookEvents lists every event type.
+var WebhookEvents = []WebhookEvent{EventFileUploaded, EventFileFinalized, EventFileDeleted, EventFileMigrated, EventRefcountZero}
+
+// Valid reports whether e is a known event type.
+func (e WebhookEvent) Valid() bool {
+	for _, event := range WebhookEvents {
+		if event == e {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhook is an endpoint notified of file lifecycle events. Each request is
+// signed with Secret, which is only returned when the webhook is created.
+type Webhook struct {
+	ApplicationModel
+	URL     string         `json:"url" binding:"required"`
+	Secret  string         `json:"secret,omitempty"`
+	Events  []WebhookEvent `json:"events"` // the events sent to the endpoint; all of them if empty
+	Enabled bool           `json:"enabled"`
+}
+
+func (w Webhook) GetID() string {
+	return w.ID
+}
+
+// Subscribed reports whether the webhook is to be notified of event.
+func (w Webhook) Subscribed(event WebhookEvent) bool {
+	if !w.Enabled {
+		return false
+	}
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// DeliveryStatus is where the delivery of an event to a webhook stands.
+type DeliveryStatus string
+
+const (
+	DeliveryStatusPending   DeliveryStatus = "pending"   // waiting for its next attempt
+	DeliveryStatusSucceeded DeliveryStatus = "succeeded" // the endpoint accepted the event
+	DeliveryStatusFailed    DeliveryStatus = "failed"    // every attempt failed; it is not retried unless asked to
+)
+
+// WebhookDelivery is an event queued for a webhook, along with the outcome of
+// its latest attempt. Deliveries are stored before they are attempted, so
+// events survive restarts.
+type WebhookDelivery struct {
+	ApplicationModel
+	WebhookID      string         `json:"webhook_id"`
+	EventID        string         `json:"event_id"` // shared by the deliveries of one event to several webhooks
+	Event          WebhookEvent   `json:"event"`
+	Payload        string         `json:"payload"` // the JSON body sent to the endpoint
+	Status         DeliveryStatus `json:"status" enums:"pending,succeeded,failed"`
+	Attempts       int            `json:"attempts"`
+	NextAttemptAt  time.Time      `json:"next_attempt_at"`
+	ResponseStatus int            `json:"response_status,omitempty"` // HTTP status of the latest attempt
+	LastError      string         `json:"last_error,omitempty"`
+}
+
+func (d WebhookDelivery) GetID() string {
+	return d.ID
+}
@@ -2,6 +2,7 @@ package repositories
 
 import (
 	"context"
+	"time"
 
 	"github.com/argon-chat/KineticaFS/pkg/models"
 )
@@ -25,12 +26,66 @@ type IFileRepository interface {
 	GetFileByID(ctx context.Context, id string) (*models.File, error)
 	GetFileByName(ctx context.Context, name string) (*models.File, error)
 	CreateFile(ctx context.Context, file *models.File) error
+	// UpdateFile saves a file except for its user metadata and tags, which
+	// only UpdateFileUserMetadata changes.
 	UpdateFile(ctx context.Context, file *models.File) error
+	UpdateFileUserMetadata(ctx context.Context, file *models.File) error
 	DeleteFile(ctx context.Context, id string) error
-	ListFiles(ctx context.Context, bucketID string) ([]*models.File, error)
+	// ListFiles returns up to limit files matching filter, starting at
+	// cursor, and the cursor of the next page, or "" if there is none. A
+	// listing may end with an empty page.
+	ListFiles(ctx context.Context, filter models.FileFilter, cursor string, limit int) ([]*models.File, string, error)
+	ListFilesByChecksum(ctx context.Context, checksum string) ([]*models.File, error)
+	ListFilesByObjectKey(ctx context.Context, objectKey string) ([]*models.File, error)
+	// ListPendingFiles returns up to limit of the files last updated before
+	// updatedBefore that are still waiting for content or were left being
+	// deleted, starting at cursor, and the cursor of the next page, or "" once
+	// every file has been seen. A page may come back short or empty.
+	ListPendingFiles(ctx context.Context, updatedBefore time.Time, cursor string, limit int) ([]*models.File, string, error)
+	// ListExpiredFiles pages through the files whose retention ended before
+	// expiredBefore like ListPendingFiles.
+	ListExpiredFiles(ctx context.Context, expiredBefore time.Time, cursor string, limit int) ([]*models.File, string, error)
+	// GetFileReferenceCount returns the anonymous references taken with
+	// AtomicIncrement plus the holders recorded with AddFileReference.
 	GetFileReferenceCount(ctx context.Context, fileID string) (int64, error)
 	AtomicIncrement(ctx context.Context, id string) error
+	// AtomicDecrement releases an anonymous reference. It returns
+	// models.ErrNoReferences instead of taking the count below the holders.
 	AtomicDecrement(ctx context.Context, id string) error
+	// AddFileReference records holder as referring to a file, which counts
+	// it in the reference count. It reports false if holder already refers
+	// to the file, which leaves the count as it is. The reference CreateFile
+	// takes for the uploader is handed over to the first holder, so a file
+	// managed through holders is deleted once the last one is removed.
+	AddFileReference(ctx context.Context, fileID, holder string) (bool, error)
+	// RemoveFileReference drops holder and its count, and reports false if
+	// holder did not refer to the file.
+	RemoveFileReference(ctx context.Context, fileID, holder string) (bool, error)
+	ListFileReferences(ctx context.Context, fileID string) ([]*models.FileReference, error)
+}
+
+// IFileVersionRepository keeps the earlier versions of files. Versions are
+// identified by the ID of their file and their number.
+type IFileVersionRepository interface {
+	IRepository
+	CreateFileVersion(ctx context.Context, version *models.FileVersion) error
+	// GetFileVersion returns nil if the file has no such version.
+	GetFileVersion(ctx context.Context, fileID string, version int) (*models.FileVersion, error)
+	UpdateFileVersion(ctx context.Context, version *models.FileVersion) error
+	DeleteFileVersion(ctx context.Context, fileID string, version int) error
+	// ListFileVersions returns the versions of a file, newest first.
+	ListFileVersions(ctx context.Context, fileID string) ([]*models.FileVersion, error)
+	ListFileVersionsByObjectKey(ctx context.Context, objectKey string) ([]*models.FileVersion, error)
+	// ListFileVersionsReplacedBefore returns the versions replaced by a newer
+	// one before the given time.
+	ListFileVersionsReplacedBefore(ctx context.Context, before time.Time) ([]*models.FileVersion, error)
+	// PromoteFileVersion records previous, the content file held until now,
+	// stores file with the content uploaded to staged, and removes the
+	// staged record, which must already be active. The sweeper must never
+	// see file pointing at the content of a staged record it may remove.
+	// It returns models.ErrVersionConflict, leaving file as it is, unless
+	// file is still stored at the version of previous.
+	PromoteFileVersion(ctx context.Context, previous *models.FileVersion, file, staged *models.File) error
 }
 
 type IServiceTokenRepository interface {
@@ -47,5 +102,49 @@ type IFileBlobRepository interface {
 	IRepository
 	CreateFileBlob(ctx context.Context, blob *models.FileBlob) (*models.FileBlob, error)
 	GetFileBlobByID(ctx context.Context, id string) (*models.FileBlob, error)
+	UpdateFileBlob(ctx context.Context, blob *models.FileBlob) error
+	// UpdateFileBlobAtOffset stores blob only while its stored upload offset
+	// is still offset, and reports whether it did. Concurrent chunks of one
+	// upload use it so that only one of them records its progress.
+	UpdateFileBlobAtOffset(ctx context.Context, blob *models.FileBlob, offset int64) (bool, error)
 	DeleteFileBlobByID(ctx context.Context, id string) error
+	ListFileBlobsByFileID(ctx context.Context, fileID string) ([]*models.FileBlob, error)
+	ListExpiredFileBlobs(ctx context.Context, updatedBefore time.Time) ([]*models.FileBlob, error)
+}
+
+type IWebhookRepository interface {
+	IRepository
+	GetWebhookByID(ctx context.Context, id string) (*models.Webhook, error)
+	CreateWebhook(ctx context.Context, webhook *models.Webhook) error
+	UpdateWebhook(ctx context.Context, webhook *models.Webhook) error
+	DeleteWebhook(ctx context.Context, id string) error
+	ListWebhooks(ctx context.Context) ([]*models.Webhook, error)
+	CreateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+	GetDeliveryByID(ctx context.Context, id string) (*models.WebhookDelivery, error)
+	UpdateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+	// ClaimDelivery moves the next attempt of a pending delivery to until if
+	// it is still at delivery.NextAttemptAt, so other dispatchers skip the
+	// delivery while it is sent. It reports false if another dispatcher
+	// claimed it first.
+	ClaimDelivery(ctx context.Context, delivery *models.WebhookDelivery, until time.Time) (bool, error)
+	DeleteDeliveriesByWebhookID(ctx context.Context, webhookID string) error
+	ListDeliveriesByWebhookID(ctx context.Context, webhookID string) ([]*models.WebhookDelivery, error)
+	ListDueDeliveries(ctx context.Context, dueBefore time.Time) ([]*models.WebhookDelivery, error)
+}
+
+type IIdempotencyRepository interface {
+	IRepository
+	// CreateIdempotencyRecord stores record unless a live record exists for
+	// its token and key, and reports whether it was stored.
+	CreateIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecord) (bool, error)
+	// GetIdempotencyRecord returns nil if there is no live record.
+	GetIdempotencyRecord(ctx context.Context, tokenID, key string) (*models.IdempotencyRecord, error)
+	// UpdateIdempotencyRecord saves the response held by record, or only
+	// refreshes its UpdatedAt while it has none. Nothing is saved if another
+	// record has taken its key over since.
+	UpdateIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecord) error
+	// DeleteIdempotencyRecord releases the key of record, unless another
+	// record has taken it over since.
+	DeleteIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecord) error
+	DeleteExpiredIdempotencyRecords(ctx context.Context, before time.Time) error
 }
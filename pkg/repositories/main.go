@@ -41,6 +41,9 @@ type ApplicationRepository struct {
 	Buckets       IBucketRepository
 	Files         IFileRepository
 	FileBlobs     IFileBlobRepository
+	FileVersions  IFileVersionRepository
+	Webhooks      IWebhookRepository
+	Idempotency   IIdempotencyRepository
 }
 
 func (a *ApplicationRepository) Close() error {
@@ -56,6 +59,11 @@ func NewApplicationRepository() (*ApplicationRepository, error) {
 		models.Bucket{},
 		models.File{},
 		models.FileBlob{},
+		models.FileVersion{},
+		models.Webhook{},
+		models.WebhookDelivery{},
+		models.IdempotencyRecord{},
+		models.FileReference{},
 	}
 	dbType := viper.GetString("database")
 	if dbType == "" {
@@ -142,6 +150,13 @@ func (ar *ApplicationRepository) migrateDatabase(ctx context.Context) error {
 	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
 		return fmt.Errorf("apply migrations: %w", err)
 	}
+	if files, ok := ar.Files.(*scylla.ScyllaFileRepository); ok {
+		// CQL cannot derive the status column added by migration 26 from
+		// the finalized column of existing rows.
+		if err := files.BackfillFileStatus(ctx); err != nil {
+			return fmt.Errorf("backfill file status: %w", err)
+		}
+	}
 	return nil
 }
 
@@ -160,6 +175,9 @@ func newPostgresRepository(connectionString string) (*ApplicationRepository, err
 		Buckets:       postgres.NewPostgresBucketRepository(repository.DB),
 		Files:         postgres.NewPostgresFileRepository(repository.DB),
 		FileBlobs:     postgres.NewPostgresFileBlobRepository(repository.DB),
+		FileVersions:  postgres.NewPostgresFileVersionRepository(repository.DB),
+		Webhooks:      postgres.NewPostgresWebhookRepository(repository.DB),
+		Idempotency:   postgres.NewPostgresIdempotencyRepository(repository.DB),
 	}
 	log.Printf("Postgres repository created: %+v", ar)
 	return ar, nil
@@ -180,6 +198,9 @@ func newScyllaRepository(connectionString string) (*ApplicationRepository, error
 		Buckets:       scylla.NewScyllaBucketRepository(repository.Session),
 		Files:         scylla.NewScyllaFileRepository(repository.Session),
 		FileBlobs:     scylla.NewScyllaFileBlobRepository(repository.Session),
+		FileVersions:  scylla.NewScyllaFileVersionRepository(repository.Session),
+		Webhooks:      scylla.NewScyllaWebhookRepository(repository.Session),
+		Idempotency:   scylla.NewScyllaIdempotencyRepository(repository.Session),
 	}
 	log.Printf("Scylla repository created: %+v", ar)
 	return ar, nil
@@ -190,4 +211,7 @@ func (r *ApplicationRepository) InitializeRepo(ctx context.Context, repo *Applic
 	// r.Buckets.CreateIndices(ctx)
 	// r.Files.CreateIndices(ctx)
 	// r.FileBlobs.CreateIndices(ctx)
+	// r.FileVersions.CreateIndices(ctx)
+	// r.Webhooks.CreateIndices(ctx)
+	// r.Idempotency.CreateIndices(ctx)
 }
@@ -32,10 +32,10 @@ func (s *PostgresBucketRepository) CreateIndices(ctx context.Context) {
 	}
 }
 func (p *PostgresBucketRepository) GetBucketByID(ctx context.Context, id string) (*models.Bucket, error) {
-	row := p.session.QueryRowContext(ctx, "select id, name, region, endpoint, s3_provider, access_key, secret_key, storage_type, use_ssl, custom_config, created_at, updated_at from bucket where id = $1", id)
+	row := p.session.QueryRowContext(ctx, "select id, name, region, endpoint, s3_provider, access_key, secret_key, storage_type, use_ssl, custom_config, deduplicate, encrypt, created_at, updated_at from bucket where id = $1", id)
 	var bucket models.Bucket
 	var storageType int8
-	err := row.Scan(&bucket.ID, &bucket.Name, &bucket.Region, &bucket.Endpoint, &bucket.S3Provider, &bucket.AccessKey, &bucket.SecretKey, &storageType, &bucket.UseSSL, &bucket.CustomConfig, &bucket.CreatedAt, &bucket.UpdatedAt)
+	err := row.Scan(&bucket.ID, &bucket.Name, &bucket.Region, &bucket.Endpoint, &bucket.S3Provider, &bucket.AccessKey, &bucket.SecretKey, &storageType, &bucket.UseSSL, &bucket.CustomConfig, &bucket.Deduplicate, &bucket.Encrypt, &bucket.CreatedAt, &bucket.UpdatedAt)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, nil
 	}
@@ -47,10 +47,10 @@ func (p *PostgresBucketRepository) GetBucketByID(ctx context.Context, id string)
 }
 
 func (p *PostgresBucketRepository) GetBucketByName(ctx context.Context, name string) (*models.Bucket, error) {
-	row := p.session.QueryRowContext(ctx, "select id, name, region, endpoint, s3_provider, access_key, secret_key, storage_type, use_ssl, custom_config, created_at, updated_at from bucket where name = $1", name)
+	row := p.session.QueryRowContext(ctx, "select id, name, region, endpoint, s3_provider, access_key, secret_key, storage_type, use_ssl, custom_config, deduplicate, encrypt, created_at, updated_at from bucket where name = $1", name)
 	var bucket models.Bucket
 	var storageType int8
-	err := row.Scan(&bucket.ID, &bucket.Name, &bucket.Region, &bucket.Endpoint, &bucket.S3Provider, &bucket.AccessKey, &bucket.SecretKey, &storageType, &bucket.UseSSL, &bucket.CustomConfig, &bucket.CreatedAt, &bucket.UpdatedAt)
+	err := row.Scan(&bucket.ID, &bucket.Name, &bucket.Region, &bucket.Endpoint, &bucket.S3Provider, &bucket.AccessKey, &bucket.SecretKey, &storageType, &bucket.UseSSL, &bucket.CustomConfig, &bucket.Deduplicate, &bucket.Encrypt, &bucket.CreatedAt, &bucket.UpdatedAt)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, nil
 	}
@@ -68,16 +68,16 @@ func (p *PostgresBucketRepository) CreateBucket(ctx context.Context, bucket *mod
 	bucket.ID = uuid.NewString()
 	_, err := p.session.ExecContext(
 		ctx,
-		"insert into bucket (id, name, region, endpoint, s3_provider, access_key, secret_key, storage_type, use_ssl, custom_config, created_at, updated_at) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)",
-		bucket.ID, bucket.Name, bucket.Region, bucket.Endpoint, bucket.S3Provider, bucket.AccessKey, bucket.SecretKey, bucket.StorageType, bucket.UseSSL, bucket.CustomConfig, bucket.CreatedAt, bucket.UpdatedAt)
+		"insert into bucket (id, name, region, endpoint, s3_provider, access_key, secret_key, storage_type, use_ssl, custom_config, deduplicate, encrypt, created_at, updated_at) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)",
+		bucket.ID, bucket.Name, bucket.Region, bucket.Endpoint, bucket.S3Provider, bucket.AccessKey, bucket.SecretKey, bucket.StorageType, bucket.UseSSL, bucket.CustomConfig, bucket.Deduplicate, bucket.Encrypt, bucket.CreatedAt, bucket.UpdatedAt)
 	return err
 }
 
 func (p *PostgresBucketRepository) UpdateBucket(ctx context.Context, bucket *models.Bucket) error {
 	_, err := p.session.ExecContext(
 		ctx,
-		"update bucket set name = $1, region = $2, endpoint = $3, s3_provider = $4, access_key = $5, secret_key = $6, storage_type = $7, use_ssl = $8, custom_config = $9, updated_at = $10 where id = $11",
-		bucket.Name, bucket.Region, bucket.Endpoint, bucket.S3Provider, bucket.AccessKey, bucket.SecretKey, bucket.StorageType, bucket.UseSSL, bucket.CustomConfig, bucket.UpdatedAt, bucket.ID)
+		"update bucket set name = $1, region = $2, endpoint = $3, s3_provider = $4, access_key = $5, secret_key = $6, storage_type = $7, use_ssl = $8, custom_config = $9, deduplicate = $10, encrypt = $11, updated_at = $12 where id = $13",
+		bucket.Name, bucket.Region, bucket.Endpoint, bucket.S3Provider, bucket.AccessKey, bucket.SecretKey, bucket.StorageType, bucket.UseSSL, bucket.CustomConfig, bucket.Deduplicate, bucket.Encrypt, bucket.UpdatedAt, bucket.ID)
 	return err
 }
 
@@ -87,7 +87,7 @@ func (p *PostgresBucketRepository) DeleteBucket(ctx context.Context, id string)
 }
 
 func (p *PostgresBucketRepository) ListBuckets(ctx context.Context) ([]*models.Bucket, error) {
-	rows, err := p.session.QueryContext(ctx, "select id, name, region, endpoint, s3_provider, access_key, secret_key, storage_type, use_ssl, custom_config, created_at, updated_at from bucket")
+	rows, err := p.session.QueryContext(ctx, "select id, name, region, endpoint, s3_provider, access_key, secret_key, storage_type, use_ssl, custom_config, deduplicate, encrypt, created_at, updated_at from bucket")
 	if err != nil {
 		return nil, err
 	}
@@ -96,7 +96,7 @@ func (p *PostgresBucketRepository) ListBuckets(ctx context.Context) ([]*models.B
 	for rows.Next() {
 		bucket := &models.Bucket{}
 		var storageType int8
-		err := rows.Scan(&bucket.ID, &bucket.Name, &bucket.Region, &bucket.Endpoint, &bucket.S3Provider, &bucket.AccessKey, &bucket.SecretKey, &storageType, &bucket.UseSSL, &bucket.CustomConfig, &bucket.CreatedAt, &bucket.UpdatedAt)
+		err := rows.Scan(&bucket.ID, &bucket.Name, &bucket.Region, &bucket.Endpoint, &bucket.S3Provider, &bucket.AccessKey, &bucket.SecretKey, &storageType, &bucket.UseSSL, &bucket.CustomConfig, &bucket.Deduplicate, &bucket.Encrypt, &bucket.CreatedAt, &bucket.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
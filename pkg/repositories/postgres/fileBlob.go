@@ -3,9 +3,12 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"log"
+	"time"
 
 	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/google/uuid"
 )
 
 type PostgresFileBlobRepository struct {
@@ -29,13 +32,109 @@ func (p *PostgresFileBlobRepository) CreateIndices(ctx context.Context) {
 }
 
 func (p *PostgresFileBlobRepository) CreateFileBlob(ctx context.Context, blob *models.FileBlob) (*models.FileBlob, error) {
-	return nil, nil
+	blob.ID = uuid.NewString()
+	blob.CreatedAt = time.Now().UTC()
+	blob.UpdatedAt = blob.CreatedAt
+	parts, err := json.Marshal(blob.Parts)
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.session.ExecContext(
+		ctx,
+		"insert into file_blob (id, created_at, updated_at, file_id, upload_id, upload_offset, upload_length, content_type, parts, hash_state, finalized) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)",
+		blob.ID, blob.CreatedAt, blob.UpdatedAt, blob.FileID, blob.UploadID, blob.UploadOffset, blob.UploadLength, blob.ContentType, string(parts), blob.HashState, blob.Finalized)
+	if err != nil {
+		return nil, err
+	}
+	return blob, nil
+}
+
+const fileBlobSelectColumns = "id, created_at, updated_at, file_id, upload_id, upload_offset, upload_length, content_type, parts, hash_state, finalized"
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// execer is a *sql.DB or a *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func scanFileBlob(row rowScanner) (*models.FileBlob, error) {
+	var blob models.FileBlob
+	var parts string
+	err := row.Scan(&blob.ID, &blob.CreatedAt, &blob.UpdatedAt, &blob.FileID, &blob.UploadID, &blob.UploadOffset, &blob.UploadLength, &blob.ContentType, &parts, &blob.HashState, &blob.Finalized)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(parts), &blob.Parts); err != nil {
+		return nil, err
+	}
+	return &blob, nil
 }
 
 func (p *PostgresFileBlobRepository) GetFileBlobByID(ctx context.Context, id string) (*models.FileBlob, error) {
-	return nil, nil
+	row := p.session.QueryRowContext(ctx, "select "+fileBlobSelectColumns+" from file_blob where id = $1", id)
+	return scanFileBlob(row)
+}
+
+func (p *PostgresFileBlobRepository) ListFileBlobsByFileID(ctx context.Context, fileID string) ([]*models.FileBlob, error) {
+	return p.queryFileBlobs(ctx, "select "+fileBlobSelectColumns+" from file_blob where file_id = $1", fileID)
+}
+
+func (p *PostgresFileBlobRepository) ListExpiredFileBlobs(ctx context.Context, updatedBefore time.Time) ([]*models.FileBlob, error) {
+	return p.queryFileBlobs(ctx, "select "+fileBlobSelectColumns+" from file_blob where updated_at < $1", updatedBefore)
+}
+
+func (p *PostgresFileBlobRepository) queryFileBlobs(ctx context.Context, query string, args ...interface{}) ([]*models.FileBlob, error) {
+	rows, err := p.session.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blobs []*models.FileBlob
+	for rows.Next() {
+		blob, err := scanFileBlob(rows)
+		if err != nil {
+			return nil, err
+		}
+		blobs = append(blobs, blob)
+	}
+	return blobs, rows.Err()
+}
+
+func (p *PostgresFileBlobRepository) UpdateFileBlob(ctx context.Context, blob *models.FileBlob) error {
+	blob.UpdatedAt = time.Now().UTC()
+	parts, err := json.Marshal(blob.Parts)
+	if err != nil {
+		return err
+	}
+	_, err = p.session.ExecContext(
+		ctx,
+		"update file_blob set updated_at = $1, file_id = $2, upload_id = $3, upload_offset = $4, upload_length = $5, content_type = $6, parts = $7, hash_state = $8, finalized = $9 where id = $10",
+		blob.UpdatedAt, blob.FileID, blob.UploadID, blob.UploadOffset, blob.UploadLength, blob.ContentType, string(parts), blob.HashState, blob.Finalized, blob.ID)
+	return err
+}
+
+func (p *PostgresFileBlobRepository) UpdateFileBlobAtOffset(ctx context.Context, blob *models.FileBlob, offset int64) (bool, error) {
+	blob.UpdatedAt = time.Now().UTC()
+	parts, err := json.Marshal(blob.Parts)
+	if err != nil {
+		return false, err
+	}
+	result, err := p.session.ExecContext(
+		ctx,
+		"update file_blob set updated_at = $1, file_id = $2, upload_id = $3, upload_offset = $4, upload_length = $5, content_type = $6, parts = $7, hash_state = $8, finalized = $9 where id = $10 and upload_offset = $11",
+		blob.UpdatedAt, blob.FileID, blob.UploadID, blob.UploadOffset, blob.UploadLength, blob.ContentType, string(parts), blob.HashState, blob.Finalized, blob.ID, offset)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
 }
 
 func (p *PostgresFileBlobRepository) DeleteFileBlobByID(ctx context.Context, id string) error {
-	return nil
+	_, err := p.session.ExecContext(ctx, "delete from file_blob where id = $1", id)
+	return err
 }
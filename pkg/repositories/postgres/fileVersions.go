@@ -0,0 +1,142 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/google/uuid"
+)
+
+type PostgresFileVersionRepository struct {
+	session *sql.DB
+}
+
+func NewPostgresFileVersionRepository(session *sql.DB) *PostgresFileVersionRepository {
+	return &PostgresFileVersionRepository{session: session}
+}
+
+func (p *PostgresFileVersionRepository) CreateIndices(ctx context.Context) {
+	indexQueries := []string{
+		"create index if not exists file_version_object_key_idx on file_version (object_key)",
+		"create index if not exists file_version_created_at_idx on file_version (created_at)",
+	}
+	for _, indexQuery := range indexQueries {
+		log.Printf("Executing index creation query: %s", indexQuery)
+		if _, err := p.session.ExecContext(ctx, indexQuery); err != nil {
+			log.Printf("Error creating index: %v", err)
+		}
+	}
+}
+
+const fileVersionSelectColumns = "id, file_id, version, bucket_id, object_key, path, file_size, content_type, checksum, etag, encrypted, data_key, scan_status, modified_at, created_at, updated_at"
+
+func scanFileVersion(row rowScanner) (*models.FileVersion, error) {
+	var v models.FileVersion
+	err := row.Scan(&v.ID, &v.FileID, &v.Version, &v.BucketID, &v.ObjectKey, &v.Path, &v.FileSize, &v.ContentType, &v.Checksum, &v.ETag, &v.Encrypted, &v.DataKey, &v.ScanStatus, &v.ModifiedAt, &v.CreatedAt, &v.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (p *PostgresFileVersionRepository) CreateFileVersion(ctx context.Context, v *models.FileVersion) error {
+	return insertFileVersion(ctx, p.session, v)
+}
+
+func insertFileVersion(ctx context.Context, db execer, v *models.FileVersion) error {
+	v.ID = uuid.NewString()
+	v.CreatedAt = time.Now().UTC()
+	v.UpdatedAt = v.CreatedAt
+	_, err := db.ExecContext(
+		ctx,
+		"insert into file_version ("+fileVersionSelectColumns+") values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)",
+		v.ID, v.FileID, v.Version, v.BucketID, v.ObjectKey, v.Path, v.FileSize, v.ContentType, v.Checksum, v.ETag, v.Encrypted, v.DataKey, v.ScanStatus, v.ModifiedAt, v.CreatedAt, v.UpdatedAt)
+	return err
+}
+
+// PromoteFileVersion makes all three writes in one transaction, which locks
+// the file first so that it only moves on from the version previous records.
+func (p *PostgresFileVersionRepository) PromoteFileVersion(ctx context.Context, previous *models.FileVersion, file, staged *models.File) error {
+	tx, err := p.session.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var version int
+	if err := tx.QueryRowContext(ctx, "select version from file where id = $1 for update", file.ID).Scan(&version); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrVersionConflict
+		}
+		return err
+	}
+	if version != previous.Version {
+		return models.ErrVersionConflict
+	}
+	if err := insertFileVersion(ctx, tx, previous); err != nil {
+		return err
+	}
+	if err := updateFile(ctx, tx, file); err != nil {
+		return err
+	}
+	if err := deleteFile(ctx, tx, staged.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (p *PostgresFileVersionRepository) GetFileVersion(ctx context.Context, fileID string, version int) (*models.FileVersion, error) {
+	row := p.session.QueryRowContext(ctx, "select "+fileVersionSelectColumns+" from file_version where file_id = $1 and version = $2", fileID, version)
+	v, err := scanFileVersion(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return v, err
+}
+
+func (p *PostgresFileVersionRepository) UpdateFileVersion(ctx context.Context, v *models.FileVersion) error {
+	v.UpdatedAt = time.Now().UTC()
+	_, err := p.session.ExecContext(
+		ctx,
+		"update file_version set object_key = $1, path = $2, encrypted = $3, data_key = $4, scan_status = $5, updated_at = $6 where file_id = $7 and version = $8",
+		v.ObjectKey, v.Path, v.Encrypted, v.DataKey, v.ScanStatus, v.UpdatedAt, v.FileID, v.Version)
+	return err
+}
+
+func (p *PostgresFileVersionRepository) DeleteFileVersion(ctx context.Context, fileID string, version int) error {
+	_, err := p.session.ExecContext(ctx, "delete from file_version where file_id = $1 and version = $2", fileID, version)
+	return err
+}
+
+func (p *PostgresFileVersionRepository) ListFileVersions(ctx context.Context, fileID string) ([]*models.FileVersion, error) {
+	return p.queryFileVersions(ctx, "select "+fileVersionSelectColumns+" from file_version where file_id = $1 order by version desc", fileID)
+}
+
+func (p *PostgresFileVersionRepository) ListFileVersionsByObjectKey(ctx context.Context, objectKey string) ([]*models.FileVersion, error) {
+	return p.queryFileVersions(ctx, "select "+fileVersionSelectColumns+" from file_version where object_key = $1", objectKey)
+}
+
+func (p *PostgresFileVersionRepository) ListFileVersionsReplacedBefore(ctx context.Context, before time.Time) ([]*models.FileVersion, error) {
+	return p.queryFileVersions(ctx, "select "+fileVersionSelectColumns+" from file_version where created_at < $1", before)
+}
+
+func (p *PostgresFileVersionRepository) queryFileVersions(ctx context.Context, query string, args ...interface{}) ([]*models.FileVersion, error) {
+	rows, err := p.session.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []*models.FileVersion
+	for rows.Next() {
+		v, err := scanFileVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
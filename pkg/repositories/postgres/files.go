@@ -3,9 +3,15 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/lib/pq"
 )
 
 type PostgresFileRepository struct {
@@ -17,7 +23,13 @@ func NewPostgresFileRepository(session *sql.DB) *PostgresFileRepository {
 }
 
 func (s *PostgresFileRepository) CreateIndices(ctx context.Context) {
-	indexQueries := []string{}
+	indexQueries := []string{
+		"create index if not exists file_bucket_id_idx on file (bucket_id)",
+		"create index if not exists file_name_idx on file (name)",
+		"create index if not exists file_user_metadata_idx on file using gin (user_metadata)",
+		"create index if not exists file_tags_idx on file using gin (tags)",
+		"create index if not exists file_created_at_id_idx on file (created_at, id)",
+	}
 	for _, indexQuery := range indexQueries {
 		log.Printf("Executing index creation query: %s", indexQuery)
 		if _, err := s.session.ExecContext(ctx, indexQuery); err != nil {
@@ -25,38 +37,353 @@ func (s *PostgresFileRepository) CreateIndices(ctx context.Context) {
 		}
 	}
 }
+
+// fileSelect selects the columns read by scanFile, with the reference count:
+// the anonymous references in file_counter plus the holders in the ledger.
+const fileSelect = "select f.id, f.bucket_id, f.name, f.object_key, f.path, f.file_size, f.content_type, f.checksum, f.etag, f.status, f.file_size_limit, f.metadata, f.upload_policy, f.expires_at, f.encrypted, f.data_key, f.scan_status, f.scan_detail, f.user_metadata, f.tags, f.version, f.version_of, f.created_at, f.updated_at, coalesce(c.ref, 0) + (select count(*) from file_reference r where r.file_id = f.id) from file f left join file_counter c on c.id = f.id"
+
+func scanFile(row rowScanner) (*models.File, error) {
+	var file models.File
+	var uploadPolicy string
+	var userMetadata []byte
+	err := row.Scan(&file.ID, &file.BucketID, &file.Name, &file.ObjectKey, &file.Path, &file.FileSize, &file.ContentType, &file.Checksum, &file.ETag, &file.Status, &file.FileSizeLimit, &file.Metadata, &uploadPolicy, &file.ExpiresAt, &file.Encrypted, &file.DataKey, &file.ScanStatus, &file.ScanDetail, &userMetadata, pq.Array(&file.Tags), &file.Version, &file.VersionOf, &file.CreatedAt, &file.UpdatedAt, &file.References)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(userMetadata, &file.UserMetadata); err != nil {
+		return nil, err
+	}
+	if len(file.UserMetadata) == 0 {
+		file.UserMetadata = nil
+	}
+	if len(file.Tags) == 0 {
+		file.Tags = nil
+	}
+	if uploadPolicy != "" {
+		file.UploadPolicy = &models.UploadPolicy{}
+		if err := json.Unmarshal([]byte(uploadPolicy), file.UploadPolicy); err != nil {
+			return nil, err
+		}
+	}
+	return &file, nil
+}
+
+func encodeUploadPolicy(policy *models.UploadPolicy) (string, error) {
+	if policy == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(policy)
+	return string(data), err
+}
+
+// encodeUserMetadata returns the user metadata and tags of a file as column
+// values, empty rather than null when unset.
+func encodeUserMetadata(file *models.File) (string, interface{}, error) {
+	metadata := file.UserMetadata
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return "", nil, err
+	}
+	tags := file.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return string(data), pq.Array(tags), nil
+}
+
 func (p *PostgresFileRepository) GetFileByID(ctx context.Context, id string) (*models.File, error) {
-	panic("implement me")
+	return scanFile(p.session.QueryRowContext(ctx, fileSelect+" where f.id = $1", id))
 }
 
 func (p *PostgresFileRepository) GetFileByName(ctx context.Context, name string) (*models.File, error) {
-	panic("implement me")
+	return scanFile(p.session.QueryRowContext(ctx, fileSelect+" where f.name = $1", name))
 }
 
 func (p *PostgresFileRepository) CreateFile(ctx context.Context, file *models.File) error {
-	panic("implement me")
+	file.CreatedAt = time.Now().UTC()
+	file.UpdatedAt = file.CreatedAt
+	file.ID = file.Name
+	uploadPolicy, err := encodeUploadPolicy(file.UploadPolicy)
+	if err != nil {
+		return err
+	}
+	userMetadata, tags, err := encodeUserMetadata(file)
+	if err != nil {
+		return err
+	}
+	tx, err := p.session.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(
+		ctx,
+		"insert into file (id, bucket_id, name, object_key, path, file_size, content_type, checksum, etag, status, file_size_limit, metadata, upload_policy, expires_at, encrypted, data_key, scan_status, scan_detail, user_metadata, tags, version, version_of, created_at, updated_at) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24)",
+		file.ID, file.BucketID, file.Name, file.ObjectKey, file.Path, file.FileSize, file.ContentType, file.Checksum, file.ETag, file.Status, file.FileSizeLimit, file.Metadata, uploadPolicy, file.ExpiresAt, file.Encrypted, file.DataKey, file.ScanStatus, file.ScanDetail, userMetadata, tags, file.Version, file.VersionOf, file.CreatedAt, file.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "insert into file_counter (id, ref) values ($1, 1) on conflict (id) do update set ref = file_counter.ref + 1", file.ID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func (p *PostgresFileRepository) UpdateFile(ctx context.Context, file *models.File) error {
-	panic("implement me")
+	return updateFile(ctx, p.session, file)
+}
+
+func updateFile(ctx context.Context, db execer, file *models.File) error {
+	file.UpdatedAt = time.Now().UTC()
+	uploadPolicy, err := encodeUploadPolicy(file.UploadPolicy)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(
+		ctx,
+		"update file set bucket_id = $1, name = $2, object_key = $3, path = $4, file_size = $5, content_type = $6, checksum = $7, etag = $8, status = $9, file_size_limit = $10, metadata = $11, upload_policy = $12, expires_at = $13, encrypted = $14, data_key = $15, scan_status = $16, scan_detail = $17, version = $18, updated_at = $19 where id = $20",
+		file.BucketID, file.Name, file.ObjectKey, file.Path, file.FileSize, file.ContentType, file.Checksum, file.ETag, file.Status, file.FileSizeLimit, file.Metadata, uploadPolicy, file.ExpiresAt, file.Encrypted, file.DataKey, file.ScanStatus, file.ScanDetail, file.Version, file.UpdatedAt, file.ID)
+	return err
+}
+
+func (p *PostgresFileRepository) UpdateFileUserMetadata(ctx context.Context, file *models.File) error {
+	file.UpdatedAt = time.Now().UTC()
+	userMetadata, tags, err := encodeUserMetadata(file)
+	if err != nil {
+		return err
+	}
+	_, err = p.session.ExecContext(ctx, "update file set user_metadata = $1, tags = $2, updated_at = $3 where id = $4", userMetadata, tags, file.UpdatedAt, file.ID)
+	return err
 }
 
 func (p *PostgresFileRepository) DeleteFile(ctx context.Context, id string) error {
-	panic("implement me")
+	tx, err := p.session.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := deleteFile(ctx, tx, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// deleteFile removes a file with its counter and references; run it in a
+// transaction.
+func deleteFile(ctx context.Context, tx execer, id string) error {
+	if _, err := tx.ExecContext(ctx, "delete from file where id = $1", id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "delete from file_counter where id = $1", id); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "delete from file_reference where file_id = $1", id)
+	return err
+}
+
+func (p *PostgresFileRepository) ListFilesByChecksum(ctx context.Context, checksum string) ([]*models.File, error) {
+	return p.queryFiles(ctx, fileSelect+" where f.checksum = $1", checksum)
+}
+
+func (p *PostgresFileRepository) ListFilesByObjectKey(ctx context.Context, objectKey string) ([]*models.File, error) {
+	return p.queryFiles(ctx, fileSelect+" where f.object_key = $1", objectKey)
+}
+
+// ListFiles pages through the files matching filter in creation order. The
+// cursor holds the creation time and ID of the last file of the previous
+// page, so pages stay consistent while files are added.
+func (p *PostgresFileRepository) ListFiles(ctx context.Context, filter models.FileFilter, cursor string, limit int) ([]*models.File, string, error) {
+	var conditions []string
+	var args []interface{}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.BucketID != "" {
+		where("f.bucket_id = $%d", filter.BucketID)
+	}
+	if filter.Status != "" {
+		where("f.status = $%d", filter.Status)
+	}
+	if filter.ContentType != "" {
+		where("f.content_type = $%d", filter.ContentType)
+	}
+	if !filter.CreatedAfter.IsZero() {
+		where("f.created_at > $%d", filter.CreatedAfter)
+	}
+	if len(filter.Tags) > 0 {
+		where("f.tags @> $%d", pq.Array(filter.Tags))
+	}
+	if len(filter.Metadata) > 0 {
+		metadata, err := json.Marshal(filter.Metadata)
+		if err != nil {
+			return nil, "", err
+		}
+		where("f.user_metadata @> $%d::jsonb", string(metadata))
+	}
+	if cursor != "" {
+		createdAt, id, err := decodeFileCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		args = append(args, createdAt, id)
+		conditions = append(conditions, fmt.Sprintf("(f.created_at, f.id) > ($%d, $%d)", len(args)-1, len(args)))
+	}
+	query := fileSelect
+	if len(conditions) > 0 {
+		query += " where " + strings.Join(conditions, " and ")
+	}
+	// One extra row tells whether there is a next page.
+	args = append(args, limit+1)
+	query += fmt.Sprintf(" order by f.created_at, f.id limit $%d", len(args))
+
+	files, err := p.queryFiles(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(files) <= limit {
+		return files, "", nil
+	}
+	files = files[:limit]
+	last := files[len(files)-1]
+	return files, encodeFileCursor(last.CreatedAt, last.ID), nil
+}
+
+func encodeFileCursor(createdAt time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(createdAt.UTC().Format(time.RFC3339Nano) + "|" + id))
+}
+
+func decodeFileCursor(cursor string) (time.Time, string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", models.ErrInvalidCursor
+	}
+	timestamp, id, ok := strings.Cut(string(data), "|")
+	if !ok {
+		return time.Time{}, "", models.ErrInvalidCursor
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil {
+		return time.Time{}, "", models.ErrInvalidCursor
+	}
+	return createdAt, id, nil
+}
+
+func (p *PostgresFileRepository) ListPendingFiles(ctx context.Context, updatedBefore time.Time, cursor string, limit int) ([]*models.File, string, error) {
+	return p.queryFilePage(ctx, fileSelect+" where f.status in ('pending', 'uploading', 'deleting', 'deleted') and f.updated_at < $1", cursor, limit, updatedBefore)
+}
+
+func (p *PostgresFileRepository) ListExpiredFiles(ctx context.Context, expiredBefore time.Time, cursor string, limit int) ([]*models.File, string, error) {
+	return p.queryFilePage(ctx, fileSelect+" where f.expires_at < $1", cursor, limit, expiredBefore)
+}
+
+// queryFilePage reads the next limit files matching query, which takes its
+// filter as $1, ordered by ID. The cursor is the last ID read.
+func (p *PostgresFileRepository) queryFilePage(ctx context.Context, query, cursor string, limit int, filter interface{}) ([]*models.File, string, error) {
+	files, err := p.queryFiles(ctx, query+" and f.id > $2 order by f.id limit $3", filter, cursor, limit)
+	if err != nil || len(files) < limit {
+		return files, "", err
+	}
+	return files, files[len(files)-1].ID, nil
 }
 
-func (p *PostgresFileRepository) ListFiles(ctx context.Context, bucketID string) ([]*models.File, error) {
-	panic("implement me")
+func (p *PostgresFileRepository) queryFiles(ctx context.Context, query string, args ...interface{}) ([]*models.File, error) {
+	rows, err := p.session.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []*models.File
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, rows.Err()
 }
 
 func (p *PostgresFileRepository) AtomicIncrement(ctx context.Context, id string) error {
-	panic("implement me")
+	_, err := p.session.ExecContext(ctx, "insert into file_counter (id, ref) values ($1, 1) on conflict (id) do update set ref = file_counter.ref + 1", id)
+	return err
 }
 
 func (p *PostgresFileRepository) AtomicDecrement(ctx context.Context, id string) error {
-	panic("implement me")
+	result, err := p.session.ExecContext(ctx, "update file_counter set ref = ref - 1 where id = $1 and ref > 0", id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return models.ErrNoReferences
+	}
+	return nil
+}
+
+// AddFileReference records the holder. The holders are counted from the
+// ledger, so file_counter only keeps the anonymous references; the first
+// holder takes the one of the uploader over in the same transaction.
+func (p *PostgresFileRepository) AddFileReference(ctx context.Context, fileID, holder string) (bool, error) {
+	tx, err := p.session.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	result, err := tx.ExecContext(ctx, "insert into file_reference (file_id, holder, created_at) values ($1, $2, $3) on conflict (file_id, holder) do nothing", fileID, holder, time.Now().UTC())
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil || rows == 0 {
+		return false, err
+	}
+	_, err = tx.ExecContext(ctx, "update file_counter set ref = greatest(ref - 1, 0), creation_handed_over = true where id = $1 and not creation_handed_over", fileID)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (p *PostgresFileRepository) RemoveFileReference(ctx context.Context, fileID, holder string) (bool, error) {
+	result, err := p.session.ExecContext(ctx, "delete from file_reference where file_id = $1 and holder = $2", fileID, holder)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+func (p *PostgresFileRepository) ListFileReferences(ctx context.Context, fileID string) ([]*models.FileReference, error) {
+	rows, err := p.session.QueryContext(ctx, "select file_id, holder, created_at from file_reference where file_id = $1 order by created_at, holder", fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var references []*models.FileReference
+	for rows.Next() {
+		var ref models.FileReference
+		if err := rows.Scan(&ref.FileID, &ref.Holder, &ref.CreatedAt); err != nil {
+			return nil, err
+		}
+		references = append(references, &ref)
+	}
+	return references, rows.Err()
 }
 
 func (p *PostgresFileRepository) GetFileReferenceCount(ctx context.Context, fileID string) (int64, error) {
-	panic("implement me")
+	var refCount int64
+	err := p.session.QueryRowContext(ctx, "select coalesce((select ref from file_counter where id = $1), 0) + (select count(*) from file_reference where file_id = $1)", fileID).Scan(&refCount)
+	if err != nil {
+		return 0, err
+	}
+	return refCount, nil
 }
@@ -0,0 +1,113 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/google/uuid"
+)
+
+type PostgresIdempotencyRepository struct {
+	session *sql.DB
+}
+
+func NewPostgresIdempotencyRepository(session *sql.DB) *PostgresIdempotencyRepository {
+	return &PostgresIdempotencyRepository{session: session}
+}
+
+func (p *PostgresIdempotencyRepository) CreateIndices(ctx context.Context) {
+	indexQueries := []string{
+		"create index if not exists idempotency_record_expires_at_idx on idempotency_record (expires_at)",
+	}
+	for _, indexQuery := range indexQueries {
+		log.Printf("Executing index creation query: %s", indexQuery)
+		if _, err := p.session.ExecContext(ctx, indexQuery); err != nil {
+			log.Printf("Error creating index: %v", err)
+		}
+	}
+}
+
+const idempotencyRecordSelectColumns = "id, token_id, idempotency_key, fingerprint, status_code, content_type, headers, body, expires_at, created_at, updated_at"
+
+func encodeHeaders(record *models.IdempotencyRecord) (string, error) {
+	headers := record.Headers
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	data, err := json.Marshal(headers)
+	return string(data), err
+}
+
+// CreateIdempotencyRecord inserts record, taking over the row of an expired
+// record for the same token and key.
+func (p *PostgresIdempotencyRepository) CreateIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecord) (bool, error) {
+	record.ID = uuid.NewString()
+	record.CreatedAt = time.Now().UTC()
+	record.UpdatedAt = record.CreatedAt
+	headers, err := encodeHeaders(record)
+	if err != nil {
+		return false, err
+	}
+	result, err := p.session.ExecContext(
+		ctx,
+		"insert into idempotency_record ("+idempotencyRecordSelectColumns+") values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) "+
+			"on conflict (token_id, idempotency_key) do update set id = excluded.id, fingerprint = excluded.fingerprint, status_code = excluded.status_code, content_type = excluded.content_type, headers = excluded.headers, body = excluded.body, expires_at = excluded.expires_at, created_at = excluded.created_at, updated_at = excluded.updated_at "+
+			"where idempotency_record.expires_at <= excluded.created_at",
+		record.ID, record.TokenID, record.Key, record.Fingerprint, record.StatusCode, record.ContentType, headers, record.Body, record.ExpiresAt, record.CreatedAt, record.UpdatedAt)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+func (p *PostgresIdempotencyRepository) GetIdempotencyRecord(ctx context.Context, tokenID, key string) (*models.IdempotencyRecord, error) {
+	var r models.IdempotencyRecord
+	var headers string
+	err := p.session.QueryRowContext(
+		ctx,
+		"select "+idempotencyRecordSelectColumns+" from idempotency_record where token_id = $1 and idempotency_key = $2 and expires_at > $3",
+		tokenID, key, time.Now().UTC()).
+		Scan(&r.ID, &r.TokenID, &r.Key, &r.Fingerprint, &r.StatusCode, &r.ContentType, &headers, &r.Body, &r.ExpiresAt, &r.CreatedAt, &r.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(headers), &r.Headers); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (p *PostgresIdempotencyRepository) UpdateIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecord) error {
+	record.UpdatedAt = time.Now().UTC()
+	headers, err := encodeHeaders(record)
+	if err != nil {
+		return err
+	}
+	_, err = p.session.ExecContext(
+		ctx,
+		"update idempotency_record set status_code = $1, content_type = $2, headers = $3, body = $4, updated_at = $5 where token_id = $6 and idempotency_key = $7 and id = $8",
+		record.StatusCode, record.ContentType, headers, record.Body, record.UpdatedAt, record.TokenID, record.Key, record.ID)
+	return err
+}
+
+func (p *PostgresIdempotencyRepository) DeleteIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecord) error {
+	_, err := p.session.ExecContext(ctx, "delete from idempotency_record where token_id = $1 and idempotency_key = $2 and id = $3", record.TokenID, record.Key, record.ID)
+	return err
+}
+
+func (p *PostgresIdempotencyRepository) DeleteExpiredIdempotencyRecords(ctx context.Context, before time.Time) error {
+	_, err := p.session.ExecContext(ctx, "delete from idempotency_record where expires_at <= $1", before)
+	return err
+}
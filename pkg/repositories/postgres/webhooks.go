@@ -0,0 +1,198 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/google/uuid"
+)
+
+type PostgresWebhookRepository struct {
+	session *sql.DB
+}
+
+func NewPostgresWebhookRepository(session *sql.DB) *PostgresWebhookRepository {
+	return &PostgresWebhookRepository{session: session}
+}
+
+func (p *PostgresWebhookRepository) CreateIndices(ctx context.Context) {
+	indexQueries := []string{
+		"create index if not exists webhook_delivery_webhook_id_idx on webhook_delivery (webhook_id)",
+		"create index if not exists webhook_delivery_due_idx on webhook_delivery (next_attempt_at) where status = 'pending'",
+	}
+	for _, indexQuery := range indexQueries {
+		log.Printf("Executing index creation query: %s", indexQuery)
+		if _, err := p.session.ExecContext(ctx, indexQuery); err != nil {
+			log.Printf("Error creating index: %v", err)
+		}
+	}
+}
+
+const webhookSelectColumns = "id, url, secret, events, enabled, created_at, updated_at"
+
+func scanWebhook(row rowScanner) (*models.Webhook, error) {
+	var webhook models.Webhook
+	var events string
+	err := row.Scan(&webhook.ID, &webhook.URL, &webhook.Secret, &events, &webhook.Enabled, &webhook.CreatedAt, &webhook.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(events), &webhook.Events); err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (p *PostgresWebhookRepository) GetWebhookByID(ctx context.Context, id string) (*models.Webhook, error) {
+	row := p.session.QueryRowContext(ctx, "select "+webhookSelectColumns+" from webhook where id = $1", id)
+	webhook, err := scanWebhook(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return webhook, err
+}
+
+func (p *PostgresWebhookRepository) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	now := time.Now().UTC()
+	webhook.ID = uuid.NewString()
+	webhook.CreatedAt = now
+	webhook.UpdatedAt = now
+	events, err := json.Marshal(webhook.Events)
+	if err != nil {
+		return err
+	}
+	_, err = p.session.ExecContext(
+		ctx,
+		"insert into webhook (id, url, secret, events, enabled, created_at, updated_at) values ($1, $2, $3, $4, $5, $6, $7)",
+		webhook.ID, webhook.URL, webhook.Secret, string(events), webhook.Enabled, webhook.CreatedAt, webhook.UpdatedAt)
+	return err
+}
+
+func (p *PostgresWebhookRepository) UpdateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	webhook.UpdatedAt = time.Now().UTC()
+	events, err := json.Marshal(webhook.Events)
+	if err != nil {
+		return err
+	}
+	_, err = p.session.ExecContext(
+		ctx,
+		"update webhook set url = $1, secret = $2, events = $3, enabled = $4, updated_at = $5 where id = $6",
+		webhook.URL, webhook.Secret, string(events), webhook.Enabled, webhook.UpdatedAt, webhook.ID)
+	return err
+}
+
+func (p *PostgresWebhookRepository) DeleteWebhook(ctx context.Context, id string) error {
+	_, err := p.session.ExecContext(ctx, "delete from webhook where id = $1", id)
+	return err
+}
+
+func (p *PostgresWebhookRepository) ListWebhooks(ctx context.Context) ([]*models.Webhook, error) {
+	rows, err := p.session.QueryContext(ctx, "select "+webhookSelectColumns+" from webhook order by created_at")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []*models.Webhook
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+const deliverySelectColumns = "id, webhook_id, event_id, event, payload, status, attempts, next_attempt_at, response_status, last_error, created_at, updated_at"
+
+func scanDelivery(row rowScanner) (*models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	err := row.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.NextAttemptAt, &d.ResponseStatus, &d.LastError, &d.CreatedAt, &d.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (p *PostgresWebhookRepository) CreateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	delivery.ID = uuid.NewString()
+	delivery.CreatedAt = time.Now().UTC()
+	delivery.UpdatedAt = delivery.CreatedAt
+	_, err := p.session.ExecContext(
+		ctx,
+		"insert into webhook_delivery ("+deliverySelectColumns+") values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)",
+		delivery.ID, delivery.WebhookID, delivery.EventID, string(delivery.Event), delivery.Payload, string(delivery.Status), delivery.Attempts, delivery.NextAttemptAt, delivery.ResponseStatus, delivery.LastError, delivery.CreatedAt, delivery.UpdatedAt)
+	return err
+}
+
+func (p *PostgresWebhookRepository) GetDeliveryByID(ctx context.Context, id string) (*models.WebhookDelivery, error) {
+	row := p.session.QueryRowContext(ctx, "select "+deliverySelectColumns+" from webhook_delivery where id = $1", id)
+	delivery, err := scanDelivery(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return delivery, err
+}
+
+func (p *PostgresWebhookRepository) UpdateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	delivery.UpdatedAt = time.Now().UTC()
+	_, err := p.session.ExecContext(
+		ctx,
+		"update webhook_delivery set status = $1, attempts = $2, next_attempt_at = $3, response_status = $4, last_error = $5, updated_at = $6 where id = $7",
+		string(delivery.Status), delivery.Attempts, delivery.NextAttemptAt, delivery.ResponseStatus, delivery.LastError, delivery.UpdatedAt, delivery.ID)
+	return err
+}
+
+func (p *PostgresWebhookRepository) ClaimDelivery(ctx context.Context, delivery *models.WebhookDelivery, until time.Time) (bool, error) {
+	result, err := p.session.ExecContext(
+		ctx,
+		"update webhook_delivery set next_attempt_at = $1 where id = $2 and status = $3 and next_attempt_at = $4",
+		until, delivery.ID, string(models.DeliveryStatusPending), delivery.NextAttemptAt)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil || rows == 0 {
+		return false, err
+	}
+	delivery.NextAttemptAt = until
+	return true, nil
+}
+
+func (p *PostgresWebhookRepository) DeleteDeliveriesByWebhookID(ctx context.Context, webhookID string) error {
+	_, err := p.session.ExecContext(ctx, "delete from webhook_delivery where webhook_id = $1", webhookID)
+	return err
+}
+
+// ListDeliveriesByWebhookID returns the deliveries of a webhook, newest first.
+func (p *PostgresWebhookRepository) ListDeliveriesByWebhookID(ctx context.Context, webhookID string) ([]*models.WebhookDelivery, error) {
+	return p.queryDeliveries(ctx, "select "+deliverySelectColumns+" from webhook_delivery where webhook_id = $1 order by created_at desc", webhookID)
+}
+
+func (p *PostgresWebhookRepository) ListDueDeliveries(ctx context.Context, dueBefore time.Time) ([]*models.WebhookDelivery, error) {
+	return p.queryDeliveries(ctx, "select "+deliverySelectColumns+" from webhook_delivery where status = $1 and next_attempt_at < $2 order by next_attempt_at", string(models.DeliveryStatusPending), dueBefore)
+}
+
+func (p *PostgresWebhookRepository) queryDeliveries(ctx context.Context, query string, args ...interface{}) ([]*models.WebhookDelivery, error) {
+	rows, err := p.session.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*models.WebhookDelivery
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
@@ -32,11 +32,11 @@ func (s *ScyllaBucketRepository) CreateIndices(ctx context.Context) {
 	}
 }
 func (s *ScyllaBucketRepository) GetBucketByID(ctx context.Context, id string) (*models.Bucket, error) {
-	query := s.session.Query("select id, name, region, endpoint, s3_provider, access_key, secret_key, storage_type, use_ssl, custom_config, created_at, updated_at from bucket where id = ?", id).
+	query := s.session.Query("select id, name, region, endpoint, s3_provider, access_key, secret_key, storage_type, use_ssl, custom_config, deduplicate, encrypt, created_at, updated_at from bucket where id = ?", id).
 		WithContext(ctx)
 	var bucket models.Bucket
 	var storageType int8
-	if err := query.Scan(&bucket.ID, &bucket.Name, &bucket.Region, &bucket.Endpoint, &bucket.S3Provider, &bucket.AccessKey, &bucket.SecretKey, &storageType, &bucket.UseSSL, &bucket.CustomConfig, &bucket.CreatedAt, &bucket.UpdatedAt); err != nil {
+	if err := query.Scan(&bucket.ID, &bucket.Name, &bucket.Region, &bucket.Endpoint, &bucket.S3Provider, &bucket.AccessKey, &bucket.SecretKey, &storageType, &bucket.UseSSL, &bucket.CustomConfig, &bucket.Deduplicate, &bucket.Encrypt, &bucket.CreatedAt, &bucket.UpdatedAt); err != nil {
 		if errors.Is(err, gocql.ErrNotFound) {
 			return nil, nil
 		}
@@ -47,11 +47,11 @@ func (s *ScyllaBucketRepository) GetBucketByID(ctx context.Context, id string) (
 }
 
 func (s *ScyllaBucketRepository) GetBucketByName(ctx context.Context, name string) (*models.Bucket, error) {
-	query := s.session.Query("select id, name, region, endpoint, s3_provider, access_key, secret_key, storage_type, use_ssl, custom_config, created_at, updated_at from bucket where name = ?", name).
+	query := s.session.Query("select id, name, region, endpoint, s3_provider, access_key, secret_key, storage_type, use_ssl, custom_config, deduplicate, encrypt, created_at, updated_at from bucket where name = ?", name).
 		WithContext(ctx)
 	var bucket models.Bucket
 	var storageType int8
-	if err := query.Scan(&bucket.ID, &bucket.Name, &bucket.Region, &bucket.Endpoint, &bucket.S3Provider, &bucket.AccessKey, &bucket.SecretKey, &storageType, &bucket.UseSSL, &bucket.CustomConfig, &bucket.CreatedAt, &bucket.UpdatedAt); err != nil {
+	if err := query.Scan(&bucket.ID, &bucket.Name, &bucket.Region, &bucket.Endpoint, &bucket.S3Provider, &bucket.AccessKey, &bucket.SecretKey, &storageType, &bucket.UseSSL, &bucket.CustomConfig, &bucket.Deduplicate, &bucket.Encrypt, &bucket.CreatedAt, &bucket.UpdatedAt); err != nil {
 		if errors.Is(err, gocql.ErrNotFound) {
 			return nil, nil
 		}
@@ -67,16 +67,16 @@ func (s *ScyllaBucketRepository) CreateBucket(ctx context.Context, bucket *model
 	bucket.UpdatedAt = now
 	bucket.ID = uuid.NewString()
 	query := s.session.Query(
-		"insert into bucket (id, name, region, endpoint, s3_provider, access_key, secret_key, storage_type, use_ssl, custom_config, created_at, updated_at) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
-		bucket.ID, bucket.Name, bucket.Region, bucket.Endpoint, bucket.S3Provider, bucket.AccessKey, bucket.SecretKey, bucket.StorageType, bucket.UseSSL, bucket.CustomConfig, bucket.CreatedAt, bucket.UpdatedAt).
+		"insert into bucket (id, name, region, endpoint, s3_provider, access_key, secret_key, storage_type, use_ssl, custom_config, deduplicate, encrypt, created_at, updated_at) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		bucket.ID, bucket.Name, bucket.Region, bucket.Endpoint, bucket.S3Provider, bucket.AccessKey, bucket.SecretKey, bucket.StorageType, bucket.UseSSL, bucket.CustomConfig, bucket.Deduplicate, bucket.Encrypt, bucket.CreatedAt, bucket.UpdatedAt).
 		WithContext(ctx)
 	return query.Exec()
 }
 
 func (s *ScyllaBucketRepository) UpdateBucket(ctx context.Context, bucket *models.Bucket) error {
 	query := s.session.Query(
-		"update bucket set name = ?, region = ?, endpoint = ?, s3_provider = ?, access_key = ?, secret_key = ?, storage_type = ?, use_ssl = ?, custom_config = ?, updated_at = ? where id = ?",
-		bucket.Name, bucket.Region, bucket.Endpoint, bucket.S3Provider, bucket.AccessKey, bucket.SecretKey, bucket.StorageType, bucket.UseSSL, bucket.CustomConfig, time.Now(), bucket.ID).
+		"update bucket set name = ?, region = ?, endpoint = ?, s3_provider = ?, access_key = ?, secret_key = ?, storage_type = ?, use_ssl = ?, custom_config = ?, deduplicate = ?, encrypt = ?, updated_at = ? where id = ?",
+		bucket.Name, bucket.Region, bucket.Endpoint, bucket.S3Provider, bucket.AccessKey, bucket.SecretKey, bucket.StorageType, bucket.UseSSL, bucket.CustomConfig, bucket.Deduplicate, bucket.Encrypt, time.Now(), bucket.ID).
 		WithContext(ctx)
 	return query.Exec()
 }
@@ -86,7 +86,7 @@ func (s *ScyllaBucketRepository) DeleteBucket(ctx context.Context, id string) er
 }
 
 func (s *ScyllaBucketRepository) ListBuckets(ctx context.Context) ([]*models.Bucket, error) {
-	iter := s.session.Query("select id, name, region, endpoint, s3_provider, access_key, secret_key, storage_type, use_ssl, custom_config, created_at, updated_at from bucket").WithContext(ctx).Iter()
+	iter := s.session.Query("select id, name, region, endpoint, s3_provider, access_key, secret_key, storage_type, use_ssl, custom_config, deduplicate, encrypt, created_at, updated_at from bucket").WithContext(ctx).Iter()
 
 	estimatedSize := iter.NumRows()
 	buckets := make([]*models.Bucket, 0, estimatedSize)
@@ -95,7 +95,7 @@ func (s *ScyllaBucketRepository) ListBuckets(ctx context.Context) ([]*models.Buc
 		bucket := &models.Bucket{}
 		var storageType int8
 
-		if !iter.Scan(&bucket.ID, &bucket.Name, &bucket.Region, &bucket.Endpoint, &bucket.S3Provider, &bucket.AccessKey, &bucket.SecretKey, &storageType, &bucket.UseSSL, &bucket.CustomConfig, &bucket.CreatedAt, &bucket.UpdatedAt) {
+		if !iter.Scan(&bucket.ID, &bucket.Name, &bucket.Region, &bucket.Endpoint, &bucket.S3Provider, &bucket.AccessKey, &bucket.SecretKey, &storageType, &bucket.UseSSL, &bucket.CustomConfig, &bucket.Deduplicate, &bucket.Encrypt, &bucket.CreatedAt, &bucket.UpdatedAt) {
 			break
 		}
 
@@ -2,6 +2,7 @@ package scylla
 
 import (
 	"context"
+	"encoding/json"
 	"log"
 	"time"
 
@@ -20,7 +21,6 @@ func NewScyllaFileBlobRepository(session *gocql.Session) *ScyllaFileBlobReposito
 func (s *ScyllaFileBlobRepository) CreateIndices(ctx context.Context) {
 	indexQueries := []string{
 		"CREATE INDEX IF NOT EXISTS fileblob_file_id_idx ON fileblob (file_id)",
-		"ALTER TABLE fileblob WITH default_time_to_live = 600",
 	}
 	for _, indexQuery := range indexQueries {
 		log.Printf("Executing index creation query: %s", indexQuery)
@@ -34,22 +34,107 @@ func (s *ScyllaFileBlobRepository) CreateFileBlob(ctx context.Context, blob *mod
 	blob.ID = gocql.TimeUUID().String()
 	blob.CreatedAt = time.Now().UTC()
 	blob.UpdatedAt = blob.CreatedAt
-	query := "INSERT INTO fileblob (id, created_at, file_id, updated_at) VALUES (?, ?, ?, ?)"
-	if err := s.session.Query(query, blob.ID, blob.CreatedAt, blob.FileID, blob.UpdatedAt).WithContext(ctx).Exec(); err != nil {
+	if err := s.insertFileBlob(ctx, blob); err != nil {
 		return nil, err
 	}
 	return blob, nil
 }
 
+const fileBlobSelectColumns = "id, created_at, file_id, updated_at, upload_id, upload_offset, upload_length, content_type, parts, hash_state, finalized"
+
+// fileBlobRow receives the columns listed by fileBlobSelectColumns.
+type fileBlobRow struct {
+	blob  models.FileBlob
+	parts string
+}
+
+func (r *fileBlobRow) dest() []interface{} {
+	b := &r.blob
+	return []interface{}{&b.ID, &b.CreatedAt, &b.FileID, &b.UpdatedAt, &b.UploadID, &b.UploadOffset, &b.UploadLength, &b.ContentType, &r.parts, &b.HashState, &b.Finalized}
+}
+
+func (r *fileBlobRow) decode() (*models.FileBlob, error) {
+	blob := r.blob
+	if r.parts != "" {
+		if err := json.Unmarshal([]byte(r.parts), &blob.Parts); err != nil {
+			return nil, err
+		}
+	}
+	return &blob, nil
+}
+
 func (s *ScyllaFileBlobRepository) GetFileBlobByID(ctx context.Context, id string) (*models.FileBlob, error) {
-	query := "SELECT id, created_at, file_id, updated_at FROM fileblob WHERE id = ?"
-	row := s.session.Query(query, id).WithContext(ctx)
-	var blob models.FileBlob
-	err := row.Scan(&blob.ID, &blob.CreatedAt, &blob.FileID, &blob.UpdatedAt)
-	if err != nil {
+	query := "SELECT " + fileBlobSelectColumns + " FROM fileblob WHERE id = ?"
+	var row fileBlobRow
+	if err := s.session.Query(query, id).WithContext(ctx).Scan(row.dest()...); err != nil {
 		return nil, err
 	}
-	return &blob, nil
+	return row.decode()
+}
+
+func (s *ScyllaFileBlobRepository) ListFileBlobsByFileID(ctx context.Context, fileID string) ([]*models.FileBlob, error) {
+	query := "SELECT " + fileBlobSelectColumns + " FROM fileblob WHERE file_id = ?"
+	return s.queryFileBlobs(ctx, query, fileID)
+}
+
+// ListExpiredFileBlobs scans for blobs last written before updatedBefore.
+func (s *ScyllaFileBlobRepository) ListExpiredFileBlobs(ctx context.Context, updatedBefore time.Time) ([]*models.FileBlob, error) {
+	query := "SELECT " + fileBlobSelectColumns + " FROM fileblob WHERE updated_at < ? ALLOW FILTERING"
+	return s.queryFileBlobs(ctx, query, updatedBefore)
+}
+
+func (s *ScyllaFileBlobRepository) queryFileBlobs(ctx context.Context, query string, args ...interface{}) ([]*models.FileBlob, error) {
+	iter := s.session.Query(query, args...).WithContext(ctx).Iter()
+	defer iter.Close()
+
+	var blobs []*models.FileBlob
+	for {
+		var row fileBlobRow
+		if !iter.Scan(row.dest()...) {
+			break
+		}
+		blob, err := row.decode()
+		if err != nil {
+			return nil, err
+		}
+		blobs = append(blobs, blob)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return blobs, nil
+}
+
+// UpdateFileBlob rewrites the whole row rather than updating single columns:
+// rows written while fileblob had a default TTL keep expiring, and an upsert
+// keeps every cell on the same expiry so an active upload session does not
+// lose its file_id mid-way.
+func (s *ScyllaFileBlobRepository) UpdateFileBlob(ctx context.Context, blob *models.FileBlob) error {
+	blob.UpdatedAt = time.Now().UTC()
+	return s.insertFileBlob(ctx, blob)
+}
+
+func (s *ScyllaFileBlobRepository) insertFileBlob(ctx context.Context, blob *models.FileBlob) error {
+	parts, err := json.Marshal(blob.Parts)
+	if err != nil {
+		return err
+	}
+	query := "INSERT INTO fileblob (id, created_at, file_id, updated_at, upload_id, upload_offset, upload_length, content_type, parts, hash_state, finalized) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	return s.session.Query(query, blob.ID, blob.CreatedAt, blob.FileID, blob.UpdatedAt, blob.UploadID, blob.UploadOffset, blob.UploadLength, blob.ContentType, string(parts), blob.HashState, blob.Finalized).WithContext(ctx).Exec()
+}
+
+// UpdateFileBlobAtOffset checks the offset with a lightweight transaction.
+// Only an INSERT can be conditional on the row not existing, so it updates
+// every column instead, which keeps them on the same expiry like the upsert
+// of UpdateFileBlob.
+func (s *ScyllaFileBlobRepository) UpdateFileBlobAtOffset(ctx context.Context, blob *models.FileBlob, offset int64) (bool, error) {
+	blob.UpdatedAt = time.Now().UTC()
+	parts, err := json.Marshal(blob.Parts)
+	if err != nil {
+		return false, err
+	}
+	query := "UPDATE fileblob SET created_at = ?, file_id = ?, updated_at = ?, upload_id = ?, upload_offset = ?, upload_length = ?, content_type = ?, parts = ?, hash_state = ?, finalized = ? WHERE id = ? IF upload_offset = ?"
+	return s.session.Query(query, blob.CreatedAt, blob.FileID, blob.UpdatedAt, blob.UploadID, blob.UploadOffset, blob.UploadLength, blob.ContentType, string(parts), blob.HashState, blob.Finalized, blob.ID, offset).WithContext(ctx).MapScanCAS(map[string]interface{}{})
 }
 
 func (s *ScyllaFileBlobRepository) DeleteFileBlobByID(ctx context.Context, id string) error {
@@ -0,0 +1,156 @@
+package scylla
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/gocql/gocql"
+	"github.com/google/uuid"
+)
+
+type ScyllaFileVersionRepository struct {
+	session *gocql.Session
+}
+
+func NewScyllaFileVersionRepository(session *gocql.Session) *ScyllaFileVersionRepository {
+	return &ScyllaFileVersionRepository{session: session}
+}
+
+func (s *ScyllaFileVersionRepository) CreateIndices(ctx context.Context) {
+	indexQueries := []string{
+		"CREATE INDEX IF NOT EXISTS file_version_object_key_idx ON file_version (object_key)",
+	}
+	for _, indexQuery := range indexQueries {
+		log.Printf("Executing index creation query: %s", indexQuery)
+		if err := s.session.Query(indexQuery).WithContext(ctx).Exec(); err != nil {
+			log.Printf("Error creating index: %v", err)
+		}
+	}
+}
+
+const fileVersionSelectColumns = "id, file_id, version, bucket_id, object_key, path, file_size, content_type, checksum, etag, encrypted, data_key, scan_status, modified_at, created_at, updated_at"
+
+func fileVersionDest(v *models.FileVersion) []interface{} {
+	return []interface{}{&v.ID, &v.FileID, &v.Version, &v.BucketID, &v.ObjectKey, &v.Path, &v.FileSize, &v.ContentType, &v.Checksum, &v.ETag, &v.Encrypted, &v.DataKey, &v.ScanStatus, &v.ModifiedAt, &v.CreatedAt, &v.UpdatedAt}
+}
+
+func (s *ScyllaFileVersionRepository) CreateFileVersion(ctx context.Context, v *models.FileVersion) error {
+	v.ID = uuid.NewString()
+	v.CreatedAt = time.Now().UTC()
+	v.UpdatedAt = v.CreatedAt
+	return s.session.Query(
+		"INSERT INTO file_version ("+fileVersionSelectColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		v.ID, v.FileID, v.Version, v.BucketID, v.ObjectKey, v.Path, v.FileSize, v.ContentType, v.Checksum, v.ETag, v.Encrypted, v.DataKey, string(v.ScanStatus), v.ModifiedAt, v.CreatedAt, v.UpdatedAt).
+		WithContext(ctx).Exec()
+}
+
+// PromoteFileVersion orders its writes so that every state an interruption
+// can leave behind is safe. The staged record is stored as active first, so
+// the sweeper no longer treats it as an upload to discard along with its
+// object; the version is recorded before the file moves to the new content,
+// and the staged record is removed last. An interrupted promotion leaves an
+// extra version or an active staged record, never a file without content.
+//
+// The version and the file are written with lightweight transactions, so of
+// concurrent promotions of a file only the first to claim its version moves
+// the file; the others get models.ErrVersionConflict.
+func (s *ScyllaFileVersionRepository) PromoteFileVersion(ctx context.Context, previous *models.FileVersion, file, staged *models.File) error {
+	files := NewScyllaFileRepository(s.session)
+	if err := files.UpdateFile(ctx, staged); err != nil {
+		return err
+	}
+	created, err := s.createFileVersionIfNotExists(ctx, previous)
+	if err != nil {
+		return err
+	}
+	if !created {
+		return models.ErrVersionConflict
+	}
+	updated, err := files.updateFileAtVersion(ctx, file, previous.Version)
+	if err == nil && !updated {
+		err = models.ErrVersionConflict
+	}
+	if err != nil {
+		if err := s.DeleteFileVersion(ctx, previous.FileID, previous.Version); err != nil {
+			log.Printf("Failed to drop version %d of file %s: %v", previous.Version, previous.FileID, err)
+		}
+		return err
+	}
+	if err := files.DeleteFile(ctx, staged.ID); err != nil {
+		log.Printf("Failed to remove staged version %s of file %s: %v", staged.ID, file.ID, err)
+	}
+	return nil
+}
+
+// createFileVersionIfNotExists records v unless the file already has a
+// version with its number, and reports whether it did.
+func (s *ScyllaFileVersionRepository) createFileVersionIfNotExists(ctx context.Context, v *models.FileVersion) (bool, error) {
+	v.ID = uuid.NewString()
+	v.CreatedAt = time.Now().UTC()
+	v.UpdatedAt = v.CreatedAt
+	return s.session.Query(
+		"INSERT INTO file_version ("+fileVersionSelectColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) IF NOT EXISTS",
+		v.ID, v.FileID, v.Version, v.BucketID, v.ObjectKey, v.Path, v.FileSize, v.ContentType, v.Checksum, v.ETag, v.Encrypted, v.DataKey, string(v.ScanStatus), v.ModifiedAt, v.CreatedAt, v.UpdatedAt).
+		WithContext(ctx).MapScanCAS(map[string]interface{}{})
+}
+
+func (s *ScyllaFileVersionRepository) GetFileVersion(ctx context.Context, fileID string, version int) (*models.FileVersion, error) {
+	var v models.FileVersion
+	query := "SELECT " + fileVersionSelectColumns + " FROM file_version WHERE file_id = ? AND version = ?"
+	if err := s.session.Query(query, fileID, version).WithContext(ctx).Scan(fileVersionDest(&v)...); err != nil {
+		if errors.Is(err, gocql.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (s *ScyllaFileVersionRepository) UpdateFileVersion(ctx context.Context, v *models.FileVersion) error {
+	v.UpdatedAt = time.Now().UTC()
+	return s.session.Query(
+		"UPDATE file_version SET object_key = ?, path = ?, encrypted = ?, data_key = ?, scan_status = ?, updated_at = ? WHERE file_id = ? AND version = ?",
+		v.ObjectKey, v.Path, v.Encrypted, v.DataKey, string(v.ScanStatus), v.UpdatedAt, v.FileID, v.Version).
+		WithContext(ctx).Exec()
+}
+
+func (s *ScyllaFileVersionRepository) DeleteFileVersion(ctx context.Context, fileID string, version int) error {
+	return s.session.Query("DELETE FROM file_version WHERE file_id = ? AND version = ?", fileID, version).WithContext(ctx).Exec()
+}
+
+// ListFileVersions returns the versions of a file, newest first as the table
+// is clustered.
+func (s *ScyllaFileVersionRepository) ListFileVersions(ctx context.Context, fileID string) ([]*models.FileVersion, error) {
+	return s.queryFileVersions(ctx, "SELECT "+fileVersionSelectColumns+" FROM file_version WHERE file_id = ?", fileID)
+}
+
+func (s *ScyllaFileVersionRepository) ListFileVersionsByObjectKey(ctx context.Context, objectKey string) ([]*models.FileVersion, error) {
+	return s.queryFileVersions(ctx, "SELECT "+fileVersionSelectColumns+" FROM file_version WHERE object_key = ?", objectKey)
+}
+
+// ListFileVersionsReplacedBefore scans for versions replaced before the given
+// time.
+func (s *ScyllaFileVersionRepository) ListFileVersionsReplacedBefore(ctx context.Context, before time.Time) ([]*models.FileVersion, error) {
+	return s.queryFileVersions(ctx, "SELECT "+fileVersionSelectColumns+" FROM file_version WHERE created_at < ? ALLOW FILTERING", before)
+}
+
+func (s *ScyllaFileVersionRepository) queryFileVersions(ctx context.Context, query string, args ...interface{}) ([]*models.FileVersion, error) {
+	iter := s.session.Query(query, args...).WithContext(ctx).Iter()
+	defer iter.Close()
+
+	var versions []*models.FileVersion
+	for {
+		v := &models.FileVersion{}
+		if !iter.Scan(fileVersionDest(v)...) {
+			break
+		}
+		versions = append(versions, v)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
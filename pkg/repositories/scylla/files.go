@@ -2,7 +2,11 @@ package scylla
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/argon-chat/KineticaFS/pkg/models"
@@ -21,6 +25,10 @@ func (s *ScyllaFileRepository) CreateIndices(ctx context.Context) {
 	indexQueries := []string{
 		"CREATE INDEX IF NOT EXISTS file_bucket_id_idx ON file (bucket_id)",
 		"CREATE INDEX IF NOT EXISTS file_name_idx ON file (name)",
+		"CREATE INDEX IF NOT EXISTS file_checksum_idx ON file (checksum)",
+		"CREATE INDEX IF NOT EXISTS file_object_key_idx ON file (object_key)",
+		"CREATE INDEX IF NOT EXISTS file_tags_idx ON file (VALUES(tags))",
+		"CREATE INDEX IF NOT EXISTS file_user_metadata_idx ON file (ENTRIES(user_metadata))",
 	}
 	for _, indexQuery := range indexQueries {
 		log.Printf("Executing index creation query: %s", indexQuery)
@@ -30,26 +38,123 @@ func (s *ScyllaFileRepository) CreateIndices(ctx context.Context) {
 	}
 }
 
+// fileRow receives the columns listed by fileSelectColumns, some of which
+// need decoding before they fit models.File.
+type fileRow struct {
+	file         models.File
+	uploadPolicy string
+	expiresAt    time.Time
+	finalized    bool
+}
+
+func (r *fileRow) dest() []interface{} {
+	f := &r.file
+	return []interface{}{&f.ID, &f.BucketID, &f.Checksum, &f.ETag, &f.ContentType, &f.CreatedAt, &f.DataKey, &f.Encrypted, &r.expiresAt, &f.FileSize, &f.FileSizeLimit, &r.finalized, &f.Metadata, &f.Name, &f.ObjectKey, &f.Path, &f.ScanDetail, &f.ScanStatus, &f.Status, &f.Tags, &f.UpdatedAt, &r.uploadPolicy, &f.UserMetadata, &f.Version, &f.VersionOf}
+}
+
+func (r *fileRow) decode() (*models.File, error) {
+	file := r.file
+	if r.uploadPolicy != "" {
+		file.UploadPolicy = &models.UploadPolicy{}
+		if err := json.Unmarshal([]byte(r.uploadPolicy), file.UploadPolicy); err != nil {
+			return nil, err
+		}
+	}
+	if !r.expiresAt.IsZero() {
+		expiresAt := r.expiresAt
+		file.ExpiresAt = &expiresAt
+	}
+	if file.Version == 0 {
+		// Written before files had versions.
+		file.Version = 1
+	}
+	if file.Status == "" {
+		// Written before files had a status.
+		file.Status = models.FileStatusPending
+		if r.finalized {
+			file.Status = models.FileStatusActive
+		}
+	}
+	return &file, nil
+}
+
+// finalized derives the legacy finalized column from a status. The column is
+// still written so ListPendingFiles can filter on it, which is why files being
+// deleted count as not finalized.
+func finalized(status models.FileStatus) bool {
+	switch status {
+	case models.FileStatusPending, models.FileStatusUploading, models.FileStatusDeleting, models.FileStatusDeleted:
+		return false
+	}
+	return true
+}
+
+// BackfillFileStatus sets the status of files written before files had one,
+// so filtering on it finds them. Only rows still without a status are
+// written, which makes it safe to run again after an interruption.
+func (s *ScyllaFileRepository) BackfillFileStatus(ctx context.Context) error {
+	iter := s.session.Query("SELECT id, finalized, status FROM file").WithContext(ctx).Iter()
+	var id, status string
+	var done bool
+	backfilled := 0
+	for iter.Scan(&id, &done, &status) {
+		if status != "" {
+			continue
+		}
+		derived := models.FileStatusPending
+		if done {
+			derived = models.FileStatusActive
+		}
+		query := "UPDATE file SET status = ? WHERE id = ? IF status = null"
+		applied, err := s.session.Query(query, derived, id).WithContext(ctx).MapScanCAS(map[string]interface{}{})
+		if err != nil {
+			iter.Close()
+			return fmt.Errorf("backfill status of file %s: %w", id, err)
+		}
+		if applied {
+			backfilled++
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+	if backfilled > 0 {
+		log.Printf("Backfilled the status of %d files", backfilled)
+	}
+	return nil
+}
+
+func encodeUploadPolicy(policy *models.UploadPolicy) (string, error) {
+	if policy == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(policy)
+	return string(data), err
+}
+
 func (s *ScyllaFileRepository) scanFileRow(row *gocql.Query) (*models.File, error) {
-	var file models.File
-	err := row.Scan(&file.ID, &file.BucketID, &file.Checksum, &file.ContentType, &file.CreatedAt, &file.FileSize, &file.FileSizeLimit, &file.Finalized, &file.Metadata, &file.Name, &file.Path, &file.UpdatedAt)
-	if err != nil {
+	var r fileRow
+	if err := row.Scan(r.dest()...); err != nil {
 		return nil, err
 	}
-	return &file, nil
+	return r.decode()
 }
 
+// GetFileReferenceCount adds the holders in the ledger to the anonymous
+// references kept in the counter.
 func (s *ScyllaFileRepository) GetFileReferenceCount(ctx context.Context, fileID string) (int64, error) {
 	var refCount int64
 	query := "SELECT ref FROM filecounter WHERE id = ?"
 	err := s.session.Query(query, fileID).WithContext(ctx).Scan(&refCount)
-	if err != nil {
-		if err == gocql.ErrNotFound {
-			return 0, nil
-		}
+	if err != nil && err != gocql.ErrNotFound {
 		return 0, err
 	}
-	return refCount, nil
+	var holders int64
+	query = "SELECT COUNT(*) FROM file_reference WHERE file_id = ?"
+	if err := s.session.Query(query, fileID).WithContext(ctx).Scan(&holders); err != nil {
+		return 0, err
+	}
+	return refCount + holders, nil
 }
 
 func (s *ScyllaFileRepository) populateFileReferences(ctx context.Context, file *models.File) error {
@@ -61,8 +166,51 @@ func (s *ScyllaFileRepository) populateFileReferences(ctx context.Context, file
 	return nil
 }
 
+// referenceBatchSize bounds the partitions read by one counter query.
+const referenceBatchSize = 100
+
+// populateReferenceCounts sets the reference counts of files, reading the
+// counters and the ledger in batches. Files whose counts cannot be read keep
+// 0.
+func (s *ScyllaFileRepository) populateReferenceCounts(ctx context.Context, files []*models.File) error {
+	byID := make(map[string][]*models.File, len(files))
+	ids := make([]string, 0, len(files))
+	for _, file := range files {
+		if _, ok := byID[file.ID]; !ok {
+			ids = append(ids, file.ID)
+		}
+		byID[file.ID] = append(byID[file.ID], file)
+	}
+	counts := make(map[string]int64, len(ids))
+	for start := 0; start < len(ids); start += referenceBatchSize {
+		batch := ids[start:min(start+referenceBatchSize, len(ids))]
+		iter := s.session.Query("SELECT id, ref FROM filecounter WHERE id IN ?", batch).WithContext(ctx).Iter()
+		var id string
+		var refCount int64
+		for iter.Scan(&id, &refCount) {
+			counts[id] += refCount
+		}
+		if err := iter.Close(); err != nil {
+			return err
+		}
+		iter = s.session.Query("SELECT file_id FROM file_reference WHERE file_id IN ?", batch).WithContext(ctx).Iter()
+		for iter.Scan(&id) {
+			counts[id]++
+		}
+		if err := iter.Close(); err != nil {
+			return err
+		}
+	}
+	for id, refCount := range counts {
+		for _, file := range byID[id] {
+			file.References = refCount
+		}
+	}
+	return nil
+}
+
 func (s *ScyllaFileRepository) fileSelectColumns() string {
-	return "id, bucket_id, checksum, content_type, created_at, file_size, file_size_limit, finalized, metadata, name, path, updated_at"
+	return "id, bucket_id, checksum, etag, content_type, created_at, data_key, encrypted, expires_at, file_size, file_size_limit, finalized, metadata, name, object_key, path, scan_detail, scan_status, status, tags, updated_at, upload_policy, user_metadata, version, version_of"
 }
 
 func (s *ScyllaFileRepository) queryFileWithReferences(ctx context.Context, query string, args ...interface{}) (*models.File, error) {
@@ -94,8 +242,12 @@ func (s *ScyllaFileRepository) CreateFile(ctx context.Context, file *models.File
 	file.CreatedAt = time.Now().UTC()
 	file.UpdatedAt = file.CreatedAt
 	file.ID = file.Name
-	query := `INSERT INTO file (id, bucket_id, name, file_size, file_size_limit, finalized, content_type, checksum, metadata, path, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-	if err := s.session.Query(query, file.ID, file.BucketID, file.Name, file.FileSize, file.FileSizeLimit, file.Finalized, file.ContentType, file.Checksum, file.Metadata, file.Path, file.CreatedAt, file.UpdatedAt).WithContext(ctx).Exec(); err != nil {
+	uploadPolicy, err := encodeUploadPolicy(file.UploadPolicy)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO file (id, bucket_id, name, file_size, file_size_limit, finalized, content_type, checksum, etag, metadata, object_key, path, upload_policy, expires_at, encrypted, data_key, scan_status, scan_detail, status, user_metadata, tags, version, version_of, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	if err := s.session.Query(query, file.ID, file.BucketID, file.Name, file.FileSize, file.FileSizeLimit, finalized(file.Status), file.ContentType, file.Checksum, file.ETag, file.Metadata, file.ObjectKey, file.Path, uploadPolicy, file.ExpiresAt, file.Encrypted, file.DataKey, file.ScanStatus, file.ScanDetail, file.Status, file.UserMetadata, file.Tags, file.Version, file.VersionOf, file.CreatedAt, file.UpdatedAt).WithContext(ctx).Exec(); err != nil {
 		log.Printf("Error creating file: %v", err)
 		return err
 	}
@@ -107,43 +259,217 @@ func (s *ScyllaFileRepository) CreateFile(ctx context.Context, file *models.File
 	return nil
 }
 
-func (s *ScyllaFileRepository) UpdateFile(ctx context.Context, file *models.File) error {
+const fileUpdate = `UPDATE file SET bucket_id = ?, finalized = ?, name = ?, file_size = ?, file_size_limit = ?, content_type = ?, checksum = ?, etag = ?, metadata = ?, object_key = ?, path = ?, upload_policy = ?, expires_at = ?, encrypted = ?, data_key = ?, scan_status = ?, scan_detail = ?, status = ?, version = ?, updated_at = ? WHERE id = ?`
+
+// fileUpdateArgs returns the values for the placeholders of fileUpdate.
+func fileUpdateArgs(file *models.File) ([]interface{}, error) {
 	file.UpdatedAt = time.Now().UTC()
-	query := `UPDATE file SET bucket_id = ?, finalized = ?, name = ?, file_size = ?, file_size_limit = ?, content_type = ?, checksum = ?, metadata = ?, path = ?, updated_at = ? WHERE id = ?`
-	if err := s.session.Query(query, file.BucketID, file.Finalized, file.Name, file.FileSize, file.FileSizeLimit, file.ContentType, file.Checksum, file.Metadata, file.Path, file.UpdatedAt, file.ID).WithContext(ctx).Exec(); err != nil {
+	uploadPolicy, err := encodeUploadPolicy(file.UploadPolicy)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{file.BucketID, finalized(file.Status), file.Name, file.FileSize, file.FileSizeLimit, file.ContentType, file.Checksum, file.ETag, file.Metadata, file.ObjectKey, file.Path, uploadPolicy, file.ExpiresAt, file.Encrypted, file.DataKey, file.ScanStatus, file.ScanDetail, file.Status, file.Version, file.UpdatedAt, file.ID}, nil
+}
+
+func (s *ScyllaFileRepository) UpdateFile(ctx context.Context, file *models.File) error {
+	args, err := fileUpdateArgs(file)
+	if err != nil {
+		return err
+	}
+	if err := s.session.Query(fileUpdate, args...).WithContext(ctx).Exec(); err != nil {
 		log.Printf("Error updating file: %v", err)
 		return err
 	}
 	return nil
 }
 
+// updateFileAtVersion stores file with a lightweight transaction that only
+// applies while the stored file is still at version, and reports whether it
+// did. Files written before they had versions have none stored, which
+// version 0 stands for.
+func (s *ScyllaFileRepository) updateFileAtVersion(ctx context.Context, file *models.File, version int) (bool, error) {
+	args, err := fileUpdateArgs(file)
+	if err != nil {
+		return false, err
+	}
+	if version == 0 {
+		return s.session.Query(fileUpdate+" IF version = null", args...).WithContext(ctx).MapScanCAS(map[string]interface{}{})
+	}
+	args = append(args, version)
+	return s.session.Query(fileUpdate+" IF version = ?", args...).WithContext(ctx).MapScanCAS(map[string]interface{}{})
+}
+
+func (s *ScyllaFileRepository) UpdateFileUserMetadata(ctx context.Context, file *models.File) error {
+	file.UpdatedAt = time.Now().UTC()
+	query := `UPDATE file SET user_metadata = ?, tags = ?, updated_at = ? WHERE id = ?`
+	return s.session.Query(query, file.UserMetadata, file.Tags, file.UpdatedAt, file.ID).WithContext(ctx).Exec()
+}
+
 func (s *ScyllaFileRepository) DeleteFile(ctx context.Context, id string) error {
 	query := "DELETE FROM file WHERE id = ?"
+	if err := s.session.Query(query, id).WithContext(ctx).Exec(); err != nil {
+		return err
+	}
+	query = "DELETE FROM filecounter WHERE id = ?"
+	if err := s.session.Query(query, id).WithContext(ctx).Exec(); err != nil {
+		return err
+	}
+	query = "DELETE FROM file_reference WHERE file_id = ?"
+	if err := s.session.Query(query, id).WithContext(ctx).Exec(); err != nil {
+		return err
+	}
+	query = "DELETE FROM file_reference_handover WHERE file_id = ?"
 	return s.session.Query(query, id).WithContext(ctx).Exec()
 }
 
-func (s *ScyllaFileRepository) ListFiles(ctx context.Context, bucketID string) ([]*models.File, error) {
-	query := "SELECT " + s.fileSelectColumns() + " FROM file WHERE bucket_id = ?"
-	iter := s.session.Query(query, bucketID).WithContext(ctx).Iter()
+func (s *ScyllaFileRepository) ListFilesByChecksum(ctx context.Context, checksum string) ([]*models.File, error) {
+	query := "SELECT " + s.fileSelectColumns() + " FROM file WHERE checksum = ?"
+	return s.queryFiles(ctx, query, checksum)
+}
+
+func (s *ScyllaFileRepository) ListFilesByObjectKey(ctx context.Context, objectKey string) ([]*models.File, error) {
+	query := "SELECT " + s.fileSelectColumns() + " FROM file WHERE object_key = ?"
+	return s.queryFiles(ctx, query, objectKey)
+}
+
+// ListFiles pages through the files matching filter using the driver's
+// paging state as the cursor. Files come in token order, and conditions the
+// indexes do not serve are filtered by the cluster.
+func (s *ScyllaFileRepository) ListFiles(ctx context.Context, filter models.FileFilter, cursor string, limit int) ([]*models.File, string, error) {
+	var conditions []string
+	var args []interface{}
+	if filter.BucketID != "" {
+		conditions = append(conditions, "bucket_id = ?")
+		args = append(args, filter.BucketID)
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, filter.Status)
+	}
+	if filter.ContentType != "" {
+		conditions = append(conditions, "content_type = ?")
+		args = append(args, filter.ContentType)
+	}
+	if !filter.CreatedAfter.IsZero() {
+		conditions = append(conditions, "created_at > ?")
+		args = append(args, filter.CreatedAfter)
+	}
+	for _, tag := range filter.Tags {
+		conditions = append(conditions, "tags CONTAINS ?")
+		args = append(args, tag)
+	}
+	for key, value := range filter.Metadata {
+		conditions = append(conditions, "user_metadata[?] = ?")
+		args = append(args, key, value)
+	}
+	query := "SELECT " + s.fileSelectColumns() + " FROM file"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ") + " ALLOW FILTERING"
+	}
+
+	pageState, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, "", models.ErrInvalidCursor
+	}
+	var files []*models.File
+	// Filtered pages may come back short or empty, so keep reading until the
+	// page is full or the table is exhausted.
+	for {
+		iter := s.session.Query(query, args...).WithContext(ctx).PageSize(limit - len(files)).PageState(pageState).Iter()
+		pageState = iter.PageState()
+		for {
+			var row fileRow
+			if !iter.Scan(row.dest()...) {
+				break
+			}
+			file, err := row.decode()
+			if err != nil {
+				iter.Close()
+				return nil, "", err
+			}
+			files = append(files, file)
+		}
+		if err := iter.Close(); err != nil {
+			return nil, "", err
+		}
+		if len(pageState) == 0 || len(files) >= limit {
+			break
+		}
+	}
+	if err := s.populateReferenceCounts(ctx, files); err != nil {
+		log.Printf("Warning: Failed to get reference counts: %v", err)
+	}
+	return files, base64.RawURLEncoding.EncodeToString(pageState), nil
+}
+
+// ListPendingFiles scans for files still waiting for their content that were
+// last written before updatedBefore. Every call reads a single page of the
+// table, so a sweep of a large table is spread over many calls.
+func (s *ScyllaFileRepository) ListPendingFiles(ctx context.Context, updatedBefore time.Time, cursor string, limit int) ([]*models.File, string, error) {
+	query := "SELECT " + s.fileSelectColumns() + " FROM file WHERE finalized = false AND updated_at < ? ALLOW FILTERING"
+	return s.queryFilePage(ctx, query, cursor, limit, updatedBefore)
+}
+
+// ListExpiredFiles scans for files whose retention ended before expiredBefore,
+// a page at a time like ListPendingFiles.
+func (s *ScyllaFileRepository) ListExpiredFiles(ctx context.Context, expiredBefore time.Time, cursor string, limit int) ([]*models.File, string, error) {
+	query := "SELECT " + s.fileSelectColumns() + " FROM file WHERE expires_at < ? ALLOW FILTERING"
+	return s.queryFilePage(ctx, query, cursor, limit, expiredBefore)
+}
+
+// queryFilePage reads the page of limit rows starting at cursor, keeping the
+// rows matching the filter of query.
+func (s *ScyllaFileRepository) queryFilePage(ctx context.Context, query, cursor string, limit int, args ...interface{}) ([]*models.File, string, error) {
+	pageState, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, "", models.ErrInvalidCursor
+	}
+	iter := s.session.Query(query, args...).WithContext(ctx).PageSize(limit).PageState(pageState).Iter()
+	pageState = iter.PageState()
+	var files []*models.File
+	for {
+		var row fileRow
+		if !iter.Scan(row.dest()...) {
+			break
+		}
+		file, err := row.decode()
+		if err != nil {
+			iter.Close()
+			return nil, "", err
+		}
+		files = append(files, file)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, "", err
+	}
+	if err := s.populateReferenceCounts(ctx, files); err != nil {
+		log.Printf("Warning: Failed to get reference counts: %v", err)
+	}
+	return files, base64.RawURLEncoding.EncodeToString(pageState), nil
+}
+
+func (s *ScyllaFileRepository) queryFiles(ctx context.Context, query string, args ...interface{}) ([]*models.File, error) {
+	iter := s.session.Query(query, args...).WithContext(ctx).Iter()
 	defer iter.Close()
 
 	var files []*models.File
 	for {
-		file := &models.File{}
-		if !iter.Scan(&file.ID, &file.BucketID, &file.Checksum, &file.ContentType, &file.CreatedAt, &file.FileSize, &file.FileSizeLimit, &file.Finalized, &file.Metadata, &file.Name, &file.Path, &file.UpdatedAt) {
+		var row fileRow
+		if !iter.Scan(row.dest()...) {
 			break
 		}
+		file, err := row.decode()
+		if err != nil {
+			return nil, err
+		}
 		files = append(files, file)
 	}
 	if err := iter.Close(); err != nil {
 		return nil, err
 	}
 
-	for _, file := range files {
-		if err := s.populateFileReferences(ctx, file); err != nil {
-			log.Printf("Warning: Failed to get reference count for file %s: %v", file.ID, err)
-			file.References = 0
-		}
+	if err := s.populateReferenceCounts(ctx, files); err != nil {
+		log.Printf("Warning: Failed to get reference counts: %v", err)
 	}
 
 	return files, nil
@@ -155,6 +481,79 @@ func (s *ScyllaFileRepository) AtomicIncrement(ctx context.Context, id string) e
 }
 
 func (s *ScyllaFileRepository) AtomicDecrement(ctx context.Context, id string) error {
+	released, err := s.releaseAnonymousReference(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !released {
+		return models.ErrNoReferences
+	}
+	return nil
+}
+
+// releaseAnonymousReference decrements the counter of a file unless that
+// takes it below zero. Counters cannot be updated conditionally, so one that
+// went negative is incremented back; concurrent releases of the last
+// reference may then all report false.
+func (s *ScyllaFileRepository) releaseAnonymousReference(ctx context.Context, id string) (bool, error) {
 	query := "UPDATE FileCounter SET ref = ref - 1 WHERE id = ?"
-	return s.session.Query(query, id).WithContext(ctx).Exec()
+	if err := s.session.Query(query, id).WithContext(ctx).Exec(); err != nil {
+		return false, err
+	}
+	var refCount int64
+	query = "SELECT ref FROM filecounter WHERE id = ?"
+	if err := s.session.Query(query, id).WithContext(ctx).Scan(&refCount); err != nil {
+		return false, err
+	}
+	if refCount >= 0 {
+		return true, nil
+	}
+	query = "UPDATE FileCounter SET ref = ref + 1 WHERE id = ?"
+	return false, s.session.Query(query, id).WithContext(ctx).Exec()
+}
+
+// AddFileReference claims the ledger row with a lightweight transaction, so
+// only one of concurrent adds of a holder succeeds. The holders are counted
+// from the ledger; the counter only keeps the anonymous references, which
+// cannot be made idempotent. The first holder claims the handover of the
+// reference of the uploader the same way before releasing it from the
+// counter; if that release fails the file keeps one reference too many.
+func (s *ScyllaFileRepository) AddFileReference(ctx context.Context, fileID, holder string) (bool, error) {
+	query := "INSERT INTO file_reference (file_id, holder, created_at) VALUES (?, ?, ?) IF NOT EXISTS"
+	added, err := s.session.Query(query, fileID, holder, time.Now().UTC()).WithContext(ctx).MapScanCAS(map[string]interface{}{})
+	if err != nil || !added {
+		return added, err
+	}
+	query = "INSERT INTO file_reference_handover (file_id) VALUES (?) IF NOT EXISTS"
+	handedOver, err := s.session.Query(query, fileID).WithContext(ctx).MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		return true, fmt.Errorf("hand over the reference of the uploader: %w", err)
+	}
+	if handedOver {
+		if _, err := s.releaseAnonymousReference(ctx, fileID); err != nil {
+			return true, fmt.Errorf("hand over the reference of the uploader: %w", err)
+		}
+	}
+	return true, nil
+}
+
+func (s *ScyllaFileRepository) RemoveFileReference(ctx context.Context, fileID, holder string) (bool, error) {
+	query := "DELETE FROM file_reference WHERE file_id = ? AND holder = ? IF EXISTS"
+	return s.session.Query(query, fileID, holder).WithContext(ctx).MapScanCAS(map[string]interface{}{})
+}
+
+func (s *ScyllaFileRepository) ListFileReferences(ctx context.Context, fileID string) ([]*models.FileReference, error) {
+	iter := s.session.Query("SELECT file_id, holder, created_at FROM file_reference WHERE file_id = ?", fileID).WithContext(ctx).Iter()
+	var references []*models.FileReference
+	for {
+		ref := &models.FileReference{}
+		if !iter.Scan(&ref.FileID, &ref.Holder, &ref.CreatedAt) {
+			break
+		}
+		references = append(references, ref)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return references, nil
 }
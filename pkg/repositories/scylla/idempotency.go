@@ -0,0 +1,78 @@
+package scylla
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/gocql/gocql"
+	"github.com/google/uuid"
+)
+
+// ScyllaIdempotencyRepository stores records with a TTL ending at their
+// expiry, so expired records disappear by themselves.
+type ScyllaIdempotencyRepository struct {
+	session *gocql.Session
+}
+
+func NewScyllaIdempotencyRepository(session *gocql.Session) *ScyllaIdempotencyRepository {
+	return &ScyllaIdempotencyRepository{session: session}
+}
+
+func (s *ScyllaIdempotencyRepository) CreateIndices(ctx context.Context) {
+}
+
+const idempotencyRecordSelectColumns = "id, token_id, idempotency_key, fingerprint, status_code, content_type, headers, body, expires_at, created_at, updated_at"
+
+// recordTTL returns the seconds left until record expires, at least one.
+func recordTTL(record *models.IdempotencyRecord) int {
+	return max(int(time.Until(record.ExpiresAt).Seconds()), 1)
+}
+
+func (s *ScyllaIdempotencyRepository) CreateIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecord) (bool, error) {
+	record.ID = uuid.NewString()
+	record.CreatedAt = time.Now().UTC()
+	record.UpdatedAt = record.CreatedAt
+	return s.session.Query(
+		"INSERT INTO idempotency_record ("+idempotencyRecordSelectColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) IF NOT EXISTS USING TTL ?",
+		record.ID, record.TokenID, record.Key, record.Fingerprint, record.StatusCode, record.ContentType, record.Headers, record.Body, record.ExpiresAt, record.CreatedAt, record.UpdatedAt, recordTTL(record)).
+		WithContext(ctx).MapScanCAS(map[string]interface{}{})
+}
+
+func (s *ScyllaIdempotencyRepository) GetIdempotencyRecord(ctx context.Context, tokenID, key string) (*models.IdempotencyRecord, error) {
+	var r models.IdempotencyRecord
+	query := "SELECT " + idempotencyRecordSelectColumns + " FROM idempotency_record WHERE token_id = ? AND idempotency_key = ?"
+	err := s.session.Query(query, tokenID, key).WithContext(ctx).
+		Scan(&r.ID, &r.TokenID, &r.Key, &r.Fingerprint, &r.StatusCode, &r.ContentType, &r.Headers, &r.Body, &r.ExpiresAt, &r.CreatedAt, &r.UpdatedAt)
+	if errors.Is(err, gocql.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !r.ExpiresAt.After(time.Now()) {
+		return nil, nil
+	}
+	return &r, nil
+}
+
+func (s *ScyllaIdempotencyRepository) UpdateIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecord) error {
+	record.UpdatedAt = time.Now().UTC()
+	_, err := s.session.Query(
+		"UPDATE idempotency_record USING TTL ? SET status_code = ?, content_type = ?, headers = ?, body = ?, updated_at = ? WHERE token_id = ? AND idempotency_key = ? IF id = ?",
+		recordTTL(record), record.StatusCode, record.ContentType, record.Headers, record.Body, record.UpdatedAt, record.TokenID, record.Key, record.ID).
+		WithContext(ctx).MapScanCAS(map[string]interface{}{})
+	return err
+}
+
+func (s *ScyllaIdempotencyRepository) DeleteIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecord) error {
+	_, err := s.session.Query("DELETE FROM idempotency_record WHERE token_id = ? AND idempotency_key = ? IF id = ?", record.TokenID, record.Key, record.ID).
+		WithContext(ctx).MapScanCAS(map[string]interface{}{})
+	return err
+}
+
+// DeleteExpiredIdempotencyRecords does nothing: records expire with their TTL.
+func (s *ScyllaIdempotencyRepository) DeleteExpiredIdempotencyRecords(ctx context.Context, before time.Time) error {
+	return nil
+}
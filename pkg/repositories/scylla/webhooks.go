@@ -0,0 +1,223 @@
+package scylla
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/gocql/gocql"
+	"github.com/google/uuid"
+)
+
+type ScyllaWebhookRepository struct {
+	session *gocql.Session
+}
+
+func NewScyllaWebhookRepository(session *gocql.Session) *ScyllaWebhookRepository {
+	return &ScyllaWebhookRepository{session: session}
+}
+
+func (s *ScyllaWebhookRepository) CreateIndices(ctx context.Context) {
+	indexQueries := []string{
+		"CREATE INDEX IF NOT EXISTS webhook_delivery_webhook_id_idx ON webhook_delivery (webhook_id)",
+	}
+	for _, indexQuery := range indexQueries {
+		log.Printf("Executing index creation query: %s", indexQuery)
+		if err := s.session.Query(indexQuery).WithContext(ctx).Exec(); err != nil {
+			log.Printf("Error creating index: %v", err)
+		}
+	}
+}
+
+const webhookSelectColumns = "id, url, secret, events, enabled, created_at, updated_at"
+
+// webhookRow receives the columns listed by webhookSelectColumns.
+type webhookRow struct {
+	webhook models.Webhook
+	events  string
+}
+
+func (r *webhookRow) dest() []interface{} {
+	w := &r.webhook
+	return []interface{}{&w.ID, &w.URL, &w.Secret, &r.events, &w.Enabled, &w.CreatedAt, &w.UpdatedAt}
+}
+
+func (r *webhookRow) decode() (*models.Webhook, error) {
+	webhook := r.webhook
+	if r.events != "" {
+		if err := json.Unmarshal([]byte(r.events), &webhook.Events); err != nil {
+			return nil, err
+		}
+	}
+	return &webhook, nil
+}
+
+func (s *ScyllaWebhookRepository) GetWebhookByID(ctx context.Context, id string) (*models.Webhook, error) {
+	query := "SELECT " + webhookSelectColumns + " FROM webhook WHERE id = ?"
+	var row webhookRow
+	if err := s.session.Query(query, id).WithContext(ctx).Scan(row.dest()...); err != nil {
+		if errors.Is(err, gocql.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return row.decode()
+}
+
+func (s *ScyllaWebhookRepository) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	now := time.Now().UTC()
+	webhook.ID = uuid.NewString()
+	webhook.CreatedAt = now
+	webhook.UpdatedAt = now
+	events, err := json.Marshal(webhook.Events)
+	if err != nil {
+		return err
+	}
+	return s.session.Query(
+		"INSERT INTO webhook (id, url, secret, events, enabled, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		webhook.ID, webhook.URL, webhook.Secret, string(events), webhook.Enabled, webhook.CreatedAt, webhook.UpdatedAt).
+		WithContext(ctx).Exec()
+}
+
+func (s *ScyllaWebhookRepository) UpdateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	webhook.UpdatedAt = time.Now().UTC()
+	events, err := json.Marshal(webhook.Events)
+	if err != nil {
+		return err
+	}
+	return s.session.Query(
+		"UPDATE webhook SET url = ?, secret = ?, events = ?, enabled = ?, updated_at = ? WHERE id = ?",
+		webhook.URL, webhook.Secret, string(events), webhook.Enabled, webhook.UpdatedAt, webhook.ID).
+		WithContext(ctx).Exec()
+}
+
+func (s *ScyllaWebhookRepository) DeleteWebhook(ctx context.Context, id string) error {
+	return s.session.Query("DELETE FROM webhook WHERE id = ?", id).WithContext(ctx).Exec()
+}
+
+func (s *ScyllaWebhookRepository) ListWebhooks(ctx context.Context) ([]*models.Webhook, error) {
+	iter := s.session.Query("SELECT " + webhookSelectColumns + " FROM webhook").WithContext(ctx).Iter()
+	defer iter.Close()
+
+	var webhooks []*models.Webhook
+	for {
+		var row webhookRow
+		if !iter.Scan(row.dest()...) {
+			break
+		}
+		webhook, err := row.decode()
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+const deliverySelectColumns = "id, webhook_id, event_id, event, payload, status, attempts, next_attempt_at, response_status, last_error, created_at, updated_at"
+
+func deliveryDest(d *models.WebhookDelivery) []interface{} {
+	return []interface{}{&d.ID, &d.WebhookID, &d.EventID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.NextAttemptAt, &d.ResponseStatus, &d.LastError, &d.CreatedAt, &d.UpdatedAt}
+}
+
+func (s *ScyllaWebhookRepository) CreateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	delivery.ID = gocql.TimeUUID().String()
+	delivery.CreatedAt = time.Now().UTC()
+	delivery.UpdatedAt = delivery.CreatedAt
+	return s.session.Query(
+		"INSERT INTO webhook_delivery ("+deliverySelectColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		delivery.ID, delivery.WebhookID, delivery.EventID, string(delivery.Event), delivery.Payload, string(delivery.Status), delivery.Attempts, delivery.NextAttemptAt, delivery.ResponseStatus, delivery.LastError, delivery.CreatedAt, delivery.UpdatedAt).
+		WithContext(ctx).Exec()
+}
+
+func (s *ScyllaWebhookRepository) GetDeliveryByID(ctx context.Context, id string) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	query := "SELECT " + deliverySelectColumns + " FROM webhook_delivery WHERE id = ?"
+	if err := s.session.Query(query, id).WithContext(ctx).Scan(deliveryDest(&delivery)...); err != nil {
+		if errors.Is(err, gocql.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+func (s *ScyllaWebhookRepository) UpdateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	delivery.UpdatedAt = time.Now().UTC()
+	return s.session.Query(
+		"UPDATE webhook_delivery SET status = ?, attempts = ?, next_attempt_at = ?, response_status = ?, last_error = ?, updated_at = ? WHERE id = ?",
+		string(delivery.Status), delivery.Attempts, delivery.NextAttemptAt, delivery.ResponseStatus, delivery.LastError, delivery.UpdatedAt, delivery.ID).
+		WithContext(ctx).Exec()
+}
+
+// ClaimDelivery uses a lightweight transaction, so only one of the
+// dispatchers listing a due delivery sends it.
+func (s *ScyllaWebhookRepository) ClaimDelivery(ctx context.Context, delivery *models.WebhookDelivery, until time.Time) (bool, error) {
+	applied, err := s.session.Query(
+		"UPDATE webhook_delivery SET next_attempt_at = ? WHERE id = ? IF status = ? AND next_attempt_at = ?",
+		until, delivery.ID, string(models.DeliveryStatusPending), delivery.NextAttemptAt).
+		WithContext(ctx).MapScanCAS(map[string]interface{}{})
+	if err != nil || !applied {
+		return false, err
+	}
+	delivery.NextAttemptAt = until
+	return true, nil
+}
+
+func (s *ScyllaWebhookRepository) DeleteDeliveriesByWebhookID(ctx context.Context, webhookID string) error {
+	deliveries, err := s.ListDeliveriesByWebhookID(ctx, webhookID)
+	if err != nil {
+		return err
+	}
+	for _, delivery := range deliveries {
+		if err := s.session.Query("DELETE FROM webhook_delivery WHERE id = ?", delivery.ID).WithContext(ctx).Exec(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListDeliveriesByWebhookID returns the deliveries of a webhook, newest first.
+func (s *ScyllaWebhookRepository) ListDeliveriesByWebhookID(ctx context.Context, webhookID string) ([]*models.WebhookDelivery, error) {
+	query := "SELECT " + deliverySelectColumns + " FROM webhook_delivery WHERE webhook_id = ?"
+	deliveries, err := s.queryDeliveries(ctx, query, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+	})
+	return deliveries, nil
+}
+
+// ListDueDeliveries scans for pending deliveries whose next attempt is due
+// before dueBefore.
+func (s *ScyllaWebhookRepository) ListDueDeliveries(ctx context.Context, dueBefore time.Time) ([]*models.WebhookDelivery, error) {
+	query := "SELECT " + deliverySelectColumns + " FROM webhook_delivery WHERE status = ? AND next_attempt_at < ? ALLOW FILTERING"
+	return s.queryDeliveries(ctx, query, string(models.DeliveryStatusPending), dueBefore)
+}
+
+func (s *ScyllaWebhookRepository) queryDeliveries(ctx context.Context, query string, args ...interface{}) ([]*models.WebhookDelivery, error) {
+	iter := s.session.Query(query, args...).WithContext(ctx).Iter()
+	defer iter.Close()
+
+	var deliveries []*models.WebhookDelivery
+	for {
+		delivery := &models.WebhookDelivery{}
+		if !iter.Scan(deliveryDest(delivery)...) {
+			break
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
@@ -11,11 +11,11 @@ import (
 // AddBucketsRoutes sets up the bucket endpoints.
 func AddBucketsRoutes(router *router, v1 *gin.RouterGroup) {
 	bucket := v1.Group("/bucket")
-	bucket.POST("/", AuthMiddleware(router.repo), AdminOnlyMiddleware, router.CreateBucketHandler)
+	bucket.POST("/", AuthMiddleware(router.repo), AdminOnlyMiddleware, IdempotencyMiddleware(router.repo), router.CreateBucketHandler)
 	bucket.GET("/", AuthMiddleware(router.repo), AdminOnlyMiddleware, router.ListBucketsHandler)
 	bucket.GET("/:id", AuthMiddleware(router.repo), AdminOnlyMiddleware, router.GetBucketHandler)
-	bucket.PATCH("/:id", AuthMiddleware(router.repo), AdminOnlyMiddleware, router.UpdateBucketHandler)
-	bucket.DELETE("/:id", AuthMiddleware(router.repo), AdminOnlyMiddleware, router.DeleteBucketHandler)
+	bucket.PATCH("/:id", AuthMiddleware(router.repo), AdminOnlyMiddleware, IdempotencyMiddleware(router.repo), router.UpdateBucketHandler)
+	bucket.DELETE("/:id", AuthMiddleware(router.repo), AdminOnlyMiddleware, IdempotencyMiddleware(router.repo), router.DeleteBucketHandler)
 }
 
 type BucketInsertDTO struct {
@@ -28,6 +28,8 @@ type BucketInsertDTO struct {
 	S3Provider   string             `json:"s3_provider"`
 	CustomConfig string             `json:"custom_config,omitempty"`
 	StorageType  models.StorageType `json:"storage_type" gorm:"default:0"`
+	Deduplicate  bool               `json:"deduplicate"`
+	Encrypt      bool               `json:"encrypt"`
 }
 
 // CreateBucketHandler creates a new bucket
@@ -50,6 +52,12 @@ func (r *router) CreateBucketHandler(c *gin.Context) {
 		writeError(c, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
 		return
 	}
+	if bucket.Encrypt {
+		if _, err := masterKey(); err != nil {
+			writeError(c, http.StatusBadRequest, fmt.Sprintf("cannot enable encryption: %v", err))
+			return
+		}
+	}
 	ctx := c.Request.Context()
 	existing, err := r.repo.Buckets.GetBucketByName(ctx, bucket.Name)
 	if err != nil {
@@ -65,6 +73,7 @@ func (r *router) CreateBucketHandler(c *gin.Context) {
 		writeError(c, http.StatusBadRequest, fmt.Sprintf("failed to create bucket: %v", err))
 		return
 	}
+	r.publishBucketEvent(eventBucketCreated, &bucket)
 	c.JSON(http.StatusCreated, bucket)
 }
 
@@ -158,11 +167,20 @@ func (r *router) UpdateBucketHandler(c *gin.Context) {
 	bucket.S3Provider = req.S3Provider
 	bucket.CustomConfig = req.CustomConfig
 	bucket.StorageType = req.StorageType
+	bucket.Deduplicate = req.Deduplicate
+	bucket.Encrypt = req.Encrypt
+	if bucket.Encrypt {
+		if _, err := masterKey(); err != nil {
+			writeError(c, http.StatusBadRequest, fmt.Sprintf("cannot enable encryption: %v", err))
+			return
+		}
+	}
 
 	if err := r.repo.Buckets.UpdateBucket(ctx, bucket); err != nil {
 		writeError(c, http.StatusBadRequest, fmt.Sprintf("failed to update bucket: %v", err))
 		return
 	}
+	r.publishBucketEvent(eventBucketUpdated, bucket)
 	c.JSON(200, bucket)
 }
 
@@ -195,5 +213,6 @@ func (r *router) DeleteBucketHandler(c *gin.Context) {
 		writeError(c, http.StatusInternalServerError, fmt.Sprintf("failed to delete bucket: %v", err))
 		return
 	}
+	r.publishBucketEvent(eventBucketDeleted, bucket)
 	c.Status(204)
 }
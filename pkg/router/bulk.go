@@ -0,0 +1,342 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// maxDeleteObjects is the most keys S3 accepts in one DeleteObjects request.
+const maxDeleteObjects = 1000
+
+const (
+	fileOpGet       = "get"
+	fileOpIncrement = "increment"
+	fileOpDecrement = "decrement"
+	fileOpDelete    = "delete"
+)
+
+type FileOperation struct {
+	Op string `json:"op" binding:"required,oneof=get increment decrement delete"`
+	ID string `json:"id" binding:"required"` // file GUID
+}
+
+type FileBulkDTO struct {
+	Operations []FileOperation `json:"operations" binding:"required,min=1,max=1000,dive"`
+}
+
+// FileOperationResult is the outcome of one operation of a bulk request. Its
+// status is the one the single-file endpoint would have answered with.
+type FileOperationResult struct {
+	Op     string         `json:"op"`
+	ID     string         `json:"id"`
+	Status int            `json:"status"`
+	File   *models.File   `json:"file,omitempty"` // set for get
+	Error  *ErrorResponse `json:"error,omitempty"`
+}
+
+type FileBulkResponse struct {
+	Results []FileOperationResult `json:"results"` // in the order of the request
+}
+
+// runBounded calls fn for 0 to n-1 with at most bulk-concurrency calls
+// running at a time, and waits for all of them.
+func runBounded(n int, fn func(i int)) {
+	sem := make(chan struct{}, max(viper.GetInt("bulk-concurrency"), 1))
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			fn(i)
+		}()
+	}
+	wg.Wait()
+}
+
+// bulkDeletion is a file removed by a bulk request, with the results of the
+// operations that asked for it.
+type bulkDeletion struct {
+	id      string
+	results []int
+	file    *models.File
+	bucket  *models.Bucket
+	// deleteObject is set if no other file refers to the object.
+	deleteObject bool
+	err          *ErrorResponse
+}
+
+// bulkRun carries out the operations of one bulk request.
+type bulkRun struct {
+	*router
+	ops     []FileOperation
+	results []FileOperationResult
+
+	mu        sync.Mutex
+	deletions map[string]*bulkDeletion
+	order     []*bulkDeletion
+}
+
+// scheduleDelete records that the operation at index i removes file id.
+func (b *bulkRun) scheduleDelete(id string, i int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	deletion, ok := b.deletions[id]
+	if !ok {
+		deletion = &bulkDeletion{id: id}
+		b.deletions[id] = deletion
+		b.order = append(b.order, deletion)
+	}
+	deletion.results = append(deletion.results, i)
+}
+
+func (b *bulkRun) fail(i, code int, msg string) {
+	b.results[i].Status = code
+	b.results[i].Error = &ErrorResponse{Code: code, Message: msg}
+}
+
+// apply runs a get, increment or decrement, and schedules deletes.
+func (b *bulkRun) apply(ctx context.Context, i int) {
+	op := b.ops[i]
+	switch op.Op {
+	case fileOpGet:
+		file, err := b.repo.Files.GetFileByID(ctx, op.ID)
+		if err != nil || file == nil {
+			b.fail(i, http.StatusNotFound, "File not found")
+			return
+		}
+		b.results[i].Status = http.StatusOK
+		b.results[i].File = file
+	case fileOpIncrement:
+		if err := b.repo.Files.AtomicIncrement(ctx, op.ID); err != nil {
+			b.fail(i, http.StatusBadRequest, "Failed to increment file ref count: "+err.Error())
+			return
+		}
+		b.results[i].Status = http.StatusNoContent
+	case fileOpDecrement:
+		err := b.repo.Files.AtomicDecrement(ctx, op.ID)
+		if errors.Is(err, models.ErrNoReferences) {
+			b.fail(i, http.StatusConflict, "File has no anonymous references to release")
+			return
+		}
+		if err != nil {
+			b.fail(i, http.StatusBadRequest, "Failed to decrement file ref count: "+err.Error())
+			return
+		}
+		refCount, err := b.repo.Files.GetFileReferenceCount(ctx, op.ID)
+		if err != nil {
+			b.fail(i, http.StatusBadRequest, "Failed to get current file ref count: "+err.Error())
+			return
+		}
+		b.results[i].Status = http.StatusNoContent
+		if refCount < 1 {
+			if file, err := b.repo.Files.GetFileByID(ctx, op.ID); err == nil {
+				b.emit(ctx, models.EventRefcountZero, file)
+			}
+			b.scheduleDelete(op.ID, i)
+		}
+	case fileOpDelete:
+		b.results[i].Status = http.StatusNoContent
+		b.scheduleDelete(op.ID, i)
+	}
+}
+
+// begin marks a file deleting, picking up where an earlier attempt stopped if
+// it already is.
+func (b *bulkRun) begin(ctx context.Context, d *bulkDeletion) {
+	file, err := b.repo.Files.GetFileByID(ctx, d.id)
+	if err != nil || file == nil {
+		d.err = &ErrorResponse{Code: http.StatusNotFound, Message: "File not found"}
+		return
+	}
+	bucket, err := b.repo.Buckets.GetBucketByID(ctx, file.BucketID)
+	if err != nil || bucket == nil {
+		d.err = &ErrorResponse{Code: http.StatusNotFound, Message: "Bucket not found"}
+		return
+	}
+	d.file, d.bucket = file, bucket
+	if file.Status != models.FileStatusDeleting && file.Status != models.FileStatusDeleted {
+		if err := file.Transition(models.FileStatusDeleting); err != nil {
+			d.err = &ErrorResponse{Code: http.StatusConflict, Message: err.Error()}
+			return
+		}
+		if err := b.repo.Files.UpdateFile(ctx, file); err != nil {
+			d.err = &ErrorResponse{Code: http.StatusInternalServerError, Message: "Failed to update file record: " + err.Error()}
+		}
+	}
+}
+
+// checkObject decides whether the object of a file goes with it. It runs once
+// every file of the request is marked deleting, so files of the same request
+// sharing an object do not keep it alive for each other.
+func (b *bulkRun) checkObject(ctx context.Context, d *bulkDeletion) {
+	inUse, err := b.objectInUse(ctx, d.file)
+	if err != nil {
+		d.err = &ErrorResponse{Code: http.StatusInternalServerError, Message: "Failed to check object references: " + err.Error()}
+		return
+	}
+	d.deleteObject = !inUse && d.file.Status == models.FileStatusDeleting
+}
+
+// deleteObjects removes the objects of the given deletions, all in one bucket,
+// with as few DeleteObjects requests as possible.
+func (b *bulkRun) deleteObjects(ctx context.Context, bucket *models.Bucket, deletions []*bulkDeletion) {
+	failAll := func(msg string) {
+		for _, d := range deletions {
+			d.err = &ErrorResponse{Code: http.StatusInternalServerError, Message: msg}
+		}
+	}
+	client, err := createS3Client(bucket)
+	if err != nil {
+		failAll("Failed to create S3 client: " + err.Error())
+		return
+	}
+	byKey := map[string][]*bulkDeletion{}
+	var keys []string
+	for _, d := range deletions {
+		key := d.file.StorageKey()
+		if _, ok := byKey[key]; !ok {
+			keys = append(keys, key)
+		}
+		byKey[key] = append(byKey[key], d)
+	}
+	for start := 0; start < len(keys); start += maxDeleteObjects {
+		chunk := keys[start:min(start+maxDeleteObjects, len(keys))]
+		objects := make([]types.ObjectIdentifier, len(chunk))
+		for i, key := range chunk {
+			objects[i] = types.ObjectIdentifier{Key: aws.String(key)}
+		}
+		out, err := client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket.Name),
+			Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			for _, key := range chunk {
+				for _, d := range byKey[key] {
+					d.err = &ErrorResponse{Code: http.StatusInternalServerError, Message: "Failed to delete file from S3: " + err.Error()}
+				}
+			}
+			continue
+		}
+		for _, e := range out.Errors {
+			for _, d := range byKey[aws.ToString(e.Key)] {
+				d.err = &ErrorResponse{Code: http.StatusInternalServerError, Message: fmt.Sprintf("Failed to delete file from S3: %s: %s", aws.ToString(e.Code), aws.ToString(e.Message))}
+			}
+		}
+	}
+}
+
+// finish removes the record of a file whose object is gone or shared.
+func (b *bulkRun) finish(ctx context.Context, d *bulkDeletion) {
+	file := d.file
+	if file.Status == models.FileStatusDeleting {
+		if err := file.Transition(models.FileStatusDeleted); err != nil {
+			d.err = &ErrorResponse{Code: http.StatusConflict, Message: err.Error()}
+			return
+		}
+		if err := b.repo.Files.UpdateFile(ctx, file); err != nil {
+			log.Printf("Failed to mark file %s deleted: %v", file.ID, err)
+		}
+	}
+	if err := b.removeFileVersions(ctx, file); err != nil {
+		d.err = &ErrorResponse{Code: http.StatusInternalServerError, Message: "Failed to delete file versions: " + err.Error()}
+		return
+	}
+	if err := b.repo.Files.DeleteFile(ctx, file.ID); err != nil {
+		log.Printf("CRITICAL: File %s deleted from S3 but failed to delete from database: %v", file.ID, err)
+		d.err = &ErrorResponse{Code: http.StatusInternalServerError, Message: "Failed to delete file from database: " + err.Error()}
+		return
+	}
+	b.emit(ctx, models.EventFileDeleted, file)
+}
+
+// run carries out the operations: gets and reference count changes first,
+// then the deletions they and the delete operations call for, in stages so
+// that the objects of a whole bucket go in one S3 request.
+func (b *bulkRun) run(ctx context.Context) {
+	runBounded(len(b.ops), func(i int) { b.apply(ctx, i) })
+
+	pending := func() []*bulkDeletion {
+		var left []*bulkDeletion
+		for _, d := range b.order {
+			if d.err == nil {
+				left = append(left, d)
+			}
+		}
+		return left
+	}
+	deletions := pending()
+	runBounded(len(deletions), func(i int) { b.begin(ctx, deletions[i]) })
+	deletions = pending()
+	runBounded(len(deletions), func(i int) { b.checkObject(ctx, deletions[i]) })
+
+	byBucket := map[string][]*bulkDeletion{}
+	var buckets []*models.Bucket
+	for _, d := range pending() {
+		if !d.deleteObject {
+			continue
+		}
+		if _, ok := byBucket[d.bucket.ID]; !ok {
+			buckets = append(buckets, d.bucket)
+		}
+		byBucket[d.bucket.ID] = append(byBucket[d.bucket.ID], d)
+	}
+	runBounded(len(buckets), func(i int) { b.deleteObjects(ctx, buckets[i], byBucket[buckets[i].ID]) })
+
+	deletions = pending()
+	runBounded(len(deletions), func(i int) { b.finish(ctx, deletions[i]) })
+
+	for _, d := range b.order {
+		if d.err == nil {
+			continue
+		}
+		for _, i := range d.results {
+			b.results[i].Status = d.err.Code
+			b.results[i].Error = d.err
+		}
+	}
+}
+
+// Run file operations in bulk (admin only)
+// @Summary Run file operations in bulk
+// @Description Run up to 1000 get, increment, decrement and delete operations in one request. They run concurrently, so operations on the same file are not ordered, except that deletions, including those of files whose reference count a decrement brings to zero, happen after everything else. Objects are removed with one S3 DeleteObjects request per bucket where possible. Each operation gets its own result with the status the single-file endpoint would have answered with. Admin access required.
+// @Tags files
+// @Accept json
+// @Produce json
+// @Param x-api-token header string true "API Token"
+// @Param data body FileBulkDTO true "Operations"
+// @Success 200 {object} FileBulkResponse
+// @Failure 400 {object} router.ErrorResponse
+// @Failure 401 {object} router.ErrorResponse "Unauthorized"
+// @Failure 403 {object} router.ErrorResponse "Forbidden - Admin only"
+// @Router /api/v1/file/batch [post]
+// @Id RunFileOperations
+func (r *router) FileBulkHandler(c *gin.Context) {
+	var dto FileBulkDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		writeError(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	b := &bulkRun{
+		router:    r,
+		ops:       dto.Operations,
+		results:   make([]FileOperationResult, len(dto.Operations)),
+		deletions: map[string]*bulkDeletion{},
+	}
+	for i, op := range dto.Operations {
+		b.results[i].Op, b.results[i].ID = op.Op, op.ID
+	}
+	b.run(c.Request.Context())
+	c.JSON(http.StatusOK, FileBulkResponse{Results: b.results})
+}
@@ -0,0 +1,166 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+func TestRunBounded(t *testing.T) {
+	viper.Set("bulk-concurrency", 3)
+	defer viper.Set("bulk-concurrency", nil)
+
+	var running, peak, calls int32
+	done := make([]bool, 20)
+	runBounded(len(done), func(i int) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		done[i] = true
+		atomic.AddInt32(&calls, 1)
+		atomic.AddInt32(&running, -1)
+	})
+	if calls != 20 || peak > 3 {
+		t.Errorf("got %d calls with up to %d at once", calls, peak)
+	}
+	for i, ok := range done {
+		if !ok {
+			t.Errorf("index %d was not run", i)
+		}
+	}
+}
+
+func TestFileBulkHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	storage := newFakeS3()
+	defer storage.Close()
+	repo := newFakeRepository()
+	repo.watchEvents()
+	ctx := context.Background()
+	repo.CreateBucket(ctx, storage.bucket("a", "bucket-a"))
+	repo.CreateBucket(ctx, storage.bucket("b", "bucket-b"))
+	for _, f := range []*models.File{
+		{Name: "a1", BucketID: "a", Status: models.FileStatusActive},
+		{Name: "a2", BucketID: "a", Status: models.FileStatusActive},
+		{Name: "a3", BucketID: "a", Status: models.FileStatusActive},
+		{Name: "dup", BucketID: "a", ObjectKey: "a3", Status: models.FileStatusActive},
+		{Name: "b1", BucketID: "b", Status: models.FileStatusActive},
+	} {
+		repo.putFile(f, 1)
+	}
+	for _, key := range []string{"bucket-a/a1", "bucket-a/a2", "bucket-a/a3", "bucket-b/b1"} {
+		bucket, name, _ := strings.Cut(key, "/")
+		storage.put(bucket, name, []byte(key))
+	}
+
+	engine := gin.New()
+	engine.POST("/batch", (&router{repo: repo.repository()}).FileBulkHandler)
+	body := `{"operations":[
+		{"op":"get","id":"a1"},
+		{"op":"get","id":"missing"},
+		{"op":"delete","id":"a1"},
+		{"op":"delete","id":"a2"},
+		{"op":"delete","id":"a3"},
+		{"op":"delete","id":"missing"},
+		{"op":"decrement","id":"b1"},
+		{"op":"increment","id":"dup"}
+	]}`
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	var response FileBulkResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	var statuses []int
+	for _, result := range response.Results {
+		statuses = append(statuses, result.Status)
+	}
+	want := []int{200, 404, 204, 204, 204, 404, 204, 204}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Errorf("statuses %v, want %v", statuses, want)
+	}
+	if response.Results[0].File == nil || response.Results[0].File.ID != "a1" {
+		t.Errorf("expected get to return the file, got %+v", response.Results[0])
+	}
+	if response.Results[5].Error == nil {
+		t.Error("expected an error for the missing file")
+	}
+
+	// One DeleteObjects request per bucket, leaving the object still
+	// referred to by dup.
+	calls := storage.callsOf("DeleteObjects")
+	sort.Strings(calls)
+	if !reflect.DeepEqual(calls, []string{"DeleteObjects bucket-a", "DeleteObjects bucket-b"}) {
+		t.Errorf("DeleteObjects calls %v", calls)
+	}
+	if len(storage.callsOf("DeleteObject")) != 0 {
+		t.Error("expected no single-object deletes")
+	}
+	for key, kept := range map[string]bool{"bucket-a/a1": false, "bucket-a/a2": false, "bucket-a/a3": true, "bucket-b/b1": false} {
+		bucket, name, _ := strings.Cut(key, "/")
+		if storage.has(bucket, name) != kept {
+			t.Errorf("object %s kept = %v, want %v", key, !kept, kept)
+		}
+	}
+	for id, kept := range map[string]bool{"a1": false, "a2": false, "a3": false, "dup": true, "b1": false} {
+		if (repo.file(id) != nil) != kept {
+			t.Errorf("file %s kept = %v, want %v", id, !kept, kept)
+		}
+	}
+	wantEvents := []string{"file.deleted a1", "file.deleted a2", "file.deleted a3", "file.deleted b1", "refcount.zero b1"}
+	if events := repo.emitted(); !reflect.DeepEqual(events, wantEvents) {
+		t.Errorf("events %v, want %v", events, wantEvents)
+	}
+}
+
+func TestFileBulkHandler_BucketFailure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	storage := newFakeS3()
+	defer storage.Close()
+	storage.failBucket = "bucket-b"
+	repo := newFakeRepository()
+	ctx := context.Background()
+	repo.CreateBucket(ctx, storage.bucket("a", "bucket-a"))
+	repo.CreateBucket(ctx, storage.bucket("b", "bucket-b"))
+	repo.putFile(&models.File{Name: "a1", BucketID: "a", Status: models.FileStatusActive}, 1)
+	repo.putFile(&models.File{Name: "b1", BucketID: "b", Status: models.FileStatusActive}, 1)
+	storage.put("bucket-a", "a1", []byte("a1"))
+	storage.put("bucket-b", "b1", []byte("b1"))
+
+	engine := gin.New()
+	engine.POST("/batch", (&router{repo: repo.repository()}).FileBulkHandler)
+	body := `{"operations":[{"op":"delete","id":"a1"},{"op":"delete","id":"b1"}]}`
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(body)))
+	var response FileBulkResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Results) != 2 || response.Results[0].Status != 204 || response.Results[1].Status != 500 {
+		t.Fatalf("expected 204 and 500, got %+v", response.Results)
+	}
+	if repo.file("a1") != nil {
+		t.Error("expected a1 to be deleted")
+	}
+	// b1 stays deleting, so deleting it again picks up where this stopped.
+	if file := repo.file("b1"); file == nil || file.Status != models.FileStatusDeleting {
+		t.Errorf("expected b1 to be left deleting, got %+v", file)
+	}
+}
@@ -0,0 +1,137 @@
+package router
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/argon-chat/KineticaFS/pkg/repositories"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+var (
+	errUploadURLExpired   = errors.New("upload URL has expired")
+	errUploadURLSignature = errors.New("invalid upload URL signature")
+)
+
+// uploadSigningEnabled reports whether upload-signing-key is set. Signed
+// upload URLs have to validate on every instance and across restarts, so
+// without a shared key none are issued or accepted.
+func uploadSigningEnabled() bool {
+	return viper.GetString("upload-signing-key") != ""
+}
+
+// uploadSigningKey returns the key upload URLs are signed with.
+func uploadSigningKey() []byte {
+	return []byte(viper.GetString("upload-signing-key"))
+}
+
+// uploadURLTTL returns how long a signed upload URL stays valid.
+func uploadURLTTL() time.Duration {
+	return viper.GetDuration("upload-url-ttl")
+}
+
+// signUpload computes the signature granting upload access to blob until
+// expires. It covers the size limit and content type rules of file, so a URL
+// stops working if they change.
+func signUpload(blobID string, file *models.File, expires int64) string {
+	var allowed, denied []string
+	if file.UploadPolicy != nil {
+		allowed, denied = file.UploadPolicy.AllowedTypes, file.UploadPolicy.DeniedTypes
+	}
+	mac := hmac.New(sha256.New, uploadSigningKey())
+	fmt.Fprintf(mac, "v1\n%s\n%d\n%d\n%s\n%s", blobID, expires, file.FileSizeLimit, strings.Join(allowed, ","), strings.Join(denied, ","))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// signedUploadURL returns the path of the upload endpoint for blob carrying a
+// signature valid until expires.
+func signedUploadURL(blobID string, file *models.File, expires time.Time) string {
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	query.Set("signature", signUpload(blobID, file, expires.Unix()))
+	return "/api/v1/upload/" + url.PathEscape(blobID) + "?" + query.Encode()
+}
+
+// verifyUploadSignature checks a signature presented for blob against the
+// file it uploads.
+func verifyUploadSignature(blobID string, file *models.File, expires, signature string) error {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return errUploadURLSignature
+	}
+	if !uploadSigningEnabled() {
+		return errUploadURLSignature
+	}
+	if time.Now().Unix() > expiresAt {
+		return errUploadURLExpired
+	}
+	if !hmac.Equal([]byte(signature), []byte(signUpload(blobID, file, expiresAt))) {
+		return errUploadURLSignature
+	}
+	return nil
+}
+
+// UploadAuthMiddleware admits requests to the upload endpoints of a blob that
+// carry a valid signature from a signed upload URL, and otherwise requires a
+// service token like AuthMiddleware. A signed URL grants uploading only;
+// cancelling an upload takes a service token.
+func UploadAuthMiddleware(repo *repositories.ApplicationRepository) GinMiddleware {
+	return uploadAuthMiddleware(repo, func(c *gin.Context) string { return c.Param("blob") })
+}
+
+// uploadAuthMiddleware is UploadAuthMiddleware for a route that names the
+// blob elsewhere than in its path.
+func uploadAuthMiddleware(repo *repositories.ApplicationRepository, blobOf func(*gin.Context) string) GinMiddleware {
+	tokenAuth := AuthMiddleware(repo)
+	return func(c *gin.Context) {
+		signature := c.Query("signature")
+		if signature == "" {
+			tokenAuth(c)
+			return
+		}
+		if c.Request.Method == http.MethodDelete {
+			c.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse{
+				Code:    http.StatusForbidden,
+				Message: "A signed upload URL cannot cancel the upload",
+			})
+			return
+		}
+		ctx := c.Request.Context()
+		blobID := blobOf(c)
+		blob, err := repo.FileBlobs.GetFileBlobByID(ctx, blobID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, ErrorResponse{
+				Code:    http.StatusNotFound,
+				Message: "File blob not found: " + err.Error(),
+			})
+			return
+		}
+		file, err := repo.Files.GetFileByID(ctx, blob.FileID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, ErrorResponse{
+				Code:    http.StatusNotFound,
+				Message: "File not found: " + err.Error(),
+			})
+			return
+		}
+		if err := verifyUploadSignature(blobID, file, c.Query("expires"), signature); err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{
+				Code:    http.StatusUnauthorized,
+				Message: err.Error(),
+			})
+			return
+		}
+		c.Set("uploadBlob", blobID)
+		c.Next()
+	}
+}
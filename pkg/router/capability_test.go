@@ -0,0 +1,86 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+func TestVerifyUploadSignature(t *testing.T) {
+	viper.Set("upload-signing-key", "test-key")
+	defer viper.Set("upload-signing-key", nil)
+
+	file := &models.File{FileSizeLimit: 1024, UploadPolicy: &models.UploadPolicy{AllowedTypes: []string{"image/*"}}}
+	expires := time.Now().Add(time.Hour)
+	u, err := url.Parse(signedUploadURL("blob-1", file, expires))
+	if err != nil {
+		t.Fatalf("invalid upload URL: %v", err)
+	}
+	if u.Path != "/api/v1/upload/blob-1" {
+		t.Errorf("unexpected upload URL path %q", u.Path)
+	}
+	q := u.Query()
+	if err := verifyUploadSignature("blob-1", file, q.Get("expires"), q.Get("signature")); err != nil {
+		t.Fatalf("expected signature to verify, got %v", err)
+	}
+	if err := verifyUploadSignature("blob-2", file, q.Get("expires"), q.Get("signature")); !errors.Is(err, errUploadURLSignature) {
+		t.Errorf("expected signature for another blob to be rejected, got %v", err)
+	}
+	widened := &models.File{FileSizeLimit: 1 << 30, UploadPolicy: file.UploadPolicy}
+	if err := verifyUploadSignature("blob-1", widened, q.Get("expires"), q.Get("signature")); !errors.Is(err, errUploadURLSignature) {
+		t.Errorf("expected signature to be bound to the size limit, got %v", err)
+	}
+	extended := strconv.FormatInt(expires.Add(time.Hour).Unix(), 10)
+	if err := verifyUploadSignature("blob-1", file, extended, q.Get("signature")); !errors.Is(err, errUploadURLSignature) {
+		t.Errorf("expected signature to be bound to the expiry, got %v", err)
+	}
+
+	past := time.Now().Add(-time.Minute)
+	q = mustQuery(t, signedUploadURL("blob-1", file, past))
+	if err := verifyUploadSignature("blob-1", file, q.Get("expires"), q.Get("signature")); !errors.Is(err, errUploadURLExpired) {
+		t.Errorf("expected errUploadURLExpired, got %v", err)
+	}
+}
+
+func mustQuery(t *testing.T, rawURL string) url.Values {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("invalid URL %q: %v", rawURL, err)
+	}
+	return u.Query()
+}
+
+func TestVerifyUploadSignature_NoKey(t *testing.T) {
+	viper.Set("upload-signing-key", "")
+	defer viper.Set("upload-signing-key", nil)
+
+	if uploadSigningEnabled() {
+		t.Error("expected signed upload URLs to be disabled without upload-signing-key")
+	}
+	file := &models.File{}
+	q := mustQuery(t, signedUploadURL("blob-1", file, time.Now().Add(time.Hour)))
+	if err := verifyUploadSignature("blob-1", file, q.Get("expires"), q.Get("signature")); !errors.Is(err, errUploadURLSignature) {
+		t.Errorf("expected signatures to be refused without a key, got %v", err)
+	}
+}
+
+func TestUploadAuthMiddleware_RefusesCancel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	// The request is refused before the blob is looked up.
+	engine.DELETE("/upload/:blob", UploadAuthMiddleware(nil), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/upload/blob-1?expires=1&signature=abc", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a signed cancel, got %d", w.Code)
+	}
+}
@@ -0,0 +1,191 @@
+package router
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/gin-gonic/gin"
+)
+
+type UploadPreflightDTO struct {
+	Checksum string `json:"checksum" binding:"required"` // "sha256:<hex>" of the file to upload
+}
+
+type UploadPreflightResponse struct {
+	// Exists is true if the content is already stored. The file then shares
+	// the stored object, is marked uploaded and the upload can be skipped.
+	Exists bool `json:"exists"`
+}
+
+// findDuplicate returns a finalized file other than file whose content has
+// the given checksum and is stored in the region of bucket, or nil if there is
+// none. Encrypted content is never shared: files sharing an object share its
+// data key, so erasing the key of one would shred the others.
+func (r *router) findDuplicate(ctx context.Context, file *models.File, bucket *models.Bucket, checksum string) (*models.File, error) {
+	if bucket.Encrypt {
+		return nil, nil
+	}
+	candidates, err := r.repo.Files.ListFilesByChecksum(ctx, checksum)
+	if err != nil {
+		return nil, err
+	}
+	for _, candidate := range candidates {
+		if candidate.ID == file.ID || !candidate.Status.Received() {
+			continue
+		}
+		if file.FileSizeLimit > 0 && uint64(candidate.FileSize) > file.FileSizeLimit {
+			continue
+		}
+		if checkContentType(file, candidate.ContentType) != nil {
+			continue
+		}
+		if candidate.Encrypted {
+			continue
+		}
+		if scanBlocksUse(candidate) || (r.scanner != nil && candidate.ScanStatus != models.ScanStatusClean) {
+			continue
+		}
+		if candidate.BucketID == bucket.ID {
+			return candidate, nil
+		}
+		candidateBucket, err := r.repo.Buckets.GetBucketByID(ctx, candidate.BucketID)
+		if err != nil {
+			return nil, err
+		}
+		if candidateBucket != nil && candidateBucket.Region == bucket.Region {
+			return candidate, nil
+		}
+	}
+	return nil, nil
+}
+
+// linkDuplicate points file at the object holding the content of original
+// and marks it uploaded.
+func linkDuplicate(file, original *models.File) error {
+	if err := file.Transition(models.FileStatusUploaded); err != nil {
+		return err
+	}
+	file.BucketID = original.BucketID
+	file.ObjectKey = original.StorageKey()
+	file.Path = original.Path
+	file.FileSize = original.FileSize
+	file.ContentType = original.ContentType
+	file.Checksum = original.Checksum
+	file.ETag = original.ETag
+	file.Encrypted = original.Encrypted
+	file.DataKey = original.DataKey
+	file.ScanStatus = original.ScanStatus
+	file.ScanDetail = original.ScanDetail
+	return nil
+}
+
+// objectInUse reports whether a file other than file, or a version of
+// another file, still refers to the object holding its content. Files being
+// deleted themselves do not count.
+func (r *router) objectInUse(ctx context.Context, file *models.File) (bool, error) {
+	return r.objectReferenced(ctx, file.BucketID, file.StorageKey(),
+		func(other *models.File) bool { return other.ID == file.ID },
+		func(version *models.FileVersion) bool { return version.FileID == file.ID })
+}
+
+// removing reports whether file is being or has been deleted.
+func removing(file *models.File) bool {
+	return file.Status == models.FileStatusDeleting || file.Status == models.FileStatusDeleted
+}
+
+// deduplicateUpload checks whether the object just stored for file duplicates
+// existing content when its bucket deduplicates uploads. If so, file is
+// pointed at the existing object and the returned function deletes the new
+// copy; call it once the file record has been saved.
+func (r *router) deduplicateUpload(ctx context.Context, file *models.File, bucket *models.Bucket, checksum string) func() {
+	if !bucket.Deduplicate {
+		return nil
+	}
+	original, err := r.findDuplicate(ctx, file, bucket, checksum)
+	if err != nil {
+		log.Printf("Failed to look up duplicates of file %s: %v", file.ID, err)
+		return nil
+	}
+	if original == nil {
+		return nil
+	}
+	if err := linkDuplicate(file, original); err != nil {
+		log.Printf("Failed to link file %s to duplicate %s: %v", file.ID, original.ID, err)
+		return nil
+	}
+	return func() {
+		if err := deleteObjectKey(context.WithoutCancel(ctx), bucket, file.Name); err != nil {
+			log.Printf("Failed to delete duplicate object %s/%s: %v", bucket.Name, file.Name, err)
+		}
+	}
+}
+
+// Upload preflight (client)
+// @Summary Upload preflight
+// @Description Ask whether content with the given SHA-256 checksum is already stored. If the bucket deduplicates content, is not encrypted, and an identical file exists in its region, the file is linked to the stored object and marked uploaded, so the client can skip the upload and go straight to finalization.
+// @Tags upload
+// @Accept json
+// @Produce json
+// @Param x-api-token header string false "API Token, unless a signed upload URL is used"
+// @Param expires query int false "Expiry of a signed upload URL (Unix seconds)"
+// @Param signature query string false "Signature of a signed upload URL"
+// @Param blob path string true "Blob ID"
+// @Param data body UploadPreflightDTO true "Checksum of the file to upload"
+// @Success 200 {object} UploadPreflightResponse
+// @Failure 400 {object} router.ErrorResponse
+// @Failure 401 {object} router.ErrorResponse "Unauthorized"
+// @Failure 404 {object} router.ErrorResponse
+// @Failure 409 {object} router.ErrorResponse "Upload already started or completed"
+// @Failure 410 {object} router.ErrorResponse "Upload session expired"
+// @Router /api/v1/upload/{blob}/preflight [post]
+// @Id UploadPreflight
+func (r *router) UploadPreflightHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	var dto UploadPreflightDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		writeError(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if _, err := parseChecksum(dto.Checksum); err != nil {
+		writeError(c, http.StatusBadRequest, "Invalid checksum: "+err.Error())
+		return
+	}
+
+	blob, file, bucket, ok := r.loadUploadSession(c, c.Param("blob"))
+	if !ok {
+		return
+	}
+	if file.Status != models.FileStatusPending || blob.UploadOffset > 0 {
+		writeError(c, http.StatusConflict, "Upload has already been started for this blob")
+		return
+	}
+	if file.Checksum != "" && file.Checksum != dto.Checksum {
+		writeError(c, http.StatusBadRequest, "Checksum conflicts with the checksum declared for the file")
+		return
+	}
+	if !bucket.Deduplicate {
+		c.JSON(http.StatusOK, UploadPreflightResponse{Exists: false})
+		return
+	}
+
+	original, err := r.findDuplicate(ctx, file, bucket, dto.Checksum)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "Failed to look up stored content: "+err.Error())
+		return
+	}
+	if original == nil {
+		c.JSON(http.StatusOK, UploadPreflightResponse{Exists: false})
+		return
+	}
+	if err := linkDuplicate(file, original); err != nil {
+		writeError(c, http.StatusConflict, err.Error())
+		return
+	}
+	if err := r.repo.Files.UpdateFile(ctx, file); err != nil {
+		writeError(c, http.StatusInternalServerError, "Failed to update file record: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, UploadPreflightResponse{Exists: true})
+}
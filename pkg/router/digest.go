@@ -0,0 +1,145 @@
+package router
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/gin-gonic/gin"
+)
+
+var errDigestMismatch = errors.New("uploaded data does not match the declared checksum")
+
+// expectedDigest holds the checksums a client declared for an upload. Nil
+// fields were not declared and are not checked.
+type expectedDigest struct {
+	SHA256 []byte
+	MD5    []byte
+}
+
+// parseDigestHeaders reads the checksums declared in the Content-Digest
+// (RFC 9530, sha-256 only), X-Checksum-SHA256 (hex or base64) and Content-MD5
+// headers.
+func parseDigestHeaders(h http.Header) (expectedDigest, error) {
+	var d expectedDigest
+	if header := h.Get("Content-Digest"); header != "" {
+		for _, member := range strings.Split(header, ",") {
+			alg, value, ok := strings.Cut(strings.TrimSpace(member), "=")
+			if !ok || len(value) < 2 || value[0] != ':' || value[len(value)-1] != ':' {
+				return d, errors.New("invalid Content-Digest header")
+			}
+			if !strings.EqualFold(alg, "sha-256") {
+				continue
+			}
+			sum, err := base64.StdEncoding.DecodeString(value[1 : len(value)-1])
+			if err != nil || len(sum) != sha256.Size {
+				return d, errors.New("invalid sha-256 value in Content-Digest header")
+			}
+			d.SHA256 = sum
+		}
+	}
+	if header := h.Get("X-Checksum-SHA256"); header != "" {
+		sum, err := decodeDigest(header, sha256.Size)
+		if err != nil {
+			return d, errors.New("invalid X-Checksum-SHA256 header")
+		}
+		if d.SHA256 != nil && !bytes.Equal(d.SHA256, sum) {
+			return d, errors.New("Content-Digest and X-Checksum-SHA256 headers disagree")
+		}
+		d.SHA256 = sum
+	}
+	if header := h.Get("Content-MD5"); header != "" {
+		sum, err := base64.StdEncoding.DecodeString(header)
+		if err != nil || len(sum) != md5.Size {
+			return d, errors.New("invalid Content-MD5 header")
+		}
+		d.MD5 = sum
+	}
+	return d, nil
+}
+
+// decodeDigest decodes a digest of the given size given in hex or base64.
+func decodeDigest(value string, size int) ([]byte, error) {
+	if len(value) == hex.EncodedLen(size) {
+		return hex.DecodeString(value)
+	}
+	sum, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(sum) != size {
+		return nil, fmt.Errorf("digest must be %d bytes", size)
+	}
+	return sum, nil
+}
+
+// parseChecksum decodes a checksum in the "sha256:<hex>" form stored on
+// models.File.
+func parseChecksum(checksum string) ([]byte, error) {
+	value, ok := strings.CutPrefix(checksum, "sha256:")
+	if !ok {
+		return nil, errors.New(`checksum must have the form "sha256:<hex>"`)
+	}
+	sum, err := hex.DecodeString(value)
+	if err != nil || len(sum) != sha256.Size {
+		return nil, errors.New("checksum must be a hex-encoded SHA-256 digest")
+	}
+	return sum, nil
+}
+
+// withChecksum adds the SHA-256 checksum declared for a file at initiation,
+// if any. It fails if the request declared a different one.
+func (d expectedDigest) withChecksum(checksum string) (expectedDigest, error) {
+	if checksum == "" {
+		return d, nil
+	}
+	sum, err := parseChecksum(checksum)
+	if err != nil {
+		return d, err
+	}
+	if d.SHA256 != nil && !bytes.Equal(d.SHA256, sum) {
+		return d, errDigestMismatch
+	}
+	d.SHA256 = sum
+	return d, nil
+}
+
+// verify compares the digests computed while streaming with the declared ones.
+func (d expectedDigest) verify(sha256Sum, md5Sum []byte) error {
+	if d.SHA256 != nil && !bytes.Equal(d.SHA256, sha256Sum) {
+		return errDigestMismatch
+	}
+	if d.MD5 != nil && !bytes.Equal(d.MD5, md5Sum) {
+		return errDigestMismatch
+	}
+	return nil
+}
+
+// expectedUploadDigest collects the checksums the upload of file must match:
+// those declared in the request headers and the one declared when the upload
+// was initiated. It writes a 400 response and returns false if they are
+// malformed or contradict each other.
+func expectedUploadDigest(c *gin.Context, file *models.File) (expectedDigest, bool) {
+	expected, err := parseDigestHeaders(c.Request.Header)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, err.Error())
+		return expected, false
+	}
+	if file.Status.Received() {
+		// The stored checksum describes the previous upload.
+		return expected, true
+	}
+	expected, err = expected.withChecksum(file.Checksum)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, "Request checksum conflicts with the checksum declared for the file")
+		return expected, false
+	}
+	return expected, true
+}
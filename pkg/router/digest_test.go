@@ -0,0 +1,60 @@
+package router
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestParseDigestHeaders(t *testing.T) {
+	data := []byte("kinetica")
+	sha := sha256.Sum256(data)
+	sum := md5.Sum(data)
+
+	h := http.Header{}
+	h.Set("Content-Digest", "sha-512=:AAAA:, sha-256=:"+base64.StdEncoding.EncodeToString(sha[:])+":")
+	h.Set("X-Checksum-SHA256", hex.EncodeToString(sha[:]))
+	h.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+	d, err := parseDigestHeaders(h)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(d.SHA256, sha[:]) || !bytes.Equal(d.MD5, sum[:]) {
+		t.Fatalf("unexpected digests: %+v", d)
+	}
+	if err := d.verify(sha[:], sum[:]); err != nil {
+		t.Errorf("expected digests to verify, got %v", err)
+	}
+	if err := d.verify(sha[:], make([]byte, md5.Size)); !errors.Is(err, errDigestMismatch) {
+		t.Errorf("expected errDigestMismatch, got %v", err)
+	}
+
+	h = http.Header{}
+	h.Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sha[:])+":")
+	h.Set("X-Checksum-SHA256", hex.EncodeToString(make([]byte, sha256.Size)))
+	if _, err := parseDigestHeaders(h); err == nil {
+		t.Error("expected an error for disagreeing headers")
+	}
+}
+
+func TestExpectedDigest_WithChecksum(t *testing.T) {
+	sha := sha256.Sum256([]byte("kinetica"))
+	checksum := fmt.Sprintf("sha256:%x", sha)
+
+	d, err := expectedDigest{}.withChecksum(checksum)
+	if err != nil || !bytes.Equal(d.SHA256, sha[:]) {
+		t.Fatalf("expected declared checksum to be adopted, got %x, %v", d.SHA256, err)
+	}
+	if _, err := (expectedDigest{SHA256: make([]byte, sha256.Size)}).withChecksum(checksum); !errors.Is(err, errDigestMismatch) {
+		t.Errorf("expected errDigestMismatch, got %v", err)
+	}
+	if _, err := (expectedDigest{}).withChecksum("md5:abc"); err == nil {
+		t.Error("expected an error for an unsupported checksum")
+	}
+}
@@ -0,0 +1,184 @@
+package router
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/spf13/viper"
+)
+
+// maxWebhookBackoff caps the delay between two attempts of a delivery.
+const maxWebhookBackoff = 6 * time.Hour
+
+// webhookBackoff returns how long to wait after the given number of failed
+// attempts: webhook-retry-backoff, doubled with each further attempt.
+func webhookBackoff(attempts int) time.Duration {
+	delay := viper.GetDuration("webhook-retry-backoff")
+	for i := 1; i < attempts && delay < maxWebhookBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxWebhookBackoff)
+}
+
+// signWebhookPayload returns the X-KineticaFS-Signature header of body sent
+// at t: "t=<unix time>,v1=<hex HMAC-SHA256 of "<t>.<body>">". Receivers
+// recompute it with the webhook secret, and reject old timestamps to guard
+// against replays.
+func signWebhookPayload(secret string, t time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// postWebhook sends a delivery to its webhook once. It returns the HTTP status
+// the endpoint answered with, if any, and an error unless it was a 2xx.
+func postWebhook(ctx context.Context, client *http.Client, webhook *models.Webhook, delivery *models.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "KineticaFS-Webhook")
+	req.Header.Set("X-KineticaFS-Event", string(delivery.Event))
+	req.Header.Set("X-KineticaFS-Delivery", delivery.ID)
+	req.Header.Set("X-KineticaFS-Signature", signWebhookPayload(webhook.Secret, time.Now(), body))
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// deliveryLease returns how long a claimed delivery is left to the dispatcher
+// sending it: the time the endpoint may take to answer, and a minute to
+// record the outcome. A delivery whose dispatcher stopped is retried after it.
+func deliveryLease() time.Duration {
+	return viper.GetDuration("webhook-timeout") + time.Minute
+}
+
+// webhookDispatcher sends queued webhook deliveries, retrying failed ones with
+// exponential backoff until webhook-max-attempts is reached. Deliveries are
+// attempted one at a time, roughly in the order their events were raised.
+// Every instance runs a dispatcher; each delivery is claimed before it is
+// sent, so only one of them sends it.
+type webhookDispatcher struct {
+	*router
+	interval time.Duration
+	client   *http.Client
+}
+
+// NewWebhookDispatcher returns a dispatcher that server wakes when it queues
+// deliveries.
+func NewWebhookDispatcher(server *router) *webhookDispatcher {
+	return &webhookDispatcher{
+		router:   server,
+		interval: viper.GetDuration("webhook-poll-interval"),
+		client:   &http.Client{Timeout: viper.GetDuration("webhook-timeout")},
+	}
+}
+
+func (d *webhookDispatcher) Run(ctx context.Context, wg *sync.WaitGroup) error {
+	defer wg.Done()
+	if d.interval <= 0 {
+		return fmt.Errorf("webhook poll interval must be positive, got %s", d.interval)
+	}
+	log.Printf("Dispatching webhook deliveries every %s", d.interval)
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		d.dispatch(ctx)
+		select {
+		case <-ctx.Done():
+			log.Println("Webhook dispatcher stopped")
+			return nil
+		case <-ticker.C:
+		case <-d.webhookWake:
+		}
+	}
+}
+
+func (d *webhookDispatcher) dispatch(ctx context.Context) {
+	deliveries, err := d.repo.Webhooks.ListDueDeliveries(ctx, time.Now().UTC())
+	if err != nil {
+		log.Printf("Failed to list due webhook deliveries: %v", err)
+		return
+	}
+	webhooks := map[string]*models.Webhook{}
+	for _, delivery := range deliveries {
+		if ctx.Err() != nil {
+			return
+		}
+		claimed, err := d.repo.Webhooks.ClaimDelivery(ctx, delivery, time.Now().UTC().Add(deliveryLease()))
+		if err != nil {
+			log.Printf("Failed to claim delivery %s: %v", delivery.ID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		webhook, ok := webhooks[delivery.WebhookID]
+		if !ok {
+			webhook, err = d.repo.Webhooks.GetWebhookByID(ctx, delivery.WebhookID)
+			if err != nil {
+				log.Printf("Failed to load webhook %s: %v", delivery.WebhookID, err)
+				continue
+			}
+			webhooks[delivery.WebhookID] = webhook
+		}
+		d.attempt(ctx, webhook, delivery)
+	}
+}
+
+// attempt sends a delivery and records the outcome, scheduling the next
+// attempt if it failed.
+func (d *webhookDispatcher) attempt(ctx context.Context, webhook *models.Webhook, delivery *models.WebhookDelivery) {
+	switch {
+	case webhook == nil:
+		delivery.Status = models.DeliveryStatusFailed
+		delivery.LastError = "webhook has been deleted"
+	case !webhook.Enabled:
+		delivery.Status = models.DeliveryStatusFailed
+		delivery.LastError = "webhook is disabled"
+	default:
+		delivery.Attempts++
+		status, err := postWebhook(ctx, d.client, webhook, delivery)
+		delivery.ResponseStatus = status
+		switch {
+		case err == nil:
+			delivery.Status = models.DeliveryStatusSucceeded
+			delivery.LastError = ""
+		case delivery.Attempts >= viper.GetInt("webhook-max-attempts"):
+			log.Printf("Giving up delivery %s to webhook %s after %d attempts: %v", delivery.ID, webhook.ID, delivery.Attempts, err)
+			delivery.Status = models.DeliveryStatusFailed
+			delivery.LastError = err.Error()
+		default:
+			delivery.LastError = err.Error()
+			delivery.NextAttemptAt = time.Now().UTC().Add(webhookBackoff(delivery.Attempts))
+		}
+	}
+	// The attempt was made; record it even if shutdown interrupted it.
+	if err := d.repo.Webhooks.UpdateDelivery(context.WithoutCancel(ctx), delivery); err != nil {
+		log.Printf("Failed to record delivery %s: %v", delivery.ID, err)
+	}
+}
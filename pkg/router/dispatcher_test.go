@@ -0,0 +1,125 @@
+package router
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/spf13/viper"
+)
+
+func TestPostWebhook_Signature(t *testing.T) {
+	webhook := &models.Webhook{Secret: "whsec_test"}
+	delivery := &models.WebhookDelivery{
+		ApplicationModel: models.ApplicationModel{ID: "delivery-1"},
+		Event:            models.EventFileFinalized,
+		Payload:          `{"type":"file.finalized"}`,
+	}
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		if req.Header.Get("X-KineticaFS-Event") != "file.finalized" || req.Header.Get("X-KineticaFS-Delivery") != "delivery-1" {
+			t.Errorf("unexpected headers %v", req.Header)
+		}
+		timestamp, signature, _ := strings.Cut(req.Header.Get("X-KineticaFS-Signature"), ",v1=")
+		mac := hmac.New(sha256.New, []byte(webhook.Secret))
+		mac.Write([]byte(strings.TrimPrefix(timestamp, "t=") + "." + string(body)))
+		if signature != hex.EncodeToString(mac.Sum(nil)) {
+			t.Errorf("signature %q does not match body %q", signature, body)
+		}
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	webhook.URL = srv.URL
+
+	if code, err := postWebhook(context.Background(), srv.Client(), webhook, delivery); err != nil || code != http.StatusNoContent {
+		t.Errorf("expected success, got %d, %v", code, err)
+	}
+	status = http.StatusServiceUnavailable
+	if code, err := postWebhook(context.Background(), srv.Client(), webhook, delivery); err == nil || code != http.StatusServiceUnavailable {
+		t.Errorf("expected failure with 503, got %d, %v", code, err)
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	viper.Set("webhook-retry-backoff", 30*time.Second)
+	defer viper.Set("webhook-retry-backoff", nil)
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{5, 8 * time.Minute},
+		{40, maxWebhookBackoff},
+	}
+	for _, tt := range tests {
+		if got := webhookBackoff(tt.attempts); got != tt.want {
+			t.Errorf("webhookBackoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+// TestDispatch_Claims checks that dispatchers of several instances listing
+// the same due deliveries send each of them once.
+func TestDispatch_Claims(t *testing.T) {
+	viper.Set("webhook-max-attempts", 3)
+	defer viper.Set("webhook-max-attempts", nil)
+
+	var mu sync.Mutex
+	received := map[string]int{}
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received[r.Header.Get("X-KineticaFS-Delivery")]++
+		mu.Unlock()
+	}))
+	defer endpoint.Close()
+
+	repo := newFakeRepository()
+	ctx := context.Background()
+	webhook := &models.Webhook{URL: endpoint.URL, Enabled: true}
+	repo.CreateWebhook(ctx, webhook)
+	due := time.Now().UTC().Add(-time.Second)
+	for i := 0; i < 20; i++ {
+		repo.CreateDelivery(ctx, &models.WebhookDelivery{
+			WebhookID:     webhook.ID,
+			Event:         models.EventFileDeleted,
+			Payload:       "{}",
+			Status:        models.DeliveryStatusPending,
+			NextAttemptAt: due,
+		})
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d := &webhookDispatcher{router: &router{repo: repo.repository()}, client: endpoint.Client()}
+			d.dispatch(ctx)
+		}()
+	}
+	wg.Wait()
+
+	if len(received) != 20 {
+		t.Errorf("expected 20 deliveries sent, got %d", len(received))
+	}
+	for id, count := range received {
+		if count != 1 {
+			t.Errorf("delivery %s sent %d times", id, count)
+		}
+	}
+	if pending := repo.matchDeliveries(func(d *models.WebhookDelivery) bool { return d.Status != models.DeliveryStatusSucceeded }); len(pending) > 0 {
+		t.Errorf("%d deliveries not recorded as sent", len(pending))
+	}
+}
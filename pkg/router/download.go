@@ -0,0 +1,192 @@
+package router
+
+import (
+	"context"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/gin-gonic/gin"
+)
+
+// downloadCacheControl lets clients keep a downloaded file for an hour and
+// revalidate it with its ETag afterwards.
+const downloadCacheControl = "private, max-age=3600"
+
+// objectReader reads an S3 object as an io.ReadSeeker so it can be handed to
+// http.ServeContent, which takes care of Range, If-Range and the conditional
+// request headers. Seeking is free; each read after a seek opens a ranged
+// GetObject starting at the new offset.
+type objectReader struct {
+	ctx    context.Context
+	client *s3.Client
+	bucket string
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+	err    error // first failure to open the object, reported after serving
+}
+
+func (o *objectReader) Read(p []byte) (int, error) {
+	if o.offset >= o.size {
+		return 0, io.EOF
+	}
+	if o.body == nil {
+		input := &s3.GetObjectInput{
+			Bucket: aws.String(o.bucket),
+			Key:    aws.String(o.key),
+		}
+		if o.offset > 0 {
+			input.Range = aws.String(fmt.Sprintf("bytes=%d-", o.offset))
+		}
+		out, err := o.client.GetObject(o.ctx, input)
+		if err != nil {
+			o.err = fmt.Errorf("get object: %w", err)
+			return 0, o.err
+		}
+		o.body = out.Body
+	}
+	n, err := o.body.Read(p)
+	o.offset += int64(n)
+	return n, err
+}
+
+func (o *objectReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += o.offset
+	case io.SeekEnd:
+		offset += o.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	if offset != o.offset {
+		o.Close()
+		o.offset = offset
+	}
+	return offset, nil
+}
+
+func (o *objectReader) Close() error {
+	if o.body == nil {
+		return nil
+	}
+	err := o.body.Close()
+	o.body = nil
+	return err
+}
+
+// fileETag returns the entity tag served for file: the ETag of its object, or
+// its checksum if the object ETag was never recorded.
+func fileETag(file *models.File) string {
+	if file.ETag != "" {
+		return file.ETag
+	}
+	if file.Checksum != "" {
+		return fmt.Sprintf("%q", file.Checksum)
+	}
+	return ""
+}
+
+// Download file content
+// @Summary Download file content
+// @Description Stream the content of an uploaded file from its bucket. Supports Range requests for partial downloads and media seeking, and If-None-Match, If-Modified-Since and If-Range for conditional requests. Content of encrypted files is decrypted on the fly.
+// @Tags files
+// @Produce octet-stream
+// @Param x-api-token header string true "API Token"
+// @Param id path string true "File ID"
+// @Param version query int false "Version to download, the current one by default"
+// @Param Range header string false "Byte range, e.g. bytes=0-1048575"
+// @Param If-None-Match header string false "ETag of a cached copy"
+// @Param If-Modified-Since header string false "Date of a cached copy"
+// @Success 200 {file} file "File content"
+// @Success 206 {file} file "Partial file content"
+// @Success 304 "Not modified"
+// @Failure 401 {object} router.ErrorResponse "Unauthorized"
+// @Failure 404 {object} router.ErrorResponse
+// @Failure 409 {object} router.ErrorResponse "File has not been uploaded yet, or has not passed content scanning"
+// @Failure 410 {object} router.ErrorResponse "File content has been erased"
+// @Failure 416 "Requested range not satisfiable"
+// @Router /api/v1/file/{id}/content [get]
+// @Id DownloadFile
+func (r *router) DownloadFileHandler(c *gin.Context) {
+	id := c.Param("id")
+	ctx := c.Request.Context()
+
+	file, err := r.repo.Files.GetFileByID(ctx, id)
+	if err != nil {
+		writeError(c, http.StatusNotFound, "File not found: "+err.Error())
+		return
+	}
+	file, ok := r.fileAtVersion(c, file)
+	if !ok {
+		return
+	}
+	if file.Status != models.FileStatusUploaded && file.Status != models.FileStatusActive {
+		writeError(c, http.StatusConflict, fmt.Sprintf("File content is not available while the file is %s", file.Status))
+		return
+	}
+	if scanBlocksUse(file) {
+		writeError(c, http.StatusConflict, fmt.Sprintf("File content is not available: scan %s", file.ScanStatus))
+		return
+	}
+	var aead cipher.AEAD
+	if file.Encrypted {
+		aead, err = fileCipher(file)
+		if errors.Is(err, errDataKeyErased) {
+			writeError(c, http.StatusGone, "File content has been erased")
+			return
+		}
+		if err != nil {
+			writeError(c, http.StatusInternalServerError, "Failed to unwrap data key: "+err.Error())
+			return
+		}
+	}
+	bucket, err := r.repo.Buckets.GetBucketByID(ctx, file.BucketID)
+	if err != nil || bucket == nil {
+		writeError(c, http.StatusNotFound, "Bucket not found")
+		return
+	}
+	s3Client, err := createS3Client(bucket)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "Failed to create S3 client: "+err.Error())
+		return
+	}
+
+	content := &objectReader{
+		ctx:    ctx,
+		client: s3Client,
+		bucket: bucket.Name,
+		key:    file.StorageKey(),
+		size:   file.FileSize,
+	}
+	defer content.Close()
+	var body io.ReadSeeker = content
+	if aead != nil {
+		content.size = encryptedSize(file.FileSize)
+		body = newDecryptingReader(content, aead, file.FileSize)
+	}
+
+	if file.ContentType != "" {
+		c.Header("Content-Type", file.ContentType)
+	}
+	if etag := fileETag(file); etag != "" {
+		c.Header("ETag", etag)
+	}
+	c.Header("Cache-Control", downloadCacheControl)
+	http.ServeContent(c.Writer, c.Request, "", file.UpdatedAt, body)
+	if content.err != nil {
+		log.Printf("Failed to stream file %s from %s/%s: %v", file.ID, bucket.Name, content.key, content.err)
+	}
+}
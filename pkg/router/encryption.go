@@ -0,0 +1,377 @@
+package router
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// Encrypted objects are stored as a sequence of segments, each holding up to
+// segmentSize bytes of plaintext sealed with AES-GCM under the data key of the
+// file: a random nonce, the ciphertext and the tag. Segments are sealed
+// independently, so a range of the plaintext can be read by decrypting only
+// the segments covering it. Each segment is bound to its index so segments
+// cannot be reordered; truncation shows up against the size on record.
+const (
+	segmentSize     = 64 << 10
+	segmentOverhead = 12 + 16 // nonce and tag
+	dataKeySize     = 32
+)
+
+var (
+	errEncryptionNotConfigured = errors.New("no encryption master key is configured")
+	errDataKeyErased           = errors.New("the data key of the file has been erased")
+)
+
+// encryptedSize returns the size of the object storing size bytes of
+// plaintext.
+func encryptedSize(size int64) int64 {
+	segments := (size + segmentSize - 1) / segmentSize
+	return size + segments*segmentOverhead
+}
+
+// alignToSegment rounds n up to a whole number of segments.
+func alignToSegment(n int64) int64 {
+	return (n + segmentSize - 1) / segmentSize * segmentSize
+}
+
+// masterKey returns the key data keys are wrapped with, read from
+// encryption-master-key or the file named by encryption-master-key-file. The
+// key is 32 bytes, given base64 encoded.
+func masterKey() ([]byte, error) {
+	encoded := viper.GetString("encryption-master-key")
+	if encoded == "" {
+		path := viper.GetString("encryption-master-key-file")
+		if path == "" {
+			return nil, errEncryptionNotConfigured
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read master key file: %w", err)
+		}
+		encoded = strings.TrimSpace(string(data))
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("decode master key: %w", err)
+	}
+	if len(key) != dataKeySize {
+		return nil, fmt.Errorf("master key must be %d bytes, got %d", dataKeySize, len(key))
+	}
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealRandom encrypts data under aead with a random nonce, which it prepends.
+func sealRandom(aead cipher.AEAD, data, additional []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, data, additional), nil
+}
+
+func openRandom(aead cipher.AEAD, sealed, additional []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("sealed data is too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additional)
+}
+
+// newDataKey generates a data key for file and stores it on the file wrapped
+// by the master key. It returns the cipher to encrypt the file content with.
+func newDataKey(file *models.File) (cipher.AEAD, error) {
+	master, err := masterKey()
+	if err != nil {
+		return nil, err
+	}
+	key := make([]byte, dataKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	wrapper, err := newGCM(master)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := sealRandom(wrapper, key, []byte("kineticafs data key"))
+	if err != nil {
+		return nil, err
+	}
+	file.Encrypted = true
+	file.DataKey = wrapped
+	return newGCM(key)
+}
+
+// uploadCipher prepares file for a new upload into bucket. If the bucket
+// encrypts content, the file gets a fresh data key and the cipher for it is
+// returned; otherwise the file is marked unencrypted and the cipher is nil.
+// The file record is not saved.
+func uploadCipher(file *models.File, bucket *models.Bucket) (cipher.AEAD, error) {
+	if !bucket.Encrypt {
+		file.Encrypted = false
+		file.DataKey = nil
+		return nil, nil
+	}
+	return newDataKey(file)
+}
+
+// fileCipher unwraps the data key of an encrypted file.
+func fileCipher(file *models.File) (cipher.AEAD, error) {
+	if len(file.DataKey) == 0 {
+		return nil, errDataKeyErased
+	}
+	master, err := masterKey()
+	if err != nil {
+		return nil, err
+	}
+	wrapper, err := newGCM(master)
+	if err != nil {
+		return nil, err
+	}
+	key, err := openRandom(wrapper, file.DataKey, []byte("kineticafs data key"))
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key: %w", err)
+	}
+	return newGCM(key)
+}
+
+func segmentAdditionalData(index int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(index))
+}
+
+// sealSegments encrypts plain as consecutive segments starting at segment
+// index first.
+func sealSegments(aead cipher.AEAD, plain []byte, first int64) ([]byte, error) {
+	out := make([]byte, 0, encryptedSize(int64(len(plain))))
+	for index := first; len(plain) > 0; index++ {
+		n := min(len(plain), segmentSize)
+		segment, err := sealRandom(aead, plain[:n], segmentAdditionalData(index))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, segment...)
+		plain = plain[n:]
+	}
+	return out, nil
+}
+
+// encryptingReader encrypts the plaintext read from src into segments.
+type encryptingReader struct {
+	src   io.Reader
+	aead  cipher.AEAD
+	index int64
+	plain []byte
+	out   []byte
+	err   error
+}
+
+func newEncryptingReader(src io.Reader, aead cipher.AEAD) *encryptingReader {
+	return &encryptingReader{src: src, aead: aead, plain: make([]byte, segmentSize)}
+}
+
+func (e *encryptingReader) Read(p []byte) (int, error) {
+	for len(e.out) == 0 {
+		if e.err != nil {
+			return 0, e.err
+		}
+		n, err := io.ReadFull(e.src, e.plain)
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = io.EOF
+		}
+		e.err = err
+		if n == 0 {
+			continue
+		}
+		if e.out, err = sealRandom(e.aead, e.plain[:n], segmentAdditionalData(e.index)); err != nil {
+			e.err = err
+			return 0, err
+		}
+		e.index++
+	}
+	n := copy(p, e.out)
+	e.out = e.out[n:]
+	return n, nil
+}
+
+// decryptingReader reads the plaintext of an encrypted object from src, which
+// reads the object itself. Seeking only moves the position; the segment
+// covering it is fetched and decrypted on the next read.
+type decryptingReader struct {
+	src    io.ReadSeeker
+	aead   cipher.AEAD
+	size   int64 // plaintext size
+	offset int64
+	index  int64 // index of the segment held in plain, -1 for none
+	plain  []byte
+	buf    []byte
+	srcPos int64
+}
+
+func newDecryptingReader(src io.ReadSeeker, aead cipher.AEAD, size int64) *decryptingReader {
+	return &decryptingReader{
+		src:   src,
+		aead:  aead,
+		size:  size,
+		index: -1,
+		buf:   make([]byte, segmentSize+segmentOverhead),
+	}
+}
+
+func (d *decryptingReader) Read(p []byte) (int, error) {
+	if d.offset >= d.size {
+		return 0, io.EOF
+	}
+	index := d.offset / segmentSize
+	if index != d.index {
+		if err := d.load(index); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain[d.offset-index*segmentSize:])
+	d.offset += int64(n)
+	return n, nil
+}
+
+func (d *decryptingReader) load(index int64) error {
+	start := index * (segmentSize + segmentOverhead)
+	if d.srcPos != start {
+		if _, err := d.src.Seek(start, io.SeekStart); err != nil {
+			return err
+		}
+		d.srcPos = start
+	}
+	n := min(d.size-index*segmentSize, segmentSize)
+	segment := d.buf[:n+segmentOverhead]
+	if _, err := io.ReadFull(d.src, segment); err != nil {
+		d.srcPos = -1
+		return err
+	}
+	d.srcPos += int64(len(segment))
+	plain, err := openRandom(d.aead, segment, segmentAdditionalData(index))
+	if err != nil {
+		return fmt.Errorf("decrypt segment %d: %w", index, err)
+	}
+	d.plain = plain
+	d.index = index
+	return nil
+}
+
+func (d *decryptingReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += d.offset
+	case io.SeekEnd:
+		offset += d.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	d.offset = offset
+	return offset, nil
+}
+
+// filesSharingObject returns file and every other file whose content is the
+// same object. Encrypted uploads are no longer deduplicated, but files linked
+// before that share the object and its data key.
+func (r *router) filesSharingObject(ctx context.Context, file *models.File) ([]*models.File, error) {
+	shared := []*models.File{file}
+	key := file.StorageKey()
+	if key != file.Name {
+		owner, err := r.repo.Files.GetFileByName(ctx, key)
+		if err == nil && owner != nil && owner.BucketID == file.BucketID && owner.ObjectKey == "" {
+			shared = append(shared, owner)
+		}
+	}
+	files, err := r.repo.Files.ListFilesByObjectKey(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	for _, other := range files {
+		if other.ID != file.ID && other.BucketID == file.BucketID {
+			shared = append(shared, other)
+		}
+	}
+	return shared, nil
+}
+
+// Erase file data key (admin only)
+// @Summary Erase file data key
+// @Description Crypto-shred the content of an encrypted file by deleting its wrapped data key. The stored object can no longer be decrypted and downloads return 410. Earlier versions of the file lose their keys as well. Encrypted content is not deduplicated, so other files keep theirs; only files linked to the same object by an older release share its key. The file record itself is kept. Admin access required.
+// @Tags files
+// @Param x-api-token header string true "API Token"
+// @Param id path string true "File ID"
+// @Success 204 "Data key erased"
+// @Failure 400 {object} router.ErrorResponse "File is not encrypted"
+// @Failure 401 {object} router.ErrorResponse "Unauthorized"
+// @Failure 403 {object} router.ErrorResponse "Forbidden - Admin only"
+// @Failure 404 {object} router.ErrorResponse
+// @Failure 500 {object} router.ErrorResponse
+// @Router /api/v1/file/{id}/key [delete]
+// @Id EraseFileKey
+func (r *router) EraseFileKeyHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	file, err := r.repo.Files.GetFileByID(ctx, c.Param("id"))
+	if err != nil {
+		writeError(c, http.StatusNotFound, "File not found: "+err.Error())
+		return
+	}
+	if !file.Encrypted {
+		writeError(c, http.StatusBadRequest, "File is not encrypted")
+		return
+	}
+	files, err := r.filesSharingObject(ctx, file)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "Failed to look up files sharing the content: "+err.Error())
+		return
+	}
+	for _, shared := range files {
+		if len(shared.DataKey) == 0 {
+			continue
+		}
+		shared.DataKey = nil
+		if err := r.repo.Files.UpdateFile(ctx, shared); err != nil {
+			writeError(c, http.StatusInternalServerError, "Failed to erase data key: "+err.Error())
+			return
+		}
+	}
+	versions, err := r.repo.FileVersions.ListFileVersions(ctx, file.ID)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "Failed to list file versions: "+err.Error())
+		return
+	}
+	for _, version := range versions {
+		if len(version.DataKey) == 0 {
+			continue
+		}
+		version.DataKey = nil
+		if err := r.repo.FileVersions.UpdateFileVersion(ctx, version); err != nil {
+			writeError(c, http.StatusInternalServerError, "Failed to erase data key: "+err.Error())
+			return
+		}
+	}
+	c.Status(http.StatusNoContent)
+}
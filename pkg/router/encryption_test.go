@@ -0,0 +1,144 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+func testFileCipher(t *testing.T) *models.File {
+	t.Helper()
+	viper.Set("encryption-master-key", base64.StdEncoding.EncodeToString(make([]byte, dataKeySize)))
+	t.Cleanup(func() { viper.Set("encryption-master-key", nil) })
+	file := &models.File{}
+	if _, err := uploadCipher(file, &models.Bucket{Encrypt: true}); err != nil {
+		t.Fatalf("failed to create data key: %v", err)
+	}
+	return file
+}
+
+func TestEncryptedRoundTrip(t *testing.T) {
+	file := testFileCipher(t)
+	plain := make([]byte, 3*segmentSize+123)
+	rand.Read(plain)
+
+	aead, err := fileCipher(file)
+	if err != nil {
+		t.Fatalf("failed to unwrap data key: %v", err)
+	}
+	sealed, err := io.ReadAll(newEncryptingReader(bytes.NewReader(plain), aead))
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if int64(len(sealed)) != encryptedSize(int64(len(plain))) {
+		t.Fatalf("expected %d encrypted bytes, got %d", encryptedSize(int64(len(plain))), len(sealed))
+	}
+	// Parts sealed separately produce the same layout.
+	first, _ := sealSegments(aead, plain[:2*segmentSize], 0)
+	rest, _ := sealSegments(aead, plain[2*segmentSize:], 2)
+	if len(first)+len(rest) != len(sealed) {
+		t.Fatalf("sealed parts have %d bytes, expected %d", len(first)+len(rest), len(sealed))
+	}
+
+	for _, object := range [][]byte{sealed, append(first, rest...)} {
+		r := newDecryptingReader(bytes.NewReader(object), aead, int64(len(plain)))
+		got, err := io.ReadAll(r)
+		if err != nil || !bytes.Equal(got, plain) {
+			t.Fatalf("full read mismatch (err %v)", err)
+		}
+		start := int64(segmentSize - 10)
+		if _, err := r.Seek(start, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		got = make([]byte, segmentSize+20)
+		if _, err := io.ReadFull(r, got); err != nil || !bytes.Equal(got, plain[start:start+int64(len(got))]) {
+			t.Fatalf("ranged read mismatch (err %v)", err)
+		}
+	}
+}
+
+func TestEncryptedTampering(t *testing.T) {
+	file := testFileCipher(t)
+	aead, _ := fileCipher(file)
+	plain := make([]byte, 2*segmentSize)
+	sealed, _ := sealSegments(aead, plain, 0)
+
+	tampered := bytes.Clone(sealed)
+	tampered[segmentSize+segmentOverhead+20] ^= 1
+	if _, err := io.ReadAll(newDecryptingReader(bytes.NewReader(tampered), aead, int64(len(plain)))); err == nil {
+		t.Error("expected modified segment to be rejected")
+	}
+
+	swapped := append(bytes.Clone(sealed[segmentSize+segmentOverhead:]), sealed[:segmentSize+segmentOverhead]...)
+	if _, err := io.ReadAll(newDecryptingReader(bytes.NewReader(swapped), aead, int64(len(plain)))); err == nil {
+		t.Error("expected reordered segments to be rejected")
+	}
+
+	truncated := sealed[:len(sealed)-1]
+	if _, err := io.ReadAll(newDecryptingReader(bytes.NewReader(truncated), aead, int64(len(plain)))); err == nil {
+		t.Error("expected truncated object to be rejected")
+	}
+}
+
+func TestErasedDataKey(t *testing.T) {
+	file := testFileCipher(t)
+	file.DataKey = nil
+	if _, err := fileCipher(file); !errors.Is(err, errDataKeyErased) {
+		t.Errorf("expected errDataKeyErased, got %v", err)
+	}
+
+	other := testFileCipher(t)
+	viper.Set("encryption-master-key", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, dataKeySize)))
+	if _, err := fileCipher(other); err == nil {
+		t.Error("expected data key wrapped by another master key to be rejected")
+	}
+}
+
+// TestEraseFileKey_KeepsTwin checks that identical content uploaded to an
+// encrypted bucket is not deduplicated, so erasing the key of one file
+// leaves the other readable.
+func TestEraseFileKey_KeepsTwin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	checksum := "sha256:" + strings.Repeat("ab", 32)
+	repo := newFakeRepository()
+	bucket := &models.Bucket{ApplicationModel: models.ApplicationModel{ID: "bucket"}, Name: "bucket", Deduplicate: true, Encrypt: true}
+	repo.CreateBucket(ctx, bucket)
+	original := testFileCipher(t)
+	original.Name, original.BucketID, original.Checksum, original.Status = "original", "bucket", checksum, models.FileStatusActive
+	repo.putFile(original, 1)
+	twin := testFileCipher(t)
+	twin.Name, twin.BucketID, twin.Checksum, twin.Status = "twin", "bucket", checksum, models.FileStatusUploaded
+
+	r := &router{repo: repo.repository()}
+	if removeCopy := r.deduplicateUpload(ctx, twin, bucket, checksum); removeCopy != nil || twin.StorageKey() != "twin" {
+		t.Fatalf("expected encrypted content to keep its own object, got %s", twin.StorageKey())
+	}
+	twin.Transition(models.FileStatusActive)
+	repo.putFile(twin, 1)
+
+	engine := gin.New()
+	engine.DELETE("/file/:id/key", r.EraseFileKeyHandler)
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/file/original/key", nil))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("erase: got %d %s", w.Code, w.Body)
+	}
+	if _, err := fileCipher(repo.file("original")); !errors.Is(err, errDataKeyErased) {
+		t.Errorf("expected the key of the erased file to be gone, got %v", err)
+	}
+	if _, err := fileCipher(repo.file("twin")); err != nil {
+		t.Errorf("expected the twin to stay readable, got %v", err)
+	}
+}
@@ -0,0 +1,289 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+const (
+	eventBucketCreated = "bucket.created"
+	eventBucketUpdated = "bucket.updated"
+	eventBucketDeleted = "bucket.deleted"
+	eventTokenCreated  = "token.created"
+	eventTokenRevoked  = "token.revoked"
+	// eventStreamGap tells a reconnecting client that events it missed have
+	// left the replay buffer, so it should reload the state it tracks.
+	eventStreamGap = "stream.gap"
+)
+
+// eventKeepAlive is how often an idle stream sends a comment so proxies do
+// not close it.
+const eventKeepAlive = 15 * time.Second
+
+// Event is a lifecycle event sent on the admin event stream. Its type is one
+// of the webhook events, bucket.created, bucket.updated, bucket.deleted,
+// token.created or token.revoked.
+type Event struct {
+	ID        uint64      `json:"id"`
+	Type      string      `json:"type"`
+	BucketID  string      `json:"bucketId,omitempty"`
+	Region    string      `json:"region,omitempty"` // region of the bucket
+	CreatedAt time.Time   `json:"createdAt"`
+	Data      interface{} `json:"data"`
+}
+
+// eventBroker fans published events out to the open streams and keeps the
+// latest event-replay-size of them for clients that reconnect.
+type eventBroker struct {
+	mu          sync.Mutex
+	lastID      uint64
+	buffer      []Event
+	subscribers map[chan Event]struct{}
+	closed      bool // the server is shutting down; no stream stays open
+}
+
+// newEventBroker returns a broker whose IDs start from the boot time in
+// microseconds, so that they keep increasing across restarts while staying
+// exact as JavaScript numbers, and a client resuming from before a restart
+// gets the whole buffer.
+func newEventBroker() *eventBroker {
+	return &eventBroker{
+		lastID:      uint64(time.Now().UnixMicro()),
+		subscribers: map[chan Event]struct{}{},
+	}
+}
+
+// publish sends event to the open streams. A nil broker, that of a router
+// not built by NewRouter, drops it.
+func (b *eventBroker) publish(event Event) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastID++
+	event.ID = b.lastID
+	event.CreatedAt = time.Now().UTC()
+
+	b.buffer = append(b.buffer, event)
+	if over := len(b.buffer) - max(viper.GetInt("event-replay-size"), 0); over > 0 {
+		b.buffer = append(b.buffer[:0], b.buffer[over:]...)
+	}
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// The client is not keeping up. Ending its stream makes it
+			// reconnect and catch up from the buffer.
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// subscribe opens a stream of the events published after lastID. It returns
+// those still buffered, whether older ones were lost, and the channel further
+// events arrive on; the channel is closed if the subscriber falls behind.
+func (b *eventBroker) subscribe(lastID uint64, resume bool) ([]Event, bool, chan Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var replay []Event
+	gap := false
+	if resume {
+		for i, event := range b.buffer {
+			if event.ID > lastID {
+				replay = append(replay, b.buffer[i:]...)
+				gap = event.ID > lastID+1
+				break
+			}
+		}
+	}
+	ch := make(chan Event, 64)
+	if b.closed {
+		close(ch)
+		return replay, gap, ch
+	}
+	b.subscribers[ch] = struct{}{}
+	return replay, gap, ch
+}
+
+func (b *eventBroker) unsubscribe(ch chan Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscribers[ch]; ok {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// close ends every open stream, and those opened later right away. Streams
+// are long-lived requests that would otherwise hold up a graceful shutdown
+// until it times out.
+func (b *eventBroker) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// bucketRegion returns the region of a bucket, or "" if it cannot be found.
+func (r *router) bucketRegion(ctx context.Context, bucketID string) string {
+	bucket, err := r.repo.Buckets.GetBucketByID(ctx, bucketID)
+	if err != nil || bucket == nil {
+		return ""
+	}
+	return bucket.Region
+}
+
+// publishBucketEvent sends a bucket event without the bucket credentials.
+func (r *router) publishBucketEvent(eventType string, bucket *models.Bucket) {
+	redacted := *bucket
+	redacted.AccessKey = ""
+	redacted.SecretKey = ""
+	r.events.publish(Event{Type: eventType, BucketID: bucket.ID, Region: bucket.Region, Data: redacted})
+}
+
+// publishTokenEvent sends a service token event without the token itself.
+func (r *router) publishTokenEvent(eventType string, token *models.ServiceToken) {
+	redacted := *token
+	redacted.AccessKey = ""
+	r.events.publish(Event{Type: eventType, Data: redacted})
+}
+
+// eventFilter selects the events a stream receives.
+type eventFilter struct {
+	bucketID string
+	region   string
+	types    []string // an entry without a dot matches a whole category, e.g. "file"
+}
+
+func parseEventFilter(c *gin.Context) eventFilter {
+	filter := eventFilter{bucketID: c.Query("bucket"), region: c.Query("region")}
+	for _, t := range strings.Split(c.Query("type"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			filter.types = append(filter.types, t)
+		}
+	}
+	return filter
+}
+
+func (f eventFilter) match(event Event) bool {
+	if event.Type == eventStreamGap {
+		return true
+	}
+	if f.bucketID != "" && event.BucketID != f.bucketID {
+		return false
+	}
+	if f.region != "" && event.Region != f.region {
+		return false
+	}
+	if len(f.types) == 0 {
+		return true
+	}
+	category, _, _ := strings.Cut(event.Type, ".")
+	for _, t := range f.types {
+		if t == event.Type || t == category {
+			return true
+		}
+	}
+	return false
+}
+
+// AddEventRoutes sets up the admin event stream.
+func AddEventRoutes(router *router, v1 *gin.RouterGroup) {
+	v1.GET("/events", AuthMiddleware(router.repo), AdminOnlyMiddleware, router.EventStreamHandler)
+}
+
+// EventStreamHandler streams lifecycle events
+// @Summary Stream lifecycle events
+// @Description Server-Sent Events stream of file, bucket and service token events as they happen on this instance. Each event carries its ID, type and the affected record as JSON; bucket credentials and token keys are left out. Admin access required.
+// @Description A client reconnecting with Last-Event-ID receives the events it missed while they are still in the replay buffer. If some have already left it, a stream.gap event is sent first.
+// @Tags events
+// @Produce text/event-stream
+// @Param x-api-token header string true "API Token"
+// @Param Last-Event-ID header string false "ID of the last event received, to resume from"
+// @Param bucket query string false "Only events of this bucket ID"
+// @Param region query string false "Only events of buckets in this region"
+// @Param type query string false "Comma-separated event types or categories, e.g. file.finalized,bucket"
+// @Success 200 {object} router.Event
+// @Failure 400 {object} router.ErrorResponse
+// @Failure 401 {object} router.ErrorResponse "Unauthorized"
+// @Failure 403 {object} router.ErrorResponse "Forbidden - Admin only"
+// @Router /api/v1/events [get]
+// @Id StreamEvents
+func (r *router) EventStreamHandler(c *gin.Context) {
+	filter := parseEventFilter(c)
+	var lastID uint64
+	resume := false
+	if header := c.GetHeader("Last-Event-ID"); header != "" {
+		id, err := strconv.ParseUint(header, 10, 64)
+		if err != nil {
+			writeError(c, http.StatusBadRequest, "Invalid Last-Event-ID header")
+			return
+		}
+		lastID, resume = id, true
+	}
+	replay, gap, ch := r.events.subscribe(lastID, resume)
+	defer r.events.unsubscribe(ch)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	send := func(event Event) bool {
+		if !filter.match(event) {
+			return true
+		}
+		err := sse.Encode(c.Writer, sse.Event{
+			Id:    strconv.FormatUint(event.ID, 10),
+			Event: event.Type,
+			Data:  event,
+		})
+		return err == nil
+	}
+	if gap {
+		// Carry the ID the client resumed from so it is not lost if the
+		// stream drops before another event arrives.
+		if !send(Event{ID: lastID, Type: eventStreamGap, CreatedAt: time.Now().UTC()}) {
+			return
+		}
+	}
+	for _, event := range replay {
+		if !send(event) {
+			return
+		}
+	}
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event, ok := <-ch:
+			if !ok || !send(event) {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := c.Writer.WriteString(": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+	}
+}
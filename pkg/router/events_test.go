@@ -0,0 +1,137 @@
+package router
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+func TestEventBroker_Replay(t *testing.T) {
+	viper.Set("event-replay-size", 3)
+	defer viper.Set("event-replay-size", nil)
+
+	b := &eventBroker{subscribers: map[chan Event]struct{}{}}
+	for i := 0; i < 5; i++ {
+		b.publish(Event{Type: "file.uploaded"})
+	}
+	// Events 3 to 5 are buffered.
+	replay, gap, ch := b.subscribe(3, true)
+	defer b.unsubscribe(ch)
+	if gap || len(replay) != 2 || replay[0].ID != 4 || replay[1].ID != 5 {
+		t.Errorf("resuming from 3: got %+v, gap %v", replay, gap)
+	}
+	replay, gap, ch2 := b.subscribe(1, true)
+	defer b.unsubscribe(ch2)
+	if !gap || len(replay) != 3 || replay[0].ID != 3 {
+		t.Errorf("resuming from 1: got %+v, gap %v", replay, gap)
+	}
+	replay, _, ch3 := b.subscribe(0, false)
+	defer b.unsubscribe(ch3)
+	if len(replay) != 0 {
+		t.Errorf("new stream should not replay, got %+v", replay)
+	}
+
+	b.publish(Event{Type: "bucket.created"})
+	if event := <-ch3; event.ID != 6 || event.Type != "bucket.created" {
+		t.Errorf("unexpected live event %+v", event)
+	}
+}
+
+func TestEventFilter(t *testing.T) {
+	filter := eventFilter{region: "eu-west-1", types: []string{"file.finalized", "bucket"}}
+	tests := []struct {
+		event Event
+		match bool
+	}{
+		{Event{Type: "file.finalized", Region: "eu-west-1"}, true},
+		{Event{Type: "bucket.deleted", Region: "eu-west-1"}, true},
+		{Event{Type: "file.deleted", Region: "eu-west-1"}, false},
+		{Event{Type: "file.finalized", Region: "us-east-1"}, false},
+		{Event{Type: eventStreamGap}, true},
+	}
+	for _, tt := range tests {
+		if got := filter.match(tt.event); got != tt.match {
+			t.Errorf("match(%+v) = %v, want %v", tt.event, got, tt.match)
+		}
+	}
+}
+
+func TestEventBroker_Close(t *testing.T) {
+	b := &eventBroker{subscribers: map[chan Event]struct{}{}}
+	_, _, ch := b.subscribe(0, false)
+	b.close()
+	if _, ok := <-ch; ok {
+		t.Error("expected open streams to end on close")
+	}
+	b.unsubscribe(ch)
+	_, _, late := b.subscribe(0, false)
+	if _, ok := <-late; ok {
+		t.Error("expected streams opened after close to end at once")
+	}
+}
+
+// TestEventStream_Shutdown checks that an open stream does not hold up a
+// graceful shutdown.
+func TestEventStream_Shutdown(t *testing.T) {
+	r := &router{events: newEventBroker()}
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/events", r.EventStreamHandler)
+	srv := httptest.NewUnstartedServer(engine)
+	srv.Config.RegisterOnShutdown(r.events.close)
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := srv.Config.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown with an open stream: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("shutdown took %s", elapsed)
+	}
+	if _, err := io.ReadAll(resp.Body); err != nil {
+		t.Errorf("expected the stream to end cleanly: %v", err)
+	}
+}
+
+// TestEmit_SharedWithWorkers checks that a worker built from the server
+// publishes on its stream and wakes its dispatcher.
+func TestEmit_SharedWithWorkers(t *testing.T) {
+	viper.Set("event-replay-size", 10)
+	defer viper.Set("event-replay-size", nil)
+	repo := newFakeRepository()
+	repo.watchEvents()
+	server := &router{repo: repo.repository(), events: newEventBroker(), webhookWake: make(chan struct{}, 1)}
+	_, _, ch := server.events.subscribe(0, false)
+	defer server.events.unsubscribe(ch)
+
+	NewSweeper(server).emit(context.Background(), models.EventFileDeleted, &models.File{ApplicationModel: models.ApplicationModel{ID: "file"}})
+	select {
+	case event := <-ch:
+		if event.Type != string(models.EventFileDeleted) {
+			t.Errorf("expected %s, got %s", models.EventFileDeleted, event.Type)
+		}
+	default:
+		t.Error("expected the event on the server stream")
+	}
+	select {
+	case <-NewWebhookDispatcher(server).webhookWake:
+	default:
+		t.Error("expected the dispatcher to be woken")
+	}
+}
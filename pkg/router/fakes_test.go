@@ -0,0 +1,955 @@
+package router
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/argon-chat/KineticaFS/pkg/repositories"
+	"github.com/google/uuid"
+)
+
+var errFakeNotFound = errors.New("not found")
+
+// fakeRepository keeps every repository in memory for handler tests. Records
+// are copied in and out, as a database would.
+type fakeRepository struct {
+	mu           sync.Mutex
+	buckets      map[string]*models.Bucket
+	files        map[string]*models.File
+	counters     map[string]int64 // anonymous references only
+	references   map[string]map[string]*models.FileReference
+	handedOver   map[string]bool // files whose first holder took the uploader's reference
+	blobs        map[string]*models.FileBlob
+	versions     map[string]map[int]*models.FileVersion
+	tokens       map[string]*models.ServiceToken
+	webhooks     map[string]*models.Webhook
+	deliveries   map[string]*models.WebhookDelivery
+	idempotency  map[string]*models.IdempotencyRecord
+	failUpdates  error  // returned by UpdateFile when set
+	promoting    func() // called when PromoteFileVersion starts, when set
+	deletedFiles []string
+}
+
+func newFakeRepository() *fakeRepository {
+	return &fakeRepository{
+		buckets:     map[string]*models.Bucket{},
+		files:       map[string]*models.File{},
+		counters:    map[string]int64{},
+		references:  map[string]map[string]*models.FileReference{},
+		handedOver:  map[string]bool{},
+		blobs:       map[string]*models.FileBlob{},
+		versions:    map[string]map[int]*models.FileVersion{},
+		tokens:      map[string]*models.ServiceToken{},
+		webhooks:    map[string]*models.Webhook{},
+		deliveries:  map[string]*models.WebhookDelivery{},
+		idempotency: map[string]*models.IdempotencyRecord{},
+	}
+}
+
+// repository wraps f for the router.
+func (f *fakeRepository) repository() *repositories.ApplicationRepository {
+	return &repositories.ApplicationRepository{
+		ServiceTokens: f,
+		Buckets:       f,
+		Files:         f,
+		FileBlobs:     f,
+		FileVersions:  f,
+		Webhooks:      f,
+		Idempotency:   f,
+	}
+}
+
+func (f *fakeRepository) CreateIndices(ctx context.Context) {}
+
+// putFile stores file as is, with count anonymous references.
+func (f *fakeRepository) putFile(file *models.File, count int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if file.ID == "" {
+		file.ID = file.Name
+	}
+	stored := *file
+	f.files[file.ID] = &stored
+	f.counters[file.ID] = count
+}
+
+// file returns the stored file with id, or nil.
+func (f *fakeRepository) file(id string) *models.File {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	file, ok := f.files[id]
+	if !ok {
+		return nil
+	}
+	copied := *file
+	return &copied
+}
+
+func (f *fakeRepository) GetBucketByID(ctx context.Context, id string) (*models.Bucket, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	bucket, ok := f.buckets[id]
+	if !ok {
+		return nil, errFakeNotFound
+	}
+	copied := *bucket
+	return &copied, nil
+}
+
+func (f *fakeRepository) GetBucketByName(ctx context.Context, name string) (*models.Bucket, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, bucket := range f.buckets {
+		if bucket.Name == name {
+			copied := *bucket
+			return &copied, nil
+		}
+	}
+	return nil, errFakeNotFound
+}
+
+func (f *fakeRepository) CreateBucket(ctx context.Context, bucket *models.Bucket) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if bucket.ID == "" {
+		bucket.ID = uuid.NewString()
+	}
+	copied := *bucket
+	f.buckets[bucket.ID] = &copied
+	return nil
+}
+
+func (f *fakeRepository) UpdateBucket(ctx context.Context, bucket *models.Bucket) error {
+	return f.CreateBucket(ctx, bucket)
+}
+
+func (f *fakeRepository) DeleteBucket(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.buckets, id)
+	return nil
+}
+
+func (f *fakeRepository) ListBuckets(ctx context.Context) ([]*models.Bucket, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var buckets []*models.Bucket
+	for _, bucket := range f.buckets {
+		copied := *bucket
+		buckets = append(buckets, &copied)
+	}
+	return buckets, nil
+}
+
+// fileCopy returns a copy of a stored file with its reference count; f.mu
+// must be held.
+func (f *fakeRepository) fileCopy(file *models.File) *models.File {
+	copied := *file
+	copied.References = f.counters[file.ID] + int64(len(f.references[file.ID]))
+	return &copied
+}
+
+func (f *fakeRepository) matchFiles(match func(*models.File) bool) []*models.File {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var files []*models.File
+	for _, file := range f.files {
+		if match(file) {
+			files = append(files, f.fileCopy(file))
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ID < files[j].ID })
+	return files
+}
+
+func (f *fakeRepository) GetFileByID(ctx context.Context, id string) (*models.File, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	file, ok := f.files[id]
+	if !ok {
+		return nil, errFakeNotFound
+	}
+	return f.fileCopy(file), nil
+}
+
+func (f *fakeRepository) GetFileByName(ctx context.Context, name string) (*models.File, error) {
+	files := f.matchFiles(func(file *models.File) bool { return file.Name == name })
+	if len(files) == 0 {
+		return nil, errFakeNotFound
+	}
+	return files[0], nil
+}
+
+func (f *fakeRepository) CreateFile(ctx context.Context, file *models.File) error {
+	file.CreatedAt = time.Now().UTC()
+	file.UpdatedAt = file.CreatedAt
+	file.ID = file.Name
+	f.putFile(file, 1)
+	return nil
+}
+
+func (f *fakeRepository) UpdateFile(ctx context.Context, file *models.File) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failUpdates != nil {
+		return f.failUpdates
+	}
+	if _, ok := f.files[file.ID]; !ok {
+		return errFakeNotFound
+	}
+	file.UpdatedAt = time.Now().UTC()
+	stored := *file
+	f.files[file.ID] = &stored
+	return nil
+}
+
+func (f *fakeRepository) UpdateFileUserMetadata(ctx context.Context, file *models.File) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stored, ok := f.files[file.ID]
+	if !ok {
+		return errFakeNotFound
+	}
+	stored.UserMetadata = file.UserMetadata
+	stored.Tags = file.Tags
+	return nil
+}
+
+func (f *fakeRepository) DeleteFile(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.files, id)
+	delete(f.counters, id)
+	delete(f.references, id)
+	delete(f.handedOver, id)
+	f.deletedFiles = append(f.deletedFiles, id)
+	return nil
+}
+
+func (f *fakeRepository) ListFiles(ctx context.Context, filter models.FileFilter, cursor string, limit int) ([]*models.File, string, error) {
+	return f.matchFiles(func(*models.File) bool { return true }), "", nil
+}
+
+func (f *fakeRepository) ListFilesByChecksum(ctx context.Context, checksum string) ([]*models.File, error) {
+	return f.matchFiles(func(file *models.File) bool { return file.Checksum == checksum }), nil
+}
+
+func (f *fakeRepository) ListFilesByObjectKey(ctx context.Context, objectKey string) ([]*models.File, error) {
+	return f.matchFiles(func(file *models.File) bool { return file.ObjectKey == objectKey }), nil
+}
+
+func (f *fakeRepository) ListPendingFiles(ctx context.Context, updatedBefore time.Time, cursor string, limit int) ([]*models.File, string, error) {
+	return f.pageFiles(cursor, limit, func(file *models.File) bool {
+		switch file.Status {
+		case models.FileStatusPending, models.FileStatusUploading, models.FileStatusDeleting, models.FileStatusDeleted:
+			return file.UpdatedAt.Before(updatedBefore)
+		}
+		return false
+	})
+}
+
+func (f *fakeRepository) ListExpiredFiles(ctx context.Context, expiredBefore time.Time, cursor string, limit int) ([]*models.File, string, error) {
+	return f.pageFiles(cursor, limit, func(file *models.File) bool {
+		return file.ExpiresAt != nil && file.ExpiresAt.Before(expiredBefore)
+	})
+}
+
+// pageFiles returns the files matching match with an ID after cursor, up to
+// limit, and the ID of the last one if the page is full.
+func (f *fakeRepository) pageFiles(cursor string, limit int, match func(*models.File) bool) ([]*models.File, string, error) {
+	files := f.matchFiles(func(file *models.File) bool { return file.ID > cursor && match(file) })
+	if len(files) < limit {
+		return files, "", nil
+	}
+	return files[:limit], files[limit-1].ID, nil
+}
+
+func (f *fakeRepository) GetFileReferenceCount(ctx context.Context, fileID string) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.counters[fileID] + int64(len(f.references[fileID])), nil
+}
+
+func (f *fakeRepository) AtomicIncrement(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.counters[id]++
+	return nil
+}
+
+func (f *fakeRepository) AtomicDecrement(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.counters[id] < 1 {
+		return models.ErrNoReferences
+	}
+	f.counters[id]--
+	return nil
+}
+
+func (f *fakeRepository) AddFileReference(ctx context.Context, fileID, holder string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	holders := f.references[fileID]
+	if holders == nil {
+		holders = map[string]*models.FileReference{}
+		f.references[fileID] = holders
+	}
+	if _, ok := holders[holder]; ok {
+		return false, nil
+	}
+	holders[holder] = &models.FileReference{FileID: fileID, Holder: holder, CreatedAt: time.Now().UTC()}
+	if !f.handedOver[fileID] {
+		f.handedOver[fileID] = true
+		f.counters[fileID] = max(f.counters[fileID]-1, 0)
+	}
+	return true, nil
+}
+
+func (f *fakeRepository) RemoveFileReference(ctx context.Context, fileID, holder string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.references[fileID][holder]; !ok {
+		return false, nil
+	}
+	delete(f.references[fileID], holder)
+	return true, nil
+}
+
+func (f *fakeRepository) ListFileReferences(ctx context.Context, fileID string) ([]*models.FileReference, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var holders []*models.FileReference
+	for _, reference := range f.references[fileID] {
+		copied := *reference
+		holders = append(holders, &copied)
+	}
+	return holders, nil
+}
+
+func (f *fakeRepository) CreateFileVersion(ctx context.Context, version *models.FileVersion) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.versions[version.FileID] == nil {
+		f.versions[version.FileID] = map[int]*models.FileVersion{}
+	}
+	version.CreatedAt = time.Now().UTC()
+	copied := *version
+	f.versions[version.FileID][version.Version] = &copied
+	return nil
+}
+
+func (f *fakeRepository) GetFileVersion(ctx context.Context, fileID string, version int) (*models.FileVersion, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stored, ok := f.versions[fileID][version]
+	if !ok {
+		return nil, nil
+	}
+	copied := *stored
+	return &copied, nil
+}
+
+func (f *fakeRepository) UpdateFileVersion(ctx context.Context, version *models.FileVersion) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	copied := *version
+	f.versions[version.FileID][version.Version] = &copied
+	return nil
+}
+
+func (f *fakeRepository) DeleteFileVersion(ctx context.Context, fileID string, version int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.versions[fileID], version)
+	return nil
+}
+
+func (f *fakeRepository) matchVersions(match func(*models.FileVersion) bool) []*models.FileVersion {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var versions []*models.FileVersion
+	for _, byNumber := range f.versions {
+		for _, version := range byNumber {
+			if match(version) {
+				copied := *version
+				versions = append(versions, &copied)
+			}
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version > versions[j].Version })
+	return versions
+}
+
+func (f *fakeRepository) ListFileVersions(ctx context.Context, fileID string) ([]*models.FileVersion, error) {
+	return f.matchVersions(func(version *models.FileVersion) bool { return version.FileID == fileID }), nil
+}
+
+func (f *fakeRepository) ListFileVersionsByObjectKey(ctx context.Context, objectKey string) ([]*models.FileVersion, error) {
+	return f.matchVersions(func(version *models.FileVersion) bool { return version.ObjectKey == objectKey }), nil
+}
+
+func (f *fakeRepository) ListFileVersionsReplacedBefore(ctx context.Context, before time.Time) ([]*models.FileVersion, error) {
+	return f.matchVersions(func(version *models.FileVersion) bool { return version.CreatedAt.Before(before) }), nil
+}
+
+// PromoteFileVersion makes its writes all or nothing, like the Postgres
+// transaction.
+func (f *fakeRepository) PromoteFileVersion(ctx context.Context, previous *models.FileVersion, file, staged *models.File) error {
+	if f.promoting != nil {
+		f.promoting()
+	}
+	f.mu.Lock()
+	failed := f.failUpdates
+	f.mu.Unlock()
+	if failed != nil {
+		return failed
+	}
+	if stored := f.file(file.ID); stored == nil || stored.Version != previous.Version {
+		return models.ErrVersionConflict
+	}
+	if v, _ := f.GetFileVersion(ctx, previous.FileID, previous.Version); v != nil {
+		return models.ErrVersionConflict
+	}
+	if err := f.CreateFileVersion(ctx, previous); err != nil {
+		return err
+	}
+	if err := f.UpdateFile(ctx, file); err != nil {
+		return err
+	}
+	return f.DeleteFile(ctx, staged.ID)
+}
+
+func (f *fakeRepository) GetAllServiceTokens(ctx context.Context) ([]*models.ServiceToken, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var tokens []*models.ServiceToken
+	for _, token := range f.tokens {
+		copied := *token
+		tokens = append(tokens, &copied)
+	}
+	return tokens, nil
+}
+
+func (f *fakeRepository) GetServiceTokenById(ctx context.Context, id string) (*models.ServiceToken, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, token := range f.tokens {
+		if token.ID == id {
+			copied := *token
+			return &copied, nil
+		}
+	}
+	return nil, errFakeNotFound
+}
+
+func (f *fakeRepository) GetServiceTokenByAccessKey(ctx context.Context, accessKey string) (*models.ServiceToken, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	token, ok := f.tokens[accessKey]
+	if !ok {
+		return nil, errFakeNotFound
+	}
+	copied := *token
+	return &copied, nil
+}
+
+func (f *fakeRepository) GetServiceTokenByName(ctx context.Context, name string) (*models.ServiceToken, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, token := range f.tokens {
+		if token.Name == name {
+			copied := *token
+			return &copied, nil
+		}
+	}
+	return nil, errFakeNotFound
+}
+
+func (f *fakeRepository) CreateServiceToken(ctx context.Context, token *models.ServiceToken) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if token.ID == "" {
+		token.ID = uuid.NewString()
+	}
+	copied := *token
+	f.tokens[token.AccessKey] = &copied
+	return nil
+}
+
+func (f *fakeRepository) RevokeServiceToken(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for key, token := range f.tokens {
+		if token.ID == id {
+			delete(f.tokens, key)
+		}
+	}
+	return nil
+}
+
+func (f *fakeRepository) CreateFileBlob(ctx context.Context, blob *models.FileBlob) (*models.FileBlob, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if blob.ID == "" {
+		blob.ID = uuid.NewString()
+	}
+	if blob.UpdatedAt.IsZero() {
+		blob.CreatedAt = time.Now().UTC()
+		blob.UpdatedAt = blob.CreatedAt
+	}
+	copied := *blob
+	f.blobs[blob.ID] = &copied
+	return blob, nil
+}
+
+func (f *fakeRepository) GetFileBlobByID(ctx context.Context, id string) (*models.FileBlob, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	blob, ok := f.blobs[id]
+	if !ok {
+		return nil, errFakeNotFound
+	}
+	copied := *blob
+	return &copied, nil
+}
+
+func (f *fakeRepository) UpdateFileBlob(ctx context.Context, blob *models.FileBlob) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	blob.UpdatedAt = time.Now().UTC()
+	copied := *blob
+	f.blobs[blob.ID] = &copied
+	return nil
+}
+
+func (f *fakeRepository) UpdateFileBlobAtOffset(ctx context.Context, blob *models.FileBlob, offset int64) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if stored, ok := f.blobs[blob.ID]; !ok || stored.UploadOffset != offset {
+		return false, nil
+	}
+	blob.UpdatedAt = time.Now().UTC()
+	copied := *blob
+	f.blobs[blob.ID] = &copied
+	return true, nil
+}
+
+func (f *fakeRepository) DeleteFileBlobByID(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.blobs, id)
+	return nil
+}
+
+func (f *fakeRepository) matchBlobs(match func(*models.FileBlob) bool) []*models.FileBlob {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var blobs []*models.FileBlob
+	for _, blob := range f.blobs {
+		if match(blob) {
+			copied := *blob
+			blobs = append(blobs, &copied)
+		}
+	}
+	sort.Slice(blobs, func(i, j int) bool { return blobs[i].ID < blobs[j].ID })
+	return blobs
+}
+
+func (f *fakeRepository) ListFileBlobsByFileID(ctx context.Context, fileID string) ([]*models.FileBlob, error) {
+	return f.matchBlobs(func(blob *models.FileBlob) bool { return blob.FileID == fileID }), nil
+}
+
+func (f *fakeRepository) ListExpiredFileBlobs(ctx context.Context, updatedBefore time.Time) ([]*models.FileBlob, error) {
+	return f.matchBlobs(func(blob *models.FileBlob) bool { return blob.UpdatedAt.Before(updatedBefore) }), nil
+}
+
+func (f *fakeRepository) GetWebhookByID(ctx context.Context, id string) (*models.Webhook, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	webhook, ok := f.webhooks[id]
+	if !ok {
+		return nil, errFakeNotFound
+	}
+	copied := *webhook
+	return &copied, nil
+}
+
+func (f *fakeRepository) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if webhook.ID == "" {
+		webhook.ID = uuid.NewString()
+	}
+	copied := *webhook
+	f.webhooks[webhook.ID] = &copied
+	return nil
+}
+
+func (f *fakeRepository) UpdateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	return f.CreateWebhook(ctx, webhook)
+}
+
+func (f *fakeRepository) DeleteWebhook(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.webhooks, id)
+	return nil
+}
+
+func (f *fakeRepository) ListWebhooks(ctx context.Context) ([]*models.Webhook, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var webhooks []*models.Webhook
+	for _, webhook := range f.webhooks {
+		copied := *webhook
+		webhooks = append(webhooks, &copied)
+	}
+	return webhooks, nil
+}
+
+func (f *fakeRepository) CreateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if delivery.ID == "" {
+		delivery.ID = uuid.NewString()
+	}
+	copied := *delivery
+	f.deliveries[delivery.ID] = &copied
+	return nil
+}
+
+func (f *fakeRepository) GetDeliveryByID(ctx context.Context, id string) (*models.WebhookDelivery, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delivery, ok := f.deliveries[id]
+	if !ok {
+		return nil, errFakeNotFound
+	}
+	copied := *delivery
+	return &copied, nil
+}
+
+func (f *fakeRepository) UpdateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	return f.CreateDelivery(ctx, delivery)
+}
+
+func (f *fakeRepository) ClaimDelivery(ctx context.Context, delivery *models.WebhookDelivery, until time.Time) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stored, ok := f.deliveries[delivery.ID]
+	if !ok || stored.Status != models.DeliveryStatusPending || !stored.NextAttemptAt.Equal(delivery.NextAttemptAt) {
+		return false, nil
+	}
+	stored.NextAttemptAt = until
+	delivery.NextAttemptAt = until
+	return true, nil
+}
+
+func (f *fakeRepository) DeleteDeliveriesByWebhookID(ctx context.Context, webhookID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for id, delivery := range f.deliveries {
+		if delivery.WebhookID == webhookID {
+			delete(f.deliveries, id)
+		}
+	}
+	return nil
+}
+
+func (f *fakeRepository) matchDeliveries(match func(*models.WebhookDelivery) bool) []*models.WebhookDelivery {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var deliveries []*models.WebhookDelivery
+	for _, delivery := range f.deliveries {
+		if match(delivery) {
+			copied := *delivery
+			deliveries = append(deliveries, &copied)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID < deliveries[j].ID })
+	return deliveries
+}
+
+func (f *fakeRepository) ListDeliveriesByWebhookID(ctx context.Context, webhookID string) ([]*models.WebhookDelivery, error) {
+	return f.matchDeliveries(func(delivery *models.WebhookDelivery) bool { return delivery.WebhookID == webhookID }), nil
+}
+
+func (f *fakeRepository) ListDueDeliveries(ctx context.Context, dueBefore time.Time) ([]*models.WebhookDelivery, error) {
+	return f.matchDeliveries(func(delivery *models.WebhookDelivery) bool {
+		return delivery.Status == models.DeliveryStatusPending && !delivery.NextAttemptAt.After(dueBefore)
+	}), nil
+}
+
+func idempotencyID(tokenID, key string) string {
+	return tokenID + "/" + key
+}
+
+func (f *fakeRepository) CreateIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecord) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := idempotencyID(record.TokenID, record.Key)
+	if existing, ok := f.idempotency[id]; ok && existing.ExpiresAt.After(time.Now()) {
+		return false, nil
+	}
+	record.ID = uuid.NewString()
+	record.CreatedAt = time.Now().UTC()
+	record.UpdatedAt = record.CreatedAt
+	copied := *record
+	f.idempotency[id] = &copied
+	return true, nil
+}
+
+func (f *fakeRepository) GetIdempotencyRecord(ctx context.Context, tokenID, key string) (*models.IdempotencyRecord, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	record, ok := f.idempotency[idempotencyID(tokenID, key)]
+	if !ok || !record.ExpiresAt.After(time.Now()) {
+		return nil, nil
+	}
+	copied := *record
+	return &copied, nil
+}
+
+func (f *fakeRepository) UpdateIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := idempotencyID(record.TokenID, record.Key)
+	if existing, ok := f.idempotency[id]; !ok || existing.ID != record.ID {
+		return nil
+	}
+	record.UpdatedAt = time.Now().UTC()
+	copied := *record
+	f.idempotency[id] = &copied
+	return nil
+}
+
+func (f *fakeRepository) DeleteIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := idempotencyID(record.TokenID, record.Key)
+	if existing, ok := f.idempotency[id]; ok && existing.ID == record.ID {
+		delete(f.idempotency, id)
+	}
+	return nil
+}
+
+func (f *fakeRepository) DeleteExpiredIdempotencyRecords(ctx context.Context, before time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for id, record := range f.idempotency {
+		if record.ExpiresAt.Before(before) {
+			delete(f.idempotency, id)
+		}
+	}
+	return nil
+}
+
+// fakeS3 is an S3 endpoint keeping objects in memory. It serves the requests
+// the router makes with path-style addressing and records each of them as
+// "<operation> <bucket>/<key>".
+type fakeS3 struct {
+	*httptest.Server
+	mu      sync.Mutex
+	objects map[string][]byte
+	uploads map[string]map[int][]byte
+	calls   []string
+	// failBucket makes DeleteObjects requests on the bucket fail.
+	failBucket string
+	// failComplete makes CompleteMultipartUpload requests fail.
+	failComplete bool
+}
+
+func newFakeS3() *fakeS3 {
+	s := &fakeS3{objects: map[string][]byte{}, uploads: map[string]map[int][]byte{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// bucket returns a bucket stored on s.
+func (s *fakeS3) bucket(id, name string) *models.Bucket {
+	return &models.Bucket{
+		ApplicationModel: models.ApplicationModel{ID: id},
+		Name:             name,
+		Region:           "us-east-1",
+		Endpoint:         s.URL,
+		AccessKey:        "access",
+		SecretKey:        "secret",
+	}
+}
+
+func (s *fakeS3) put(bucket, key string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[bucket+"/"+key] = data
+}
+
+func (s *fakeS3) has(bucket, key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.objects[bucket+"/"+key]
+	return ok
+}
+
+// callsOf returns the recorded calls of operation op.
+func (s *fakeS3) callsOf(op string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var calls []string
+	for _, call := range s.calls {
+		if strings.HasPrefix(call, op+" ") {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+func etagOf(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func (s *fakeS3) serve(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := strings.TrimPrefix(req.URL.Path, "/")
+	query := req.URL.Query()
+	record := func(op string) { s.calls = append(s.calls, op+" "+path) }
+	body, _ := io.ReadAll(req.Body)
+
+	switch {
+	case req.Method == http.MethodPost && query.Has("delete"):
+		record("DeleteObjects")
+		if path == s.failBucket {
+			http.Error(w, "AccessDenied", http.StatusForbidden)
+			return
+		}
+		var input struct {
+			Objects []struct{ Key string } `xml:"Object"`
+		}
+		if err := xml.Unmarshal(body, &input); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var out strings.Builder
+		out.WriteString(`<DeleteResult>`)
+		for _, object := range input.Objects {
+			delete(s.objects, path+"/"+object.Key)
+			fmt.Fprintf(&out, `<Deleted><Key>%s</Key></Deleted>`, object.Key)
+		}
+		out.WriteString(`</DeleteResult>`)
+		w.Header().Set("Content-Type", "application/xml")
+		io.WriteString(w, out.String())
+	case req.Method == http.MethodPost && query.Has("uploads"):
+		record("CreateMultipartUpload")
+		uploadID := uuid.NewString()
+		s.uploads[uploadID] = map[int][]byte{}
+		fmt.Fprintf(w, `<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>`, uploadID)
+	case req.Method == http.MethodPost && query.Has("uploadId"):
+		record("CompleteMultipartUpload")
+		if s.failComplete {
+			http.Error(w, "AccessDenied", http.StatusForbidden)
+			return
+		}
+		parts, ok := s.uploads[query.Get("uploadId")]
+		if !ok {
+			http.Error(w, "NoSuchUpload", http.StatusNotFound)
+			return
+		}
+		numbers := make([]int, 0, len(parts))
+		for number := range parts {
+			numbers = append(numbers, number)
+		}
+		sort.Ints(numbers)
+		var data []byte
+		for _, number := range numbers {
+			data = append(data, parts[number]...)
+		}
+		delete(s.uploads, query.Get("uploadId"))
+		s.objects[path] = data
+		fmt.Fprintf(w, `<CompleteMultipartUploadResult><ETag>%s</ETag></CompleteMultipartUploadResult>`, etagOf(data))
+	case req.Method == http.MethodPut && query.Has("uploadId"):
+		record("UploadPart")
+		parts, ok := s.uploads[query.Get("uploadId")]
+		if !ok {
+			http.Error(w, "NoSuchUpload", http.StatusNotFound)
+			return
+		}
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		parts[number] = body
+		w.Header().Set("ETag", etagOf(body))
+	case req.Method == http.MethodPut && req.Header.Get("X-Amz-Copy-Source") != "":
+		record("CopyObject")
+		source := strings.TrimPrefix(req.Header.Get("X-Amz-Copy-Source"), "/")
+		data, ok := s.objects[source]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		s.objects[path] = data
+		fmt.Fprintf(w, `<CopyObjectResult><ETag>%s</ETag></CopyObjectResult>`, etagOf(data))
+	case req.Method == http.MethodPut:
+		record("PutObject")
+		s.objects[path] = body
+		w.Header().Set("ETag", etagOf(body))
+	case req.Method == http.MethodDelete && query.Has("uploadId"):
+		record("AbortMultipartUpload")
+		delete(s.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case req.Method == http.MethodDelete:
+		record("DeleteObject")
+		delete(s.objects, path)
+		w.WriteHeader(http.StatusNoContent)
+	case req.Method == http.MethodHead || req.Method == http.MethodGet:
+		record(map[string]string{http.MethodHead: "HeadObject", http.MethodGet: "GetObject"}[req.Method])
+		data, ok := s.objects[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", etagOf(data))
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		if req.Method == http.MethodGet {
+			w.Write(data)
+		}
+	default:
+		http.Error(w, "unsupported", http.StatusNotImplemented)
+	}
+}
+
+// watchEvents subscribes a webhook to every event, so emitted events are
+// queued as deliveries.
+func (f *fakeRepository) watchEvents() {
+	f.CreateWebhook(context.Background(), &models.Webhook{URL: "http://127.0.0.1:0/", Enabled: true})
+}
+
+// emitted returns the queued events as "<event> <file ID>", sorted.
+func (f *fakeRepository) emitted() []string {
+	var events []string
+	for _, delivery := range f.matchDeliveries(func(*models.WebhookDelivery) bool { return true }) {
+		var payload struct {
+			Data struct {
+				ID string `json:"id"`
+			} `json:"data"`
+		}
+		json.Unmarshal([]byte(delivery.Payload), &payload)
+		events = append(events, string(delivery.Event)+" "+payload.Data.ID)
+	}
+	sort.Strings(events)
+	return events
+}
@@ -1,66 +1,128 @@
 package router
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
-	"crypto/sha256"
+	"encoding/base64"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"mime/multipart"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/argon-chat/KineticaFS/pkg/guid"
 	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/argon-chat/KineticaFS/pkg/repositories"
 	"github.com/argon-chat/KineticaFS/pkg/timestamp"
 	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/spf13/viper"
 )
 
 // AddFileRoutes sets up the server-side file management endpoints.
 func AddFileRoutes(router *router, v1 *gin.RouterGroup) {
 	files := v1.Group("/file")
-	files.POST("/", AuthMiddleware(router.repo), AdminOnlyMiddleware, router.InitiateFileUploadHandler)
-	files.POST("/:blob/finalize", AuthMiddleware(router.repo), AdminOnlyMiddleware, router.FinalizeFileUploadHandler)
-	files.DELETE("/:id", AuthMiddleware(router.repo), AdminOnlyMiddleware, router.DeleteFileHandler)
-	files.PATCH("/:id/increment", AuthMiddleware(router.repo), AdminOnlyMiddleware, router.IncrementHandler)
-	files.PATCH("/:id/decrement", AuthMiddleware(router.repo), AdminOnlyMiddleware, router.DecrementHandler)
+	files.POST("/", AuthMiddleware(router.repo), AdminOnlyMiddleware, IdempotencyMiddleware(router.repo), router.InitiateFileUploadHandler)
+	files.POST("/initiate-batch", AuthMiddleware(router.repo), AdminOnlyMiddleware, IdempotencyMiddleware(router.repo), router.InitiateFileUploadBatchHandler)
+	files.POST("/batch", AuthMiddleware(router.repo), AdminOnlyMiddleware, IdempotencyMiddleware(router.repo), router.FileBulkHandler)
+	files.POST("/:id/finalize", AuthMiddleware(router.repo), AdminOnlyMiddleware, IdempotencyMiddleware(router.repo), router.FinalizeFileUploadHandler)
+	files.DELETE("/:id", AuthMiddleware(router.repo), AdminOnlyMiddleware, IdempotencyMiddleware(router.repo), router.DeleteFileHandler)
+	files.PATCH("/:id/increment", AuthMiddleware(router.repo), AdminOnlyMiddleware, IdempotencyMiddleware(router.repo), router.IncrementHandler)
+	files.PATCH("/:id/decrement", AuthMiddleware(router.repo), AdminOnlyMiddleware, IdempotencyMiddleware(router.repo), router.DecrementHandler)
+	files.DELETE("/:id/key", AuthMiddleware(router.repo), AdminOnlyMiddleware, IdempotencyMiddleware(router.repo), router.EraseFileKeyHandler)
+	files.GET("/:id/refs", AuthMiddleware(router.repo), AdminOnlyMiddleware, router.ListFileReferencesHandler)
+	files.PUT("/:id/refs/:holder", AuthMiddleware(router.repo), AdminOnlyMiddleware, IdempotencyMiddleware(router.repo), router.AddFileReferenceHandler)
+	files.DELETE("/:id/refs/:holder", AuthMiddleware(router.repo), AdminOnlyMiddleware, IdempotencyMiddleware(router.repo), router.RemoveFileReferenceHandler)
+	files.GET("/", AuthMiddleware(router.repo), AdminOnlyMiddleware, router.ListFilesHandler)
 	files.GET("/:id", AuthMiddleware(router.repo), AdminOnlyMiddleware, router.GetFileByIDHandler)
+	files.PATCH("/:id", AuthMiddleware(router.repo), AdminOnlyMiddleware, IdempotencyMiddleware(router.repo), router.UpdateFileHandler)
+	files.GET("/:id/versions", AuthMiddleware(router.repo), AdminOnlyMiddleware, router.ListFileVersionsHandler)
+	files.POST("/:id/copy", AuthMiddleware(router.repo), AdminOnlyMiddleware, IdempotencyMiddleware(router.repo), router.CopyFileHandler)
+	files.POST("/:id/move", AuthMiddleware(router.repo), AdminOnlyMiddleware, IdempotencyMiddleware(router.repo), router.MoveFileHandler)
+	files.GET("/:id/content", AuthMiddleware(router.repo), router.DownloadFileHandler)
+	files.HEAD("/:id/content", AuthMiddleware(router.repo), router.DownloadFileHandler)
 }
 
-// AddFileBlobRoutes sets up the client-side upload endpoint.
+// AddFileBlobRoutes sets up the client-side upload endpoints. They accept the
+// signature of a signed upload URL in place of a service token.
 func AddFileBlobRoutes(router *router, v1 *gin.RouterGroup) {
 	upload := v1.Group("/upload")
-	upload.PATCH("/:blob", AuthMiddleware(router.repo), router.UploadFileBlobHandler)
+	upload.PATCH("/:blob", UploadAuthMiddleware(router.repo), router.UploadFileBlobHandler)
+	upload.HEAD("/:blob", UploadAuthMiddleware(router.repo), router.GetUploadOffsetHandler)
+	upload.GET("/:blob", UploadAuthMiddleware(router.repo), router.GetUploadProgressHandler)
+	upload.DELETE("/:blob", UploadAuthMiddleware(router.repo), router.CancelUploadHandler)
+	upload.POST("/:blob/preflight", UploadAuthMiddleware(router.repo), router.UploadPreflightHandler)
 }
 
 type InitiateFileUploadDTO struct {
 	RegionID      string `json:"regionId" binding:"required"`
 	FileSizeLimit uint64 `json:"fileSizeLimit,omitempty"`
 	BucketCode    string `json:"bucketCode"`
+	UploadMode    string `json:"uploadMode,omitempty" binding:"omitempty,oneof=proxy presigned-put presigned-post"`
+	ContentType   string `json:"contentType,omitempty"` // required content type of a presigned upload
+	Checksum      string `json:"checksum,omitempty"`    // expected "sha256:<hex>" of the file
+	// Policy overrides fields of the upload policy configured for the region
+	// and bucket; fileSizeLimit, if set, overrides its maxSize.
+	Policy *models.UploadPolicy `json:"policy,omitempty"`
+	// Metadata and Tags are kept with the file for clients to filter on.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Tags     []string          `json:"tags,omitempty"`
+	// FileID makes the upload a new version of an existing active file. Its
+	// bucket is used unless bucketCode is given.
+	FileID string `json:"fileId,omitempty"`
 }
 
 type InitiateFileUploadResponse struct {
-	URL string `json:"url"`
-	TTL int    `json:"ttl"` // seconds
+	FileID string `json:"fileId"` // GUID of the file being uploaded, or of the file it replaces
+	URL    string `json:"url"`    // blob ID of the upload session
+	TTL    int    `json:"ttl"`    // seconds
+	// UploadURL is the path of the upload endpoint for the blob with a
+	// signature that grants access without a service token until
+	// UploadURLExpiresAt. It can be handed to untrusted clients. Both are
+	// omitted unless upload-signing-key is set.
+	UploadURL          string     `json:"uploadUrl,omitempty"`
+	UploadURLExpiresAt *time.Time `json:"uploadUrlExpiresAt,omitempty"`
+	// Upload is set for presigned upload modes and describes the request
+	// that stores the file directly in the bucket.
+	Upload *PresignedUpload `json:"upload,omitempty"`
+}
+
+type InitiateFileUploadBatchDTO struct {
+	Files []InitiateFileUploadDTO `json:"files" binding:"required,min=1,max=100"`
+}
+
+// InitiateFileUploadResult is the outcome of one item of a batch initiation:
+// either the upload session or the error that prevented it.
+type InitiateFileUploadResult struct {
+	*InitiateFileUploadResponse
+	Error *ErrorResponse `json:"error,omitempty"`
+}
+
+type InitiateFileUploadBatchResponse struct {
+	Results []InitiateFileUploadResult `json:"results"` // in the order of the request
 }
 
 type RegionBucket struct {
-	ID       uint16 `json:"id"`
-	BucketID string `json:"bucketId"`
+	ID       uint16               `json:"id"`
+	BucketID string               `json:"bucketId"`
+	Policy   *models.UploadPolicy `json:"policy,omitempty"` // overrides the region policy
 }
 
 type RegionInfo struct {
-	ID      uint8          `json:"id"`
-	Buckets []RegionBucket `json:"buckets"`
+	ID      uint8                `json:"id"`
+	Buckets []RegionBucket       `json:"buckets"`
+	Policy  *models.UploadPolicy `json:"policy,omitempty"`
 }
 
 type Regions map[string]RegionInfo
@@ -89,9 +151,41 @@ func generateRandomEntropy() uint64 {
 	return entropy
 }
 
+// selectRegionBucket returns the bucket of region with the given code, or a
+// random one if code is empty.
+func selectRegionBucket(region RegionInfo, code string) (*RegionBucket, *ErrorResponse) {
+	if code == "" {
+		if len(region.Buckets) == 0 {
+			return nil, &ErrorResponse{Code: 400, Message: "No buckets defined for the specified region"}
+		}
+		randIndexBytes := make([]byte, 2)
+		_, err := rand.Read(randIndexBytes)
+		if err != nil {
+			return nil, &ErrorResponse{Code: 400, Message: "Failed to generate random bucket selection: " + err.Error()}
+		}
+		randIndex := binary.BigEndian.Uint16(randIndexBytes) % uint16(len(region.Buckets))
+		return &region.Buckets[randIndex], nil
+	}
+	for i, bucket := range region.Buckets {
+		if bucket.BucketID == code {
+			return &region.Buckets[i], nil
+		}
+	}
+	return nil, &ErrorResponse{Code: 400, Message: "Invalid bucket code for the specified region"}
+}
+
+// newFileGUID generates the GUID of a new file stored in bucket of region.
+func newFileGUID(region RegionInfo, bucket *RegionBucket) (string, error) {
+	entropy := generateRandomEntropy()
+	return guid.NewGuid(timestamp.CurrentTimestamp(), region.ID, bucket.ID, entropy, 0x0A).Pack()
+}
+
 // Initiate a new file upload (admin only)
 // @Summary Initiate file upload
-// @Description Initiate a new file upload. Receives regionId and bucketCode, returns a pre-signed upload URL and TTL (seconds). Admin access required.
+// @Description Initiate a new file upload. Receives regionId and bucketCode, returns the blob ID, TTL (seconds) and a signed upload URL. Admin access required.
+// @Description The signed upload URL grants access to the upload endpoints of the blob without a service token until it expires, so it can be handed to untrusted clients. It is bound to the size limit and content type rules of the file.
+// @Description The upload policy (size limit, allowed and denied content types, retention) configured for the region and bucket applies unless overridden by policy.
+// @Description With uploadMode "presigned-put" or "presigned-post" the response also carries a presigned S3 request, so the client uploads straight to the bucket; contentType, if given, is enforced by S3. Finalize the upload afterwards with the returned blob ID.
 // @Tags files
 // @Accept json
 // @Produce json
@@ -101,99 +195,232 @@ func generateRandomEntropy() uint64 {
 // @Failure 400 {object} router.ErrorResponse
 // @Failure 401 {object} router.ErrorResponse "Unauthorized"
 // @Failure 403 {object} router.ErrorResponse "Forbidden - Admin only"
+// @Failure 500 {object} router.ErrorResponse
 // @Router /api/v1/file/ [post]
 // @Id InitiateFileUpload
 func (r *router) InitiateFileUploadHandler(c *gin.Context) {
-	ctx := c.Request.Context()
 	var dto InitiateFileUploadDTO
 	if err := c.ShouldBindJSON(&dto); err != nil {
 		c.JSON(400, ErrorResponse{Message: "Invalid request body: " + err.Error()})
 		return
 	}
-	regions := Regions{}
-	err := loadRegionsConfig(&regions)
+	initiator, err := r.newUploadInitiator()
 	if err != nil {
 		c.JSON(500, ErrorResponse{Message: "Failed to load regions configuration: " + err.Error()})
 		return
 	}
-	region, ok := regions[dto.RegionID]
-	if !ok {
-		c.JSON(400, ErrorResponse{Message: "Invalid region ID"})
+	response, failure := initiator.initiate(c.Request.Context(), dto)
+	if failure != nil {
+		c.JSON(failure.Code, failure)
 		return
 	}
-	var bucketID uint16
-	if dto.BucketCode == "" {
-		if len(region.Buckets) == 0 {
-			c.JSON(400, ErrorResponse{Message: "No buckets defined for the specified region"})
-			return
+	c.JSON(201, response)
+}
+
+// Initiate a batch of file uploads (admin only)
+// @Summary Initiate file uploads in batch
+// @Description Initiate up to 100 file uploads in one request. Each item is handled like a single initiation and gets its own result, holding either the file GUID, blob ID and TTL or the error that prevented it. Admin access required.
+// @Tags files
+// @Accept json
+// @Produce json
+// @Param x-api-token header string true "API Token"
+// @Param data body InitiateFileUploadBatchDTO true "Upload initiation data"
+// @Success 200 {object} InitiateFileUploadBatchResponse
+// @Failure 400 {object} router.ErrorResponse
+// @Failure 401 {object} router.ErrorResponse "Unauthorized"
+// @Failure 403 {object} router.ErrorResponse "Forbidden - Admin only"
+// @Failure 500 {object} router.ErrorResponse
+// @Router /api/v1/file/initiate-batch [post]
+// @Id InitiateFileUploadBatch
+func (r *router) InitiateFileUploadBatchHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	var dto InitiateFileUploadBatchDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		c.JSON(400, ErrorResponse{Message: "Invalid request body: " + err.Error()})
+		return
+	}
+	initiator, err := r.newUploadInitiator()
+	if err != nil {
+		c.JSON(500, ErrorResponse{Message: "Failed to load regions configuration: " + err.Error()})
+		return
+	}
+
+	results := make([]InitiateFileUploadResult, len(dto.Files))
+	for i, item := range dto.Files {
+		if err := binding.Validator.ValidateStruct(&item); err != nil {
+			results[i].Error = &ErrorResponse{Code: 400, Message: "Invalid request body: " + err.Error()}
+			continue
 		}
-		randIndexBytes := make([]byte, 2)
-		_, err := rand.Read(randIndexBytes)
-		if err != nil {
-			c.JSON(400, ErrorResponse{Message: "Failed to generate random bucket selection: " + err.Error()})
-			return
+		results[i].InitiateFileUploadResponse, results[i].Error = initiator.initiate(ctx, item)
+	}
+	c.JSON(200, InitiateFileUploadBatchResponse{Results: results})
+}
+
+// uploadInitiator creates upload sessions against one snapshot of the regions
+// configuration, caching the buckets it looks up along the way.
+type uploadInitiator struct {
+	repo    *repositories.ApplicationRepository
+	regions Regions
+	buckets map[string]*models.Bucket
+}
+
+func (r *router) newUploadInitiator() (*uploadInitiator, error) {
+	regions := Regions{}
+	if err := loadRegionsConfig(&regions); err != nil {
+		return nil, err
+	}
+	return &uploadInitiator{repo: r.repo, regions: regions, buckets: map[string]*models.Bucket{}}, nil
+}
+
+func (u *uploadInitiator) bucket(ctx context.Context, id string) (*models.Bucket, error) {
+	if bucket, ok := u.buckets[id]; ok {
+		return bucket, nil
+	}
+	bucket, err := u.repo.Buckets.GetBucketByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	u.buckets[id] = bucket
+	return bucket, nil
+}
+
+// initiate selects a bucket for dto and creates the file and blob records of
+// a new upload.
+func (u *uploadInitiator) initiate(ctx context.Context, dto InitiateFileUploadDTO) (*InitiateFileUploadResponse, *ErrorResponse) {
+	region, ok := u.regions[dto.RegionID]
+	if !ok {
+		return nil, &ErrorResponse{Code: 400, Message: "Invalid region ID"}
+	}
+	var replaces *models.File
+	if dto.FileID != "" {
+		if len(dto.Metadata) > 0 || len(dto.Tags) > 0 {
+			return nil, &ErrorResponse{Code: 400, Message: "Metadata and tags of an existing file are changed with PATCH /api/v1/file/{id}"}
 		}
-		randIndex := binary.BigEndian.Uint16(randIndexBytes) % uint16(len(region.Buckets))
-		bucketID = region.Buckets[randIndex].ID
-		dto.BucketCode = region.Buckets[randIndex].BucketID
+		var err error
+		replaces, err = u.repo.Files.GetFileByID(ctx, dto.FileID)
+		if err != nil || replaces == nil {
+			return nil, &ErrorResponse{Code: 404, Message: "File to replace not found"}
+		}
+		if replaces.Status != models.FileStatusActive {
+			return nil, &ErrorResponse{Code: 409, Message: fmt.Sprintf("Cannot replace the content of a file that is %s", replaces.Status)}
+		}
+		if dto.BucketCode == "" {
+			dto.BucketCode = replaces.BucketID
+		}
+	}
+	regionBucket, failure := selectRegionBucket(region, dto.BucketCode)
+	if failure != nil {
+		return nil, failure
 	}
-	found := false
-	for _, bucket := range region.Buckets {
-		if bucket.BucketID == dto.BucketCode {
-			bucketID = bucket.ID
-			found = true
-			break
+	dto.BucketCode = regionBucket.BucketID
+	if dto.Checksum != "" {
+		if _, err := parseChecksum(dto.Checksum); err != nil {
+			return nil, &ErrorResponse{Code: 400, Message: "Invalid checksum: " + err.Error()}
 		}
 	}
-	if !found {
-		c.JSON(400, ErrorResponse{Message: "Invalid bucket code for the specified region"})
-		return
+	if err := validateUserMetadata(dto.Metadata); err != nil {
+		return nil, &ErrorResponse{Code: 400, Message: "Invalid metadata: " + err.Error()}
 	}
-	entropy := generateRandomEntropy()
-	guid := guid.NewGuid(timestamp.CurrentTimestamp(), region.ID, bucketID, entropy, 0x0A)
-	guidString, err := guid.Pack()
+	tags, err := normalizeTags(dto.Tags)
 	if err != nil {
-		c.JSON(400, ErrorResponse{Message: "Failed to generate file GUID: " + err.Error()})
-		return
+		return nil, &ErrorResponse{Code: 400, Message: "Invalid tags: " + err.Error()}
+	}
+	if dto.UploadMode == "" {
+		dto.UploadMode = uploadModeProxy
+	}
+	var bucket *models.Bucket
+	if dto.UploadMode != uploadModeProxy {
+		var err error
+		bucket, err = u.bucket(ctx, dto.BucketCode)
+		if err != nil || bucket == nil {
+			return nil, &ErrorResponse{Code: 400, Message: "Bucket not found for presigned upload"}
+		}
+		if bucket.Encrypt {
+			// Content must pass through KineticaFS to be encrypted.
+			return nil, &ErrorResponse{Code: 400, Message: "Bucket encrypts its content and only accepts proxy uploads"}
+		}
+	}
+	guidString, err := newFileGUID(region, regionBucket)
+	if err != nil {
+		return nil, &ErrorResponse{Code: 400, Message: "Failed to generate file GUID: " + err.Error()}
 	}
 
-	model := &models.File{BucketID: dto.BucketCode, Name: guidString, FileSizeLimit: dto.FileSizeLimit}
+	policy := mergeUploadPolicies(region.Policy, regionBucket.Policy, dto.Policy)
+	if dto.FileSizeLimit > 0 {
+		policy.MaxSize = dto.FileSizeLimit
+	}
+	model := &models.File{BucketID: dto.BucketCode, Name: guidString, Checksum: dto.Checksum, Status: models.FileStatusPending, Version: 1}
+	if len(dto.Metadata) > 0 {
+		model.UserMetadata = dto.Metadata
+	}
+	model.Tags = tags
+	if replaces != nil {
+		model.VersionOf = replaces.ID
+	}
+	applyUploadPolicy(model, policy)
 	blob := &models.FileBlob{FileID: guidString}
 
-	err = r.repo.Files.CreateFile(ctx, model)
+	err = u.repo.Files.CreateFile(ctx, model)
 	if err != nil {
-		c.JSON(500, ErrorResponse{Message: "Failed to create file record: " + err.Error()})
-		return
+		return nil, &ErrorResponse{Code: 500, Message: "Failed to create file record: " + err.Error()}
 	}
-	blob, err = r.repo.FileBlobs.CreateFileBlob(ctx, blob)
+	blob, err = u.repo.FileBlobs.CreateFileBlob(ctx, blob)
 	if err != nil {
-		c.JSON(500, ErrorResponse{Message: "Failed to create file blob: " + err.Error()})
-		return
+		return nil, &ErrorResponse{Code: 500, Message: "Failed to create file blob: " + err.Error()}
 	}
 
-	response := InitiateFileUploadResponse{
-		URL: blob.GetID(),
-		TTL: 600,
+	response := &InitiateFileUploadResponse{
+		FileID: model.ID,
+		URL:    blob.GetID(),
+		TTL:    int(uploadSessionTTL().Seconds()),
 	}
-	c.JSON(201, response)
+	if uploadSigningEnabled() {
+		expires := time.Now().Add(uploadURLTTL()).UTC().Truncate(time.Second)
+		response.UploadURL = signedUploadURL(blob.GetID(), model, expires)
+		response.UploadURLExpiresAt = &expires
+	}
+	if replaces != nil {
+		response.FileID = replaces.ID
+	}
+	if bucket != nil {
+		response.Upload, err = presignUpload(ctx, bucket, model, dto.UploadMode, dto.ContentType)
+		if err != nil {
+			return nil, &ErrorResponse{Code: 500, Message: "Failed to presign upload: " + err.Error()}
+		}
+	}
+	return response, nil
 }
 
 // Upload file data (client)
 // @Summary Upload file data
 // @Description Upload file data using the blob ID provided by the server. Supports stream, form-data, and multipart uploads. No admin access required.
+// @Description Sending an Upload-Offset (with Upload-Length) or Content-Range header makes the request one chunk of a resumable upload: chunks must start at the offset reported by HEAD /api/v1/upload/{blob}, and the upload completes once the declared length has been received.
+// @Description A checksum declared with Content-Digest, X-Checksum-SHA256, Content-MD5 or at initiation is compared with the received data; on a mismatch the object is discarded and 422 is returned. On chunked uploads the SHA-256 headers describe the whole file and are checked once the last chunk arrives.
 // @Tags upload
 // @Accept octet-stream
 // @Accept multipart/form-data
 // @Accept application/x-www-form-urlencoded
 // @Produce json
-// @Param x-api-token header string true "API Token"
+// @Param x-api-token header string false "API Token, unless a signed upload URL is used"
+// @Param expires query int false "Expiry of a signed upload URL (Unix seconds)"
+// @Param signature query string false "Signature of a signed upload URL"
 // @Param blob path string true "Blob ID"
 // @Param file formData file false "File data (multipart or form-data, required if not using raw stream)"
 // @Param file body []byte false "File data (raw stream, required if not using multipart/form-data)"
+// @Param Upload-Offset header int false "Offset of this chunk within a resumable upload"
+// @Param Upload-Length header int false "Total size of a resumable upload"
+// @Param Content-Range header string false "Chunk position, e.g. bytes 0-1048575/4194304 or bytes 0-1048575/*"
+// @Param Content-Digest header string false "Expected digest of the file, e.g. sha-256=:<base64>:"
+// @Param X-Checksum-SHA256 header string false "Expected SHA-256 of the file, hex or base64"
+// @Param Content-MD5 header string false "Expected MD5 of the body, base64 (one-shot uploads only)"
 // @Success 204 {object} nil
 // @Failure 400 {object} router.ErrorResponse
 // @Failure 401 {object} router.ErrorResponse "Unauthorized"
 // @Failure 404 {object} router.ErrorResponse
+// @Failure 409 {object} router.ErrorResponse "Chunk offset does not match the bytes received, another chunk was stored at that offset first, or the upload has been finalized"
+// @Failure 410 {object} router.ErrorResponse "Upload session expired"
+// @Failure 415 {object} router.UploadRejectionResponse "Content type rejected by the upload policy"
+// @Failure 422 {object} router.ErrorResponse "Uploaded data does not match the declared checksum"
 // @Router /api/v1/upload/{blob} [patch]
 // @Id UploadFileBlob
 func (r *router) UploadFileBlobHandler(c *gin.Context) {
@@ -205,6 +432,14 @@ func (r *router) UploadFileBlobHandler(c *gin.Context) {
 		c.JSON(404, ErrorResponse{Message: "File blob not found: " + err.Error()})
 		return
 	}
+	if uploadExpired(blob) {
+		c.JSON(410, ErrorResponse{Message: "Upload session expired"})
+		return
+	}
+	if blob.Finalized {
+		c.JSON(409, ErrorResponse{Message: "Upload has already been finalized"})
+		return
+	}
 
 	file, err := r.repo.Files.GetFileByID(ctx, blob.FileID)
 	if err != nil {
@@ -218,105 +453,199 @@ func (r *router) UploadFileBlobHandler(c *gin.Context) {
 		return
 	}
 
-	var requestFile io.ReadCloser
+	rng, chunked, err := parseChunkRange(c.Request.Header)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if chunked {
+		r.uploadChunk(c, blob, file, bucket, rng)
+		return
+	}
+	if blob.UploadOffset > 0 {
+		writeError(c, http.StatusConflict, "A resumable upload is in progress for this blob; continue it with Upload-Offset or Content-Range")
+		return
+	}
+	switch file.Status {
+	case models.FileStatusPending, models.FileStatusUploading, models.FileStatusUploaded:
+	default:
+		writeError(c, http.StatusConflict, fmt.Sprintf("File is %s and cannot receive content", file.Status))
+		return
+	}
+	if file.Status == models.FileStatusUploaded {
+		// Overwriting an object that deduplicated files share would change
+		// their content too.
+		inUse, err := r.objectInUse(ctx, file)
+		if err != nil {
+			writeError(c, http.StatusInternalServerError, "Failed to check object references: "+err.Error())
+			return
+		}
+		if inUse {
+			writeError(c, http.StatusConflict, "File content is shared with other files and cannot be replaced")
+			return
+		}
+	}
+
+	var requestFile io.Reader
+	var requestSize int64 = -1
 	contentType := c.GetHeader("Content-Type")
 
 	if strings.HasPrefix(contentType, "multipart/") {
-		type formData struct {
-			File *multipart.FileHeader `form:"file" binding:"required"`
-		}
-		form := formData{}
-		if err := c.ShouldBind(&form); err != nil {
+		// Walk the parts by hand instead of binding the form so the file is
+		// never buffered in memory or spilled to a temporary file.
+		mr, err := c.Request.MultipartReader()
+		if err != nil {
 			writeError(c, http.StatusBadRequest, "Invalid form data")
 			return
 		}
-		f, err := form.File.Open()
-		if err != nil {
-			writeError(c, http.StatusInternalServerError, "Cannot read file")
-			return
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				writeError(c, http.StatusBadRequest, "Invalid form data")
+				return
+			}
+			if part.FormName() == "file" {
+				requestFile = part
+				defer part.Close()
+				break
+			}
+			part.Close()
 		}
-		requestFile = f
-		defer f.Close()
 	} else if contentType == "application/octet-stream" {
 		requestFile = c.Request.Body
+		requestSize = c.Request.ContentLength
 	} else {
 		c.JSON(400, ErrorResponse{Message: "Unsupported Content-Type. Use multipart/form-data or application/octet-stream"})
 		return
 	}
 
-	// TODO: Currently reads the entire file into memory.
-	//       This can consume a lot of RAM for large files.
-	//       Consider streaming the file directly (e.g., to S3)
-	//       and computing checksum on the fly to avoid memory spikes.
-	body, err := io.ReadAll(requestFile)
-
-	if uint64(len(body)) >= file.FileSizeLimit && file.FileSizeLimit > 0 {
-		c.JSON(400, ErrorResponse{Message: fmt.Sprintf("File size exceeds the limit of %d bytes", file.FileSizeLimit)})
+	if requestSize == 0 {
+		c.JSON(400, ErrorResponse{Message: "Empty file data"})
+		return
+	}
+	if requestSize > 0 && file.FileSizeLimit > 0 && uint64(requestSize) > file.FileSizeLimit {
+		writeRejection(c, sizeLimitRejection(file.FileSizeLimit))
 		return
 	}
 
+	expected, ok := expectedUploadDigest(c, file)
+	if !ok {
+		return
+	}
+	stream := newUploadStream(requestFile, file.FileSizeLimit)
+	if expected.MD5 != nil {
+		stream.trackMD5()
+	}
+	fileContentType, body, err := sniffContentType(stream)
 	if err != nil {
-		c.JSON(400, ErrorResponse{Message: "Failed to read request body: " + err.Error()})
+		writeUploadStreamError(c, file, err)
 		return
 	}
-
-	if len(body) == 0 {
-		c.JSON(400, ErrorResponse{Message: "Empty file data"})
+	if rejection := checkContentType(file, fileContentType); rejection != nil {
+		writeRejection(c, rejection)
 		return
 	}
 
-	n := min(len(body), 512)
-	fileContentType := http.DetectContentType(body[:n])
-
 	s3Client, err := createS3Client(bucket)
 	if err != nil {
 		c.JSON(500, ErrorResponse{Message: "Failed to create S3 client: " + err.Error()})
 		return
 	}
 
-	objectKey := file.Name
-	hash := sha256.New()
-	// bodyReader := bytes.NewReader(body)
-	// tee := io.TeeReader(bodyReader, hash)
-
-	_, err = s3Client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket:        aws.String(bucket.Name),
-		Key:           aws.String(objectKey),
-		Body:          strings.NewReader(string(body)),
-		ContentType:   aws.String(fileContentType),
-		ContentLength: aws.Int64(int64(len(body))),
-	})
+	aead, err := uploadCipher(file, bucket)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "Failed to create data key: "+err.Error())
+		return
+	}
+	objectSize := requestSize
+	if aead != nil {
+		body = newEncryptingReader(body, aead)
+		if requestSize > 0 {
+			objectSize = encryptedSize(requestSize)
+		}
+	}
 
+	objectKey := file.Name
+	err = uploadObject(ctx, s3Client, bucket.Name, objectKey, fileContentType, body, objectSize)
+	if streamErr := stream.Err(); streamErr != nil {
+		writeUploadStreamError(c, file, streamErr)
+		return
+	}
 	if err != nil {
 		c.JSON(500, ErrorResponse{Message: "Failed to upload file to S3: " + err.Error()})
 		return
 	}
+	if err := expected.verify(stream.Sum(), stream.MD5Sum()); err != nil {
+		if err := deleteObject(context.WithoutCancel(ctx), bucket, file); err != nil {
+			log.Printf("Failed to delete corrupted object %s/%s: %v", bucket.Name, file.Name, err)
+		}
+		writeError(c, http.StatusUnprocessableEntity, "Checksum mismatch: "+err.Error())
+		return
+	}
 
-	metadata := map[string]string{
-		"file_type":   fileContentType,
-		"uploaded_by": c.GetHeader("x-api-token"),
+	err = r.markFileUploaded(ctx, c, file, bucket, fileContentType, stream.Size(), stream.Checksum())
+	if errors.Is(err, models.ErrIllegalTransition) {
+		writeError(c, http.StatusConflict, err.Error())
+		return
 	}
-	jsonMetadata, err := json.Marshal(metadata)
 	if err != nil {
-		c.JSON(500, ErrorResponse{Message: "Failed to marshal metadata: " + err.Error()})
+		c.JSON(500, ErrorResponse{Message: "Failed to update file record: " + err.Error()})
 		return
 	}
+	c.Status(204)
+}
 
-	checksum := fmt.Sprintf("%x", hash.Sum(nil))
+// markFileUploaded records on the file that its object has been stored in
+// bucket under the file name. If the bucket deduplicates content and the
+// object duplicates an existing one, the file is linked to that object
+// instead and the new copy is removed. Content that still has to be scanned
+// leaves the file scanning.
+func (r *router) markFileUploaded(ctx context.Context, c *gin.Context, file *models.File, bucket *models.Bucket, contentType string, size int64, checksum string) error {
+	if err := file.Transition(models.FileStatusUploaded); err != nil {
+		return err
+	}
+	uploadedBy := c.GetHeader("x-api-token")
+	if uploadedBy == "" && c.GetString("uploadBlob") != "" {
+		uploadedBy = "signed-url"
+	}
+	metadata := map[string]string{
+		"file_type":   contentType,
+		"uploaded_by": uploadedBy,
+	}
+	jsonMetadata, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("marshal metadata: %w", err)
+	}
 
-	file.Path = fmt.Sprintf("%s/%s/%s", bucket.Endpoint, bucket.Name, objectKey)
-	file.FileSize = int64(len(body))
-	file.ContentType = fileContentType
-	file.Finalized = true
+	file.Path = fmt.Sprintf("%s/%s/%s", bucket.Endpoint, bucket.Name, file.Name)
+	file.ObjectKey = ""
+	file.FileSize = size
+	file.ContentType = contentType
 	file.Metadata = string(jsonMetadata)
-	file.Checksum = fmt.Sprintf("sha256:%s", checksum)
+	file.Checksum = checksum
+	file.ScanStatus = models.ScanStatusNone
+	file.ScanDetail = ""
 
-	err = r.repo.Files.UpdateFile(ctx, file)
-	if err != nil {
-		c.JSON(500, ErrorResponse{Message: "Failed to update file record: " + err.Error()})
-		return
+	removeCopy := r.deduplicateUpload(ctx, file, bucket, checksum)
+	// Content linked to a duplicate has been scanned already.
+	scan := r.scanner != nil && file.ScanStatus != models.ScanStatusClean
+	if scan {
+		if err := file.Transition(models.FileStatusScanning); err != nil {
+			return err
+		}
+		file.ScanStatus = models.ScanStatusScanning
 	}
-	c.Status(204)
+	if err := r.repo.Files.UpdateFile(ctx, file); err != nil {
+		return err
+	}
+	if removeCopy != nil {
+		removeCopy()
+	}
+	r.emit(ctx, models.EventFileUploaded, file)
+	if scan {
+		r.scans.start(func() { r.scanFile(file.ID) })
+	}
+	return nil
 }
 
 func createS3Client(bucket *models.Bucket) (*s3.Client, error) {
@@ -336,14 +665,46 @@ func createS3Client(bucket *models.Bucket) (*s3.Client, error) {
 	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
 		o.BaseEndpoint = aws.String(bucket.Endpoint)
 		o.UsePathStyle = true
+		o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
 	})
 
 	return client, nil
 }
 
+// putObjectStream uploads body as a single object without buffering it.
+// The payload is sent unsigned because a non-seekable stream cannot be
+// hashed up front for SigV4; size is passed as Content-Length when known.
+func putObjectStream(ctx context.Context, client *s3.Client, bucket, key, contentType string, body io.Reader, size int64) error {
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: aws.String(contentType),
+	}
+	if size > 0 {
+		input.ContentLength = aws.Int64(size)
+	}
+	_, err := client.PutObject(ctx, input, s3.WithAPIOptions(v4.SwapComputePayloadSHA256ForUnsignedPayloadMiddleware))
+	return err
+}
+
+// writeUploadStreamError maps an error raised while reading the upload body
+// to a client response.
+func writeUploadStreamError(c *gin.Context, file *models.File, err error) {
+	switch {
+	case errors.Is(err, errFileSizeLimitExceeded):
+		writeRejection(c, sizeLimitRejection(file.FileSizeLimit))
+	case errors.Is(err, errEmptyUpload):
+		c.JSON(400, ErrorResponse{Message: "Empty file data"})
+	default:
+		c.JSON(400, ErrorResponse{Message: "Failed to read request body: " + err.Error()})
+	}
+}
+
 // Finalize file upload (admin only)
 // @Summary Finalize file upload
-// @Description Finalize a file upload after client notifies server. Admin access required.
+// @Description Finalize a file upload after client notifies server. The stored object is looked up in the bucket and its size, ETag and content type are recorded on the file; an object violating the upload policy is deleted. Finalizing an upload again returns the file unchanged. Admin access required.
+// @Description When content scanning is enabled, the file can only be finalized once the scanner has passed it. Until then 409 is returned, and a scan is started if none is running; content the scanner rejects is moved to quarantine and 422 is returned.
 // @Tags files
 // @Produce json
 // @Param x-api-token header string true "API Token"
@@ -353,26 +714,145 @@ func createS3Client(bucket *models.Bucket) (*s3.Client, error) {
 // @Failure 401 {object} router.ErrorResponse "Unauthorized"
 // @Failure 403 {object} router.ErrorResponse "Forbidden - Admin only"
 // @Failure 404 {object} router.ErrorResponse
+// @Failure 409 {object} router.ErrorResponse "Object has not been uploaded yet, its content is being scanned, or another version replaced the file meanwhile"
+// @Failure 410 {object} router.ErrorResponse "Upload session expired"
+// @Failure 415 {object} router.UploadRejectionResponse "Content type rejected by the upload policy"
+// @Failure 422 {object} router.ErrorResponse "Object does not match the declared checksum, or was rejected by the scanner"
 // @Router /api/v1/file/{blob}/finalize [post]
 // @Id FinalizeFileUpload
 func (r *router) FinalizeFileUploadHandler(c *gin.Context) {
-	blobId := c.Param("blob")
+	// The route shares its wildcard with the /file/:id routes; it names a blob.
+	blobId := c.Param("id")
 	ctx := c.Request.Context()
-	log.Println(blobId)
-	blob, err := r.repo.FileBlobs.GetFileBlobByID(ctx, blobId)
-	if err != nil {
-		c.JSON(404, ErrorResponse{Message: "File blob not found: " + err.Error()})
+	blob, file, bucket, ok := r.loadUploadSession(c, blobId)
+	if !ok {
+		return
+	}
+	if blob.Finalized || file.Status == models.FileStatusActive {
+		c.JSON(200, file)
 		return
 	}
+	switch file.Status {
+	case models.FileStatusPending, models.FileStatusUploaded, models.FileStatusScanning:
+	case models.FileStatusFailed:
+		writeError(c, http.StatusUnprocessableEntity, "File content was rejected: "+file.ScanDetail)
+		return
+	default:
+		writeError(c, http.StatusConflict, fmt.Sprintf("Cannot finalize a file that is %s", file.Status))
+		return
+	}
+	// Content uploaded straight to the bucket is checked here, the rest was
+	// checked as it came in.
+	presigned := file.Status == models.FileStatusPending
 
-	file, err := r.repo.Files.GetFileByID(ctx, blob.FileID)
-	if err != nil {
-		c.JSON(404, ErrorResponse{Message: "File not found: " + err.Error()})
+	head, err := headUploadedObject(ctx, bucket, file)
+	if errors.Is(err, errObjectNotUploaded) {
+		c.JSON(409, ErrorResponse{Message: "File has not been uploaded yet"})
 		return
 	}
-	err = r.repo.FileBlobs.DeleteFileBlobByID(ctx, blob.ID)
 	if err != nil {
-		c.JSON(500, ErrorResponse{Message: "Failed to delete file blob record: " + err.Error()})
+		c.JSON(500, ErrorResponse{Message: "Failed to look up uploaded object: " + err.Error()})
+		return
+	}
+	size := aws.ToInt64(head.ContentLength)
+	if presigned && file.FileSizeLimit > 0 && uint64(size) > file.FileSizeLimit {
+		if err := deleteObject(ctx, bucket, file); err != nil {
+			log.Printf("Failed to delete oversized object %s/%s: %v", bucket.Name, file.Name, err)
+		}
+		writeRejection(c, sizeLimitRejection(file.FileSizeLimit))
+		return
+	}
+	if presigned && restrictsContentType(file) {
+		contentType, err := sniffStoredObject(ctx, bucket, file)
+		if err != nil {
+			c.JSON(500, ErrorResponse{Message: "Failed to inspect uploaded object: " + err.Error()})
+			return
+		}
+		if rejection := checkContentType(file, contentType); rejection != nil {
+			if err := deleteObject(ctx, bucket, file); err != nil {
+				log.Printf("Failed to delete rejected object %s/%s: %v", bucket.Name, file.Name, err)
+			}
+			writeRejection(c, rejection)
+			return
+		}
+		file.ContentType = contentType
+	}
+
+	// S3 reports the SHA-256 only for objects whose upload declared it, in
+	// which case S3 verified the body against it.
+	verified := presigned && file.Checksum != "" && head.ChecksumSHA256 != nil
+	if verified {
+		expected, _ := parseChecksum(file.Checksum)
+		actual, err := base64.StdEncoding.DecodeString(aws.ToString(head.ChecksumSHA256))
+		if err != nil || !bytes.Equal(expected, actual) {
+			if err := deleteObject(ctx, bucket, file); err != nil {
+				log.Printf("Failed to delete corrupted object %s/%s: %v", bucket.Name, file.Name, err)
+			}
+			c.JSON(422, ErrorResponse{Message: "Checksum mismatch: " + errDigestMismatch.Error()})
+			return
+		}
+	}
+	if presigned {
+		if err := file.Transition(models.FileStatusUploaded); err != nil {
+			writeError(c, http.StatusConflict, err.Error())
+			return
+		}
+	}
+	if !r.requireCleanScan(c, file) {
+		if presigned && file.Status == models.FileStatusScanning {
+			// The scan started for content uploaded straight to the bucket.
+			r.emit(ctx, models.EventFileUploaded, file)
+		}
+		// Keep the session alive while the client waits for the verdict.
+		if err := r.repo.FileBlobs.UpdateFileBlob(ctx, blob); err != nil {
+			log.Printf("Failed to extend upload session %s: %v", blob.ID, err)
+		}
+		return
+	}
+
+	file.Path = fmt.Sprintf("%s/%s/%s", bucket.Endpoint, bucket.Name, file.StorageKey())
+	if !file.Encrypted {
+		// The object of an encrypted file is larger than its content, whose
+		// size was recorded when it was uploaded.
+		file.FileSize = size
+	}
+	file.ETag = aws.ToString(head.ETag)
+	if contentType := aws.ToString(head.ContentType); contentType != "" && !restrictsContentType(file) {
+		file.ContentType = contentType
+	}
+	var removeCopy func()
+	if verified {
+		removeCopy = r.deduplicateUpload(ctx, file, bucket, file.Checksum)
+	}
+	if err := file.Transition(models.FileStatusActive); err != nil {
+		writeError(c, http.StatusConflict, err.Error())
+		return
+	}
+	if file.VersionOf != "" {
+		// The content becomes the new version of an existing file.
+		replaced, failure := r.promoteVersion(ctx, file, blob)
+		if failure != nil {
+			c.JSON(failure.Code, failure)
+			return
+		}
+		file = replaced
+	} else if err := r.repo.Files.UpdateFile(ctx, file); err != nil {
+		c.JSON(500, ErrorResponse{Message: "Failed to update file record: " + err.Error()})
+		return
+	}
+	if removeCopy != nil {
+		removeCopy()
+	}
+	if presigned {
+		r.emit(ctx, models.EventFileUploaded, file)
+	}
+	r.emit(ctx, models.EventFileFinalized, file)
+
+	// The blob is kept so the session still reports its state; the sweeper
+	// removes it once it expires.
+	blob.Finalized = true
+	if err := r.repo.FileBlobs.UpdateFileBlob(ctx, blob); err != nil {
+		c.JSON(500, ErrorResponse{Message: "Failed to update file blob record: " + err.Error()})
 		return
 	}
 	c.JSON(200, file)
@@ -380,7 +860,7 @@ func (r *router) FinalizeFileUploadHandler(c *gin.Context) {
 
 // Delete file (admin only)
 // @Summary Delete file
-// @Description Delete a file by ID. Removes the file from S3 storage and then deletes the database record. Admin access required.
+// @Description Delete a file by ID. The file moves to deleting, its object is removed from S3 storage, and the database record is deleted once the file is deleted. Earlier versions of the file are deleted with it. An object shared by deduplicated files is kept until the last of them is deleted. Admin access required.
 // @Tags files
 // @Param x-api-token header string true "API Token"
 // @Param id path string true "File ID"
@@ -414,12 +894,46 @@ func (r *router) DeleteFileHandler(c *gin.Context) {
 		return
 	}
 
-	_, err = s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
-		Bucket: aws.String(bucket.Name),
-		Key:    aws.String(file.Name),
-	})
+	// A file left deleting or deleted by an earlier attempt picks up where
+	// that attempt stopped.
+	if file.Status != models.FileStatusDeleting && file.Status != models.FileStatusDeleted {
+		if err := file.Transition(models.FileStatusDeleting); err != nil {
+			writeError(c, http.StatusConflict, err.Error())
+			return
+		}
+		if err := r.repo.Files.UpdateFile(ctx, file); err != nil {
+			c.JSON(500, ErrorResponse{Message: "Failed to update file record: " + err.Error()})
+			return
+		}
+	}
+
+	inUse, err := r.objectInUse(ctx, file)
 	if err != nil {
-		c.JSON(500, ErrorResponse{Message: "Failed to delete file from S3: " + err.Error()})
+		c.JSON(500, ErrorResponse{Message: "Failed to check object references: " + err.Error()})
+		return
+	}
+	if !inUse && file.Status == models.FileStatusDeleting {
+		_, err = s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(bucket.Name),
+			Key:    aws.String(file.StorageKey()),
+		})
+		if err != nil {
+			c.JSON(500, ErrorResponse{Message: "Failed to delete file from S3: " + err.Error()})
+			return
+		}
+	}
+	if file.Status == models.FileStatusDeleting {
+		if err := file.Transition(models.FileStatusDeleted); err != nil {
+			writeError(c, http.StatusConflict, err.Error())
+			return
+		}
+		if err := r.repo.Files.UpdateFile(ctx, file); err != nil {
+			log.Printf("Failed to mark file %s deleted: %v", id, err)
+		}
+	}
+
+	if err := r.removeFileVersions(ctx, file); err != nil {
+		c.JSON(500, ErrorResponse{Message: "Failed to delete file versions: " + err.Error()})
 		return
 	}
 
@@ -429,6 +943,7 @@ func (r *router) DeleteFileHandler(c *gin.Context) {
 		c.JSON(500, ErrorResponse{Message: "Failed to delete file from database: " + err.Error()})
 		return
 	}
+	r.emit(ctx, models.EventFileDeleted, file)
 
 	c.Status(204)
 }
@@ -461,7 +976,7 @@ func (r *router) IncrementHandler(c *gin.Context) {
 
 // Decrement file reference count
 // @Summary Decrement file reference count
-// @Description Atomically decrements the reference count for a file. Used for tracking how many clients are using a file. When reference count reaches zero or below, the file is automatically deleted from both S3 storage and database. Requires authentication.
+// @Description Atomically decrements the reference count for a file. Used for tracking how many clients are using a file. Only anonymous references taken with increment, and the one of the uploader until a holder takes it over, can be released this way. When reference count reaches zero, the file is automatically deleted from both S3 storage and database. Requires authentication.
 // @Tags files
 // @Accept json
 // @Produce json
@@ -471,6 +986,7 @@ func (r *router) IncrementHandler(c *gin.Context) {
 // @Failure 400 {object} router.ErrorResponse
 // @Failure 401 {object} router.ErrorResponse
 // @Failure 404 {object} router.ErrorResponse
+// @Failure 409 {object} router.ErrorResponse "No anonymous references left"
 // @Failure 500 {object} router.ErrorResponse "Internal error during file deletion"
 // @Router /api/v1/file/{id}/decrement [patch]
 // @Id DecrementFileRef
@@ -479,6 +995,10 @@ func (r *router) DecrementHandler(c *gin.Context) {
 	ctx := c.Request.Context()
 
 	err := r.repo.Files.AtomicDecrement(ctx, id)
+	if errors.Is(err, models.ErrNoReferences) {
+		c.JSON(409, ErrorResponse{Message: "File has no anonymous references to release"})
+		return
+	}
 	if err != nil {
 		c.JSON(400, ErrorResponse{Message: "Failed to decrement file ref count: " + err.Error()})
 		return
@@ -489,6 +1009,9 @@ func (r *router) DecrementHandler(c *gin.Context) {
 		return
 	}
 	if currentRefCount < 1 {
+		if file, err := r.repo.Files.GetFileByID(ctx, id); err == nil {
+			r.emit(ctx, models.EventRefcountZero, file)
+		}
 		r.DeleteFileHandler(c)
 	}
 	c.Status(204)
@@ -496,12 +1019,13 @@ func (r *router) DecrementHandler(c *gin.Context) {
 
 // Get file by ID (admin only)
 // @Summary Get file by ID
-// @Description Retrieve detailed information about a file by its ID, including metadata, size, content type, and reference count. Admin access required.
+// @Description Retrieve detailed information about a file by its ID, including metadata, size, content type, and reference count. With version, the content fields describe that earlier version instead. Admin access required.
 // @Tags files
 // @Accept json
 // @Produce json
 // @Param x-api-token header string true "API Token"
 // @Param id path string true "File ID"
+// @Param version query int false "Version to describe, the current one by default"
 // @Success 200 {object} models.File
 // @Failure 400 {object} router.ErrorResponse
 // @Failure 401 {object} router.ErrorResponse "Unauthorized"
@@ -518,6 +1042,10 @@ func (r *router) GetFileByIDHandler(c *gin.Context) {
 		c.JSON(404, ErrorResponse{Message: "File not found: " + err.Error()})
 		return
 	}
+	file, ok := r.fileAtVersion(c, file)
+	if !ok {
+		return
+	}
 
 	c.JSON(200, file)
 }
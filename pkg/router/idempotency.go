@@ -0,0 +1,266 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/argon-chat/KineticaFS/pkg/repositories"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+	maxIdempotentRequestBody = 1 << 20
+	// idempotencyLockTimeout is how long a key is held without a heartbeat
+	// before a retry may take it over, for when the instance serving the
+	// request stopped.
+	idempotencyLockTimeout = 5 * time.Minute
+	// idempotencyHeartbeat is how often a request still being served
+	// refreshes its hold on its key.
+	idempotencyHeartbeat = time.Minute
+)
+
+// idempotencyKeyTTL returns how long the response to a request with an
+// Idempotency-Key is replayed to retries.
+func idempotencyKeyTTL() time.Duration {
+	return viper.GetDuration("idempotency-key-ttl")
+}
+
+// parseIdempotencyKey reads the Idempotency-Key header, a structured field
+// string; the quotes are optional.
+func parseIdempotencyKey(header string) (string, error) {
+	key := strings.TrimSpace(header)
+	if len(key) >= 2 && key[0] == '"' && key[len(key)-1] == '"' {
+		key = key[1 : len(key)-1]
+	}
+	if key == "" || len(key) > maxIdempotencyKeyLength {
+		return "", fmt.Errorf("%s must be 1 to %d characters long", idempotencyKeyHeader, maxIdempotencyKeyLength)
+	}
+	return key, nil
+}
+
+// requestFingerprint identifies a request, so a key reused for another
+// request can be told apart from a retry.
+func requestFingerprint(method, uri string, body []byte) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s\n", method, uri)
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// replayedHeader reports whether a response header is stored to be replayed
+// to retries. Headers every response gets anyway, such as CORS headers, are
+// left out; the content type is stored on its own.
+func replayedHeader(name string) bool {
+	switch name {
+	case "Content-Type", "Content-Length", "Date", "Vary", idempotentReplayedHeader:
+		return false
+	}
+	return !strings.HasPrefix(name, "Access-Control-")
+}
+
+// replayedHeaders returns the headers of a response to store for retries.
+func replayedHeaders(header http.Header) map[string]string {
+	headers := map[string]string{}
+	for name, values := range header {
+		if replayedHeader(name) && len(values) > 0 {
+			headers[name] = strings.Join(values, ", ")
+		}
+	}
+	return headers
+}
+
+// holdIdempotencyKey refreshes the hold of record on its key until the
+// returned function is called, so a request running longer than
+// idempotencyLockTimeout is not taken over by a retry.
+func holdIdempotencyKey(ctx context.Context, repo *repositories.ApplicationRepository, record *models.IdempotencyRecord) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	beat := *record
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(idempotencyHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := repo.Idempotency.UpdateIdempotencyRecord(ctx, &beat); err != nil {
+					log.Printf("Failed to refresh idempotency key %q: %v", beat.Key, err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+func mutatingMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// recordingWriter keeps a copy of the response body written through it.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// claimIdempotencyKey stores record, holding its key for the request being
+// served. If the key is already held, the record holding it is returned.
+func claimIdempotencyKey(ctx context.Context, repo *repositories.ApplicationRepository, record *models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		created, err := repo.Idempotency.CreateIdempotencyRecord(ctx, record)
+		if err != nil || created {
+			return nil, err
+		}
+		existing, err := repo.Idempotency.GetIdempotencyRecord(ctx, record.TokenID, record.Key)
+		if err != nil {
+			return nil, err
+		}
+		if existing == nil {
+			// Expired since; claim it again.
+			continue
+		}
+		if existing.StatusCode == 0 && existing.Fingerprint == record.Fingerprint && time.Since(existing.UpdatedAt) > idempotencyLockTimeout {
+			// Its request stopped refreshing the key.
+			if err := repo.Idempotency.DeleteIdempotencyRecord(ctx, existing); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		return existing, nil
+	}
+	return nil, errors.New("idempotency key is contended")
+}
+
+// IdempotencyMiddleware honors the Idempotency-Key header on mutating
+// requests made with a service token. It runs after AuthMiddleware, keyed by
+// the token that middleware accepted, so requests it turns away never claim a
+// key. The first response to a key is stored for idempotency-key-ttl and
+// replayed to retries, headers included; a retry arriving while the first
+// request is still served gets 409, and reusing a key for a different request
+// gets 422. Server errors are not stored, so a retry runs again. Requests
+// without the header are passed on untouched. The request body is buffered,
+// so uploads, which carry large bodies and resume from their offset, do not
+// use the middleware.
+func IdempotencyMiddleware(repo *repositories.ApplicationRepository) GinMiddleware {
+	return func(c *gin.Context) {
+		header := c.GetHeader(idempotencyKeyHeader)
+		if header == "" || !mutatingMethod(c.Request.Method) {
+			c.Next()
+			return
+		}
+		key, err := parseIdempotencyKey(header)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Code: http.StatusBadRequest, Message: err.Error()})
+			return
+		}
+		serviceTokenIface, _ := c.Get("serviceToken")
+		serviceToken, ok := serviceTokenIface.(*models.ServiceToken)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Code: http.StatusInternalServerError, Message: "Internal server error"})
+			return
+		}
+		ctx := c.Request.Context()
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxIdempotentRequestBody+1))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Code: http.StatusBadRequest, Message: "Failed to read request body: " + err.Error()})
+			return
+		}
+		if len(body) > maxIdempotentRequestBody {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, ErrorResponse{
+				Code:    http.StatusRequestEntityTooLarge,
+				Message: fmt.Sprintf("Requests with an %s carry at most %d bytes", idempotencyKeyHeader, maxIdempotentRequestBody),
+			})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		record := &models.IdempotencyRecord{
+			TokenID:     serviceToken.ID,
+			Key:         key,
+			Fingerprint: requestFingerprint(c.Request.Method, c.Request.URL.RequestURI(), body),
+			ExpiresAt:   time.Now().UTC().Add(idempotencyKeyTTL()),
+		}
+		existing, err := claimIdempotencyKey(ctx, repo, record)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Code: http.StatusInternalServerError, Message: "Failed to store idempotency key: " + err.Error()})
+			return
+		}
+		switch {
+		case existing == nil:
+		case existing.Fingerprint != record.Fingerprint:
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, ErrorResponse{
+				Code:    http.StatusUnprocessableEntity,
+				Message: fmt.Sprintf("%s has already been used for a different request", idempotencyKeyHeader),
+			})
+			return
+		case existing.StatusCode == 0:
+			c.AbortWithStatusJSON(http.StatusConflict, ErrorResponse{
+				Code:    http.StatusConflict,
+				Message: fmt.Sprintf("A request with this %s is still being processed", idempotencyKeyHeader),
+			})
+			return
+		default:
+			for name, value := range existing.Headers {
+				c.Header(name, value)
+			}
+			c.Header(idempotentReplayedHeader, "true")
+			c.Data(existing.StatusCode, existing.ContentType, existing.Body)
+			c.Abort()
+			return
+		}
+
+		// The response is stored even if the client hangs up.
+		ctx = context.WithoutCancel(ctx)
+		release := holdIdempotencyKey(ctx, repo, record)
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		release()
+
+		if writer.Status() >= http.StatusInternalServerError {
+			if err := repo.Idempotency.DeleteIdempotencyRecord(ctx, record); err != nil {
+				log.Printf("Failed to release idempotency key %q: %v", key, err)
+			}
+			return
+		}
+		record.StatusCode = writer.Status()
+		record.ContentType = writer.Header().Get("Content-Type")
+		record.Headers = replayedHeaders(writer.Header())
+		record.Body = writer.body.Bytes()
+		if err := repo.Idempotency.UpdateIdempotencyRecord(ctx, record); err != nil {
+			log.Printf("Failed to store response for idempotency key %q: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+func TestParseIdempotencyKey(t *testing.T) {
+	cases := []struct {
+		header string
+		key    string
+		ok     bool
+	}{
+		{`"8e03978e-40d5-43e8-bc93-6894a57f9324"`, "8e03978e-40d5-43e8-bc93-6894a57f9324", true},
+		{"retry-1", "retry-1", true},
+		{` "spaced" `, "spaced", true},
+		{`""`, "", false},
+		{strings.Repeat("k", maxIdempotencyKeyLength+1), "", false},
+	}
+	for _, tc := range cases {
+		key, err := parseIdempotencyKey(tc.header)
+		if (err == nil) != tc.ok || key != tc.key {
+			t.Errorf("parseIdempotencyKey(%q) = %q, %v", tc.header, key, err)
+		}
+	}
+}
+
+func TestRequestFingerprint(t *testing.T) {
+	base := requestFingerprint(http.MethodPost, "/api/v1/file/", []byte(`{"regionId":"eu"}`))
+	if base != requestFingerprint(http.MethodPost, "/api/v1/file/", []byte(`{"regionId":"eu"}`)) {
+		t.Error("expected the same request to have the same fingerprint")
+	}
+	if base == requestFingerprint(http.MethodPost, "/api/v1/file/", []byte(`{"regionId":"us"}`)) {
+		t.Error("expected another body to change the fingerprint")
+	}
+	if base == requestFingerprint(http.MethodPost, "/api/v1/file/initiate-batch", []byte(`{"regionId":"eu"}`)) {
+		t.Error("expected another path to change the fingerprint")
+	}
+}
+
+func TestIdempotencyMiddleware_PassesThrough(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	// Without a key or on reads the repository is never touched.
+	engine.Use(IdempotencyMiddleware(nil))
+	engine.Any("/", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodPost, "/", nil),
+		httptest.NewRequest(http.MethodGet, "/", nil),
+	} {
+		req.Header.Set("x-api-token", "token")
+		if req.Method == http.MethodGet {
+			req.Header.Set(idempotencyKeyHeader, "key")
+		}
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		if w.Code != http.StatusNoContent {
+			t.Errorf("%s: expected 204, got %d", req.Method, w.Code)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("x-api-token", "token")
+	req.Header.Set(idempotencyKeyHeader, `""`)
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("empty key: expected 400, got %d", w.Code)
+	}
+}
+
+// idempotencyServer serves POST / through AuthMiddleware and
+// IdempotencyMiddleware with a fake repository holding the service token
+// "token". The handler answers with status, a Location header and the number
+// of times it ran.
+func idempotencyServer(t *testing.T, status int) (*gin.Engine, *fakeRepository, *int) {
+	gin.SetMode(gin.TestMode)
+	viper.Set("idempotency-key-ttl", time.Hour)
+	t.Cleanup(func() { viper.Set("idempotency-key-ttl", nil) })
+	repo := newFakeRepository()
+	repo.CreateServiceToken(context.Background(), &models.ServiceToken{Name: "test", AccessKey: "token", TokenType: models.AdminToken})
+	calls := 0
+	engine := gin.New()
+	engine.Use(AuthMiddleware(repo.repository()), IdempotencyMiddleware(repo.repository()))
+	engine.POST("/", func(c *gin.Context) {
+		calls++
+		c.Header("Location", fmt.Sprintf("/things/%d", calls))
+		c.JSON(status, gin.H{"calls": calls})
+	})
+	return engine, repo, &calls
+}
+
+func idempotentRequest(engine *gin.Engine, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("x-api-token", "token")
+	req.Header.Set(idempotencyKeyHeader, key)
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyMiddleware_Replay(t *testing.T) {
+	engine, _, calls := idempotencyServer(t, http.StatusCreated)
+
+	first := idempotentRequest(engine, "key-1", `{"a":1}`)
+	retry := idempotentRequest(engine, "key-1", `{"a":1}`)
+	if *calls != 1 {
+		t.Fatalf("expected the handler to run once, ran %d times", *calls)
+	}
+	if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() {
+		t.Errorf("expected the first response replayed, got %d %s", retry.Code, retry.Body)
+	}
+	if retry.Header().Get("Location") != "/things/1" || retry.Header().Get("Content-Type") != first.Header().Get("Content-Type") {
+		t.Errorf("expected the headers replayed, got %v", retry.Header())
+	}
+	if retry.Header().Get(idempotentReplayedHeader) != "true" || first.Header().Get(idempotentReplayedHeader) != "" {
+		t.Error("expected only the replay to be marked as such")
+	}
+
+	// Another key runs the request again.
+	idempotentRequest(engine, "key-2", `{"a":1}`)
+	if *calls != 2 {
+		t.Errorf("expected a new key to run the handler, ran %d times", *calls)
+	}
+}
+
+func TestIdempotencyMiddleware_FingerprintMismatch(t *testing.T) {
+	engine, _, calls := idempotencyServer(t, http.StatusCreated)
+	idempotentRequest(engine, "key-1", `{"a":1}`)
+	if w := idempotentRequest(engine, "key-1", `{"a":2}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 for a key reused with another body, got %d", w.Code)
+	}
+	if *calls != 1 {
+		t.Errorf("expected the handler to run once, ran %d times", *calls)
+	}
+}
+
+func TestIdempotencyMiddleware_InFlight(t *testing.T) {
+	engine, repo, calls := idempotencyServer(t, http.StatusCreated)
+	token, _ := repo.GetServiceTokenByAccessKey(context.Background(), "token")
+	held := &models.IdempotencyRecord{
+		TokenID:     token.ID,
+		Key:         "key-1",
+		Fingerprint: requestFingerprint(http.MethodPost, "/", []byte(`{"a":1}`)),
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}
+	repo.CreateIdempotencyRecord(context.Background(), held)
+
+	if w := idempotentRequest(engine, "key-1", `{"a":1}`); w.Code != http.StatusConflict {
+		t.Errorf("expected 409 while the first request runs, got %d", w.Code)
+	}
+	if *calls != 0 {
+		t.Errorf("expected the handler not to run, ran %d times", *calls)
+	}
+
+	// A key whose request stopped refreshing it is taken over.
+	repo.mu.Lock()
+	repo.idempotency[idempotencyID(token.ID, "key-1")].UpdatedAt = time.Now().Add(-2 * idempotencyLockTimeout)
+	repo.mu.Unlock()
+	if w := idempotentRequest(engine, "key-1", `{"a":1}`); w.Code != http.StatusCreated || *calls != 1 {
+		t.Errorf("expected a stale key to be taken over, got %d after %d calls", w.Code, *calls)
+	}
+	// The request that lost the key cannot overwrite or release it.
+	held.StatusCode = http.StatusAccepted
+	repo.UpdateIdempotencyRecord(context.Background(), held)
+	repo.DeleteIdempotencyRecord(context.Background(), held)
+	if w := idempotentRequest(engine, "key-1", `{"a":1}`); w.Code != http.StatusCreated || *calls != 1 {
+		t.Errorf("expected the response of the new holder replayed, got %d after %d calls", w.Code, *calls)
+	}
+}
+
+func TestIdempotencyMiddleware_ReleasesOnServerError(t *testing.T) {
+	engine, _, calls := idempotencyServer(t, http.StatusInternalServerError)
+	idempotentRequest(engine, "key-1", `{"a":1}`)
+	if w := idempotentRequest(engine, "key-1", `{"a":1}`); w.Code != http.StatusInternalServerError || w.Header().Get(idempotentReplayedHeader) != "" {
+		t.Errorf("expected the retry to run again, got %d", w.Code)
+	}
+	if *calls != 2 {
+		t.Errorf("expected the handler to run twice, ran %d times", *calls)
+	}
+}
+
+// TestIdempotencyMiddleware_SkipsUploads checks that large upload chunks sent
+// with an Idempotency-Key are not buffered and refused.
+func TestIdempotencyMiddleware_SkipsUploads(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newFakeRepository()
+	repo.CreateServiceToken(context.Background(), &models.ServiceToken{Name: "test", AccessKey: "token", TokenType: models.AdminToken})
+	r := &router{engine: gin.New(), repo: repo.repository()}
+	getRoutes(r)
+
+	for _, path := range []string{"/api/v1/upload/blob-1", "/api/v1/tus/blob-1"} {
+		req := httptest.NewRequest(http.MethodPatch, path, bytes.NewReader(make([]byte, maxIdempotentRequestBody+1)))
+		req.Header.Set("x-api-token", "token")
+		req.Header.Set(idempotencyKeyHeader, "key-1")
+		req.Header.Set("Content-Type", "application/offset+octet-stream")
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		req.Header.Set("Upload-Offset", "0")
+		w := httptest.NewRecorder()
+		r.engine.ServeHTTP(w, req)
+		if w.Code == http.StatusRequestEntityTooLarge {
+			t.Errorf("%s: expected the upload not to be buffered, got 413", path)
+		}
+	}
+	if len(repo.idempotency) != 0 {
+		t.Error("expected uploads not to claim idempotency keys")
+	}
+}
+
+// TestIdempotencyMiddleware_AfterAuth checks that requests turned away by the
+// auth middlewares do not claim the key they carry.
+func TestIdempotencyMiddleware_AfterAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newFakeRepository()
+	repo.CreateServiceToken(context.Background(), &models.ServiceToken{Name: "user", AccessKey: "user-token", TokenType: models.UserToken})
+	r := &router{engine: gin.New(), repo: repo.repository()}
+	getRoutes(r)
+
+	for token, want := range map[string]int{"": http.StatusUnauthorized, "user-token": http.StatusForbidden} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/bucket/", strings.NewReader(`{}`))
+		if token != "" {
+			req.Header.Set("x-api-token", token)
+		}
+		req.Header.Set(idempotencyKeyHeader, "key-1")
+		w := httptest.NewRecorder()
+		r.engine.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("token %q: expected %d, got %d", token, want, w.Code)
+		}
+	}
+	if len(repo.idempotency) != 0 {
+		t.Error("expected rejected requests not to claim idempotency keys")
+	}
+}
@@ -0,0 +1,95 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/gin-gonic/gin"
+)
+
+// Page sizes of the file listing.
+const (
+	defaultFileListLimit = 100
+	maxFileListLimit     = 1000
+)
+
+type FileListResponse struct {
+	Files []*models.File `json:"files"`
+	// NextCursor resumes the listing after this page. It is left out on the
+	// last page.
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// parseFileListQuery reads the filter and page size of a file listing.
+func parseFileListQuery(c *gin.Context) (models.FileFilter, int, error) {
+	filter := models.FileFilter{
+		BucketID:    c.Query("bucket"),
+		Status:      models.FileStatus(c.Query("status")),
+		ContentType: c.Query("content_type"),
+		Tags:        c.QueryArray("tag"),
+		Metadata:    parseMetadataQuery(c),
+	}
+	if filter.Status != "" && !filter.Status.Valid() {
+		return filter, 0, fmt.Errorf("unknown status %q", filter.Status)
+	}
+	if createdAfter := c.Query("created_after"); createdAfter != "" {
+		t, err := time.Parse(time.RFC3339, createdAfter)
+		if err != nil {
+			return filter, 0, fmt.Errorf("created_after must be an RFC 3339 time")
+		}
+		filter.CreatedAfter = t.UTC()
+	}
+	limit := defaultFileListLimit
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxFileListLimit {
+			return filter, 0, fmt.Errorf("limit must be between 1 and %d", maxFileListLimit)
+		}
+		limit = n
+	}
+	return filter, limit, nil
+}
+
+// List files (admin only)
+// @Summary List files
+// @Description Page through the files matching the given filters, with their reference counts. Pass the nextCursor of a page as cursor to get the next one; it is left out on the last page, which may be empty. Metadata is matched with meta.<key>=<value> query parameters, e.g. meta.channel=42. Admin access required.
+// @Tags files
+// @Produce json
+// @Param x-api-token header string true "API Token"
+// @Param bucket query string false "Bucket ID"
+// @Param status query string false "File status" Enums(pending, uploading, uploaded, scanning, active, deleting, deleted, failed)
+// @Param content_type query string false "Content type"
+// @Param created_after query string false "Only files created after this RFC 3339 time"
+// @Param tag query []string false "Tag the files must carry" collectionFormat(multi)
+// @Param cursor query string false "Cursor of the page to get"
+// @Param limit query int false "Files per page, 100 by default and at most 1000"
+// @Success 200 {object} FileListResponse
+// @Failure 400 {object} router.ErrorResponse
+// @Failure 401 {object} router.ErrorResponse "Unauthorized"
+// @Failure 403 {object} router.ErrorResponse "Forbidden - Admin only"
+// @Router /api/v1/file/ [get]
+// @Id ListFiles
+func (r *router) ListFilesHandler(c *gin.Context) {
+	filter, limit, err := parseFileListQuery(c)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	files, next, err := r.repo.Files.ListFiles(c.Request.Context(), filter, c.Query("cursor"), limit)
+	if errors.Is(err, models.ErrInvalidCursor) {
+		writeError(c, http.StatusBadRequest, "Invalid cursor")
+		return
+	}
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "Failed to list files: "+err.Error())
+		return
+	}
+	if files == nil {
+		files = []*models.File{}
+	}
+	c.JSON(http.StatusOK, FileListResponse{Files: files, NextCursor: next})
+}
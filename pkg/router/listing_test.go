@@ -0,0 +1,45 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/gin-gonic/gin"
+)
+
+func listQueryContext(query string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest(http.MethodGet, "/api/v1/file/?"+query, nil)
+	return c
+}
+
+func TestParseFileListQuery(t *testing.T) {
+	c := listQueryContext("bucket=b1&status=active&created_after=2025-01-02T03:04:05Z&tag=a&tag=b&meta.channel=42&limit=50")
+	filter, limit, err := parseFileListQuery(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := models.FileFilter{
+		BucketID:     "b1",
+		Status:       models.FileStatusActive,
+		CreatedAfter: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		Tags:         []string{"a", "b"},
+		Metadata:     map[string]string{"channel": "42"},
+	}
+	if !reflect.DeepEqual(filter, want) || limit != 50 {
+		t.Errorf("got %+v, limit %d", filter, limit)
+	}
+
+	if _, limit, err := parseFileListQuery(listQueryContext("")); err != nil || limit != defaultFileListLimit {
+		t.Errorf("defaults: got limit %d, %v", limit, err)
+	}
+	for _, query := range []string{"status=gone", "limit=0", "limit=5000", "created_after=yesterday"} {
+		if _, _, err := parseFileListQuery(listQueryContext(query)); err == nil {
+			t.Errorf("expected %q to be rejected", query)
+		}
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/argon-chat/KineticaFS/pkg/repositories"
+	"github.com/argon-chat/KineticaFS/pkg/scanner"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/viper"
@@ -26,9 +27,14 @@ type ErrorResponse struct {
 }
 
 type router struct {
-	engine *gin.Engine
-	repo   *repositories.ApplicationRepository
-	port   int
+	engine  *gin.Engine
+	repo    *repositories.ApplicationRepository
+	scanner scanner.Scanner // nil when content scanning is disabled
+	scans   scanQueue
+	port    int
+	events  *eventBroker
+	// webhookWake nudges the webhook dispatcher when deliveries are queued
+	webhookWake chan struct{}
 }
 
 func (r *router) Run(ctx context.Context, wg *sync.WaitGroup) error {
@@ -42,6 +48,7 @@ func (r *router) Run(ctx context.Context, wg *sync.WaitGroup) error {
 		Addr:    fmt.Sprintf(":%d", r.port),
 		Handler: r.engine,
 	}
+	srv.RegisterOnShutdown(r.events.close)
 
 	go func() {
 		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
@@ -60,11 +67,13 @@ func (r *router) Run(ctx context.Context, wg *sync.WaitGroup) error {
 	} else {
 		log.Printf("Server on port %s stopped gracefully", srv.Addr)
 	}
+	// Scans outlive the requests that started them.
+	r.scans.close(shutdownCtx)
 
 	return nil
 }
 
-func NewRouter(repo *repositories.ApplicationRepository, port int) *router {
+func NewRouter(repo *repositories.ApplicationRepository, contentScanner scanner.Scanner, port int) *router {
 	ginRouter := gin.Default()
 	var allowedOrigins []string
 	var allowedHeaders []string
@@ -90,13 +99,21 @@ func NewRouter(repo *repositories.ApplicationRepository, port int) *router {
 		AllowOrigins: allowedOrigins,
 		AllowMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowHeaders: allowedHeaders,
-		MaxAge:       24 * time.Hour,
+		// Downloads and resumable uploads report their state in response headers.
+		ExposeHeaders: []string{"ETag", "Content-Range", "Accept-Ranges", "Location", "Upload-Offset", "Upload-Length", "Upload-Expires", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Idempotent-Replayed"},
+		MaxAge:        24 * time.Hour,
 	}
 	ginRouter.Use(cors.New(corsConfig))
+	if !uploadSigningEnabled() {
+		log.Println("Warning: upload-signing-key is not set; signed upload URLs are disabled")
+	}
 	return &router{
-		engine: ginRouter,
-		repo:   repo,
-		port:   port,
+		engine:      ginRouter,
+		repo:        repo,
+		scanner:     contentScanner,
+		port:        port,
+		events:      newEventBroker(),
+		webhookWake: make(chan struct{}, 1),
 	}
 }
 
@@ -116,8 +133,7 @@ func setupDashboard(router *router) {
 }
 
 func getRoutes(router *router) {
-	v1 := router.engine.Group("/api/v1")
-	addV1Routes(router, v1)
+	addV1Routes(router, router.engine.Group("/api/v1"))
 }
 
 func addV1Routes(router *router, v1 *gin.RouterGroup) {
@@ -125,4 +141,7 @@ func addV1Routes(router *router, v1 *gin.RouterGroup) {
 	AddBucketsRoutes(router, v1)
 	AddFileRoutes(router, v1)
 	AddFileBlobRoutes(router, v1)
+	AddTusRoutes(router, v1)
+	AddWebhookRoutes(router, v1)
+	AddEventRoutes(router, v1)
 }
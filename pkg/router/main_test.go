@@ -0,0 +1,18 @@
+package router
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestAddV1Routes builds the real route table, as gin panics on conflicting
+// wildcards only when the routes are registered.
+func TestAddV1Routes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := &router{engine: gin.New()}
+	addV1Routes(r, r.engine.Group("/api/v1"))
+	if len(r.engine.Routes()) == 0 {
+		t.Error("expected routes to be registered")
+	}
+}
@@ -0,0 +1,181 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/gin-gonic/gin"
+)
+
+// Limits on the metadata and tags clients attach to a file.
+const (
+	maxUserMetadataEntries = 32
+	maxUserMetadataKey     = 128
+	maxUserMetadataValue   = 1024
+	maxTags                = 32
+	maxTagLength           = 128
+)
+
+// metadataQueryPrefix marks the query parameters that filter on user
+// metadata, e.g. meta.channel=42.
+const metadataQueryPrefix = "meta."
+
+// FileUpdateDTO changes the client-set fields of a file. Fields left out are
+// kept.
+type FileUpdateDTO struct {
+	// Metadata is merged into the user metadata; a null value removes the key.
+	Metadata   map[string]*string `json:"metadata,omitempty"`
+	Tags       *[]string          `json:"tags,omitempty"` // replaces all tags
+	AddTags    []string           `json:"addTags,omitempty"`
+	RemoveTags []string           `json:"removeTags,omitempty"`
+}
+
+// validateUserMetadata checks metadata against the limits.
+func validateUserMetadata(metadata map[string]string) error {
+	if len(metadata) > maxUserMetadataEntries {
+		return fmt.Errorf("at most %d metadata entries are allowed", maxUserMetadataEntries)
+	}
+	for key, value := range metadata {
+		if key == "" || len(key) > maxUserMetadataKey {
+			return fmt.Errorf("metadata keys must be 1 to %d bytes long", maxUserMetadataKey)
+		}
+		if len(value) > maxUserMetadataValue {
+			return fmt.Errorf("metadata value of %q exceeds %d bytes", key, maxUserMetadataValue)
+		}
+	}
+	return nil
+}
+
+// normalizeTags trims, deduplicates and sorts tags and checks them against
+// the limits. It returns nil for no tags.
+func normalizeTags(tags []string) ([]string, error) {
+	seen := map[string]bool{}
+	var normalized []string
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || len(tag) > maxTagLength {
+			return nil, fmt.Errorf("tags must be 1 to %d bytes long", maxTagLength)
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	if len(normalized) > maxTags {
+		return nil, fmt.Errorf("at most %d tags are allowed", maxTags)
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// apply changes the user metadata and tags of file as the request asks.
+func (req FileUpdateDTO) apply(file *models.File) error {
+	if len(req.Metadata) > 0 {
+		metadata := map[string]string{}
+		for key, value := range file.UserMetadata {
+			metadata[key] = value
+		}
+		for key, value := range req.Metadata {
+			if value == nil {
+				delete(metadata, key)
+			} else {
+				metadata[key] = *value
+			}
+		}
+		if err := validateUserMetadata(metadata); err != nil {
+			return err
+		}
+		if len(metadata) == 0 {
+			metadata = nil
+		}
+		file.UserMetadata = metadata
+	}
+
+	tags := file.Tags
+	if req.Tags != nil {
+		tags = *req.Tags
+	}
+	tags = append(append([]string(nil), tags...), req.AddTags...)
+	if len(req.RemoveTags) > 0 {
+		remove := map[string]bool{}
+		for _, tag := range req.RemoveTags {
+			remove[strings.TrimSpace(tag)] = true
+		}
+		kept := tags[:0]
+		for _, tag := range tags {
+			if !remove[strings.TrimSpace(tag)] {
+				kept = append(kept, tag)
+			}
+		}
+		tags = kept
+	}
+	normalized, err := normalizeTags(tags)
+	if err != nil {
+		return err
+	}
+	file.Tags = normalized
+	return nil
+}
+
+// parseMetadataQuery reads the meta.<key> query parameters.
+func parseMetadataQuery(c *gin.Context) map[string]string {
+	var metadata map[string]string
+	for param, values := range c.Request.URL.Query() {
+		key, ok := strings.CutPrefix(param, metadataQueryPrefix)
+		if !ok || key == "" || len(values) == 0 {
+			continue
+		}
+		if metadata == nil {
+			metadata = map[string]string{}
+		}
+		metadata[key] = values[0]
+	}
+	return metadata
+}
+
+// Update file metadata and tags (admin only)
+// @Summary Update file metadata and tags
+// @Description Change the metadata and tags clients attach to a file. Metadata keys are merged into the existing ones, and a null value removes a key. Tags can be replaced as a whole, or added and removed one by one. What the server records about the upload is left untouched. Admin access required.
+// @Tags files
+// @Accept json
+// @Produce json
+// @Param x-api-token header string true "API Token"
+// @Param id path string true "File ID"
+// @Param changes body FileUpdateDTO true "Changes"
+// @Success 200 {object} models.File
+// @Failure 400 {object} router.ErrorResponse
+// @Failure 401 {object} router.ErrorResponse "Unauthorized"
+// @Failure 403 {object} router.ErrorResponse "Forbidden - Admin only"
+// @Failure 404 {object} router.ErrorResponse
+// @Failure 409 {object} router.ErrorResponse "File is being deleted"
+// @Router /api/v1/file/{id} [patch]
+// @Id UpdateFile
+func (r *router) UpdateFileHandler(c *gin.Context) {
+	var req FileUpdateDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+	ctx := c.Request.Context()
+	file, err := r.repo.Files.GetFileByID(ctx, c.Param("id"))
+	if err != nil || file == nil {
+		writeError(c, http.StatusNotFound, "File not found")
+		return
+	}
+	if removing(file) {
+		writeError(c, http.StatusConflict, fmt.Sprintf("File is %s", file.Status))
+		return
+	}
+	if err := req.apply(file); err != nil {
+		writeError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := r.repo.Files.UpdateFileUserMetadata(ctx, file); err != nil {
+		writeError(c, http.StatusInternalServerError, "Failed to update file record: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, file)
+}
@@ -0,0 +1,56 @@
+package router
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	tags, err := normalizeTags([]string{" video ", "avatar", "video"})
+	if err != nil || !reflect.DeepEqual(tags, []string{"avatar", "video"}) {
+		t.Errorf("got %v, %v", tags, err)
+	}
+	if tags, err := normalizeTags(nil); err != nil || tags != nil {
+		t.Errorf("no tags: got %v, %v", tags, err)
+	}
+	if _, err := normalizeTags([]string{" "}); err == nil {
+		t.Error("expected an empty tag to be rejected")
+	}
+	if _, err := normalizeTags([]string{strings.Repeat("a", maxTagLength+1)}); err == nil {
+		t.Error("expected a long tag to be rejected")
+	}
+}
+
+func TestFileUpdateDTO_Apply(t *testing.T) {
+	channel := "42"
+	file := &models.File{
+		Metadata:     `{"content_type":"image/png"}`,
+		UserMetadata: map[string]string{"owner": "alice", "channel": "1"},
+		Tags:         []string{"avatar", "draft"},
+	}
+	req := FileUpdateDTO{
+		Metadata:   map[string]*string{"channel": &channel, "owner": nil},
+		AddTags:    []string{"public"},
+		RemoveTags: []string{"draft"},
+	}
+	if err := req.apply(file); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(file.UserMetadata, map[string]string{"channel": "42"}) {
+		t.Errorf("unexpected metadata %v", file.UserMetadata)
+	}
+	if !reflect.DeepEqual(file.Tags, []string{"avatar", "public"}) {
+		t.Errorf("unexpected tags %v", file.Tags)
+	}
+	if file.Metadata != `{"content_type":"image/png"}` {
+		t.Errorf("system metadata changed: %v", file.Metadata)
+	}
+
+	empty := []string{}
+	if err := (FileUpdateDTO{Tags: &empty}).apply(file); err != nil || file.Tags != nil {
+		t.Errorf("replacing tags: got %v, %v", file.Tags, err)
+	}
+}
@@ -0,0 +1,182 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/spf13/viper"
+)
+
+const (
+	// minPartSize is the smallest part S3 accepts for anything but the last part.
+	minPartSize = 5 << 20
+	// maxParts is the largest number of parts a single multipart upload may have.
+	maxParts = 10000
+	// abortTimeout bounds the cleanup call made after a failed multipart upload.
+	abortTimeout = 30 * time.Second
+)
+
+// multipartThreshold returns the object size above which uploads switch from a
+// single PutObject to a multipart upload.
+func multipartThreshold() int64 {
+	return viper.GetInt64("multipart-threshold")
+}
+
+// multipartPartSize returns the configured part size, raised to whatever is
+// needed to fit size bytes into maxParts parts. Pass a negative size when the
+// total is unknown.
+func multipartPartSize(size int64) int64 {
+	partSize := max(viper.GetInt64("multipart-part-size"), minPartSize)
+	if size > 0 {
+		partSize = max(partSize, (size+maxParts-1)/maxParts)
+	}
+	return partSize
+}
+
+// multipartUpload tracks an in-progress S3 multipart upload.
+type multipartUpload struct {
+	client   *s3.Client
+	bucket   string
+	key      string
+	uploadID string
+	parts    []types.CompletedPart
+}
+
+func startMultipartUpload(ctx context.Context, client *s3.Client, bucket, key, contentType string) (*multipartUpload, error) {
+	out, err := client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create multipart upload: %w", err)
+	}
+	return &multipartUpload{
+		client:   client,
+		bucket:   bucket,
+		key:      key,
+		uploadID: aws.ToString(out.UploadId),
+	}, nil
+}
+
+// resumeMultipartUpload rebuilds the handle of a multipart upload whose state
+// was persisted on a FileBlob.
+func resumeMultipartUpload(client *s3.Client, bucket, key string, blob *models.FileBlob) *multipartUpload {
+	upload := &multipartUpload{
+		client:   client,
+		bucket:   bucket,
+		key:      key,
+		uploadID: blob.UploadID,
+	}
+	for _, part := range blob.Parts {
+		upload.parts = append(upload.parts, types.CompletedPart{
+			ETag:       aws.String(part.ETag),
+			PartNumber: aws.Int32(part.Number),
+		})
+	}
+	return upload
+}
+
+// UploadPart uploads data as the given 1-based part number, records it for
+// completion and returns its ETag.
+func (m *multipartUpload) UploadPart(ctx context.Context, number int32, data []byte) (string, error) {
+	out, err := m.client.UploadPart(ctx, &s3.UploadPartInput{
+		Bucket:        aws.String(m.bucket),
+		Key:           aws.String(m.key),
+		UploadId:      aws.String(m.uploadID),
+		PartNumber:    aws.Int32(number),
+		Body:          bytes.NewReader(data),
+		ContentLength: aws.Int64(int64(len(data))),
+	})
+	if err != nil {
+		return "", fmt.Errorf("upload part %d: %w", number, err)
+	}
+	m.parts = append(m.parts, types.CompletedPart{
+		ETag:       out.ETag,
+		PartNumber: aws.Int32(number),
+	})
+	return aws.ToString(out.ETag), nil
+}
+
+// Complete stitches the uploaded parts into the final object.
+func (m *multipartUpload) Complete(ctx context.Context) error {
+	_, err := m.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(m.bucket),
+		Key:             aws.String(m.key),
+		UploadId:        aws.String(m.uploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: m.parts},
+	})
+	if err != nil {
+		return fmt.Errorf("complete multipart upload: %w", err)
+	}
+	return nil
+}
+
+// Abort discards the upload and every part stored so far. It runs on its own
+// context because it is usually called after the request context has failed.
+func (m *multipartUpload) Abort() {
+	ctx, cancel := context.WithTimeout(context.Background(), abortTimeout)
+	defer cancel()
+	_, err := m.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(m.bucket),
+		Key:      aws.String(m.key),
+		UploadId: aws.String(m.uploadID),
+	})
+	if err != nil {
+		log.Printf("Failed to abort multipart upload %s for %s/%s: %v", m.uploadID, m.bucket, m.key, err)
+	}
+}
+
+// uploadObject stores body under key. Bodies of a known size up to the
+// multipart threshold go out as a single PutObject; larger or unknown-length
+// bodies are cut into parts and sent as a multipart upload, which is aborted
+// on any failure so no orphaned parts are left in the bucket.
+func uploadObject(ctx context.Context, client *s3.Client, bucket, key, contentType string, body io.Reader, size int64) error {
+	if size > 0 && size <= multipartThreshold() {
+		return putObjectStream(ctx, client, bucket, key, contentType, body, size)
+	}
+
+	buf := make([]byte, multipartPartSize(size))
+	n, err := io.ReadFull(body, buf)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		// Everything fit into a single part.
+		return putObjectStream(ctx, client, bucket, key, contentType, bytes.NewReader(buf[:n]), int64(n))
+	}
+	if err != nil {
+		return err
+	}
+
+	upload, err := startMultipartUpload(ctx, client, bucket, key, contentType)
+	if err != nil {
+		return err
+	}
+	for number := int32(1); n > 0; number++ {
+		if number > maxParts {
+			upload.Abort()
+			return fmt.Errorf("upload exceeds %d parts", maxParts)
+		}
+		if _, err := upload.UploadPart(ctx, number, buf[:n]); err != nil {
+			upload.Abort()
+			return err
+		}
+		n, err = io.ReadFull(body, buf)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			upload.Abort()
+			return err
+		}
+	}
+	if err := upload.Complete(ctx); err != nil {
+		upload.Abort()
+		return err
+	}
+	return nil
+}
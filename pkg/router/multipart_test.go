@@ -0,0 +1,138 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/spf13/viper"
+)
+
+// failingReader returns data and then err.
+type failingReader struct {
+	data []byte
+	err  error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestUploadObject(t *testing.T) {
+	viper.Set("multipart-threshold", 1<<20)
+	viper.Set("multipart-part-size", minPartSize)
+	defer viper.Set("multipart-threshold", nil)
+	defer viper.Set("multipart-part-size", nil)
+
+	large := bytes.Repeat([]byte("0123456789abcdef"), (2*minPartSize+minPartSize/2)/16)
+	tests := []struct {
+		name         string
+		body         io.Reader
+		size         int64
+		failComplete bool
+		wantErr      bool
+		wantStored   []byte
+		wantParts    int
+		wantAborts   int
+	}{
+		{name: "small body", body: bytes.NewReader([]byte("data")), size: 4, wantStored: []byte("data")},
+		{name: "unknown length fitting a part", body: bytes.NewReader([]byte("data")), size: -1, wantStored: []byte("data")},
+		{name: "large body", body: bytes.NewReader(large), size: int64(len(large)), wantStored: large, wantParts: 3},
+		{name: "unknown length over a part", body: bytes.NewReader(large), size: -1, wantStored: large, wantParts: 3},
+		{
+			name:       "body failing after a part",
+			body:       &failingReader{data: large[:minPartSize+1], err: errors.New("connection reset")},
+			size:       -1,
+			wantErr:    true,
+			wantParts:  1,
+			wantAborts: 1,
+		},
+		{
+			name:         "failed completion",
+			body:         bytes.NewReader(large),
+			size:         int64(len(large)),
+			failComplete: true,
+			wantErr:      true,
+			wantParts:    3,
+			wantAborts:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := newFakeS3()
+			defer storage.Close()
+			storage.failComplete = tt.failComplete
+			client, err := createS3Client(storage.bucket("bucket", "bucket"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = uploadObject(context.Background(), client, "bucket", "key", "application/octet-stream", tt.body, tt.size)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("uploadObject: %v", err)
+			}
+			storage.mu.Lock()
+			stored, ok := storage.objects["bucket/key"]
+			uploads := len(storage.uploads)
+			storage.mu.Unlock()
+			if tt.wantStored == nil && ok {
+				t.Error("expected no object to be stored")
+			}
+			if tt.wantStored != nil && !bytes.Equal(stored, tt.wantStored) {
+				t.Errorf("stored %d bytes, want %d", len(stored), len(tt.wantStored))
+			}
+			if parts := len(storage.callsOf("UploadPart")); parts != tt.wantParts {
+				t.Errorf("uploaded %d parts, want %d", parts, tt.wantParts)
+			}
+			if aborts := len(storage.callsOf("AbortMultipartUpload")); aborts != tt.wantAborts {
+				t.Errorf("aborted %d uploads, want %d", aborts, tt.wantAborts)
+			}
+			if uploads != 0 {
+				t.Errorf("expected no multipart upload left, found %d", uploads)
+			}
+		})
+	}
+}
+
+// TestResumeMultipartUpload checks that parts recorded on a blob are
+// completed together with the parts uploaded after resuming.
+func TestResumeMultipartUpload(t *testing.T) {
+	storage := newFakeS3()
+	defer storage.Close()
+	client, err := createS3Client(storage.bucket("bucket", "bucket"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	first, err := startMultipartUpload(ctx, client, "bucket", "key", "text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag, err := first.UploadPart(ctx, 1, []byte("hello "))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob := &models.FileBlob{UploadID: first.uploadID, Parts: []models.BlobPart{{Number: 1, ETag: etag}}}
+
+	resumed := resumeMultipartUpload(client, "bucket", "key", blob)
+	if _, err := resumed.UploadPart(ctx, 2, []byte("world")); err != nil {
+		t.Fatal(err)
+	}
+	if err := resumed.Complete(ctx); err != nil {
+		t.Fatal(err)
+	}
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	if got := string(storage.objects["bucket/key"]); got != "hello world" {
+		t.Errorf("stored %q", got)
+	}
+}
@@ -0,0 +1,157 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/gin-gonic/gin"
+)
+
+// Reasons reported in an UploadRejectionResponse.
+const (
+	rejectSizeLimitExceeded   = "size_limit_exceeded"
+	rejectContentTypeDenied   = "content_type_denied"
+	rejectContentTypeNotAllow = "content_type_not_allowed"
+)
+
+// UploadRejectionResponse explains why an upload was refused by its upload
+// policy.
+type UploadRejectionResponse struct {
+	Code        int    `json:"code" example:"415"`
+	Message     string `json:"message" example:"Content type application/x-msdownload is denied"`
+	Reason      string `json:"reason" example:"content_type_denied"` // size_limit_exceeded, content_type_denied or content_type_not_allowed
+	Limit       uint64 `json:"limit,omitempty"`                      // size limit in bytes, for size_limit_exceeded
+	ContentType string `json:"contentType,omitempty"`                // detected content type, for content type rejections
+}
+
+func writeRejection(c *gin.Context, rejection *UploadRejectionResponse) {
+	c.JSON(rejection.Code, rejection)
+}
+
+func sizeLimitRejection(limit uint64) *UploadRejectionResponse {
+	return &UploadRejectionResponse{
+		Code:    http.StatusBadRequest,
+		Message: fmt.Sprintf("File size exceeds the limit of %d bytes", limit),
+		Reason:  rejectSizeLimitExceeded,
+		Limit:   limit,
+	}
+}
+
+// mergeUploadPolicies layers policies from the most general to the most
+// specific: every field set in a later policy replaces the earlier value.
+func mergeUploadPolicies(policies ...*models.UploadPolicy) models.UploadPolicy {
+	var merged models.UploadPolicy
+	for _, p := range policies {
+		if p == nil {
+			continue
+		}
+		if p.MaxSize > 0 {
+			merged.MaxSize = p.MaxSize
+		}
+		if p.AllowedTypes != nil {
+			merged.AllowedTypes = p.AllowedTypes
+		}
+		if p.DeniedTypes != nil {
+			merged.DeniedTypes = p.DeniedTypes
+		}
+		if p.RetentionDays > 0 {
+			merged.RetentionDays = p.RetentionDays
+		}
+	}
+	return merged
+}
+
+// applyUploadPolicy stores policy on a file that is about to be created.
+func applyUploadPolicy(file *models.File, policy models.UploadPolicy) {
+	file.FileSizeLimit = policy.MaxSize
+	if policy.RetentionDays > 0 {
+		expiresAt := time.Now().UTC().AddDate(0, 0, policy.RetentionDays)
+		file.ExpiresAt = &expiresAt
+	}
+	if len(policy.AllowedTypes) > 0 || len(policy.DeniedTypes) > 0 || policy.RetentionDays > 0 {
+		file.UploadPolicy = &models.UploadPolicy{
+			AllowedTypes:  policy.AllowedTypes,
+			DeniedTypes:   policy.DeniedTypes,
+			RetentionDays: policy.RetentionDays,
+		}
+	}
+}
+
+// matchContentType reports whether contentType matches any of patterns.
+// A pattern is a full media type or a wildcard such as image/* or */*.
+func matchContentType(contentType string, patterns []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "*/*" || pattern == mediaType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkContentType checks the content type detected from the uploaded bytes
+// against the policy of file. It returns nil if the type is acceptable.
+func checkContentType(file *models.File, contentType string) *UploadRejectionResponse {
+	policy := file.UploadPolicy
+	if policy == nil {
+		return nil
+	}
+	if matchContentType(contentType, policy.DeniedTypes) {
+		return &UploadRejectionResponse{
+			Code:        http.StatusUnsupportedMediaType,
+			Message:     fmt.Sprintf("Content type %s is denied", contentType),
+			Reason:      rejectContentTypeDenied,
+			ContentType: contentType,
+		}
+	}
+	if len(policy.AllowedTypes) > 0 && !matchContentType(contentType, policy.AllowedTypes) {
+		return &UploadRejectionResponse{
+			Code:        http.StatusUnsupportedMediaType,
+			Message:     fmt.Sprintf("Content type %s is not allowed", contentType),
+			Reason:      rejectContentTypeNotAllow,
+			ContentType: contentType,
+		}
+	}
+	return nil
+}
+
+// restrictsContentType reports whether the policy of file limits content types.
+func restrictsContentType(file *models.File) bool {
+	return file.UploadPolicy != nil && (len(file.UploadPolicy.AllowedTypes) > 0 || len(file.UploadPolicy.DeniedTypes) > 0)
+}
+
+// sniffStoredObject detects the content type of the object holding the
+// content of file from its leading bytes, for uploads that bypassed the
+// server.
+func sniffStoredObject(ctx context.Context, bucket *models.Bucket, file *models.File) (string, error) {
+	client, err := createS3Client(bucket)
+	if err != nil {
+		return "", err
+	}
+	out, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket.Name),
+		Key:    aws.String(file.StorageKey()),
+		Range:  aws.String(fmt.Sprintf("bytes=0-%d", sniffLength-1)),
+	})
+	if err != nil {
+		return "", fmt.Errorf("get object: %w", err)
+	}
+	defer out.Body.Close()
+	contentType, _, err := sniffContentType(io.LimitReader(out.Body, sniffLength))
+	return contentType, err
+}
@@ -0,0 +1,53 @@
+package router
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+)
+
+func TestMatchContentType(t *testing.T) {
+	cases := []struct {
+		contentType string
+		patterns    []string
+		want        bool
+	}{
+		{"image/png", []string{"image/*"}, true},
+		{"text/plain; charset=utf-8", []string{"text/plain"}, true},
+		{"video/mp4", []string{"image/*", "audio/*"}, false},
+		{"application/pdf", []string{"*/*"}, true},
+		{"application/pdf", nil, false},
+	}
+	for _, tc := range cases {
+		if got := matchContentType(tc.contentType, tc.patterns); got != tc.want {
+			t.Errorf("matchContentType(%q, %v) = %v, want %v", tc.contentType, tc.patterns, got, tc.want)
+		}
+	}
+}
+
+func TestMergeUploadPolicies(t *testing.T) {
+	region := &models.UploadPolicy{MaxSize: 100, DeniedTypes: []string{"application/x-msdownload"}, RetentionDays: 30}
+	bucket := &models.UploadPolicy{AllowedTypes: []string{"image/*"}}
+	override := &models.UploadPolicy{MaxSize: 10}
+
+	got := mergeUploadPolicies(region, nil, bucket, override)
+	if got.MaxSize != 10 || got.RetentionDays != 30 || len(got.AllowedTypes) != 1 || len(got.DeniedTypes) != 1 {
+		t.Fatalf("unexpected merged policy: %+v", got)
+	}
+
+	file := &models.File{}
+	applyUploadPolicy(file, got)
+	if file.FileSizeLimit != 10 || file.ExpiresAt == nil {
+		t.Fatalf("policy not applied: %+v", file)
+	}
+	if r := checkContentType(file, "image/png"); r != nil {
+		t.Errorf("expected image/png to be accepted, got %+v", r)
+	}
+	if r := checkContentType(file, "application/x-msdownload"); r == nil || r.Reason != rejectContentTypeDenied || r.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("expected a denial, got %+v", r)
+	}
+	if r := checkContentType(file, "text/plain"); r == nil || r.Reason != rejectContentTypeNotAllow {
+		t.Errorf("expected text/plain to be rejected, got %+v", r)
+	}
+}
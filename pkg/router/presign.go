@@ -0,0 +1,145 @@
+package router
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Upload modes accepted by InitiateFileUpload.
+const (
+	// uploadModeProxy streams the bytes through KineticaFS via /upload/:blob.
+	uploadModeProxy = "proxy"
+	// uploadModePresignedPut hands out a presigned S3 PUT URL.
+	uploadModePresignedPut = "presigned-put"
+	// uploadModePresignedPost hands out a presigned S3 POST policy.
+	uploadModePresignedPost = "presigned-post"
+)
+
+var errObjectNotUploaded = errors.New("object has not been uploaded")
+
+// PresignedUpload describes a request the client sends straight to the bucket.
+type PresignedUpload struct {
+	Method  string            `json:"method"` // PUT or POST
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"` // PUT: headers the request must carry
+	Fields  map[string]string `json:"fields,omitempty"`  // POST: form fields to send ahead of the file
+}
+
+// presignUpload builds a direct-to-bucket upload of file for the given mode.
+// A POST policy enforces the file size limit and content type on the S3 side;
+// a PUT URL can only pin the content type and checksum, so the size is checked
+// when the upload is finalized.
+func presignUpload(ctx context.Context, bucket *models.Bucket, file *models.File, mode, contentType string) (*PresignedUpload, error) {
+	client, err := createS3Client(bucket)
+	if err != nil {
+		return nil, err
+	}
+	presigner := s3.NewPresignClient(client)
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(bucket.Name),
+		Key:    aws.String(file.Name),
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+	var checksum string
+	if file.Checksum != "" {
+		sum, err := parseChecksum(file.Checksum)
+		if err != nil {
+			return nil, err
+		}
+		checksum = base64.StdEncoding.EncodeToString(sum)
+	}
+
+	switch mode {
+	case uploadModePresignedPut:
+		if checksum != "" {
+			// S3 rejects the PUT if the body does not match.
+			input.ChecksumSHA256 = aws.String(checksum)
+		}
+		req, err := presigner.PresignPutObject(ctx, input, s3.WithPresignExpires(uploadSessionTTL()))
+		if err != nil {
+			return nil, fmt.Errorf("presign put: %w", err)
+		}
+		upload := &PresignedUpload{Method: req.Method, URL: req.URL, Headers: map[string]string{}}
+		if contentType != "" {
+			upload.Headers["Content-Type"] = contentType
+		}
+		if checksum != "" {
+			upload.Headers["x-amz-checksum-sha256"] = checksum
+		}
+		if len(upload.Headers) == 0 {
+			upload.Headers = nil
+		}
+		return upload, nil
+	case uploadModePresignedPost:
+		var conditions []interface{}
+		if file.FileSizeLimit > 0 {
+			conditions = append(conditions, []interface{}{"content-length-range", 1, file.FileSizeLimit})
+		}
+		if contentType != "" {
+			conditions = append(conditions, map[string]string{"Content-Type": contentType})
+		}
+		req, err := presigner.PresignPostObject(ctx, input, func(o *s3.PresignPostOptions) {
+			o.Expires = uploadSessionTTL()
+			o.Conditions = conditions
+		})
+		if err != nil {
+			return nil, fmt.Errorf("presign post: %w", err)
+		}
+		if contentType != "" {
+			req.Values["Content-Type"] = contentType
+		}
+		return &PresignedUpload{Method: http.MethodPost, URL: req.URL, Fields: req.Values}, nil
+	default:
+		return nil, fmt.Errorf("unsupported upload mode %q", mode)
+	}
+}
+
+// headUploadedObject looks up the object holding the content of file. It returns
+// errObjectNotUploaded if the bucket has no such object.
+func headUploadedObject(ctx context.Context, bucket *models.Bucket, file *models.File) (*s3.HeadObjectOutput, error) {
+	client, err := createS3Client(bucket)
+	if err != nil {
+		return nil, err
+	}
+	head, err := client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:       aws.String(bucket.Name),
+		Key:          aws.String(file.StorageKey()),
+		ChecksumMode: types.ChecksumModeEnabled,
+	})
+	if err != nil {
+		var notFound *types.NotFound
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &notFound) || errors.As(err, &noSuchKey) {
+			return nil, errObjectNotUploaded
+		}
+		return nil, fmt.Errorf("head object: %w", err)
+	}
+	return head, nil
+}
+
+// deleteObject removes the object holding the content of file from the bucket.
+func deleteObject(ctx context.Context, bucket *models.Bucket, file *models.File) error {
+	return deleteObjectKey(ctx, bucket, file.StorageKey())
+}
+
+func deleteObjectKey(ctx context.Context, bucket *models.Bucket, key string) error {
+	client, err := createS3Client(bucket)
+	if err != nil {
+		return err
+	}
+	_, err = client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket.Name),
+		Key:    aws.String(key),
+	})
+	return err
+}
@@ -0,0 +1,172 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/gin-gonic/gin"
+)
+
+// maxHolderLength bounds the name of a reference holder.
+const maxHolderLength = 255
+
+type FileReferencesResponse struct {
+	// References is the reference count of the file. Besides one for every
+	// holder it counts the anonymous references taken with increment, and
+	// the one of the uploader until the first holder takes it over.
+	References int64                   `json:"references"`
+	Holders    []*models.FileReference `json:"holders"`
+}
+
+func validateHolder(holder string) error {
+	if holder == "" || len(holder) > maxHolderLength {
+		return fmt.Errorf("holder must be 1 to %d bytes long", maxHolderLength)
+	}
+	return nil
+}
+
+// sortReferences orders holders oldest first, by name when added at once.
+func sortReferences(holders []*models.FileReference) {
+	sort.Slice(holders, func(i, j int) bool {
+		if !holders[i].CreatedAt.Equal(holders[j].CreatedAt) {
+			return holders[i].CreatedAt.Before(holders[j].CreatedAt)
+		}
+		return holders[i].Holder < holders[j].Holder
+	})
+}
+
+// Add a reference holder (admin only)
+// @Summary Add a reference holder
+// @Description Record that holder, such as a message ID, refers to the file, counting it once in the reference count. Adding a holder that already refers to the file changes nothing, so the request can be retried safely. Admin access required.
+// @Tags files
+// @Produce json
+// @Param x-api-token header string true "API Token"
+// @Param id path string true "File ID"
+// @Param holder path string true "Reference holder"
+// @Success 201 "Holder added"
+// @Success 204 "Holder already refers to the file"
+// @Failure 400 {object} router.ErrorResponse
+// @Failure 401 {object} router.ErrorResponse "Unauthorized"
+// @Failure 403 {object} router.ErrorResponse "Forbidden - Admin only"
+// @Failure 404 {object} router.ErrorResponse
+// @Failure 409 {object} router.ErrorResponse "File is being deleted"
+// @Failure 500 {object} router.ErrorResponse
+// @Router /api/v1/file/{id}/refs/{holder} [put]
+// @Id AddFileReference
+func (r *router) AddFileReferenceHandler(c *gin.Context) {
+	holder := c.Param("holder")
+	if err := validateHolder(holder); err != nil {
+		writeError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx := c.Request.Context()
+	file, err := r.repo.Files.GetFileByID(ctx, c.Param("id"))
+	if err != nil || file == nil {
+		writeError(c, http.StatusNotFound, "File not found")
+		return
+	}
+	if removing(file) {
+		writeError(c, http.StatusConflict, fmt.Sprintf("File is %s", file.Status))
+		return
+	}
+	added, err := r.repo.Files.AddFileReference(ctx, file.ID, holder)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "Failed to add file reference: "+err.Error())
+		return
+	}
+	if added {
+		c.Status(http.StatusCreated)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Remove a reference holder (admin only)
+// @Summary Remove a reference holder
+// @Description Drop holder from the holders of the file and its count from the reference count. When the reference count reaches zero, the file is deleted from both S3 storage and database. Admin access required.
+// @Tags files
+// @Produce json
+// @Param x-api-token header string true "API Token"
+// @Param id path string true "File ID"
+// @Param holder path string true "Reference holder"
+// @Success 204 "Holder removed (and file deleted if the count reached zero)"
+// @Failure 400 {object} router.ErrorResponse
+// @Failure 401 {object} router.ErrorResponse "Unauthorized"
+// @Failure 403 {object} router.ErrorResponse "Forbidden - Admin only"
+// @Failure 404 {object} router.ErrorResponse "File not found, or holder does not refer to it"
+// @Failure 500 {object} router.ErrorResponse
+// @Router /api/v1/file/{id}/refs/{holder} [delete]
+// @Id RemoveFileReference
+func (r *router) RemoveFileReferenceHandler(c *gin.Context) {
+	holder := c.Param("holder")
+	if err := validateHolder(holder); err != nil {
+		writeError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx := c.Request.Context()
+	file, err := r.repo.Files.GetFileByID(ctx, c.Param("id"))
+	if err != nil || file == nil {
+		writeError(c, http.StatusNotFound, "File not found")
+		return
+	}
+	removed, err := r.repo.Files.RemoveFileReference(ctx, file.ID, holder)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "Failed to remove file reference: "+err.Error())
+		return
+	}
+	if !removed {
+		writeError(c, http.StatusNotFound, "Holder does not refer to the file")
+		return
+	}
+	refCount, err := r.repo.Files.GetFileReferenceCount(ctx, file.ID)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "Failed to get current file ref count: "+err.Error())
+		return
+	}
+	if refCount < 1 {
+		r.emit(ctx, models.EventRefcountZero, file)
+		r.DeleteFileHandler(c)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// List reference holders (admin only)
+// @Summary List reference holders
+// @Description List the holders referring to the file, oldest first, with its reference count. Admin access required.
+// @Tags files
+// @Produce json
+// @Param x-api-token header string true "API Token"
+// @Param id path string true "File ID"
+// @Success 200 {object} FileReferencesResponse
+// @Failure 401 {object} router.ErrorResponse "Unauthorized"
+// @Failure 403 {object} router.ErrorResponse "Forbidden - Admin only"
+// @Failure 404 {object} router.ErrorResponse
+// @Failure 500 {object} router.ErrorResponse
+// @Router /api/v1/file/{id}/refs [get]
+// @Id ListFileReferences
+func (r *router) ListFileReferencesHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	file, err := r.repo.Files.GetFileByID(ctx, c.Param("id"))
+	if err != nil || file == nil {
+		writeError(c, http.StatusNotFound, "File not found")
+		return
+	}
+	holders, err := r.repo.Files.ListFileReferences(ctx, file.ID)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "Failed to list file references: "+err.Error())
+		return
+	}
+	if holders == nil {
+		holders = []*models.FileReference{}
+	}
+	sortReferences(holders)
+	refCount, err := r.repo.Files.GetFileReferenceCount(ctx, file.ID)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "Failed to get current file ref count: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, FileReferencesResponse{References: refCount, Holders: holders})
+}
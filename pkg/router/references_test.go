@@ -0,0 +1,162 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/gin-gonic/gin"
+)
+
+func TestValidateHolder(t *testing.T) {
+	if err := validateHolder("message-42"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := validateHolder(""); err == nil {
+		t.Error("expected an error for an empty holder")
+	}
+	if err := validateHolder(strings.Repeat("h", maxHolderLength+1)); err == nil {
+		t.Error("expected an error for a holder over the limit")
+	}
+}
+
+func TestSortReferences(t *testing.T) {
+	now := time.Now()
+	holders := []*models.FileReference{
+		{Holder: "c", CreatedAt: now.Add(time.Second)},
+		{Holder: "b", CreatedAt: now},
+		{Holder: "a", CreatedAt: now},
+	}
+	sortReferences(holders)
+	for i, want := range []string{"a", "b", "c"} {
+		if holders[i].Holder != want {
+			t.Errorf("position %d: expected %s, got %s", i, want, holders[i].Holder)
+		}
+	}
+}
+
+// referencesServer serves the reference routes for a file "file" stored with
+// the reference of its uploader in a fake bucket.
+func referencesServer(t *testing.T) (*gin.Engine, *fakeRepository, *fakeS3) {
+	gin.SetMode(gin.TestMode)
+	storage := newFakeS3()
+	t.Cleanup(storage.Close)
+	repo := newFakeRepository()
+	repo.watchEvents()
+	repo.CreateBucket(context.Background(), storage.bucket("bucket", "bucket"))
+	repo.putFile(&models.File{Name: "file", BucketID: "bucket", Status: models.FileStatusActive}, 1)
+	storage.put("bucket", "file", []byte("data"))
+
+	r := &router{repo: repo.repository()}
+	engine := gin.New()
+	engine.GET("/file/:id/refs", r.ListFileReferencesHandler)
+	engine.PUT("/file/:id/refs/:holder", r.AddFileReferenceHandler)
+	engine.DELETE("/file/:id/refs/:holder", r.RemoveFileReferenceHandler)
+	engine.PATCH("/file/:id/increment", r.IncrementHandler)
+	engine.PATCH("/file/:id/decrement", r.DecrementHandler)
+	return engine, repo, storage
+}
+
+func serveReferences(engine *gin.Engine, method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+func TestFileReferenceHandlers(t *testing.T) {
+	engine, repo, storage := referencesServer(t)
+
+	steps := []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodPut, "/file/file/refs/message-1", http.StatusCreated},
+		{http.MethodPut, "/file/file/refs/message-2", http.StatusCreated},
+		{http.MethodPut, "/file/file/refs/message-1", http.StatusNoContent},
+		{http.MethodPut, "/file/missing/refs/message-1", http.StatusNotFound},
+		{http.MethodDelete, "/file/file/refs/message-3", http.StatusNotFound},
+		{http.MethodDelete, "/file/file/refs/message-2", http.StatusNoContent},
+		{http.MethodDelete, "/file/file/refs/message-2", http.StatusNotFound},
+	}
+	for _, step := range steps {
+		if w := serveReferences(engine, step.method, step.path); w.Code != step.want {
+			t.Errorf("%s %s: got %d, want %d", step.method, step.path, w.Code, step.want)
+		}
+	}
+
+	w := serveReferences(engine, http.MethodGet, "/file/file/refs")
+	var listed FileReferencesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &listed); err != nil {
+		t.Fatalf("list: %d %s", w.Code, w.Body)
+	}
+	var holders []string
+	for _, holder := range listed.Holders {
+		holders = append(holders, holder.Holder)
+	}
+	// message-1 took over the reference of the uploader.
+	if listed.References != 1 || !reflect.DeepEqual(holders, []string{"message-1"}) {
+		t.Errorf("listed %d references held by %v", listed.References, holders)
+	}
+	if repo.counters["file"] != 0 {
+		t.Errorf("expected the first holder to take over the anonymous reference, got %d", repo.counters["file"])
+	}
+	if !storage.has("bucket", "file") || repo.file("file") == nil {
+		t.Error("expected the referenced file to be kept")
+	}
+}
+
+func TestRemoveFileReferenceHandler_DeletesUnreferencedFile(t *testing.T) {
+	engine, repo, storage := referencesServer(t)
+
+	serveReferences(engine, http.MethodPut, "/file/file/refs/message-1")
+	if w := serveReferences(engine, http.MethodDelete, "/file/file/refs/message-1"); w.Code != http.StatusNoContent {
+		t.Fatalf("remove: got %d %s", w.Code, w.Body)
+	}
+	if storage.has("bucket", "file") || repo.file("file") != nil {
+		t.Error("expected the file to be deleted when its last reference is removed")
+	}
+	if events := repo.emitted(); !reflect.DeepEqual(events, []string{"file.deleted file", "refcount.zero file"}) {
+		t.Errorf("events: %v", events)
+	}
+}
+
+// TestDecrementHandler_KeepsHolders checks that anonymous releases cannot go
+// below zero and cancel out the holders of a file.
+func TestDecrementHandler_KeepsHolders(t *testing.T) {
+	engine, repo, storage := referencesServer(t)
+
+	steps := []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodPatch, "/file/file/increment", http.StatusNoContent},
+		{http.MethodPut, "/file/file/refs/message-1", http.StatusCreated},
+		{http.MethodPatch, "/file/file/decrement", http.StatusNoContent},
+		{http.MethodPatch, "/file/file/decrement", http.StatusConflict},
+		{http.MethodPatch, "/file/file/decrement", http.StatusConflict},
+	}
+	for _, step := range steps {
+		if w := serveReferences(engine, step.method, step.path); w.Code != step.want {
+			t.Errorf("%s %s: got %d, want %d", step.method, step.path, w.Code, step.want)
+		}
+	}
+	if refs, _ := repo.GetFileReferenceCount(context.Background(), "file"); refs != 1 || repo.counters["file"] != 0 {
+		t.Errorf("expected message-1 to be the only reference left, got %d with %d anonymous", refs, repo.counters["file"])
+	}
+	if !storage.has("bucket", "file") || repo.file("file") == nil {
+		t.Error("expected the file held by message-1 to be kept")
+	}
+
+	if w := serveReferences(engine, http.MethodDelete, "/file/file/refs/message-1"); w.Code != http.StatusNoContent {
+		t.Fatalf("remove: got %d %s", w.Code, w.Body)
+	}
+	if storage.has("bucket", "file") || repo.file("file") != nil {
+		t.Error("expected the file to be deleted with its last holder")
+	}
+}
@@ -0,0 +1,643 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/gin-gonic/gin"
+)
+
+// States of an upload session reported by UploadProgressResponse.
+const (
+	uploadStatePending   = "pending"   // no data received yet
+	uploadStateReceiving = "receiving" // a resumable upload is in progress
+	uploadStateUploaded  = "uploaded"  // the content is stored and awaits finalization
+	uploadStateFinalized = "finalized"
+	uploadStateExpired   = "expired" // the session lapsed before the upload completed
+)
+
+type UploadProgressResponse struct {
+	BlobID    string    `json:"blobId"`
+	FileID    string    `json:"fileId"`
+	State     string    `json:"state" enums:"pending,receiving,uploaded,finalized,expired"`
+	Offset    int64     `json:"offset"`           // bytes received so far
+	Length    int64     `json:"length,omitempty"` // declared total size, omitted while unknown
+	ExpiresAt time.Time `json:"expiresAt"`        // when the session lapses unless written to again
+}
+
+// uploadState reports where the upload session of blob for file stands.
+func uploadState(blob *models.FileBlob, file *models.File) string {
+	switch {
+	case blob.Finalized || file.Status == models.FileStatusActive:
+		return uploadStateFinalized
+	case file.Status.Received():
+		return uploadStateUploaded
+	case uploadExpired(blob):
+		return uploadStateExpired
+	case blob.UploadOffset > 0:
+		return uploadStateReceiving
+	default:
+		return uploadStatePending
+	}
+}
+
+// chunkRange is the position of a chunk within a resumable upload.
+type chunkRange struct {
+	Offset int64
+	End    int64 // inclusive, -1 if the chunk runs to the end of the body
+	Total  int64 // 0 if the total size has not been declared
+}
+
+var contentRangePattern = regexp.MustCompile(`^bytes (\d+)-(\d+)/(\d+|\*)$`)
+
+// parseChunkRange reads the chunk position from either an Upload-Offset header
+// (with an optional Upload-Length) or a Content-Range header. The boolean is
+// false when neither is present and the body is a complete, one-shot upload.
+func parseChunkRange(h http.Header) (chunkRange, bool, error) {
+	rng := chunkRange{End: -1}
+	if offset := h.Get("Upload-Offset"); offset != "" {
+		v, err := strconv.ParseInt(offset, 10, 64)
+		if err != nil || v < 0 {
+			return rng, false, fmt.Errorf("invalid Upload-Offset header")
+		}
+		rng.Offset = v
+		if length := h.Get("Upload-Length"); length != "" {
+			v, err := strconv.ParseInt(length, 10, 64)
+			if err != nil || v < 1 {
+				return rng, false, fmt.Errorf("invalid Upload-Length header")
+			}
+			rng.Total = v
+		}
+		return rng, true, nil
+	}
+	if contentRange := h.Get("Content-Range"); contentRange != "" {
+		m := contentRangePattern.FindStringSubmatch(contentRange)
+		if m == nil {
+			return rng, false, fmt.Errorf("invalid Content-Range header")
+		}
+		rng.Offset, _ = strconv.ParseInt(m[1], 10, 64)
+		rng.End, _ = strconv.ParseInt(m[2], 10, 64)
+		if m[3] != "*" {
+			rng.Total, _ = strconv.ParseInt(m[3], 10, 64)
+		}
+		if rng.End < rng.Offset || (rng.Total > 0 && rng.End >= rng.Total) {
+			return rng, false, fmt.Errorf("invalid Content-Range header")
+		}
+		return rng, true, nil
+	}
+	return rng, false, nil
+}
+
+// pendingPartKey is the object holding bytes that were received but do not
+// yet fill a multipart part, since S3 rejects non-final parts under 5 MiB.
+func pendingPartKey(key string) string {
+	return key + ".part"
+}
+
+func restoreHash(state []byte) (hash.Hash, error) {
+	h := sha256.New()
+	if len(state) == 0 {
+		return h, nil
+	}
+	if err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+		return nil, fmt.Errorf("restore checksum state: %w", err)
+	}
+	return h, nil
+}
+
+func marshalHash(h hash.Hash) ([]byte, error) {
+	return h.(encoding.BinaryMarshaler).MarshalBinary()
+}
+
+func setUploadHeaders(c *gin.Context, blob *models.FileBlob) {
+	c.Header("Upload-Offset", strconv.FormatInt(blob.UploadOffset, 10))
+	if blob.UploadLength > 0 {
+		c.Header("Upload-Length", strconv.FormatInt(blob.UploadLength, 10))
+	}
+	c.Header("Cache-Control", "no-store")
+}
+
+// uploadChunk appends the request body to the resumable upload tracked by
+// blob. Full parts go straight to the S3 multipart upload; the remainder is
+// kept in a pending part object and prepended to the next chunk. If the client
+// drops mid-chunk, whatever arrived is kept so it can resume from the reported
+// offset. Once the declared length is reached the upload is completed and the
+// file is marked uploaded.
+func (r *router) uploadChunk(c *gin.Context, blob *models.FileBlob, file *models.File, bucket *models.Bucket, rng chunkRange) {
+	// Progress must still be saved after the client hangs up, which cancels
+	// the request context.
+	ctx := context.WithoutCancel(c.Request.Context())
+
+	if file.Status != models.FileStatusPending && file.Status != models.FileStatusUploading {
+		writeError(c, http.StatusConflict, fmt.Sprintf("File is %s and cannot receive content", file.Status))
+		return
+	}
+	expected, ok := expectedUploadDigest(c, file)
+	if !ok {
+		return
+	}
+	if expected.MD5 != nil {
+		writeError(c, http.StatusBadRequest, "Content-MD5 is only supported for one-shot uploads; use Content-Digest or X-Checksum-SHA256")
+		return
+	}
+	if rng.Offset != blob.UploadOffset {
+		setUploadHeaders(c, blob)
+		writeError(c, http.StatusConflict, fmt.Sprintf("Upload offset mismatch: expected %d, got %d", blob.UploadOffset, rng.Offset))
+		return
+	}
+	if rng.Total > 0 {
+		if blob.UploadLength > 0 && blob.UploadLength != rng.Total {
+			writeError(c, http.StatusBadRequest, "Upload length cannot change once declared")
+			return
+		}
+		if file.FileSizeLimit > 0 && uint64(rng.Total) > file.FileSizeLimit {
+			writeRejection(c, sizeLimitRejection(file.FileSizeLimit))
+			return
+		}
+		blob.UploadLength = rng.Total
+	}
+	if blob.UploadLength > 0 && rng.End >= blob.UploadLength {
+		writeError(c, http.StatusBadRequest, "Chunk extends past the declared upload length")
+		return
+	}
+	if file.FileSizeLimit > 0 && uint64(blob.UploadOffset) >= file.FileSizeLimit {
+		writeRejection(c, sizeLimitRejection(file.FileSizeLimit))
+		return
+	}
+	switch c.ContentType() {
+	case "application/octet-stream", "application/offset+octet-stream":
+	default:
+		writeError(c, http.StatusBadRequest, "Unsupported Content-Type for chunk upload. Use application/octet-stream")
+		return
+	}
+
+	h, err := restoreHash(blob.HashState)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var source io.Reader = c.Request.Body
+	if rng.End >= 0 {
+		source = io.LimitReader(source, rng.End-rng.Offset+1)
+	}
+	if blob.UploadLength > 0 {
+		source = io.LimitReader(source, blob.UploadLength-blob.UploadOffset)
+	}
+	var limit uint64
+	if file.FileSizeLimit > 0 {
+		limit = file.FileSizeLimit - uint64(blob.UploadOffset)
+	}
+	stream := resumeUploadStream(source, h, limit)
+	var body io.Reader = stream
+	if blob.UploadOffset == 0 {
+		contentType, sniffed, err := sniffContentType(stream)
+		if err != nil {
+			writeUploadStreamError(c, file, err)
+			return
+		}
+		if rejection := checkContentType(file, contentType); rejection != nil {
+			writeRejection(c, rejection)
+			return
+		}
+		blob.ContentType = contentType
+		body = sniffed
+	}
+
+	s3Client, err := createS3Client(bucket)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "Failed to create S3 client: "+err.Error())
+		return
+	}
+	var aead cipher.AEAD
+	if blob.UploadOffset == 0 && blob.UploadID == "" {
+		// A fresh start marks the file uploading and gets a fresh data key,
+		// saved before any part is.
+		save := false
+		if file.Status == models.FileStatusPending {
+			err = file.Transition(models.FileStatusUploading)
+			save = true
+		}
+		if err == nil && (bucket.Encrypt || file.Encrypted) {
+			aead, err = uploadCipher(file, bucket)
+			save = true
+		}
+		if err == nil && save {
+			err = r.repo.Files.UpdateFile(ctx, file)
+		}
+	} else if file.Encrypted {
+		aead, err = fileCipher(file)
+	}
+	if errors.Is(err, models.ErrIllegalTransition) {
+		writeError(c, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "Failed to start upload: "+err.Error())
+		return
+	}
+	// sealPart encrypts a part starting at plaintext offset start; parts
+	// always start on a segment boundary.
+	sealPart := func(plain []byte, start int64) ([]byte, error) {
+		if aead == nil {
+			return plain, nil
+		}
+		return sealSegments(aead, plain, start/segmentSize)
+	}
+
+	key := file.Name
+	saved := false
+	if blob.UploadID == "" {
+		upload, err := startMultipartUpload(ctx, s3Client, bucket.Name, key, blob.ContentType)
+		if err != nil {
+			writeError(c, http.StatusInternalServerError, "Failed to start upload: "+err.Error())
+			return
+		}
+		blob.UploadID = upload.uploadID
+		// Nothing points at a fresh multipart upload until the blob is saved.
+		defer func() {
+			if !saved {
+				upload.Abort()
+			}
+		}()
+	}
+	upload := resumeMultipartUpload(s3Client, bucket.Name, key, blob)
+
+	pending := blob.UploadOffset - blob.PartsSize()
+	if pending > 0 {
+		obj, err := s3Client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(bucket.Name),
+			Key:    aws.String(pendingPartKey(key)),
+		})
+		if err != nil {
+			writeError(c, http.StatusInternalServerError, "Failed to read pending upload data: "+err.Error())
+			return
+		}
+		defer obj.Body.Close()
+		var pendingData io.Reader = obj.Body
+		if aead != nil {
+			sealed, err := io.ReadAll(obj.Body)
+			if err != nil {
+				writeError(c, http.StatusInternalServerError, "Failed to read pending upload data: "+err.Error())
+				return
+			}
+			plain, err := openRandom(aead, sealed, []byte(pendingPartKey(key)))
+			if err != nil {
+				writeError(c, http.StatusInternalServerError, "Failed to decrypt pending upload data: "+err.Error())
+				return
+			}
+			pendingData = bytes.NewReader(plain)
+		}
+		body = io.MultiReader(pendingData, body)
+	}
+
+	parts := blob.Parts
+	partSize := multipartPartSize(blob.UploadLength)
+	if aead != nil {
+		partSize = alignToSegment(partSize)
+	}
+	buf := make([]byte, partSize)
+	partStart := blob.PartsSize()
+	var n int
+	var readErr error
+	for {
+		n, readErr = io.ReadFull(body, buf)
+		if readErr != nil {
+			break
+		}
+		number := int32(len(parts) + 1)
+		if number > maxParts {
+			writeError(c, http.StatusBadRequest, fmt.Sprintf("Upload exceeds %d parts", maxParts))
+			return
+		}
+		data, err := sealPart(buf, partStart)
+		if err != nil {
+			writeError(c, http.StatusInternalServerError, "Failed to encrypt part: "+err.Error())
+			return
+		}
+		etag, err := upload.UploadPart(ctx, number, data)
+		if err != nil {
+			writeError(c, http.StatusInternalServerError, "Failed to upload part: "+err.Error())
+			return
+		}
+		parts = append(parts, models.BlobPart{Number: number, ETag: etag, Size: int64(len(buf))})
+		partStart += int64(len(buf))
+	}
+
+	streamErr := stream.Err()
+	if errors.Is(streamErr, errFileSizeLimitExceeded) {
+		saved = true
+		r.resetResumableUpload(ctx, s3Client, bucket, key, blob)
+		writeUploadStreamError(c, file, streamErr)
+		return
+	}
+	if streamErr == nil && !errors.Is(readErr, io.EOF) && !errors.Is(readErr, io.ErrUnexpectedEOF) {
+		// The read failed on our side (the pending part object), not the client's.
+		writeError(c, http.StatusInternalServerError, "Failed to read pending upload data: "+readErr.Error())
+		return
+	}
+
+	blob.Parts = parts
+	blob.UploadOffset = blob.PartsSize() + int64(n)
+	if blob.HashState, err = marshalHash(h); err != nil {
+		writeError(c, http.StatusInternalServerError, "Failed to save checksum state: "+err.Error())
+		return
+	}
+
+	switch {
+	case blob.UploadLength > 0 && blob.UploadOffset == blob.UploadLength:
+		if n > 0 {
+			number := int32(len(blob.Parts) + 1)
+			data, err := sealPart(buf[:n], partStart)
+			if err != nil {
+				writeError(c, http.StatusInternalServerError, "Failed to encrypt part: "+err.Error())
+				return
+			}
+			etag, err := upload.UploadPart(ctx, number, data)
+			if err != nil {
+				writeError(c, http.StatusInternalServerError, "Failed to upload part: "+err.Error())
+				return
+			}
+			blob.Parts = append(blob.Parts, models.BlobPart{Number: number, ETag: etag, Size: int64(n)})
+		}
+		if err := upload.Complete(ctx); err != nil {
+			writeError(c, http.StatusInternalServerError, "Failed to complete upload: "+err.Error())
+			return
+		}
+		if err := expected.verify(stream.Sum(), nil); err != nil {
+			if err := deleteObject(ctx, bucket, file); err != nil {
+				log.Printf("Failed to delete corrupted object %s/%s: %v", bucket.Name, key, err)
+			}
+			// The multipart upload is gone now; start over from scratch.
+			blob.UploadID = ""
+			saved = true
+			r.resetResumableUpload(ctx, s3Client, bucket, key, blob)
+			writeError(c, http.StatusUnprocessableEntity, "Checksum mismatch: "+err.Error())
+			return
+		}
+		if pending > 0 || n > 0 {
+			deletePendingPart(ctx, s3Client, bucket.Name, key)
+		}
+		if err := r.markFileUploaded(ctx, c, file, bucket, blob.ContentType, blob.UploadOffset, stream.Checksum()); err != nil {
+			if errors.Is(err, models.ErrIllegalTransition) {
+				writeError(c, http.StatusConflict, err.Error())
+				return
+			}
+			writeError(c, http.StatusInternalServerError, "Failed to update file record: "+err.Error())
+			return
+		}
+	case n > 0:
+		data := buf[:n]
+		if aead != nil {
+			if data, err = sealRandom(aead, data, []byte(pendingPartKey(key))); err != nil {
+				writeError(c, http.StatusInternalServerError, "Failed to encrypt pending upload data: "+err.Error())
+				return
+			}
+		}
+		err := putObjectStream(ctx, s3Client, bucket.Name, pendingPartKey(key), "application/octet-stream", bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			writeError(c, http.StatusInternalServerError, "Failed to store pending upload data: "+err.Error())
+			return
+		}
+	case pending > 0:
+		deletePendingPart(ctx, s3Client, bucket.Name, key)
+	}
+
+	stored, err := r.repo.FileBlobs.UpdateFileBlobAtOffset(ctx, blob, rng.Offset)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "Failed to save upload progress: "+err.Error())
+		return
+	}
+	if !stored {
+		writeError(c, http.StatusConflict, "Another chunk was stored at this offset meanwhile; resume from the current offset")
+		return
+	}
+	saved = true
+	setUploadHeaders(c, blob)
+	if streamErr != nil {
+		writeError(c, http.StatusBadRequest, "Failed to read request body: "+streamErr.Error())
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// resetResumableUpload discards everything stored for blob so the upload can
+// start over from offset zero.
+func (r *router) resetResumableUpload(ctx context.Context, client *s3.Client, bucket *models.Bucket, key string, blob *models.FileBlob) {
+	if blob.UploadID != "" {
+		resumeMultipartUpload(client, bucket.Name, key, blob).Abort()
+	}
+	deletePendingPart(ctx, client, bucket.Name, key)
+	blob.UploadID = ""
+	blob.UploadOffset = 0
+	blob.UploadLength = 0
+	blob.ContentType = ""
+	blob.Parts = nil
+	blob.HashState = nil
+	if err := r.repo.FileBlobs.UpdateFileBlob(ctx, blob); err != nil {
+		log.Printf("Failed to reset upload state of blob %s: %v", blob.ID, err)
+	}
+}
+
+// loadUploadSession loads the blob named blobID together with the file and
+// bucket it uploads into. It writes the error response itself and returns
+// false if any of them is missing.
+func (r *router) loadUploadSession(c *gin.Context, blobID string) (*models.FileBlob, *models.File, *models.Bucket, bool) {
+	ctx := c.Request.Context()
+	blob, err := r.repo.FileBlobs.GetFileBlobByID(ctx, blobID)
+	if err != nil {
+		writeError(c, http.StatusNotFound, "File blob not found: "+err.Error())
+		return nil, nil, nil, false
+	}
+	if uploadExpired(blob) {
+		writeError(c, http.StatusGone, "Upload session expired")
+		return nil, nil, nil, false
+	}
+	file, err := r.repo.Files.GetFileByID(ctx, blob.FileID)
+	if err != nil {
+		writeError(c, http.StatusNotFound, "File not found: "+err.Error())
+		return nil, nil, nil, false
+	}
+	bucket, err := r.repo.Buckets.GetBucketByID(ctx, file.BucketID)
+	if err != nil || bucket == nil {
+		writeError(c, http.StatusNotFound, "Bucket not found")
+		return nil, nil, nil, false
+	}
+	return blob, file, bucket, true
+}
+
+// cancelUpload discards an upload that has not completed along with the file
+// record it was created for.
+func (r *router) cancelUpload(ctx context.Context, blob *models.FileBlob, file *models.File, bucket *models.Bucket) error {
+	ctx = context.WithoutCancel(ctx)
+	if err := r.discardUpload(ctx, blob, file, bucket); err != nil {
+		return err
+	}
+	return r.retireFile(ctx, file, bucket)
+}
+
+// discardUpload removes what an upload that has not completed left behind:
+// the multipart upload, pending part and any object uploaded straight to S3,
+// and the blob.
+func (r *router) discardUpload(ctx context.Context, blob *models.FileBlob, file *models.File, bucket *models.Bucket) error {
+	ctx = context.WithoutCancel(ctx)
+	s3Client, err := createS3Client(bucket)
+	if err != nil {
+		return fmt.Errorf("create S3 client: %w", err)
+	}
+	if blob.UploadID != "" {
+		resumeMultipartUpload(s3Client, bucket.Name, file.Name, blob).Abort()
+	}
+	if blob.UploadOffset > blob.PartsSize() {
+		deletePendingPart(ctx, s3Client, bucket.Name, file.Name)
+	}
+	if blob.UploadOffset == 0 {
+		// A presigned upload may have stored the object without going
+		// through the blob.
+		if err := deleteObjectKey(ctx, bucket, file.Name); err != nil {
+			log.Printf("Failed to delete object %s/%s: %v", bucket.Name, file.Name, err)
+		}
+	}
+	if err := r.repo.FileBlobs.DeleteFileBlobByID(ctx, blob.ID); err != nil {
+		return fmt.Errorf("delete file blob: %w", err)
+	}
+	return nil
+}
+
+func deletePendingPart(ctx context.Context, client *s3.Client, bucket, key string) {
+	_, err := client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(pendingPartKey(key)),
+	})
+	if err != nil {
+		log.Printf("Failed to delete pending part of %s/%s: %v", bucket, key, err)
+	}
+}
+
+// Get upload offset (client)
+// @Summary Get upload offset
+// @Description Report how many bytes of a resumable upload have been received in the Upload-Offset header, and the declared total in Upload-Length if known. Clients resume by sending the next chunk from that offset.
+// @Tags upload
+// @Param x-api-token header string false "API Token, unless a signed upload URL is used"
+// @Param expires query int false "Expiry of a signed upload URL (Unix seconds)"
+// @Param signature query string false "Signature of a signed upload URL"
+// @Param blob path string true "Blob ID"
+// @Success 200 "Upload-Offset and Upload-Length headers"
+// @Failure 401 {object} router.ErrorResponse "Unauthorized"
+// @Failure 404 {object} router.ErrorResponse
+// @Failure 410 {object} router.ErrorResponse "Upload session expired"
+// @Router /api/v1/upload/{blob} [head]
+// @Id GetUploadOffset
+func (r *router) GetUploadOffsetHandler(c *gin.Context) {
+	blob, err := r.repo.FileBlobs.GetFileBlobByID(c.Request.Context(), c.Param("blob"))
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if uploadExpired(blob) {
+		c.Status(http.StatusGone)
+		return
+	}
+	setUploadHeaders(c, blob)
+	c.Status(http.StatusOK)
+}
+
+// Get upload status (client)
+// @Summary Get upload status
+// @Description Report the state of an upload session (pending, receiving, uploaded, finalized or expired), how many bytes have been received, the declared total size, if known, and when the session expires.
+// @Tags upload
+// @Produce json
+// @Param x-api-token header string false "API Token, unless a signed upload URL is used"
+// @Param expires query int false "Expiry of a signed upload URL (Unix seconds)"
+// @Param signature query string false "Signature of a signed upload URL"
+// @Param blob path string true "Blob ID"
+// @Success 200 {object} UploadProgressResponse
+// @Failure 401 {object} router.ErrorResponse "Unauthorized"
+// @Failure 404 {object} router.ErrorResponse
+// @Router /api/v1/upload/{blob} [get]
+// @Id GetUploadProgress
+func (r *router) GetUploadProgressHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	blob, err := r.repo.FileBlobs.GetFileBlobByID(ctx, c.Param("blob"))
+	if err != nil {
+		writeError(c, http.StatusNotFound, "File blob not found: "+err.Error())
+		return
+	}
+	file, err := r.repo.Files.GetFileByID(ctx, blob.FileID)
+	if err != nil {
+		writeError(c, http.StatusNotFound, "File not found: "+err.Error())
+		return
+	}
+	response := UploadProgressResponse{
+		BlobID:    blob.ID,
+		FileID:    blob.FileID,
+		State:     uploadState(blob, file),
+		Offset:    blob.UploadOffset,
+		Length:    blob.UploadLength,
+		ExpiresAt: uploadExpiresAt(blob).UTC(),
+	}
+	if file.Status.Received() {
+		// Presigned and deduplicated uploads store the content without
+		// going through the blob.
+		response.Offset = file.FileSize
+		response.Length = file.FileSize
+	}
+	setUploadHeaders(c, blob)
+	c.JSON(http.StatusOK, response)
+}
+
+// Cancel upload (client)
+// @Summary Cancel upload
+// @Description Abort an upload session that has not completed: any multipart upload, partial or directly uploaded object is removed from S3, and the blob and the pending file are deleted. A signed upload URL does not grant cancelling; a service token is required.
+// @Tags upload
+// @Param x-api-token header string true "API Token"
+// @Param blob path string true "Blob ID"
+// @Success 204 "Upload cancelled"
+// @Failure 401 {object} router.ErrorResponse "Unauthorized"
+// @Failure 403 {object} router.ErrorResponse "Signed upload URLs cannot cancel uploads"
+// @Failure 404 {object} router.ErrorResponse
+// @Failure 409 {object} router.ErrorResponse "Upload already completed"
+// @Failure 500 {object} router.ErrorResponse
+// @Router /api/v1/upload/{blob} [delete]
+// @Id CancelUpload
+func (r *router) CancelUploadHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	blob, err := r.repo.FileBlobs.GetFileBlobByID(ctx, c.Param("blob"))
+	if err != nil {
+		writeError(c, http.StatusNotFound, "File blob not found: "+err.Error())
+		return
+	}
+	file, err := r.repo.Files.GetFileByID(ctx, blob.FileID)
+	if err != nil {
+		writeError(c, http.StatusNotFound, "File not found: "+err.Error())
+		return
+	}
+	if file.Status.Received() || blob.Finalized {
+		writeError(c, http.StatusConflict, "Upload has already completed; delete the file instead")
+		return
+	}
+	bucket, err := r.repo.Buckets.GetBucketByID(ctx, file.BucketID)
+	if err != nil || bucket == nil {
+		writeError(c, http.StatusNotFound, "Bucket not found")
+		return
+	}
+	if err := r.cancelUpload(ctx, blob, file, bucket); err != nil {
+		writeError(c, http.StatusInternalServerError, "Failed to cancel upload: "+err.Error())
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,132 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+func TestParseChunkRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		chunked bool
+		want    chunkRange
+		wantErr bool
+	}{
+		{name: "one-shot", headers: map[string]string{}, chunked: false, want: chunkRange{End: -1}},
+		{name: "upload offset", headers: map[string]string{"Upload-Offset": "1024"}, chunked: true, want: chunkRange{Offset: 1024, End: -1}},
+		{name: "upload offset and length", headers: map[string]string{"Upload-Offset": "0", "Upload-Length": "4096"}, chunked: true, want: chunkRange{End: -1, Total: 4096}},
+		{name: "content range", headers: map[string]string{"Content-Range": "bytes 1024-2047/4096"}, chunked: true, want: chunkRange{Offset: 1024, End: 2047, Total: 4096}},
+		{name: "content range unknown total", headers: map[string]string{"Content-Range": "bytes 0-1023/*"}, chunked: true, want: chunkRange{End: 1023}},
+		{name: "negative offset", headers: map[string]string{"Upload-Offset": "-1"}, wantErr: true},
+		{name: "malformed content range", headers: map[string]string{"Content-Range": "bytes=0-1023"}, wantErr: true},
+		{name: "content range past total", headers: map[string]string{"Content-Range": "bytes 0-4096/4096"}, wantErr: true},
+		{name: "inverted content range", headers: map[string]string{"Content-Range": "bytes 2048-1024/4096"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			for k, v := range tt.headers {
+				h.Set(k, v)
+			}
+			got, chunked, err := parseChunkRange(h)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if chunked != tt.chunked {
+				t.Errorf("expected chunked=%v, got %v", tt.chunked, chunked)
+			}
+			if got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestUploadState(t *testing.T) {
+	viper.Set("upload-session-ttl", 10*time.Minute)
+	defer viper.Set("upload-session-ttl", nil)
+
+	now := time.Now()
+	tests := []struct {
+		name string
+		blob models.FileBlob
+		file models.File
+		want string
+	}{
+		{name: "pending", blob: models.FileBlob{ApplicationModel: models.ApplicationModel{UpdatedAt: now}}, want: uploadStatePending},
+		{name: "receiving", blob: models.FileBlob{ApplicationModel: models.ApplicationModel{UpdatedAt: now}, UploadOffset: 1024}, want: uploadStateReceiving},
+		{name: "uploaded", blob: models.FileBlob{ApplicationModel: models.ApplicationModel{UpdatedAt: now}}, file: models.File{Status: models.FileStatusUploaded}, want: uploadStateUploaded},
+		{name: "finalized", blob: models.FileBlob{ApplicationModel: models.ApplicationModel{UpdatedAt: now.Add(-time.Hour)}, Finalized: true}, file: models.File{Status: models.FileStatusActive}, want: uploadStateFinalized},
+		{name: "expired", blob: models.FileBlob{ApplicationModel: models.ApplicationModel{UpdatedAt: now.Add(-time.Hour)}, UploadOffset: 1024}, want: uploadStateExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := uploadState(&tt.blob, &tt.file); got != tt.want {
+				t.Errorf("uploadState() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestUploadChunk_OffsetRace checks that of two chunks sent for the same
+// offset only the first to save its progress is kept.
+func TestUploadChunk_OffsetRace(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, tt := range []struct {
+		name        string
+		storedAt    int64 // offset another chunk moved the blob to meanwhile
+		want        int
+		wantOffset  int64
+		wantAborted int
+	}{
+		{name: "stored", want: http.StatusNoContent, wantOffset: 5},
+		{name: "lost", storedAt: 3, want: http.StatusConflict, wantOffset: 3, wantAborted: 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := newFakeS3()
+			defer storage.Close()
+			repo := newFakeRepository()
+			bucket := storage.bucket("bucket", "bucket")
+			repo.CreateBucket(context.Background(), bucket)
+			repo.putFile(&models.File{Name: "file", BucketID: "bucket", Status: models.FileStatusPending}, 1)
+			blob, _ := repo.CreateFileBlob(context.Background(), &models.FileBlob{ApplicationModel: models.ApplicationModel{ID: "blob"}, FileID: "file"})
+			loaded := *blob
+			if tt.storedAt > 0 {
+				blob.UploadOffset = tt.storedAt
+				repo.UpdateFileBlob(context.Background(), blob)
+			}
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPatch, "/upload/blob", strings.NewReader("hello"))
+			c.Request.Header.Set("Content-Type", "application/offset+octet-stream")
+			r := &router{repo: repo.repository()}
+			r.uploadChunk(c, &loaded, repo.file("file"), bucket, chunkRange{End: -1})
+
+			if code := c.Writer.Status(); code != tt.want {
+				t.Fatalf("got %d %s, want %d", code, w.Body, tt.want)
+			}
+			if stored, _ := repo.GetFileBlobByID(context.Background(), "blob"); stored.UploadOffset != tt.wantOffset {
+				t.Errorf("stored offset %d, want %d", stored.UploadOffset, tt.wantOffset)
+			}
+			if aborted := len(storage.callsOf("AbortMultipartUpload")); aborted != tt.wantAborted {
+				t.Errorf("aborted %d multipart uploads, want %d", aborted, tt.wantAborted)
+			}
+		})
+	}
+}
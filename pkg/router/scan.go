@@ -0,0 +1,268 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/argon-chat/KineticaFS/pkg/scanner"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// scanTimeout returns how long a single scan may take.
+func scanTimeout() time.Duration {
+	return viper.GetDuration("scanner-timeout")
+}
+
+// quarantinePrefix returns the key prefix rejected objects are moved under.
+func quarantinePrefix() string {
+	return viper.GetString("quarantine-prefix")
+}
+
+// scanQueue runs content scans in the background, at most scan-concurrency
+// at a time. Its zero value is ready to use.
+type scanQueue struct {
+	mu      sync.Mutex
+	running sync.WaitGroup
+	slots   chan struct{}
+	closing chan struct{}
+	closed  bool
+}
+
+func (q *scanQueue) init() {
+	if q.slots == nil {
+		q.slots = make(chan struct{}, max(viper.GetInt("scan-concurrency"), 1))
+		q.closing = make(chan struct{})
+	}
+}
+
+// start runs scan once a slot is free. Scans still waiting for a slot when
+// the queue is closed are dropped; finalizing their files starts a new scan
+// once theirs is stale.
+func (q *scanQueue) start(scan func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.init()
+	if q.closed {
+		return
+	}
+	q.running.Add(1)
+	go func() {
+		defer q.running.Done()
+		select {
+		case q.slots <- struct{}{}:
+		case <-q.closing:
+			return
+		}
+		defer func() { <-q.slots }()
+		scan()
+	}()
+}
+
+// close stops starting scans and waits for the running ones to finish, or
+// for ctx to end.
+func (q *scanQueue) close(ctx context.Context) {
+	q.mu.Lock()
+	q.init()
+	if !q.closed {
+		q.closed = true
+		close(q.closing)
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Printf("Content scans still running at shutdown: %v", ctx.Err())
+	}
+}
+
+// scanBlocksUse reports whether the scan state of file keeps its content from
+// being served or shared with other files.
+func scanBlocksUse(file *models.File) bool {
+	switch file.ScanStatus {
+	case models.ScanStatusScanning, models.ScanStatusQuarantined, models.ScanStatusFailed:
+		return true
+	}
+	return false
+}
+
+// scanStale reports whether a scan in progress has long outlived the scanner
+// timeout, which happens when the instance running it stopped.
+func scanStale(file *models.File) bool {
+	return file.ScanStatus == models.ScanStatusScanning && time.Since(file.UpdatedAt) > 2*scanTimeout()
+}
+
+// startScan marks file as being scanned and scans its content in the
+// background.
+func (r *router) startScan(ctx context.Context, file *models.File) error {
+	if err := file.Transition(models.FileStatusScanning); err != nil {
+		return err
+	}
+	file.ScanStatus = models.ScanStatusScanning
+	file.ScanDetail = ""
+	if err := r.repo.Files.UpdateFile(ctx, file); err != nil {
+		return err
+	}
+	r.scans.start(func() { r.scanFile(file.ID) })
+	return nil
+}
+
+// scanFile runs the scanner over the content of a file and records its
+// verdict. Rejected content is moved under the quarantine prefix.
+func (r *router) scanFile(id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), scanTimeout())
+	defer cancel()
+	verdict, scanErr := r.scanContent(ctx, id)
+
+	// The record may have changed while the scan ran.
+	ctx = context.WithoutCancel(ctx)
+	file, err := r.repo.Files.GetFileByID(ctx, id)
+	if err != nil {
+		log.Printf("Failed to record scan verdict of file %s: %v", id, err)
+		return
+	}
+	if file.Status != models.FileStatusScanning {
+		return
+	}
+	status := models.FileStatusUploaded
+	switch {
+	case scanErr != nil:
+		log.Printf("Failed to scan file %s: %v", id, scanErr)
+		file.ScanStatus = models.ScanStatusFailed
+		file.ScanDetail = scanErr.Error()
+	case verdict.Clean:
+		file.ScanStatus = models.ScanStatusClean
+	default:
+		log.Printf("Quarantining file %s: %s", id, verdict.Threat)
+		status = models.FileStatusFailed
+		file.ScanStatus = models.ScanStatusQuarantined
+		file.ScanDetail = verdict.Threat
+		if err := r.quarantineObject(ctx, file); err != nil {
+			log.Printf("Failed to move object of file %s to quarantine: %v", id, err)
+		}
+	}
+	if err := file.Transition(status); err != nil {
+		log.Printf("Failed to record scan verdict of file %s: %v", id, err)
+		return
+	}
+	if err := r.repo.Files.UpdateFile(ctx, file); err != nil {
+		log.Printf("Failed to record scan verdict of file %s: %v", id, err)
+	}
+}
+
+// scanContent streams the content of a file through the scanner, decrypted
+// if the file is encrypted.
+func (r *router) scanContent(ctx context.Context, id string) (scanner.Verdict, error) {
+	file, err := r.repo.Files.GetFileByID(ctx, id)
+	if err != nil {
+		return scanner.Verdict{}, fmt.Errorf("load file: %w", err)
+	}
+	bucket, err := r.repo.Buckets.GetBucketByID(ctx, file.BucketID)
+	if err != nil || bucket == nil {
+		return scanner.Verdict{}, fmt.Errorf("bucket %s not found", file.BucketID)
+	}
+	head, err := headUploadedObject(ctx, bucket, file)
+	if err != nil {
+		return scanner.Verdict{}, err
+	}
+	client, err := createS3Client(bucket)
+	if err != nil {
+		return scanner.Verdict{}, err
+	}
+	object := &objectReader{
+		ctx:    ctx,
+		client: client,
+		bucket: bucket.Name,
+		key:    file.StorageKey(),
+		size:   aws.ToInt64(head.ContentLength),
+	}
+	defer object.Close()
+	var content io.Reader = object
+	if file.Encrypted {
+		aead, err := fileCipher(file)
+		if err != nil {
+			return scanner.Verdict{}, err
+		}
+		content = newDecryptingReader(object, aead, file.FileSize)
+	}
+	return r.scanner.Scan(ctx, content)
+}
+
+// quarantineObject moves the object of file under the quarantine prefix and
+// points the file at it. Content that has not been scanned clean is never
+// shared, so no other file refers to the object.
+func (r *router) quarantineObject(ctx context.Context, file *models.File) error {
+	bucket, err := r.repo.Buckets.GetBucketByID(ctx, file.BucketID)
+	if err != nil || bucket == nil {
+		return fmt.Errorf("bucket %s not found", file.BucketID)
+	}
+	client, err := createS3Client(bucket)
+	if err != nil {
+		return err
+	}
+	key := file.StorageKey()
+	target := quarantinePrefix() + key
+	_, err = client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(bucket.Name),
+		Key:        aws.String(target),
+		CopySource: aws.String(bucket.Name + "/" + url.PathEscape(key)),
+	})
+	if err != nil {
+		return fmt.Errorf("copy object: %w", err)
+	}
+	file.ObjectKey = target
+	file.Path = fmt.Sprintf("%s/%s/%s", bucket.Endpoint, bucket.Name, target)
+	if err := deleteObjectKey(ctx, bucket, key); err != nil {
+		return fmt.Errorf("delete object: %w", err)
+	}
+	return nil
+}
+
+// requireCleanScan lets a file be finalized only once the scanner has passed
+// its content. A file that was not scanned yet, or whose scan failed or
+// stalled, gets a new scan. It writes the error response itself and returns
+// false if the file cannot be finalized yet.
+func (r *router) requireCleanScan(c *gin.Context, file *models.File) bool {
+	switch {
+	case file.ScanStatus == models.ScanStatusClean:
+		return true
+	case file.ScanStatus == models.ScanStatusQuarantined:
+		writeError(c, http.StatusUnprocessableEntity, "File content was rejected by the scanner: "+file.ScanDetail)
+		return false
+	case file.ScanStatus == models.ScanStatusScanning && !scanStale(file):
+		writeError(c, http.StatusConflict, "File content is being scanned; finalize again once the scan completes")
+		return false
+	case r.scanner == nil:
+		// Scanning has been turned off since the file was last scanned.
+		if file.Status == models.FileStatusScanning {
+			if err := file.Transition(models.FileStatusUploaded); err != nil {
+				writeError(c, http.StatusConflict, err.Error())
+				return false
+			}
+		}
+		file.ScanStatus = models.ScanStatusNone
+		file.ScanDetail = ""
+		return true
+	}
+	if err := r.startScan(c.Request.Context(), file); err != nil {
+		writeError(c, http.StatusInternalServerError, "Failed to start content scan: "+err.Error())
+		return false
+	}
+	writeError(c, http.StatusConflict, "File content is being scanned; finalize again once the scan completes")
+	return false
+}
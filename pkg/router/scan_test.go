@@ -0,0 +1,64 @@
+package router
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestScanQueue(t *testing.T) {
+	viper.Set("scan-concurrency", 2)
+	defer viper.Set("scan-concurrency", nil)
+
+	var q scanQueue
+	release := make(chan struct{})
+	var started, finished int32
+	for i := 0; i < 5; i++ {
+		q.start(func() {
+			atomic.AddInt32(&started, 1)
+			<-release
+			atomic.AddInt32(&finished, 1)
+		})
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&started); n != 2 {
+		t.Fatalf("expected 2 scans to run at once, %d started", n)
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		q.close(context.Background())
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("expected close to wait for the running scans")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-closed
+	if n := atomic.LoadInt32(&finished); n != 2 {
+		t.Errorf("expected the 2 running scans to finish and the queued ones to be dropped, %d finished", n)
+	}
+
+	q.start(func() { t.Error("expected no scan to start after close") })
+	q.close(context.Background())
+}
+
+func TestScanQueue_CloseTimeout(t *testing.T) {
+	var q scanQueue
+	release := make(chan struct{})
+	defer close(release)
+	q.start(func() { <-release })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	q.close(ctx)
+	if time.Since(start) > time.Second {
+		t.Error("expected close to give up when its context ends")
+	}
+}
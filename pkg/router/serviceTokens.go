@@ -20,9 +20,9 @@ func AddServiceTokenRoutes(router *router, v1 *gin.RouterGroup) {
 	st.GET("/first-run", router.FirstRunCheckHandler)
 	st.POST("/bootstrap", router.CreateAdminServiceTokenHandler)
 	st.GET("/", AuthMiddleware(router.repo), AdminOnlyMiddleware, router.ListAllServiceTokens)
-	st.POST("/", AuthMiddleware(router.repo), AdminOnlyMiddleware, router.CreateServiceTokenHandler)
+	st.POST("/", AuthMiddleware(router.repo), AdminOnlyMiddleware, IdempotencyMiddleware(router.repo), router.CreateServiceTokenHandler)
 	st.GET("/:id", AuthMiddleware(router.repo), AdminOnlyMiddleware, router.GetServiceTokenHandler)
-	st.DELETE("/:id", AuthMiddleware(router.repo), AdminOnlyMiddleware, router.DeleteServiceTokenHandler)
+	st.DELETE("/:id", AuthMiddleware(router.repo), AdminOnlyMiddleware, IdempotencyMiddleware(router.repo), router.DeleteServiceTokenHandler)
 }
 
 // @Summary Check if admin token has already been created
@@ -74,6 +74,7 @@ func (r *router) CreateAdminServiceTokenHandler(c *gin.Context) {
 		writeError(c, http.StatusBadRequest, fmt.Sprintf("failed to create admin token: %v", err))
 		return
 	}
+	r.publishTokenEvent(eventTokenCreated, &token)
 	c.JSON(http.StatusCreated, token)
 }
 
@@ -136,6 +137,7 @@ func (r *router) CreateServiceTokenHandler(c *gin.Context) {
 		writeError(c, http.StatusBadRequest, fmt.Sprintf("failed to create service token: %v", err))
 		return
 	}
+	r.publishTokenEvent(eventTokenCreated, &token)
 	c.JSON(http.StatusCreated, token)
 }
 
@@ -199,5 +201,6 @@ func (r *router) DeleteServiceTokenHandler(c *gin.Context) {
 		writeError(c, http.StatusInternalServerError, fmt.Sprintf("failed to delete service token: %v", err))
 		return
 	}
+	r.publishTokenEvent(eventTokenRevoked, token)
 	c.Status(http.StatusNoContent)
 }
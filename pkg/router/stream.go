@@ -0,0 +1,120 @@
+package router
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+)
+
+// sniffLength is the number of leading bytes http.DetectContentType looks at.
+const sniffLength = 512
+
+var (
+	errFileSizeLimitExceeded = errors.New("file size limit exceeded")
+	errEmptyUpload           = errors.New("empty file data")
+)
+
+// uploadStream wraps an upload body and hashes and counts the bytes passing
+// through it. Once more than limit bytes have been read every further Read
+// fails with errFileSizeLimitExceeded, so the consumer aborts mid-transfer
+// instead of after the whole body has been received. A zero limit disables
+// the check.
+type uploadStream struct {
+	r     io.Reader
+	hash  hash.Hash
+	md5   hash.Hash // only set when the client declared a Content-MD5
+	limit uint64
+	read  uint64
+	err   error
+}
+
+func newUploadStream(r io.Reader, limit uint64) *uploadStream {
+	return resumeUploadStream(r, sha256.New(), limit)
+}
+
+// resumeUploadStream continues hashing into h, which already holds the state
+// of the bytes received by earlier chunks of the same upload.
+func resumeUploadStream(r io.Reader, h hash.Hash, limit uint64) *uploadStream {
+	return &uploadStream{
+		r:     r,
+		hash:  h,
+		limit: limit,
+	}
+}
+
+func (s *uploadStream) Read(p []byte) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	n, err := s.r.Read(p)
+	if n > 0 {
+		s.read += uint64(n)
+		if s.limit > 0 && s.read > s.limit {
+			s.err = errFileSizeLimitExceeded
+			return 0, s.err
+		}
+		s.hash.Write(p[:n])
+		if s.md5 != nil {
+			s.md5.Write(p[:n])
+		}
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		s.err = err
+	}
+	return n, err
+}
+
+// trackMD5 makes the stream compute an MD5 digest alongside the SHA-256 one.
+func (s *uploadStream) trackMD5() {
+	s.md5 = md5.New()
+}
+
+// Err returns the first non-EOF error the stream encountered, if any.
+func (s *uploadStream) Err() error {
+	return s.err
+}
+
+// Size returns the number of bytes read so far.
+func (s *uploadStream) Size() int64 {
+	return int64(s.read)
+}
+
+// Checksum returns the SHA-256 digest of the bytes read so far in the
+// "sha256:<hex>" form stored on models.File.
+func (s *uploadStream) Checksum() string {
+	return fmt.Sprintf("sha256:%x", s.Sum())
+}
+
+// Sum returns the SHA-256 digest of the bytes read so far.
+func (s *uploadStream) Sum() []byte {
+	return s.hash.Sum(nil)
+}
+
+// MD5Sum returns the MD5 digest of the bytes read so far, or nil unless
+// trackMD5 was called.
+func (s *uploadStream) MD5Sum() []byte {
+	if s.md5 == nil {
+		return nil
+	}
+	return s.md5.Sum(nil)
+}
+
+// sniffContentType reads up to sniffLength bytes from r to detect the content
+// type and returns a reader that replays them ahead of the rest of r.
+func sniffContentType(r io.Reader) (string, io.Reader, error) {
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", nil, err
+	}
+	if n == 0 {
+		return "", nil, errEmptyUpload
+	}
+	head = head[:n]
+	return http.DetectContentType(head), io.MultiReader(bytes.NewReader(head), r), nil
+}
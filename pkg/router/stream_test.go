@@ -0,0 +1,57 @@
+package router
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestUploadStream_ChecksumAndSize(t *testing.T) {
+	data := []byte(strings.Repeat("kinetica", 1000))
+	stream := newUploadStream(bytes.NewReader(data), 0)
+
+	contentType, body, err := sniffContentType(stream)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if contentType != "text/plain; charset=utf-8" {
+		t.Errorf("unexpected content type: %s", contentType)
+	}
+	out, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Errorf("sniffed reader did not replay the full body")
+	}
+	if stream.Size() != int64(len(data)) {
+		t.Errorf("expected size %d, got %d", len(data), stream.Size())
+	}
+	expected := fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+	if stream.Checksum() != expected {
+		t.Errorf("expected checksum %s, got %s", expected, stream.Checksum())
+	}
+}
+
+func TestUploadStream_LimitExceeded(t *testing.T) {
+	stream := newUploadStream(bytes.NewReader(make([]byte, 2048)), 1024)
+
+	_, err := io.Copy(io.Discard, stream)
+	if !errors.Is(err, errFileSizeLimitExceeded) {
+		t.Fatalf("expected errFileSizeLimitExceeded, got %v", err)
+	}
+	if !errors.Is(stream.Err(), errFileSizeLimitExceeded) {
+		t.Errorf("expected stream to remember the limit error, got %v", stream.Err())
+	}
+}
+
+func TestSniffContentType_Empty(t *testing.T) {
+	_, _, err := sniffContentType(bytes.NewReader(nil))
+	if !errors.Is(err, errEmptyUpload) {
+		t.Errorf("expected errEmptyUpload, got %v", err)
+	}
+}
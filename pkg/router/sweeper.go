@@ -0,0 +1,244 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/spf13/viper"
+)
+
+// uploadSessionTTL returns how long a blob stays usable after its last write.
+func uploadSessionTTL() time.Duration {
+	return viper.GetDuration("upload-session-ttl")
+}
+
+// sweepPageSize bounds the files listed by one pass of the sweeper. Listing
+// them may scan the whole file table, so each pass reads the next page and a
+// full scan is spread over several passes.
+const sweepPageSize = 500
+
+// sweeper periodically removes what abandoned uploads leave behind: expired
+// blobs with the unfinalized files and S3 objects they were created for,
+// pending files whose blob is already gone, files past their retention, file
+// versions past version-retention-period and expired idempotency keys.
+type sweeper struct {
+	*router
+	interval time.Duration
+	// where the listings of pending and expired files continue
+	pendingCursor string
+	expiredCursor string
+}
+
+// NewSweeper returns a sweeper publishing its events through server.
+func NewSweeper(server *router) *sweeper {
+	return &sweeper{
+		router:   server,
+		interval: viper.GetDuration("upload-sweep-interval"),
+	}
+}
+
+func (s *sweeper) Run(ctx context.Context, wg *sync.WaitGroup) error {
+	defer wg.Done()
+	if s.interval <= 0 {
+		return fmt.Errorf("upload sweep interval must be positive, got %s", s.interval)
+	}
+	log.Printf("Sweeping expired uploads every %s", s.interval)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		s.sweep(ctx)
+		select {
+		case <-ctx.Done():
+			log.Println("Upload sweeper stopped")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *sweeper) sweep(ctx context.Context) {
+	cutoff := time.Now().UTC().Add(-uploadSessionTTL())
+
+	blobs, err := s.repo.FileBlobs.ListExpiredFileBlobs(ctx, cutoff)
+	if err != nil {
+		log.Printf("Failed to list expired file blobs: %v", err)
+	}
+	for _, blob := range blobs {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := s.sweepBlob(ctx, blob); err != nil {
+			log.Printf("Failed to sweep file blob %s: %v", blob.ID, err)
+		}
+	}
+
+	files, cursor, err := s.repo.Files.ListPendingFiles(ctx, cutoff, s.pendingCursor, sweepPageSize)
+	if err != nil {
+		log.Printf("Failed to list pending files: %v", err)
+	}
+	s.pendingCursor = cursor
+	for _, file := range files {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := s.sweepPendingFile(ctx, file); err != nil {
+			log.Printf("Failed to sweep pending file %s: %v", file.ID, err)
+		}
+	}
+
+	files, cursor, err = s.repo.Files.ListExpiredFiles(ctx, time.Now().UTC(), s.expiredCursor, sweepPageSize)
+	if err != nil {
+		log.Printf("Failed to list expired files: %v", err)
+	}
+	s.expiredCursor = cursor
+	for _, file := range files {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := s.sweepExpiredFile(ctx, file); err != nil {
+			log.Printf("Failed to sweep expired file %s: %v", file.ID, err)
+		}
+	}
+
+	if err := s.repo.Idempotency.DeleteExpiredIdempotencyRecords(ctx, time.Now().UTC()); err != nil {
+		log.Printf("Failed to delete expired idempotency keys: %v", err)
+	}
+
+	if period := viper.GetDuration("version-retention-period"); period > 0 {
+		versions, err := s.repo.FileVersions.ListFileVersionsReplacedBefore(ctx, time.Now().UTC().Add(-period))
+		if err != nil {
+			log.Printf("Failed to list expired file versions: %v", err)
+		}
+		for _, version := range versions {
+			if ctx.Err() != nil {
+				return
+			}
+			if err := s.removeVersion(ctx, version); err != nil {
+				log.Printf("Failed to sweep version %d of file %s: %v", version.Version, version.FileID, err)
+			}
+		}
+	}
+}
+
+// inProgress reports whether file is still waiting for its content.
+func inProgress(file *models.File) bool {
+	return file.Status == models.FileStatusPending || file.Status == models.FileStatusUploading
+}
+
+// sweepBlob removes an expired blob. An active file only loses its upload
+// session; any other file was abandoned before it was finalized and is
+// removed along with it.
+func (s *sweeper) sweepBlob(ctx context.Context, blob *models.FileBlob) error {
+	file, err := s.repo.Files.GetFileByID(ctx, blob.FileID)
+	if err != nil || file.Status == models.FileStatusActive {
+		return s.repo.FileBlobs.DeleteFileBlobByID(ctx, blob.ID)
+	}
+	bucket, err := s.repo.Buckets.GetBucketByID(ctx, file.BucketID)
+	if err != nil || bucket == nil {
+		return fmt.Errorf("bucket %s of file %s not found", file.BucketID, file.ID)
+	}
+	log.Printf("Removing expired upload %s of file %s", blob.ID, file.ID)
+	if inProgress(file) {
+		return s.cancelUpload(ctx, blob, file, bucket)
+	}
+	// The content was received, so the file goes first: ListPendingFiles
+	// would not find it again if it were left without its blob.
+	if err := s.retireFile(ctx, file, bucket); err != nil {
+		return err
+	}
+	return s.repo.FileBlobs.DeleteFileBlobByID(ctx, blob.ID)
+}
+
+// sweepPendingFile removes a file that was never finalized once no blob is
+// left to complete it, or finishes a deletion that was interrupted.
+func (s *sweeper) sweepPendingFile(ctx context.Context, file *models.File) error {
+	blobs, err := s.repo.FileBlobs.ListFileBlobsByFileID(ctx, file.ID)
+	if err != nil {
+		return fmt.Errorf("list file blobs: %w", err)
+	}
+	if len(blobs) > 0 {
+		return nil
+	}
+	bucket, err := s.repo.Buckets.GetBucketByID(ctx, file.BucketID)
+	if err != nil {
+		bucket = nil
+	}
+	log.Printf("Removing orphaned pending file %s", file.ID)
+	return s.retireFile(ctx, file, bucket)
+}
+
+// sweepExpiredFile removes a file whose retention has ended, and its object
+// unless another file still refers to it. Uploads still running for the file
+// are cancelled first.
+func (s *sweeper) sweepExpiredFile(ctx context.Context, file *models.File) error {
+	bucket, err := s.repo.Buckets.GetBucketByID(ctx, file.BucketID)
+	if err != nil || bucket == nil {
+		return fmt.Errorf("bucket %s of file %s not found", file.BucketID, file.ID)
+	}
+	blobs, err := s.repo.FileBlobs.ListFileBlobsByFileID(ctx, file.ID)
+	if err != nil {
+		return fmt.Errorf("list file blobs: %w", err)
+	}
+	for _, blob := range blobs {
+		if inProgress(file) {
+			err = s.discardUpload(ctx, blob, file, bucket)
+		} else {
+			err = s.repo.FileBlobs.DeleteFileBlobByID(ctx, blob.ID)
+		}
+		if err != nil {
+			return fmt.Errorf("remove file blob %s: %w", blob.ID, err)
+		}
+	}
+	log.Printf("Removing file %s past its retention", file.ID)
+	if err := s.retireFile(ctx, file, bucket); err != nil {
+		return err
+	}
+	s.emit(ctx, models.EventFileDeleted, file)
+	return nil
+}
+
+// retireFile moves file through deleting to deleted, removing its object
+// unless something else still refers to it, and then deletes its versions and
+// its record. A file left deleting or deleted by an earlier attempt carries on
+// from there. Without a bucket the object is left alone.
+func (r *router) retireFile(ctx context.Context, file *models.File, bucket *models.Bucket) error {
+	if !removing(file) {
+		if err := file.Transition(models.FileStatusDeleting); err != nil {
+			return err
+		}
+		if err := r.repo.Files.UpdateFile(ctx, file); err != nil {
+			return fmt.Errorf("update file record: %w", err)
+		}
+	}
+	if file.Status == models.FileStatusDeleting {
+		if bucket != nil {
+			inUse, err := r.objectInUse(ctx, file)
+			if err != nil {
+				return fmt.Errorf("check object references: %w", err)
+			}
+			if !inUse {
+				if err := deleteObject(ctx, bucket, file); err != nil {
+					return fmt.Errorf("delete object: %w", err)
+				}
+			}
+		}
+		if err := file.Transition(models.FileStatusDeleted); err != nil {
+			return err
+		}
+		if err := r.repo.Files.UpdateFile(ctx, file); err != nil {
+			return fmt.Errorf("update file record: %w", err)
+		}
+	}
+	if err := r.removeFileVersions(ctx, file); err != nil {
+		return err
+	}
+	if err := r.repo.Files.DeleteFile(ctx, file.ID); err != nil {
+		return fmt.Errorf("delete file record: %w", err)
+	}
+	return nil
+}
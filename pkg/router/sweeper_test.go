@@ -0,0 +1,257 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/spf13/viper"
+)
+
+func TestSweep(t *testing.T) {
+	viper.Set("upload-session-ttl", time.Hour)
+	defer viper.Set("upload-session-ttl", nil)
+
+	old := time.Now().UTC().Add(-2 * time.Hour)
+	expired := time.Now().UTC().Add(-time.Minute)
+	file := func(name string, status models.FileStatus) *models.File {
+		return &models.File{
+			ApplicationModel: models.ApplicationModel{ID: name, UpdatedAt: old},
+			Name:             name,
+			BucketID:         "bucket",
+			Status:           status,
+		}
+	}
+	expiring := func(f *models.File) *models.File {
+		f.ExpiresAt = &expired
+		return f
+	}
+
+	tests := []struct {
+		name    string
+		files   []*models.File
+		blobs   []*models.FileBlob
+		objects []string
+		// versions are stored for the file named "file" under these keys
+		versions []string
+		// what is left afterwards, and the events emitted
+		wantFiles   []string
+		wantObjects []string
+		wantBlobs   []string
+		wantEvents  []string
+		wantAborts  int
+	}{
+		{
+			name:        "expired upload with several blobs",
+			files:       []*models.File{expiring(file("file", models.FileStatusUploading))},
+			blobs:       []*models.FileBlob{{FileID: "file", UploadID: "upload-1", UploadOffset: 10}, {FileID: "file", UploadID: "upload-2", UploadOffset: 10}},
+			objects:     []string{"other"},
+			wantObjects: []string{"other"},
+			wantEvents:  []string{"file.deleted file"},
+			wantAborts:  2,
+		},
+		{
+			name:        "expired active file and its versions",
+			files:       []*models.File{expiring(file("file", models.FileStatusActive))},
+			blobs:       []*models.FileBlob{{FileID: "file", Finalized: true}},
+			objects:     []string{"file", "v1", "other"},
+			versions:    []string{"v1"},
+			wantObjects: []string{"other"},
+			wantEvents:  []string{"file.deleted file"},
+		},
+		{
+			name: "expired file sharing its object",
+			files: []*models.File{
+				expiring(file("file", models.FileStatusActive)),
+				{ApplicationModel: models.ApplicationModel{ID: "dup"}, Name: "dup", BucketID: "bucket", ObjectKey: "file", Status: models.FileStatusActive},
+			},
+			objects:     []string{"file"},
+			wantFiles:   []string{"dup"},
+			wantObjects: []string{"file"},
+			wantEvents:  []string{"file.deleted file"},
+		},
+		{
+			name:        "pending file without a blob",
+			files:       []*models.File{file("file", models.FileStatusPending)},
+			objects:     []string{"file"},
+			wantObjects: nil,
+		},
+		{
+			name:        "pending file with a live blob",
+			files:       []*models.File{file("file", models.FileStatusUploading)},
+			blobs:       []*models.FileBlob{{ApplicationModel: models.ApplicationModel{ID: "live", UpdatedAt: time.Now().UTC()}, FileID: "file", UploadOffset: 10}},
+			objects:     []string{"file"},
+			wantFiles:   []string{"file"},
+			wantObjects: []string{"file"},
+			wantBlobs:   []string{"live"},
+		},
+		{
+			name:       "expired blob of an upload",
+			files:      []*models.File{file("file", models.FileStatusUploading)},
+			blobs:      []*models.FileBlob{{ApplicationModel: models.ApplicationModel{ID: "stale", UpdatedAt: old}, FileID: "file", UploadID: "upload-1", UploadOffset: 10}},
+			wantAborts: 1,
+		},
+		{
+			name:    "expired blob of an uploaded file",
+			files:   []*models.File{file("file", models.FileStatusUploaded)},
+			blobs:   []*models.FileBlob{{ApplicationModel: models.ApplicationModel{ID: "stale", UpdatedAt: old}, FileID: "file", UploadOffset: 10}},
+			objects: []string{"file"},
+		},
+		{
+			name:    "expired blob of a failed file",
+			files:   []*models.File{file("file", models.FileStatusFailed)},
+			blobs:   []*models.FileBlob{{ApplicationModel: models.ApplicationModel{ID: "stale", UpdatedAt: old}, FileID: "file", UploadOffset: 10}},
+			objects: []string{"file"},
+		},
+		{
+			name:        "expired blob of an active file",
+			files:       []*models.File{file("file", models.FileStatusActive)},
+			blobs:       []*models.FileBlob{{ApplicationModel: models.ApplicationModel{ID: "stale", UpdatedAt: old}, FileID: "file", Finalized: true}},
+			objects:     []string{"file"},
+			wantFiles:   []string{"file"},
+			wantObjects: []string{"file"},
+		},
+		{
+			name:        "interrupted deletion",
+			files:       []*models.File{file("file", models.FileStatusDeleting)},
+			objects:     []string{"file"},
+			versions:    []string{"v1"},
+			wantObjects: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := newFakeS3()
+			defer storage.Close()
+			repo := newFakeRepository()
+			repo.watchEvents()
+			repo.CreateBucket(context.Background(), storage.bucket("bucket", "bucket"))
+			for _, f := range tt.files {
+				repo.putFile(f, 1)
+			}
+			for i, blob := range tt.blobs {
+				if blob.ID == "" {
+					blob.ID = string(rune('a' + i))
+				}
+				if blob.UpdatedAt.IsZero() {
+					blob.UpdatedAt = time.Now().UTC()
+				}
+				repo.CreateFileBlob(context.Background(), blob)
+			}
+			for _, key := range tt.objects {
+				storage.put("bucket", key, []byte(key))
+			}
+			for i, key := range tt.versions {
+				repo.CreateFileVersion(context.Background(), &models.FileVersion{FileID: "file", Version: i + 1, BucketID: "bucket", ObjectKey: key})
+			}
+
+			s := &sweeper{router: &router{repo: repo.repository()}}
+			s.sweep(context.Background())
+
+			var files, objects, blobs []string
+			for _, f := range repo.matchFiles(func(*models.File) bool { return true }) {
+				files = append(files, f.ID)
+			}
+			for _, key := range []string{"file", "v1", "other"} {
+				if storage.has("bucket", key) {
+					objects = append(objects, key)
+				}
+			}
+			for _, blob := range repo.matchBlobs(func(*models.FileBlob) bool { return true }) {
+				blobs = append(blobs, blob.ID)
+			}
+			sort.Strings(tt.wantObjects)
+			sort.Strings(objects)
+			if !reflect.DeepEqual(files, tt.wantFiles) {
+				t.Errorf("files left: %v, want %v", files, tt.wantFiles)
+			}
+			if !reflect.DeepEqual(objects, tt.wantObjects) {
+				t.Errorf("objects left: %v, want %v", objects, tt.wantObjects)
+			}
+			if !reflect.DeepEqual(blobs, tt.wantBlobs) {
+				t.Errorf("blobs left: %v, want %v", blobs, tt.wantBlobs)
+			}
+			if events := repo.emitted(); !reflect.DeepEqual(events, tt.wantEvents) {
+				t.Errorf("events: %v, want %v", events, tt.wantEvents)
+			}
+			if aborts := len(storage.callsOf("AbortMultipartUpload")); aborts != tt.wantAborts {
+				t.Errorf("aborted %d multipart uploads, want %d", aborts, tt.wantAborts)
+			}
+			if versions := repo.matchVersions(func(v *models.FileVersion) bool { return repo.file(v.FileID) == nil }); len(versions) > 0 {
+				t.Errorf("versions of deleted files left: %v", versions)
+			}
+		})
+	}
+}
+
+// TestRetireFile_MovesThroughDeleting checks that the sweeper marks a file
+// deleting before anything is removed, so an interrupted sweep is resumed.
+func TestRetireFile_MovesThroughDeleting(t *testing.T) {
+	storage := newFakeS3()
+	defer storage.Close()
+	repo := newFakeRepository()
+	bucket := storage.bucket("bucket", "bucket")
+	repo.CreateBucket(context.Background(), bucket)
+	repo.putFile(&models.File{Name: "file", BucketID: "bucket", Status: models.FileStatusPending}, 1)
+	storage.put("bucket", "file", []byte("data"))
+	repo.failUpdates = errFakeNotFound
+
+	r := &router{repo: repo.repository()}
+	file, _ := repo.GetFileByID(context.Background(), "file")
+	if err := r.retireFile(context.Background(), file, bucket); err == nil {
+		t.Fatal("expected the failed update to stop the removal")
+	}
+	if !storage.has("bucket", "file") || repo.file("file") == nil {
+		t.Error("expected nothing to be removed before the file is marked deleting")
+	}
+
+	repo.failUpdates = nil
+	file, _ = repo.GetFileByID(context.Background(), "file")
+	file.Status = models.FileStatusFailed
+	if err := r.retireFile(context.Background(), file, bucket); err != nil {
+		t.Fatalf("retireFile: %v", err)
+	}
+	if storage.has("bucket", "file") || repo.file("file") != nil {
+		t.Error("expected the file and its object to be removed")
+	}
+	if file.Status != models.FileStatusDeleted {
+		t.Errorf("expected the file to end deleted, got %s", file.Status)
+	}
+}
+
+// TestSweep_Pages checks that each pass lists a single page of pending files
+// and that the next pass continues where it stopped.
+func TestSweep_Pages(t *testing.T) {
+	viper.Set("upload-session-ttl", time.Hour)
+	defer viper.Set("upload-session-ttl", nil)
+
+	repo := newFakeRepository()
+	old := time.Now().UTC().Add(-2 * time.Hour)
+	for i := 0; i < sweepPageSize+10; i++ {
+		repo.putFile(&models.File{
+			ApplicationModel: models.ApplicationModel{ID: fmt.Sprintf("file-%04d", i), UpdatedAt: old},
+			BucketID:         "gone",
+			Status:           models.FileStatusPending,
+		}, 1)
+	}
+	s := &sweeper{router: &router{repo: repo.repository()}}
+
+	s.sweep(context.Background())
+	if left := len(repo.matchFiles(func(*models.File) bool { return true })); left != 10 {
+		t.Fatalf("expected one page swept, %d files left", left)
+	}
+	if s.pendingCursor == "" {
+		t.Error("expected the listing to continue on the next pass")
+	}
+	s.sweep(context.Background())
+	if left := len(repo.matchFiles(func(*models.File) bool { return true })); left != 0 {
+		t.Errorf("expected the rest swept, %d files left", left)
+	}
+	if s.pendingCursor != "" {
+		t.Errorf("expected the listing to start over, cursor %q", s.pendingCursor)
+	}
+}
@@ -0,0 +1,302 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/gin-gonic/gin"
+)
+
+// maxCopyObjectSize is the largest object S3 copies with a single CopyObject
+// request. Larger objects are streamed.
+const maxCopyObjectSize = 5 << 30
+
+type FileTransferDTO struct {
+	RegionID   string `json:"regionId" binding:"required"`
+	BucketCode string `json:"bucketCode"` // a bucket of the region is picked if empty
+}
+
+// sameStorage reports whether objects of from can be copied into to by the
+// storage itself: both buckets live on the same endpoint and are reached with
+// the same credentials.
+func sameStorage(from, to *models.Bucket) bool {
+	return from.Endpoint == to.Endpoint && from.AccessKey == to.AccessKey
+}
+
+// copyContent stores the content of file, held in bucket from, in bucket to
+// under the name of target, and points target at the new object. Content is
+// encrypted or decrypted on the way as the destination bucket requires, so
+// target also gets the encryption state and data key that go with it. The
+// target record is not saved.
+func copyContent(ctx context.Context, file *models.File, from *models.Bucket, target *models.File, to *models.Bucket) error {
+	target.Encrypted = file.Encrypted
+	target.DataKey = file.DataKey
+	objectSize := file.FileSize
+	if file.Encrypted {
+		objectSize = encryptedSize(file.FileSize)
+	}
+
+	client, err := createS3Client(to)
+	if err != nil {
+		return err
+	}
+	if file.Encrypted == to.Encrypt && sameStorage(from, to) && objectSize <= maxCopyObjectSize {
+		_, err = client.CopyObject(ctx, &s3.CopyObjectInput{
+			Bucket:     aws.String(to.Name),
+			Key:        aws.String(target.Name),
+			CopySource: aws.String(from.Name + "/" + url.PathEscape(file.StorageKey())),
+		})
+		if err != nil {
+			return fmt.Errorf("copy object: %w", err)
+		}
+	} else {
+		source, err := createS3Client(from)
+		if err != nil {
+			return err
+		}
+		object := &objectReader{
+			ctx:    ctx,
+			client: source,
+			bucket: from.Name,
+			key:    file.StorageKey(),
+			size:   objectSize,
+		}
+		defer object.Close()
+		var body io.Reader = object
+		switch {
+		case file.Encrypted && !to.Encrypt:
+			aead, err := fileCipher(file)
+			if err != nil {
+				return err
+			}
+			body = newDecryptingReader(object, aead, file.FileSize)
+			objectSize = file.FileSize
+			target.Encrypted = false
+			target.DataKey = nil
+		case !file.Encrypted && to.Encrypt:
+			aead, err := newDataKey(target)
+			if err != nil {
+				return err
+			}
+			body = newEncryptingReader(body, aead)
+			objectSize = encryptedSize(file.FileSize)
+		}
+		err = uploadObject(ctx, client, to.Name, target.Name, file.ContentType, body, objectSize)
+		if object.err != nil {
+			return object.err
+		}
+		if err != nil {
+			return fmt.Errorf("upload object: %w", err)
+		}
+	}
+
+	target.BucketID = to.ID
+	target.ObjectKey = ""
+	target.Path = fmt.Sprintf("%s/%s/%s", to.Endpoint, to.Name, target.Name)
+	head, err := headUploadedObject(ctx, to, target)
+	if err != nil {
+		return err
+	}
+	target.ETag = aws.ToString(head.ETag)
+	return nil
+}
+
+// fileTransfer is a file to copy or move with its bucket and the region and
+// bucket it goes to.
+type fileTransfer struct {
+	file         *models.File
+	from         *models.Bucket
+	region       RegionInfo
+	regionBucket *RegionBucket
+	to           *models.Bucket
+}
+
+// loadTransfer reads the copy or move request for the file of the path. It
+// writes the error response itself and returns false on failure.
+func (r *router) loadTransfer(c *gin.Context) (*fileTransfer, bool) {
+	var dto FileTransferDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		writeError(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return nil, false
+	}
+	ctx := c.Request.Context()
+	file, err := r.repo.Files.GetFileByID(ctx, c.Param("id"))
+	if err != nil || file == nil {
+		writeError(c, http.StatusNotFound, "File not found")
+		return nil, false
+	}
+	if file.Status != models.FileStatusActive {
+		writeError(c, http.StatusConflict, fmt.Sprintf("Only active files can be copied or moved, the file is %s", file.Status))
+		return nil, false
+	}
+	from, err := r.repo.Buckets.GetBucketByID(ctx, file.BucketID)
+	if err != nil || from == nil {
+		writeError(c, http.StatusNotFound, "Bucket not found")
+		return nil, false
+	}
+	regions := Regions{}
+	if err := loadRegionsConfig(&regions); err != nil {
+		writeError(c, http.StatusInternalServerError, "Failed to load regions configuration: "+err.Error())
+		return nil, false
+	}
+	region, ok := regions[dto.RegionID]
+	if !ok {
+		writeError(c, http.StatusBadRequest, "Invalid region ID")
+		return nil, false
+	}
+	regionBucket, failure := selectRegionBucket(region, dto.BucketCode)
+	if failure != nil {
+		c.JSON(failure.Code, failure)
+		return nil, false
+	}
+	to, err := r.repo.Buckets.GetBucketByID(ctx, regionBucket.BucketID)
+	if err != nil || to == nil {
+		writeError(c, http.StatusBadRequest, "Destination bucket not found")
+		return nil, false
+	}
+	return &fileTransfer{file: file, from: from, region: region, regionBucket: regionBucket, to: to}, true
+}
+
+// writeTransferError answers a failed copy of file content.
+func writeTransferError(c *gin.Context, err error) {
+	if errors.Is(err, errDataKeyErased) {
+		writeError(c, http.StatusGone, "File content has been erased")
+		return
+	}
+	writeError(c, http.StatusInternalServerError, "Failed to copy file content: "+err.Error())
+}
+
+// Copy a file (admin only)
+// @Summary Copy file
+// @Description Copy an active file into a bucket of the given region, picked at random unless bucketCode is given. The copy is a new file whose GUID carries the region and bucket it is stored in; it keeps the metadata, tags and upload policy of the original, and its retention starts over. Buckets on the same endpoint copy the object within the storage; otherwise the content is streamed through KineticaFS, and encrypted or decrypted as the destination bucket requires. Admin access required.
+// @Tags files
+// @Accept json
+// @Produce json
+// @Param x-api-token header string true "API Token"
+// @Param id path string true "File ID"
+// @Param destination body FileTransferDTO true "Destination"
+// @Success 201 {object} models.File
+// @Failure 400 {object} router.ErrorResponse
+// @Failure 401 {object} router.ErrorResponse "Unauthorized"
+// @Failure 403 {object} router.ErrorResponse "Forbidden - Admin only"
+// @Failure 404 {object} router.ErrorResponse
+// @Failure 409 {object} router.ErrorResponse "File is not active"
+// @Failure 410 {object} router.ErrorResponse "File content has been erased"
+// @Failure 500 {object} router.ErrorResponse
+// @Router /api/v1/file/{id}/copy [post]
+// @Id CopyFile
+func (r *router) CopyFileHandler(c *gin.Context) {
+	t, ok := r.loadTransfer(c)
+	if !ok {
+		return
+	}
+	file, from, to := t.file, t.from, t.to
+	ctx := c.Request.Context()
+	name, err := newFileGUID(t.region, t.regionBucket)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "Failed to generate file GUID: "+err.Error())
+		return
+	}
+	copied := &models.File{
+		Name:         name,
+		FileSize:     file.FileSize,
+		ContentType:  file.ContentType,
+		Checksum:     file.Checksum,
+		Status:       models.FileStatusActive,
+		Metadata:     file.Metadata,
+		ScanStatus:   file.ScanStatus,
+		ScanDetail:   file.ScanDetail,
+		Version:      1,
+		UserMetadata: file.UserMetadata,
+		Tags:         file.Tags,
+	}
+	policy := models.UploadPolicy{}
+	if file.UploadPolicy != nil {
+		policy = *file.UploadPolicy
+	}
+	policy.MaxSize = file.FileSizeLimit
+	applyUploadPolicy(copied, policy)
+
+	if err := copyContent(ctx, file, from, copied, to); err != nil {
+		writeTransferError(c, err)
+		return
+	}
+	if err := r.repo.Files.CreateFile(ctx, copied); err != nil {
+		if err := deleteObject(context.WithoutCancel(ctx), to, copied); err != nil {
+			log.Printf("Failed to delete copied object %s/%s: %v", to.Name, copied.Name, err)
+		}
+		writeError(c, http.StatusInternalServerError, "Failed to create file record: "+err.Error())
+		return
+	}
+	r.emit(ctx, models.EventFileFinalized, copied)
+	c.JSON(http.StatusCreated, copied)
+}
+
+// Move a file (admin only)
+// @Summary Move file
+// @Description Move the content of an active file into a bucket of the given region, picked at random unless bucketCode is given. The file keeps its ID; its bucket and path change in one update once the content is in place, and the object it was read from is deleted unless another file or version still refers to it. Earlier versions stay where they are. Buckets on the same endpoint copy the object within the storage; otherwise the content is streamed through KineticaFS, and encrypted or decrypted as the destination bucket requires. Admin access required.
+// @Tags files
+// @Accept json
+// @Produce json
+// @Param x-api-token header string true "API Token"
+// @Param id path string true "File ID"
+// @Param destination body FileTransferDTO true "Destination"
+// @Success 200 {object} models.File
+// @Failure 400 {object} router.ErrorResponse
+// @Failure 401 {object} router.ErrorResponse "Unauthorized"
+// @Failure 403 {object} router.ErrorResponse "Forbidden - Admin only"
+// @Failure 404 {object} router.ErrorResponse
+// @Failure 409 {object} router.ErrorResponse "File is not active, or already stored in the bucket"
+// @Failure 410 {object} router.ErrorResponse "File content has been erased"
+// @Failure 500 {object} router.ErrorResponse
+// @Router /api/v1/file/{id}/move [post]
+// @Id MoveFile
+func (r *router) MoveFileHandler(c *gin.Context) {
+	t, ok := r.loadTransfer(c)
+	if !ok {
+		return
+	}
+	file, from, to := t.file, t.from, t.to
+	if from.ID == to.ID {
+		writeError(c, http.StatusConflict, "File is already stored in that bucket")
+		return
+	}
+	ctx := c.Request.Context()
+	moved := *file
+	if err := copyContent(ctx, file, from, &moved, to); err != nil {
+		writeTransferError(c, err)
+		return
+	}
+	if err := r.repo.Files.UpdateFile(ctx, &moved); err != nil {
+		if err := deleteObject(context.WithoutCancel(ctx), to, &moved); err != nil {
+			log.Printf("Failed to delete copied object %s/%s: %v", to.Name, moved.Name, err)
+		}
+		writeError(c, http.StatusInternalServerError, "Failed to update file record: "+err.Error())
+		return
+	}
+
+	// The file now lives in the destination bucket, so only other files and
+	// versions can still refer to the object it was read from.
+	ctx = context.WithoutCancel(ctx)
+	key := file.StorageKey()
+	inUse, err := r.objectReferenced(ctx, from.ID, key,
+		func(*models.File) bool { return false },
+		func(*models.FileVersion) bool { return false })
+	if err != nil {
+		log.Printf("Failed to check references of object %s/%s after moving file %s: %v", from.Name, key, file.ID, err)
+	} else if !inUse {
+		if err := deleteObjectKey(ctx, from, key); err != nil {
+			log.Printf("Failed to delete object %s/%s after moving file %s: %v", from.Name, key, file.ID, err)
+		}
+	}
+	r.emit(ctx, models.EventFileMigrated, &moved)
+	c.JSON(http.StatusOK, &moved)
+}
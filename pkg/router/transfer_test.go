@@ -0,0 +1,42 @@
+package router
+
+import (
+	"testing"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+)
+
+func TestSelectRegionBucket(t *testing.T) {
+	region := RegionInfo{ID: 1, Buckets: []RegionBucket{{ID: 1, BucketID: "a"}, {ID: 2, BucketID: "b"}}}
+
+	bucket, failure := selectRegionBucket(region, "b")
+	if failure != nil || bucket.ID != 2 {
+		t.Errorf("expected bucket 2, got %+v, %+v", bucket, failure)
+	}
+	if _, failure := selectRegionBucket(region, "c"); failure == nil || failure.Code != 400 {
+		t.Errorf("expected 400 for an unknown bucket code, got %+v", failure)
+	}
+	bucket, failure = selectRegionBucket(region, "")
+	if failure != nil || (bucket.BucketID != "a" && bucket.BucketID != "b") {
+		t.Errorf("expected a bucket of the region, got %+v, %+v", bucket, failure)
+	}
+	if _, failure := selectRegionBucket(RegionInfo{}, ""); failure == nil {
+		t.Error("expected an error for a region without buckets")
+	}
+}
+
+func TestSameStorage(t *testing.T) {
+	a := &models.Bucket{Name: "a", Endpoint: "https://s3.example.com", AccessKey: "key"}
+	b := &models.Bucket{Name: "b", Endpoint: "https://s3.example.com", AccessKey: "key"}
+	if !sameStorage(a, b) {
+		t.Error("expected buckets on the same endpoint and credentials to share storage")
+	}
+	b.AccessKey = "other"
+	if sameStorage(a, b) {
+		t.Error("expected buckets reached with other credentials not to share storage")
+	}
+	b.AccessKey, b.Endpoint = "key", "https://s3.other.example.com"
+	if sameStorage(a, b) {
+		t.Error("expected buckets on other endpoints not to share storage")
+	}
+}
@@ -0,0 +1,288 @@
+package router
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination,expiration"
+)
+
+// AddTusRoutes sets up a tus 1.0 (https://tus.io/protocols/resumable-upload)
+// endpoint as an alternative to /upload/:blob. A tus upload is created for a
+// blob returned by InitiateFileUpload and is stored through the same resumable
+// multipart path, so it ends in the same file lifecycle as a native upload.
+// Like /upload/:blob it accepts signed upload URLs, whose query the creation
+// carries over to the upload URL it returns.
+func AddTusRoutes(router *router, v1 *gin.RouterGroup) {
+	tus := v1.Group("/tus", TusResumableMiddleware)
+	tus.OPTIONS("/", router.TusOptionsHandler)
+	tus.POST("/", uploadAuthMiddleware(router.repo, tusMetadataBlob), router.TusCreateUploadHandler)
+	tus.HEAD("/:blob", UploadAuthMiddleware(router.repo), router.TusHeadHandler)
+	tus.PATCH("/:blob", UploadAuthMiddleware(router.repo), router.TusPatchHandler)
+	tus.DELETE("/:blob", UploadAuthMiddleware(router.repo), router.TusTerminateHandler)
+}
+
+// tusMetadataBlob returns the blob ID a tus creation request names in its
+// Upload-Metadata, or "" if there is none.
+func tusMetadataBlob(c *gin.Context) string {
+	metadata, err := parseTusMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		return ""
+	}
+	return metadata["blob"]
+}
+
+// TusResumableMiddleware stamps every response with the protocol version and
+// rejects requests speaking a version other than the one supported.
+func TusResumableMiddleware(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	if c.Request.Method != http.MethodOptions && c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		c.AbortWithStatusJSON(http.StatusPreconditionFailed, ErrorResponse{
+			Code:    http.StatusPreconditionFailed,
+			Message: "Unsupported tus version",
+		})
+		return
+	}
+	c.Next()
+}
+
+// parseTusMetadata decodes an Upload-Metadata header: comma-separated pairs
+// of a key and an optional base64-encoded value.
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		switch len(fields) {
+		case 1:
+			metadata[fields[0]] = ""
+		case 2:
+			value, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid Upload-Metadata value for %q", fields[0])
+			}
+			metadata[fields[0]] = string(value)
+		default:
+			return nil, fmt.Errorf("invalid Upload-Metadata pair %q", pair)
+		}
+	}
+	return metadata, nil
+}
+
+// uploadExpiresAt returns when the upload session of blob lapses. Every write
+// to the blob extends the session.
+func uploadExpiresAt(blob *models.FileBlob) time.Time {
+	return blob.UpdatedAt.Add(uploadSessionTTL())
+}
+
+// uploadExpired reports whether the upload session of blob has lapsed. The
+// blob is left for the sweeper to remove.
+func uploadExpired(blob *models.FileBlob) bool {
+	return time.Now().After(uploadExpiresAt(blob))
+}
+
+func setUploadExpires(c *gin.Context, expires time.Time) {
+	c.Header("Upload-Expires", expires.UTC().Format(http.TimeFormat))
+}
+
+// Tus capabilities
+// @Summary Tus capabilities
+// @Description Report the tus protocol version and extensions supported by the server.
+// @Tags tus
+// @Success 204 "Tus-Version and Tus-Extension headers"
+// @Router /api/v1/tus/ [options]
+// @Id TusOptions
+func (r *router) TusOptionsHandler(c *gin.Context) {
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	c.Status(http.StatusNoContent)
+}
+
+// Create tus upload (client)
+// @Summary Create tus upload
+// @Description Create a tus upload for a blob returned by InitiateFileUpload. The blob ID is passed as the "blob" key of Upload-Metadata and the total size in Upload-Length. The Location header holds the upload URL, which keeps the query of a signed upload URL.
+// @Tags tus
+// @Param x-api-token header string false "API Token, unless a signed upload URL is used"
+// @Param expires query int false "Expiry of a signed upload URL (Unix seconds)"
+// @Param signature query string false "Signature of a signed upload URL"
+// @Param Tus-Resumable header string true "Protocol version (1.0.0)"
+// @Param Upload-Length header int true "Total size of the upload in bytes"
+// @Param Upload-Metadata header string true "Comma-separated key/base64 value pairs; must contain blob"
+// @Success 201 "Location header points to the upload"
+// @Failure 400 {object} router.ErrorResponse
+// @Failure 401 {object} router.ErrorResponse "Unauthorized"
+// @Failure 404 {object} router.ErrorResponse
+// @Failure 409 {object} router.ErrorResponse "Upload already started or completed"
+// @Failure 410 {object} router.ErrorResponse "Upload session expired"
+// @Failure 412 {object} router.ErrorResponse "Unsupported tus version"
+// @Failure 413 {object} router.UploadRejectionResponse "Upload-Length exceeds the file size limit"
+// @Router /api/v1/tus/ [post]
+// @Id TusCreateUpload
+func (r *router) TusCreateUploadHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 1 {
+		writeError(c, http.StatusBadRequest, "Missing or invalid Upload-Length header")
+		return
+	}
+	metadata, err := parseTusMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		writeError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	blobID := metadata["blob"]
+	if blobID == "" {
+		writeError(c, http.StatusBadRequest, "Upload-Metadata must contain the blob ID returned by file upload initiation")
+		return
+	}
+
+	blob, file, _, ok := r.loadUploadSession(c, blobID)
+	if !ok {
+		return
+	}
+	if file.Status != models.FileStatusPending || blob.UploadOffset > 0 || (blob.UploadLength > 0 && blob.UploadLength != length) {
+		writeError(c, http.StatusConflict, "Upload has already been started for this blob")
+		return
+	}
+	if file.FileSizeLimit > 0 && uint64(length) > file.FileSizeLimit {
+		rejection := sizeLimitRejection(file.FileSizeLimit)
+		rejection.Code = http.StatusRequestEntityTooLarge
+		writeRejection(c, rejection)
+		return
+	}
+
+	blob.UploadLength = length
+	if err := r.repo.FileBlobs.UpdateFileBlob(ctx, blob); err != nil {
+		writeError(c, http.StatusInternalServerError, "Failed to create upload: "+err.Error())
+		return
+	}
+	location := "/api/v1/tus/" + blob.ID
+	if c.GetString("uploadBlob") != "" {
+		location += "?" + c.Request.URL.RawQuery
+	}
+	c.Header("Location", location)
+	setUploadExpires(c, uploadExpiresAt(blob))
+	c.Status(http.StatusCreated)
+}
+
+// Get tus upload offset (client)
+// @Summary Get tus upload offset
+// @Description Report the offset and length of a tus upload.
+// @Tags tus
+// @Param x-api-token header string false "API Token, unless a signed upload URL is used"
+// @Param expires query int false "Expiry of a signed upload URL (Unix seconds)"
+// @Param signature query string false "Signature of a signed upload URL"
+// @Param Tus-Resumable header string true "Protocol version (1.0.0)"
+// @Param blob path string true "Blob ID"
+// @Success 200 "Upload-Offset, Upload-Length and Upload-Expires headers"
+// @Failure 401 {object} router.ErrorResponse "Unauthorized"
+// @Failure 404 {object} router.ErrorResponse
+// @Failure 410 {object} router.ErrorResponse "Upload expired"
+// @Router /api/v1/tus/{blob} [head]
+// @Id TusHead
+func (r *router) TusHeadHandler(c *gin.Context) {
+	blob, err := r.repo.FileBlobs.GetFileBlobByID(c.Request.Context(), c.Param("blob"))
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if uploadExpired(blob) {
+		c.Status(http.StatusGone)
+		return
+	}
+	setUploadHeaders(c, blob)
+	setUploadExpires(c, uploadExpiresAt(blob))
+	c.Status(http.StatusOK)
+}
+
+// Upload tus chunk (client)
+// @Summary Upload tus chunk
+// @Description Append a chunk to a tus upload at the given Upload-Offset. The file is marked uploaded once Upload-Length bytes have been received.
+// @Tags tus
+// @Accept application/offset+octet-stream
+// @Param x-api-token header string false "API Token, unless a signed upload URL is used"
+// @Param expires query int false "Expiry of a signed upload URL (Unix seconds)"
+// @Param signature query string false "Signature of a signed upload URL"
+// @Param Tus-Resumable header string true "Protocol version (1.0.0)"
+// @Param Upload-Offset header int true "Offset of this chunk"
+// @Param blob path string true "Blob ID"
+// @Param chunk body []byte true "Chunk data"
+// @Success 204 "Upload-Offset header holds the new offset"
+// @Failure 400 {object} router.ErrorResponse
+// @Failure 401 {object} router.ErrorResponse "Unauthorized"
+// @Failure 404 {object} router.ErrorResponse
+// @Failure 409 {object} router.ErrorResponse "Offset mismatch, or another chunk was stored at that offset first"
+// @Failure 410 {object} router.ErrorResponse "Upload expired"
+// @Failure 415 {object} router.ErrorResponse "Content-Type must be application/offset+octet-stream, or the content type is rejected by the upload policy"
+// @Router /api/v1/tus/{blob} [patch]
+// @Id TusPatch
+func (r *router) TusPatchHandler(c *gin.Context) {
+	if c.ContentType() != "application/offset+octet-stream" {
+		writeError(c, http.StatusUnsupportedMediaType, "Content-Type must be application/offset+octet-stream")
+		return
+	}
+	if c.GetHeader("Upload-Offset") == "" {
+		writeError(c, http.StatusBadRequest, "Missing Upload-Offset header")
+		return
+	}
+	rng, _, err := parseChunkRange(c.Request.Header)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	blob, file, bucket, ok := r.loadUploadSession(c, c.Param("blob"))
+	if !ok {
+		return
+	}
+	if blob.UploadLength == 0 && rng.Total == 0 {
+		writeError(c, http.StatusBadRequest, "Upload-Length has not been declared; create the upload first")
+		return
+	}
+	setUploadExpires(c, time.Now().Add(uploadSessionTTL()))
+	r.uploadChunk(c, blob, file, bucket, rng)
+}
+
+// Terminate tus upload (client)
+// @Summary Terminate tus upload
+// @Description Abort a tus upload that has not completed yet: discards the bytes stored so far, the upload session and the pending file.
+// @Tags tus
+// @Param x-api-token header string true "API Token"
+// @Param Tus-Resumable header string true "Protocol version (1.0.0)"
+// @Param blob path string true "Blob ID"
+// @Success 204 "Upload terminated"
+// @Failure 401 {object} router.ErrorResponse "Unauthorized"
+// @Failure 404 {object} router.ErrorResponse
+// @Failure 409 {object} router.ErrorResponse "Upload already completed"
+// @Failure 410 {object} router.ErrorResponse "Upload session expired"
+// @Failure 500 {object} router.ErrorResponse
+// @Router /api/v1/tus/{blob} [delete]
+// @Id TusTerminate
+func (r *router) TusTerminateHandler(c *gin.Context) {
+	blob, file, bucket, ok := r.loadUploadSession(c, c.Param("blob"))
+	if !ok {
+		return
+	}
+	if file.Status.Received() {
+		writeError(c, http.StatusConflict, "Upload has already completed; delete the file instead")
+		return
+	}
+	if err := r.cancelUpload(c.Request.Context(), blob, file, bucket); err != nil {
+		writeError(c, http.StatusInternalServerError, "Failed to terminate upload: "+err.Error())
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
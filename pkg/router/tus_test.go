@@ -0,0 +1,253 @@
+package router
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+func TestParseTusMetadata(t *testing.T) {
+	metadata, err := parseTusMetadata("blob YWJjLTEyMw==, filename aGVsbG8udHh0,is_confidential")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]string{
+		"blob":            "abc-123",
+		"filename":        "hello.txt",
+		"is_confidential": "",
+	}
+	if len(metadata) != len(expected) {
+		t.Fatalf("expected %d keys, got %v", len(expected), metadata)
+	}
+	for key, value := range expected {
+		if metadata[key] != value {
+			t.Errorf("expected %s=%q, got %q", key, value, metadata[key])
+		}
+	}
+
+	if _, err := parseTusMetadata("blob not-base64!"); err == nil {
+		t.Error("expected an error for an invalid base64 value")
+	}
+	if _, err := parseTusMetadata("blob a b"); err == nil {
+		t.Error("expected an error for a malformed pair")
+	}
+}
+
+// tusServer serves the tus routes for a blob "blob" of a pending file "file"
+// in a fake bucket, last written at updated. The service token is "token".
+func tusServer(t *testing.T, updated time.Time) (*gin.Engine, *fakeRepository, *fakeS3) {
+	gin.SetMode(gin.TestMode)
+	viper.Set("upload-session-ttl", time.Hour)
+	t.Cleanup(func() { viper.Set("upload-session-ttl", nil) })
+	storage := newFakeS3()
+	t.Cleanup(storage.Close)
+	repo := newFakeRepository()
+	repo.CreateBucket(context.Background(), storage.bucket("bucket", "bucket"))
+	repo.CreateServiceToken(context.Background(), &models.ServiceToken{Name: "test", AccessKey: "token", TokenType: models.UserToken})
+	repo.putFile(&models.File{Name: "file", BucketID: "bucket", Status: models.FileStatusPending}, 1)
+	repo.CreateFileBlob(context.Background(), &models.FileBlob{ApplicationModel: models.ApplicationModel{ID: "blob", CreatedAt: updated, UpdatedAt: updated}, FileID: "file"})
+
+	engine := gin.New()
+	AddTusRoutes(&router{repo: repo.repository()}, engine.Group("/api/v1"))
+	return engine, repo, storage
+}
+
+type tusRequest struct {
+	method, path string
+	headers      map[string]string
+	body         string
+}
+
+func serveTus(engine *gin.Engine, req tusRequest) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(req.method, req.path, strings.NewReader(req.body))
+	r.Header.Set("Tus-Resumable", tusVersion)
+	for name, value := range req.headers {
+		if value == "" {
+			r.Header.Del(name)
+		} else {
+			r.Header.Set(name, value)
+		}
+	}
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, r)
+	return w
+}
+
+func tusBlobMetadata(blob string) string {
+	return "blob " + base64.StdEncoding.EncodeToString([]byte(blob))
+}
+
+func TestTusHandlers(t *testing.T) {
+	engine, repo, storage := tusServer(t, time.Now().UTC())
+	token := map[string]string{"x-api-token": "token"}
+	with := func(headers map[string]string) map[string]string {
+		merged := map[string]string{"x-api-token": "token"}
+		for name, value := range headers {
+			merged[name] = value
+		}
+		return merged
+	}
+	chunk := func(offset string) map[string]string {
+		return with(map[string]string{"Content-Type": "application/offset+octet-stream", "Upload-Offset": offset})
+	}
+
+	steps := []struct {
+		name string
+		tusRequest
+		want int
+		// response headers expected, "" for absent
+		wantHeaders map[string]string
+	}{
+		{
+			name:        "capabilities",
+			tusRequest:  tusRequest{method: http.MethodOptions, path: "/api/v1/tus/", headers: map[string]string{"Tus-Resumable": ""}},
+			want:        http.StatusNoContent,
+			wantHeaders: map[string]string{"Tus-Resumable": tusVersion, "Tus-Version": tusVersion, "Tus-Extension": tusExtensions},
+		},
+		{
+			name:        "other protocol version",
+			tusRequest:  tusRequest{method: http.MethodPost, path: "/api/v1/tus/", headers: with(map[string]string{"Tus-Resumable": "0.2.2"})},
+			want:        http.StatusPreconditionFailed,
+			wantHeaders: map[string]string{"Tus-Version": tusVersion},
+		},
+		{
+			name:       "creation without a token",
+			tusRequest: tusRequest{method: http.MethodPost, path: "/api/v1/tus/", headers: map[string]string{"Upload-Length": "5", "Upload-Metadata": tusBlobMetadata("blob")}},
+			want:       http.StatusUnauthorized,
+		},
+		{
+			name:       "deferred length",
+			tusRequest: tusRequest{method: http.MethodPost, path: "/api/v1/tus/", headers: with(map[string]string{"Upload-Defer-Length": "1", "Upload-Metadata": tusBlobMetadata("blob")})},
+			want:       http.StatusBadRequest,
+		},
+		{
+			name:       "creation without a blob",
+			tusRequest: tusRequest{method: http.MethodPost, path: "/api/v1/tus/", headers: with(map[string]string{"Upload-Length": "5"})},
+			want:       http.StatusBadRequest,
+		},
+		{
+			name:        "creation",
+			tusRequest:  tusRequest{method: http.MethodPost, path: "/api/v1/tus/", headers: with(map[string]string{"Upload-Length": "5", "Upload-Metadata": tusBlobMetadata("blob")})},
+			want:        http.StatusCreated,
+			wantHeaders: map[string]string{"Location": "/api/v1/tus/blob"},
+		},
+		{
+			name:        "offset of a new upload",
+			tusRequest:  tusRequest{method: http.MethodHead, path: "/api/v1/tus/blob", headers: token},
+			want:        http.StatusOK,
+			wantHeaders: map[string]string{"Upload-Offset": "0", "Upload-Length": "5", "Cache-Control": "no-store"},
+		},
+		{
+			name:       "chunk of another content type",
+			tusRequest: tusRequest{method: http.MethodPatch, path: "/api/v1/tus/blob", headers: with(map[string]string{"Content-Type": "application/octet-stream", "Upload-Offset": "0"}), body: "hel"},
+			want:       http.StatusUnsupportedMediaType,
+		},
+		{
+			name:        "chunk at the wrong offset",
+			tusRequest:  tusRequest{method: http.MethodPatch, path: "/api/v1/tus/blob", headers: chunk("3"), body: "lo"},
+			want:        http.StatusConflict,
+			wantHeaders: map[string]string{"Upload-Offset": "0"},
+		},
+		{
+			name:        "chunk",
+			tusRequest:  tusRequest{method: http.MethodPatch, path: "/api/v1/tus/blob", headers: chunk("0"), body: "hel"},
+			want:        http.StatusNoContent,
+			wantHeaders: map[string]string{"Upload-Offset": "3"},
+		},
+		{
+			name:        "offset after a chunk",
+			tusRequest:  tusRequest{method: http.MethodHead, path: "/api/v1/tus/blob", headers: token},
+			want:        http.StatusOK,
+			wantHeaders: map[string]string{"Upload-Offset": "3", "Upload-Length": "5"},
+		},
+		{
+			name:       "termination",
+			tusRequest: tusRequest{method: http.MethodDelete, path: "/api/v1/tus/blob", headers: token},
+			want:       http.StatusNoContent,
+		},
+		{
+			name:       "offset after termination",
+			tusRequest: tusRequest{method: http.MethodHead, path: "/api/v1/tus/blob", headers: token},
+			want:       http.StatusNotFound,
+		},
+	}
+	for _, step := range steps {
+		w := serveTus(engine, step.tusRequest)
+		if w.Code != step.want {
+			t.Fatalf("%s: got %d %s, want %d", step.name, w.Code, w.Body, step.want)
+		}
+		for name, want := range step.wantHeaders {
+			if got := w.Header().Get(name); got != want {
+				t.Errorf("%s: %s is %q, want %q", step.name, name, got, want)
+			}
+		}
+	}
+	if repo.file("file") != nil {
+		t.Error("expected termination to remove the pending file")
+	}
+	if aborts := len(storage.callsOf("AbortMultipartUpload")); aborts != 1 {
+		t.Errorf("expected termination to abort the multipart upload, got %d aborts", aborts)
+	}
+}
+
+func TestTusHandlers_Expired(t *testing.T) {
+	engine, repo, _ := tusServer(t, time.Now().UTC().Add(-2*time.Hour))
+	token := map[string]string{"x-api-token": "token"}
+
+	for _, req := range []tusRequest{
+		{method: http.MethodPost, path: "/api/v1/tus/", headers: map[string]string{"x-api-token": "token", "Upload-Length": "5", "Upload-Metadata": tusBlobMetadata("blob")}},
+		{method: http.MethodHead, path: "/api/v1/tus/blob", headers: token},
+		{method: http.MethodPatch, path: "/api/v1/tus/blob", headers: map[string]string{"x-api-token": "token", "Content-Type": "application/offset+octet-stream", "Upload-Offset": "0"}, body: "hel"},
+		{method: http.MethodDelete, path: "/api/v1/tus/blob", headers: token},
+	} {
+		if w := serveTus(engine, req); w.Code != http.StatusGone {
+			t.Errorf("%s %s: got %d %s, want %d", req.method, req.path, w.Code, w.Body, http.StatusGone)
+		}
+	}
+	if repo.file("file") == nil {
+		t.Error("expected an expired upload to be left for the sweeper")
+	}
+}
+
+func TestTusHandlers_SignedURL(t *testing.T) {
+	viper.Set("upload-signing-key", "test-key")
+	defer viper.Set("upload-signing-key", nil)
+	engine, repo, storage := tusServer(t, time.Now().UTC())
+	signed, err := url.Parse(signedUploadURL("blob", repo.file("file"), time.Now().Add(time.Hour)))
+	if err != nil {
+		t.Fatalf("invalid upload URL: %v", err)
+	}
+	query := "?" + signed.RawQuery
+
+	w := serveTus(engine, tusRequest{method: http.MethodPost, path: "/api/v1/tus/" + query, headers: map[string]string{"Upload-Length": "5", "Upload-Metadata": tusBlobMetadata("blob")}})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: got %d %s", w.Code, w.Body)
+	}
+	location := w.Header().Get("Location")
+	if location != "/api/v1/tus/blob"+query {
+		t.Fatalf("expected the upload URL to keep the signature, got %q", location)
+	}
+	w = serveTus(engine, tusRequest{method: http.MethodPatch, path: location, headers: map[string]string{"Content-Type": "application/offset+octet-stream", "Upload-Offset": "0"}, body: "hello"})
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("patch: got %d %s", w.Code, w.Body)
+	}
+	if file := repo.file("file"); file == nil || file.Status != models.FileStatusUploaded || !storage.has("bucket", "file") {
+		t.Error("expected the signed upload to store the file")
+	}
+
+	if w := serveTus(engine, tusRequest{method: http.MethodPost, path: "/api/v1/tus/" + query, headers: map[string]string{"Upload-Length": "5", "Upload-Metadata": tusBlobMetadata("other")}}); w.Code != http.StatusNotFound {
+		t.Errorf("create for another blob: got %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := serveTus(engine, tusRequest{method: http.MethodDelete, path: location}); w.Code != http.StatusForbidden {
+		t.Errorf("terminate with a signed URL: got %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,201 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// objectReferenced reports whether a file or file version in bucketID stores
+// its content under key, leaving out files being deleted and those the skip
+// functions select.
+func (r *router) objectReferenced(ctx context.Context, bucketID, key string, skipFile func(*models.File) bool, skipVersion func(*models.FileVersion) bool) (bool, error) {
+	// The file that uploaded the object is stored under the object key.
+	owner, err := r.repo.Files.GetFileByName(ctx, key)
+	if err == nil && owner != nil && owner.BucketID == bucketID && owner.ObjectKey == "" && !removing(owner) && !skipFile(owner) {
+		return true, nil
+	}
+	files, err := r.repo.Files.ListFilesByObjectKey(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	for _, other := range files {
+		if other.BucketID == bucketID && !removing(other) && !skipFile(other) {
+			return true, nil
+		}
+	}
+	versions, err := r.repo.FileVersions.ListFileVersionsByObjectKey(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	for _, version := range versions {
+		if version.BucketID == bucketID && !skipVersion(version) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// promoteVersion makes the content uploaded by staged the current version of
+// the file it was created for, keeping the content that file held until now
+// as a version. The staged record is removed and blob is pointed at the file.
+func (r *router) promoteVersion(ctx context.Context, staged *models.File, blob *models.FileBlob) (*models.File, *ErrorResponse) {
+	file, err := r.repo.Files.GetFileByID(ctx, staged.VersionOf)
+	if err != nil || file == nil {
+		return nil, &ErrorResponse{Code: http.StatusNotFound, Message: "File to replace not found"}
+	}
+	if file.Status != models.FileStatusActive {
+		return nil, &ErrorResponse{Code: http.StatusConflict, Message: fmt.Sprintf("Cannot replace the content of a file that is %s", file.Status)}
+	}
+	previous := models.NewFileVersion(file)
+	file.ReplaceContent(staged)
+	err = r.repo.FileVersions.PromoteFileVersion(ctx, previous, file, staged)
+	if errors.Is(err, models.ErrVersionConflict) {
+		// Another version was promoted meanwhile. This content was uploaded
+		// to replace one the file no longer holds, so it is discarded.
+		bucket, err := r.repo.Buckets.GetBucketByID(ctx, staged.BucketID)
+		if err != nil {
+			bucket = nil
+		}
+		if err := r.retireFile(context.WithoutCancel(ctx), staged, bucket); err != nil {
+			log.Printf("Failed to discard staged version %s of file %s: %v", staged.ID, file.ID, err)
+		}
+		return nil, &ErrorResponse{Code: http.StatusConflict, Message: "File was replaced by another version while this one was promoted"}
+	}
+	if err != nil {
+		return nil, &ErrorResponse{Code: http.StatusInternalServerError, Message: "Failed to promote file version: " + err.Error()}
+	}
+	// Finalizing the session again now returns the file.
+	blob.FileID = file.ID
+	if err := r.pruneVersions(ctx, file); err != nil {
+		log.Printf("Failed to prune versions of file %s: %v", file.ID, err)
+	}
+	return file, nil
+}
+
+// pruneVersions removes the versions of file that version-retention-count
+// and version-retention-period no longer keep.
+func (r *router) pruneVersions(ctx context.Context, file *models.File) error {
+	keep := viper.GetInt("version-retention-count")
+	period := viper.GetDuration("version-retention-period")
+	if keep <= 0 && period <= 0 {
+		return nil
+	}
+	versions, err := r.repo.FileVersions.ListFileVersions(ctx, file.ID)
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().UTC().Add(-period)
+	for i, version := range versions {
+		if (keep > 0 && i >= keep) || (period > 0 && version.CreatedAt.Before(cutoff)) {
+			if err := r.removeVersion(ctx, version); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// removeVersion deletes a version, and its object unless something else still
+// refers to it.
+func (r *router) removeVersion(ctx context.Context, version *models.FileVersion) error {
+	inUse, err := r.objectReferenced(ctx, version.BucketID, version.ObjectKey,
+		func(*models.File) bool { return false },
+		func(other *models.FileVersion) bool {
+			return other.FileID == version.FileID && other.Version == version.Version
+		})
+	if err != nil {
+		return fmt.Errorf("check object references: %w", err)
+	}
+	if !inUse {
+		bucket, err := r.repo.Buckets.GetBucketByID(ctx, version.BucketID)
+		if err != nil || bucket == nil {
+			return fmt.Errorf("bucket %s of version %d of file %s not found", version.BucketID, version.Version, version.FileID)
+		}
+		if err := deleteObjectKey(ctx, bucket, version.ObjectKey); err != nil {
+			return fmt.Errorf("delete object: %w", err)
+		}
+	}
+	return r.repo.FileVersions.DeleteFileVersion(ctx, version.FileID, version.Version)
+}
+
+// removeFileVersions deletes every version of a file that is being deleted.
+func (r *router) removeFileVersions(ctx context.Context, file *models.File) error {
+	versions, err := r.repo.FileVersions.ListFileVersions(ctx, file.ID)
+	if err != nil {
+		return fmt.Errorf("list file versions: %w", err)
+	}
+	for _, version := range versions {
+		if err := r.removeVersion(ctx, version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileAtVersion returns file as of the version given by the version query
+// parameter, or file itself without one. It writes the error response if the
+// version cannot be read.
+func (r *router) fileAtVersion(c *gin.Context, file *models.File) (*models.File, bool) {
+	param := c.Query("version")
+	if param == "" {
+		return file, true
+	}
+	number, err := strconv.Atoi(param)
+	if err != nil || number < 1 {
+		writeError(c, http.StatusBadRequest, "Invalid version")
+		return nil, false
+	}
+	if number == max(file.Version, 1) {
+		return file, true
+	}
+	version, err := r.repo.FileVersions.GetFileVersion(c.Request.Context(), file.ID, number)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "Failed to load file version: "+err.Error())
+		return nil, false
+	}
+	if version == nil {
+		writeError(c, http.StatusNotFound, "File version not found")
+		return nil, false
+	}
+	return version.AsFile(file), true
+}
+
+// List file versions (admin only)
+// @Summary List file versions
+// @Description List the earlier versions of a file still kept, newest first. The current version is the file itself. Read a version with the version query parameter of GET /api/v1/file/{id} and GET /api/v1/file/{id}/content. Admin access required.
+// @Tags files
+// @Produce json
+// @Param x-api-token header string true "API Token"
+// @Param id path string true "File ID"
+// @Success 200 {array} models.FileVersion
+// @Failure 401 {object} router.ErrorResponse "Unauthorized"
+// @Failure 403 {object} router.ErrorResponse "Forbidden - Admin only"
+// @Failure 404 {object} router.ErrorResponse
+// @Router /api/v1/file/{id}/versions [get]
+// @Id ListFileVersions
+func (r *router) ListFileVersionsHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	file, err := r.repo.Files.GetFileByID(ctx, c.Param("id"))
+	if err != nil || file == nil {
+		writeError(c, http.StatusNotFound, "File not found")
+		return
+	}
+	versions, err := r.repo.FileVersions.ListFileVersions(ctx, file.ID)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "Failed to list file versions: "+err.Error())
+		return
+	}
+	if versions == nil {
+		versions = []*models.FileVersion{}
+	}
+	c.JSON(http.StatusOK, versions)
+}
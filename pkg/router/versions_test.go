@@ -0,0 +1,84 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+)
+
+func TestPromoteVersion(t *testing.T) {
+	ctx := context.Background()
+	setup := func() (*fakeRepository, *models.File, *models.FileBlob) {
+		repo := newFakeRepository()
+		repo.putFile(&models.File{Name: "file", BucketID: "bucket", Status: models.FileStatusActive, Version: 1}, 1)
+		repo.putFile(&models.File{Name: "staged", BucketID: "bucket", Status: models.FileStatusUploaded, VersionOf: "file"}, 1)
+		staged, _ := repo.GetFileByID(ctx, "staged")
+		staged.Transition(models.FileStatusActive)
+		return repo, staged, &models.FileBlob{FileID: "staged"}
+	}
+
+	t.Run("promoted", func(t *testing.T) {
+		repo, staged, blob := setup()
+		r := &router{repo: repo.repository()}
+		file, failure := r.promoteVersion(ctx, staged, blob)
+		if failure != nil {
+			t.Fatalf("promoteVersion: %s", failure.Message)
+		}
+		if file.Version != 2 || file.StorageKey() != "staged" || blob.FileID != "file" {
+			t.Errorf("expected version 2 holding the staged content, got version %d of %s", file.Version, file.StorageKey())
+		}
+		if stored := repo.file("file"); stored == nil || stored.StorageKey() != "staged" {
+			t.Error("expected the file to be stored with its new content")
+		}
+		if repo.file("staged") != nil {
+			t.Error("expected the staged record to be removed")
+		}
+		versions := repo.matchVersions(func(*models.FileVersion) bool { return true })
+		if len(versions) != 1 || versions[0].Version != 1 || versions[0].ObjectKey != "file" {
+			t.Errorf("expected the earlier content kept as version 1, got %v", versions)
+		}
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		repo, staged, blob := setup()
+		repo.failUpdates = errFakeNotFound
+		r := &router{repo: repo.repository()}
+		if _, failure := r.promoteVersion(ctx, staged, blob); failure == nil || failure.Code != http.StatusInternalServerError {
+			t.Fatalf("expected a server error, got %v", failure)
+		}
+		if stored := repo.file("file"); stored == nil || stored.StorageKey() != "file" || stored.Version != 1 {
+			t.Error("expected the file to keep its content")
+		}
+		if repo.file("staged") == nil || blob.FileID != "staged" {
+			t.Error("expected the staged record to be kept for a retry")
+		}
+		if versions := repo.matchVersions(func(*models.FileVersion) bool { return true }); len(versions) != 0 {
+			t.Errorf("expected no version recorded, got %v", versions)
+		}
+	})
+	t.Run("conflict", func(t *testing.T) {
+		repo, staged, blob := setup()
+		r := &router{repo: repo.repository()}
+		// Another version is promoted while this one is.
+		repo.promoting = func() {
+			file := repo.file("file")
+			file.Version = 2
+			file.ObjectKey = "other"
+			repo.UpdateFile(ctx, file)
+		}
+		if _, failure := r.promoteVersion(ctx, staged, blob); failure == nil || failure.Code != http.StatusConflict {
+			t.Fatalf("expected a conflict, got %v", failure)
+		}
+		if stored := repo.file("file"); stored == nil || stored.StorageKey() != "other" || stored.Version != 2 {
+			t.Error("expected the file to keep the version promoted first")
+		}
+		if repo.file("staged") != nil || blob.FileID != "staged" {
+			t.Error("expected the staged record to be discarded")
+		}
+		if versions := repo.matchVersions(func(*models.FileVersion) bool { return true }); len(versions) != 0 {
+			t.Errorf("expected no version recorded, got %v", versions)
+		}
+	})
+}
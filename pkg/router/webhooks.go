@@ -0,0 +1,397 @@
+package router
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/argon-chat/KineticaFS/pkg/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// AddWebhookRoutes sets up the webhook endpoints.
+func AddWebhookRoutes(router *router, v1 *gin.RouterGroup) {
+	webhook := v1.Group("/webhook")
+	webhook.POST("/", AuthMiddleware(router.repo), AdminOnlyMiddleware, IdempotencyMiddleware(router.repo), router.CreateWebhookHandler)
+	webhook.GET("/", AuthMiddleware(router.repo), AdminOnlyMiddleware, router.ListWebhooksHandler)
+	webhook.GET("/:id", AuthMiddleware(router.repo), AdminOnlyMiddleware, router.GetWebhookHandler)
+	webhook.PATCH("/:id", AuthMiddleware(router.repo), AdminOnlyMiddleware, IdempotencyMiddleware(router.repo), router.UpdateWebhookHandler)
+	webhook.DELETE("/:id", AuthMiddleware(router.repo), AdminOnlyMiddleware, IdempotencyMiddleware(router.repo), router.DeleteWebhookHandler)
+	webhook.GET("/:id/deliveries", AuthMiddleware(router.repo), AdminOnlyMiddleware, router.ListWebhookDeliveriesHandler)
+	webhook.POST("/:id/deliveries/:delivery/redeliver", AuthMiddleware(router.repo), AdminOnlyMiddleware, IdempotencyMiddleware(router.repo), router.RedeliverWebhookHandler)
+}
+
+type WebhookInsertDTO struct {
+	URL    string                `json:"url" binding:"required" example:"https://chat.example.com/hooks/kineticafs"`
+	Events []models.WebhookEvent `json:"events,omitempty"` // all events if empty
+}
+
+type WebhookUpdateDTO struct {
+	URL          string                 `json:"url,omitempty"`
+	Events       *[]models.WebhookEvent `json:"events,omitempty"` // an empty list subscribes to all events
+	Enabled      *bool                  `json:"enabled,omitempty"`
+	RotateSecret bool                   `json:"rotateSecret,omitempty"` // replace the signing secret, returning the new one
+}
+
+// WebhookEventPayload is the body POSTed to webhook endpoints.
+type WebhookEventPayload struct {
+	ID        string              `json:"id"` // the same for every webhook notified of the event
+	Type      models.WebhookEvent `json:"type"`
+	CreatedAt time.Time           `json:"createdAt"`
+	Data      *models.File        `json:"data"`
+}
+
+// wakeDispatcher nudges the dispatcher when deliveries are queued, so they
+// are attempted before its next poll.
+func (r *router) wakeDispatcher() {
+	select {
+	case r.webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// emit publishes event about file on the event stream and queues it for every
+// webhook subscribed to it. Failing to queue is logged and does not fail the
+// operation that raised the event.
+func (r *router) emit(ctx context.Context, event models.WebhookEvent, file *models.File) {
+	// The operation has happened; a client hanging up must not lose the event.
+	ctx = context.WithoutCancel(ctx)
+	snapshot := *file
+	r.events.publish(Event{Type: string(event), BucketID: file.BucketID, Region: r.bucketRegion(ctx, file.BucketID), Data: &snapshot})
+	webhooks, err := r.repo.Webhooks.ListWebhooks(ctx)
+	if err != nil {
+		log.Printf("Failed to list webhooks for %s of file %s: %v", event, file.ID, err)
+		return
+	}
+	now := time.Now().UTC()
+	eventID := uuid.NewString()
+	payload, err := json.Marshal(WebhookEventPayload{
+		ID:        eventID,
+		Type:      event,
+		CreatedAt: now,
+		Data:      file,
+	})
+	if err != nil {
+		log.Printf("Failed to encode %s of file %s: %v", event, file.ID, err)
+		return
+	}
+	queued := false
+	for _, webhook := range webhooks {
+		if !webhook.Subscribed(event) {
+			continue
+		}
+		delivery := &models.WebhookDelivery{
+			WebhookID:     webhook.ID,
+			EventID:       eventID,
+			Event:         event,
+			Payload:       string(payload),
+			Status:        models.DeliveryStatusPending,
+			NextAttemptAt: now,
+		}
+		if err := r.repo.Webhooks.CreateDelivery(ctx, delivery); err != nil {
+			log.Printf("Failed to queue %s of file %s for webhook %s: %v", event, file.ID, webhook.ID, err)
+			continue
+		}
+		queued = true
+	}
+	if queued {
+		r.wakeDispatcher()
+	}
+}
+
+// newWebhookSecret returns a random secret for signing webhook requests.
+func newWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(secret), nil
+}
+
+// validateWebhook checks the endpoint and events of a webhook.
+func validateWebhook(webhook *models.Webhook) error {
+	endpoint, err := url.Parse(webhook.URL)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	for _, event := range webhook.Events {
+		if !event.Valid() {
+			return fmt.Errorf("unknown event %q", event)
+		}
+	}
+	return nil
+}
+
+// CreateWebhookHandler registers a webhook endpoint
+// @Summary Create webhook
+// @Description Register an endpoint to be notified of file lifecycle events: file.uploaded, file.finalized, file.deleted, file.migrated and refcount.zero. Only admin users can create webhooks.
+// @Description Events are POSTed as JSON with the X-KineticaFS-Event, X-KineticaFS-Delivery and X-KineticaFS-Signature headers. The signature is "t=<unix time>,v1=<hex HMAC-SHA256 of "<t>.<body>">" keyed by the webhook secret, which is only returned by this call. Failed deliveries are retried with exponential backoff; an event may be delivered more than once.
+// @Tags webhooks
+// @Param x-api-token header string true "API Token"
+// @Accept json
+// @Produce json
+// @Param webhook body WebhookInsertDTO true "Webhook"
+// @Success 201 {object} models.Webhook
+// @Failure 400 {object} router.ErrorResponse
+// @Failure 401 {object} router.ErrorResponse "Unauthorized"
+// @Failure 403 {object} router.ErrorResponse "Forbidden - Admin only"
+// @Router /api/v1/webhook/ [post]
+// @Id CreateWebhook
+func (r *router) CreateWebhookHandler(c *gin.Context) {
+	var req WebhookInsertDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+	webhook := &models.Webhook{
+		URL:     req.URL,
+		Events:  req.Events,
+		Enabled: true,
+	}
+	if err := validateWebhook(webhook); err != nil {
+		writeError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	secret, err := newWebhookSecret()
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, fmt.Sprintf("failed to generate webhook secret: %v", err))
+		return
+	}
+	webhook.Secret = secret
+	if err := r.repo.Webhooks.CreateWebhook(c.Request.Context(), webhook); err != nil {
+		writeError(c, http.StatusInternalServerError, fmt.Sprintf("failed to create webhook: %v", err))
+		return
+	}
+	c.JSON(http.StatusCreated, webhook)
+}
+
+// ListWebhooksHandler lists all webhooks
+// @Summary List webhooks
+// @Description List all webhooks. Their secrets are not included.
+// @Tags webhooks
+// @Param x-api-token header string true "API Token"
+// @Produce json
+// @Success 200 {array} models.Webhook
+// @Failure 401 {object} router.ErrorResponse "Unauthorized"
+// @Failure 403 {object} router.ErrorResponse "Forbidden - Admin only"
+// @Router /api/v1/webhook/ [get]
+// @Id ListWebhooks
+func (r *router) ListWebhooksHandler(c *gin.Context) {
+	webhooks, err := r.repo.Webhooks.ListWebhooks(c.Request.Context())
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, fmt.Sprintf("failed to list webhooks: %v", err))
+		return
+	}
+	for _, webhook := range webhooks {
+		webhook.Secret = ""
+	}
+	c.JSON(http.StatusOK, webhooks)
+}
+
+// loadWebhook looks up the webhook named by the id path parameter. It writes
+// the error response itself and returns nil if there is none.
+func (r *router) loadWebhook(c *gin.Context) *models.Webhook {
+	webhook, err := r.repo.Webhooks.GetWebhookByID(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, fmt.Sprintf("failed to get webhook: %v", err))
+		return nil
+	}
+	if webhook == nil {
+		writeError(c, http.StatusNotFound, "Webhook not found")
+		return nil
+	}
+	return webhook
+}
+
+// GetWebhookHandler gets a webhook by ID
+// @Summary Get webhook
+// @Description Get a webhook by ID. Its secret is not included.
+// @Tags webhooks
+// @Param x-api-token header string true "API Token"
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Success 200 {object} models.Webhook
+// @Failure 401 {object} router.ErrorResponse "Unauthorized"
+// @Failure 403 {object} router.ErrorResponse "Forbidden - Admin only"
+// @Failure 404 {object} router.ErrorResponse
+// @Router /api/v1/webhook/{id} [get]
+// @Id GetWebhook
+func (r *router) GetWebhookHandler(c *gin.Context) {
+	webhook := r.loadWebhook(c)
+	if webhook == nil {
+		return
+	}
+	webhook.Secret = ""
+	c.JSON(http.StatusOK, webhook)
+}
+
+// UpdateWebhookHandler updates a webhook by ID
+// @Summary Update webhook
+// @Description Change the endpoint or events of a webhook, enable or disable it, or rotate its secret. The new secret is returned only when it is rotated. Deliveries queued for a disabled webhook fail without being attempted.
+// @Tags webhooks
+// @Param x-api-token header string true "API Token"
+// @Accept json
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Param webhook body WebhookUpdateDTO true "Changes"
+// @Success 200 {object} models.Webhook
+// @Failure 400 {object} router.ErrorResponse
+// @Failure 401 {object} router.ErrorResponse "Unauthorized"
+// @Failure 403 {object} router.ErrorResponse "Forbidden - Admin only"
+// @Failure 404 {object} router.ErrorResponse
+// @Router /api/v1/webhook/{id} [patch]
+// @Id UpdateWebhook
+func (r *router) UpdateWebhookHandler(c *gin.Context) {
+	var req WebhookUpdateDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+	webhook := r.loadWebhook(c)
+	if webhook == nil {
+		return
+	}
+	if req.URL != "" {
+		webhook.URL = req.URL
+	}
+	if req.Events != nil {
+		webhook.Events = *req.Events
+	}
+	if req.Enabled != nil {
+		webhook.Enabled = *req.Enabled
+	}
+	if err := validateWebhook(webhook); err != nil {
+		writeError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.RotateSecret {
+		secret, err := newWebhookSecret()
+		if err != nil {
+			writeError(c, http.StatusInternalServerError, fmt.Sprintf("failed to generate webhook secret: %v", err))
+			return
+		}
+		webhook.Secret = secret
+	}
+	if err := r.repo.Webhooks.UpdateWebhook(c.Request.Context(), webhook); err != nil {
+		writeError(c, http.StatusInternalServerError, fmt.Sprintf("failed to update webhook: %v", err))
+		return
+	}
+	if !req.RotateSecret {
+		webhook.Secret = ""
+	}
+	c.JSON(http.StatusOK, webhook)
+}
+
+// DeleteWebhookHandler deletes a webhook by ID
+// @Summary Delete webhook
+// @Description Delete a webhook along with its delivery log. Queued deliveries are dropped.
+// @Tags webhooks
+// @Param x-api-token header string true "API Token"
+// @Param id path string true "Webhook ID"
+// @Success 204 {object} nil
+// @Failure 401 {object} router.ErrorResponse "Unauthorized"
+// @Failure 403 {object} router.ErrorResponse "Forbidden - Admin only"
+// @Failure 404 {object} router.ErrorResponse
+// @Router /api/v1/webhook/{id} [delete]
+// @Id DeleteWebhook
+func (r *router) DeleteWebhookHandler(c *gin.Context) {
+	webhook := r.loadWebhook(c)
+	if webhook == nil {
+		return
+	}
+	ctx := c.Request.Context()
+	if err := r.repo.Webhooks.DeleteWebhook(ctx, webhook.ID); err != nil {
+		writeError(c, http.StatusInternalServerError, fmt.Sprintf("failed to delete webhook: %v", err))
+		return
+	}
+	if err := r.repo.Webhooks.DeleteDeliveriesByWebhookID(ctx, webhook.ID); err != nil {
+		log.Printf("Failed to delete deliveries of webhook %s: %v", webhook.ID, err)
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ListWebhookDeliveriesHandler lists the delivery log of a webhook
+// @Summary List webhook deliveries
+// @Description List the events queued for a webhook, newest first, with the number of attempts made and the outcome of the latest one.
+// @Tags webhooks
+// @Param x-api-token header string true "API Token"
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Param status query string false "Only list deliveries in this status" Enums(pending, succeeded, failed)
+// @Success 200 {array} models.WebhookDelivery
+// @Failure 401 {object} router.ErrorResponse "Unauthorized"
+// @Failure 403 {object} router.ErrorResponse "Forbidden - Admin only"
+// @Failure 404 {object} router.ErrorResponse
+// @Router /api/v1/webhook/{id}/deliveries [get]
+// @Id ListWebhookDeliveries
+func (r *router) ListWebhookDeliveriesHandler(c *gin.Context) {
+	webhook := r.loadWebhook(c)
+	if webhook == nil {
+		return
+	}
+	deliveries, err := r.repo.Webhooks.ListDeliveriesByWebhookID(c.Request.Context(), webhook.ID)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, fmt.Sprintf("failed to list deliveries: %v", err))
+		return
+	}
+	if status := models.DeliveryStatus(c.Query("status")); status != "" {
+		filtered := deliveries[:0]
+		for _, delivery := range deliveries {
+			if delivery.Status == status {
+				filtered = append(filtered, delivery)
+			}
+		}
+		deliveries = filtered
+	}
+	if deliveries == nil {
+		deliveries = []*models.WebhookDelivery{}
+	}
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// RedeliverWebhookHandler queues a delivery again
+// @Summary Redeliver webhook event
+// @Description Queue a delivery for another round of attempts, e.g. once a failing endpoint has been fixed. The event is sent with its original payload and delivery ID.
+// @Tags webhooks
+// @Param x-api-token header string true "API Token"
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Param delivery path string true "Delivery ID"
+// @Success 202 {object} models.WebhookDelivery
+// @Failure 401 {object} router.ErrorResponse "Unauthorized"
+// @Failure 403 {object} router.ErrorResponse "Forbidden - Admin only"
+// @Failure 404 {object} router.ErrorResponse
+// @Router /api/v1/webhook/{id}/deliveries/{delivery}/redeliver [post]
+// @Id RedeliverWebhookEvent
+func (r *router) RedeliverWebhookHandler(c *gin.Context) {
+	webhook := r.loadWebhook(c)
+	if webhook == nil {
+		return
+	}
+	ctx := c.Request.Context()
+	delivery, err := r.repo.Webhooks.GetDeliveryByID(ctx, c.Param("delivery"))
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, fmt.Sprintf("failed to get delivery: %v", err))
+		return
+	}
+	if delivery == nil || delivery.WebhookID != webhook.ID {
+		writeError(c, http.StatusNotFound, "Delivery not found")
+		return
+	}
+	delivery.Status = models.DeliveryStatusPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Now().UTC()
+	if err := r.repo.Webhooks.UpdateDelivery(ctx, delivery); err != nil {
+		writeError(c, http.StatusInternalServerError, fmt.Sprintf("failed to update delivery: %v", err))
+		return
+	}
+	r.wakeDispatcher()
+	c.JSON(http.StatusAccepted, delivery)
+}
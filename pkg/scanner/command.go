@@ -0,0 +1,45 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// CommandScanner runs an external program with the content on stdin. Like
+// clamscan and clamdscan, the program exits with 0 for clean content and 1
+// for infected content, naming what it found on stdout; any other exit status
+// is a failure.
+type CommandScanner struct {
+	Path string
+	Args []string
+}
+
+func (s *CommandScanner) Scan(ctx context.Context, content io.Reader) (Verdict, error) {
+	cmd := exec.CommandContext(ctx, s.Path, s.Args...)
+	cmd.Stdin = content
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err == nil {
+		return Verdict{Clean: true}, nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 && ctx.Err() == nil {
+		threat, _, _ := strings.Cut(strings.TrimSpace(stdout.String()), "\n")
+		if threat == "" {
+			threat = "rejected by " + s.Path
+		}
+		return Verdict{Threat: threat}, nil
+	}
+	if msg := strings.TrimSpace(stderr.String()); msg != "" {
+		return Verdict{}, fmt.Errorf("%s: %w: %s", s.Path, err, msg)
+	}
+	return Verdict{}, fmt.Errorf("%s: %w", s.Path, err)
+}
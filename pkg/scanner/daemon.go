@@ -0,0 +1,96 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// chunkSize is the largest chunk sent to the daemon at once.
+const chunkSize = 64 << 10
+
+// DaemonScanner streams content to a local scanning daemon speaking the clamd
+// INSTREAM protocol: the content is sent as length-prefixed chunks and the
+// daemon answers with a single verdict line.
+type DaemonScanner struct {
+	network string
+	address string
+}
+
+// NewDaemonScanner returns a scanner for the daemon at address, either a
+// host:port or the path of a Unix socket.
+func NewDaemonScanner(address string) *DaemonScanner {
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		return &DaemonScanner{network: "unix", address: path}
+	}
+	if strings.HasPrefix(address, "/") {
+		return &DaemonScanner{network: "unix", address: address}
+	}
+	return &DaemonScanner{network: "tcp", address: strings.TrimPrefix(address, "tcp:")}
+}
+
+func (s *DaemonScanner) Scan(ctx context.Context, content io.Reader) (Verdict, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("connect to scanner: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if err := sendStream(conn, content); err != nil {
+		return Verdict{}, err
+	}
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return Verdict{}, fmt.Errorf("read scanner reply: %w", err)
+	}
+	return parseReply(reply)
+}
+
+func sendStream(w io.Writer, content io.Reader) error {
+	if _, err := io.WriteString(w, "zINSTREAM\x00"); err != nil {
+		return fmt.Errorf("send scan command: %w", err)
+	}
+	buf := make([]byte, 4+chunkSize)
+	for {
+		n, err := io.ReadFull(content, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf, uint32(n))
+			if _, err := w.Write(buf[:4+n]); err != nil {
+				return fmt.Errorf("send content: %w", err)
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read content: %w", err)
+		}
+	}
+	if _, err := w.Write([]byte{0, 0, 0, 0}); err != nil {
+		return fmt.Errorf("send content: %w", err)
+	}
+	return nil
+}
+
+// parseReply reads a verdict line such as "stream: OK" or
+// "stream: Eicar-Signature FOUND".
+func parseReply(reply string) (Verdict, error) {
+	reply = strings.TrimRight(reply, "\x00\n")
+	result := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case result == "OK":
+		return Verdict{Clean: true}, nil
+	case strings.HasSuffix(result, " FOUND"):
+		return Verdict{Threat: strings.TrimSuffix(result, " FOUND")}, nil
+	default:
+		return Verdict{}, fmt.Errorf("scanner error: %s", reply)
+	}
+}
@@ -0,0 +1,59 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Verdict is the outcome of scanning content.
+type Verdict struct {
+	Clean  bool
+	Threat string // what was found when the content is not clean
+}
+
+// Scanner inspects content before it becomes usable, e.g. for malware or
+// policy violations. An error means no verdict could be reached.
+type Scanner interface {
+	Scan(ctx context.Context, content io.Reader) (Verdict, error)
+}
+
+// NewScanner returns the scanner selected by the scanner setting, or nil if
+// scanning is disabled:
+//
+//	""        scanning disabled
+//	"noop"    every file passes, but still goes through the scanning state
+//	"command" scanner-command is run with the content on stdin
+//	"clamd"   the content is streamed to the daemon at scanner-address
+func NewScanner() (Scanner, error) {
+	switch kind := viper.GetString("scanner"); kind {
+	case "":
+		return nil, nil
+	case "noop":
+		return NoopScanner{}, nil
+	case "command":
+		fields := strings.Fields(viper.GetString("scanner-command"))
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("scanner-command is not set")
+		}
+		return &CommandScanner{Path: fields[0], Args: fields[1:]}, nil
+	case "clamd":
+		address := viper.GetString("scanner-address")
+		if address == "" {
+			return nil, fmt.Errorf("scanner-address is not set")
+		}
+		return NewDaemonScanner(address), nil
+	default:
+		return nil, fmt.Errorf("unsupported scanner: %s", kind)
+	}
+}
+
+// NoopScanner passes all content.
+type NoopScanner struct{}
+
+func (NoopScanner) Scan(ctx context.Context, content io.Reader) (Verdict, error) {
+	return Verdict{Clean: true}, nil
+}
@@ -0,0 +1,97 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// fakeDaemon accepts one INSTREAM request and replies FOUND if the content
+// contains "EICAR".
+func fakeDaemon(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		if cmd, err := r.ReadString(0); err != nil || cmd != "zINSTREAM\x00" {
+			io.WriteString(conn, "UNKNOWN COMMAND\x00")
+			return
+		}
+		var content strings.Builder
+		for {
+			var size uint32
+			if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+				return
+			}
+			if size == 0 {
+				break
+			}
+			io.CopyN(&content, r, int64(size))
+		}
+		if strings.Contains(content.String(), "EICAR") {
+			io.WriteString(conn, "stream: Eicar-Test-Signature FOUND\x00")
+		} else {
+			io.WriteString(conn, "stream: OK\x00")
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestDaemonScanner(t *testing.T) {
+	tests := []struct {
+		content string
+		clean   bool
+	}{
+		{strings.Repeat("harmless ", 20000), true},
+		{strings.Repeat("x", chunkSize) + "EICAR", false},
+	}
+	for _, tt := range tests {
+		s := NewDaemonScanner(fakeDaemon(t))
+		verdict, err := s.Scan(context.Background(), strings.NewReader(tt.content))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if verdict.Clean != tt.clean {
+			t.Errorf("expected clean=%v, got %+v", tt.clean, verdict)
+		}
+		if !tt.clean && verdict.Threat != "Eicar-Test-Signature" {
+			t.Errorf("unexpected threat %q", verdict.Threat)
+		}
+	}
+}
+
+func TestParseReply(t *testing.T) {
+	if _, err := parseReply("INSTREAM size limit exceeded. ERROR\x00"); err == nil {
+		t.Error("expected error reply to fail the scan")
+	}
+}
+
+func TestCommandScanner(t *testing.T) {
+	s := &CommandScanner{Path: "sh", Args: []string{"-c", `if grep -q EICAR; then echo "stdin: Eicar FOUND"; exit 1; fi`}}
+	verdict, err := s.Scan(context.Background(), strings.NewReader("clean content"))
+	if err != nil || !verdict.Clean {
+		t.Errorf("expected clean verdict, got %+v, %v", verdict, err)
+	}
+	verdict, err = s.Scan(context.Background(), strings.NewReader("EICAR"))
+	if err != nil || verdict.Clean || verdict.Threat != "stdin: Eicar FOUND" {
+		t.Errorf("expected infected verdict, got %+v, %v", verdict, err)
+	}
+
+	s = &CommandScanner{Path: "sh", Args: []string{"-c", "echo broken >&2; exit 2"}}
+	if _, err := s.Scan(context.Background(), strings.NewReader("")); err == nil {
+		t.Error("expected failing command to return an error")
+	}
+}